@@ -18,6 +18,7 @@ import (
 	"github.com/amillerrr/hls-pipeline/internal/config"
 	"github.com/amillerrr/hls-pipeline/internal/health"
 	"github.com/amillerrr/hls-pipeline/internal/observability"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
 	"github.com/amillerrr/hls-pipeline/internal/storage"
 )
 
@@ -70,15 +71,30 @@ func main() {
 	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
 
 	sqsClient := sqs.NewFromConfig(awsCfg)
-	s3Client := storage.NewS3ClientFromAWSConfig(awsCfg)
 
-	// Initialize video repository
-	videoRepo, err := storage.NewVideoRepository(context.Background(), cfg)
+	// Initialize object storage
+	objects, err := storage.NewObjectStore(cfg, awsCfg)
 	if err != nil {
-		log.Error("Failed to initialize video repository", "error", err)
+		log.Error("Failed to initialize object storage", "error", err)
 		os.Exit(1)
 	}
-	log.Info("DynamoDB video repository initialized")
+	log.Info("Object storage initialized", "backend", cfg.Storage.Backend)
+
+	// Initialize job queue
+	jobQueue, err := queue.New(cfg, sqsClient)
+	if err != nil {
+		log.Error("Failed to initialize job queue", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Job queue initialized", "backend", cfg.Queue.Backend)
+
+	// Initialize video store
+	videos, err := storage.NewVideoStore(context.Background(), cfg)
+	if err != nil {
+		log.Error("Failed to initialize video store", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Video store initialized", "backend", cfg.Database.Backend)
 
 	// Initialize JWT service
 	jwtSecret, err := cfg.GetJWTSecret()
@@ -97,19 +113,24 @@ func main() {
 
 	// Initialize health checker
 	healthConfig := health.DefaultConfig("hls-api", log)
-	healthConfig.S3Client = s3Client
-	healthConfig.SQSClient = sqsClient
-	healthConfig.S3Bucket = cfg.AWS.RawBucket
-	healthConfig.SQSQueueURL = cfg.AWS.SQSQueueURL
+	if s3Client, ok := objects.(*storage.S3Client); ok {
+		healthConfig.S3Client = s3Client
+		healthConfig.S3Bucket = cfg.AWS.RawBucket
+	}
+	if cfg.Queue.Backend == queue.BackendSQS {
+		healthConfig.SQSClient = sqsClient
+		healthConfig.SQSQueueURL = cfg.AWS.SQSQueueURL
+	}
 	healthChecker := health.NewChecker(healthConfig)
 
 	// Create and start server
 	server, err := api.NewServer(&api.ServerConfig{
 		Config:        cfg,
 		Logger:        log,
-		S3Client:      s3Client,
-		SQSClient:     sqsClient,
-		VideoRepo:     videoRepo,
+		Objects:       objects,
+		JobQueue:      jobQueue,
+		DeadLetters:   jobQueue.DeadLetters(),
+		Videos:        videos,
 		JWTService:    jwtService,
 		RateLimiter:   rateLimiter,
 		HealthChecker: healthChecker,
@@ -0,0 +1,303 @@
+// Command hlsctl is an operator CLI for the HLS pipeline API.
+//
+// Usage:
+//
+//	hlsctl [-api URL] dlq list [-limit N]
+//	hlsctl [-api URL] dlq redrive (-all | MESSAGE_ID...)
+//	hlsctl [-api URL] dlq purge (-all | MESSAGE_ID...)
+//	hlsctl [-api URL] verify [-version N] [-deep] VIDEO_ID
+//
+// It authenticates with HLS_TOKEN, or logs in with API_USERNAME and
+// API_PASSWORD. The dlq commands need the API's admin credentials.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/api"
+)
+
+// Client configuration
+const (
+	DefaultAPIURL  = "http://localhost:8080"
+	RequestTimeout = 60 * time.Second
+	VerifyTimeout  = 5 * time.Minute // Deep checks download the whole output
+	MaxErrorLength = 80
+)
+
+// errUsage reports a command line that names no known command.
+var errUsage = errors.New("usage")
+
+// errVerifyFailed reports stored files that do not match their manifest.
+var errVerifyFailed = errors.New("verification failed")
+
+func main() {
+	apiURL := flag.String("api", envOr("HLS_API_URL", DefaultAPIURL), "API base URL")
+	flag.Usage = usage
+	flag.Parse()
+
+	c := &client{
+		baseURL: strings.TrimRight(*apiURL, "/"),
+		http:    &http.Client{Timeout: RequestTimeout},
+	}
+
+	err := errUsage
+	switch args := flag.Args(); {
+	case len(args) >= 2 && args[0] == "dlq":
+		switch args[1] {
+		case "list":
+			err = c.listDeadLetters(args[2:])
+		case "redrive":
+			err = c.deadLetterAction("redrive", args[2:])
+		case "purge":
+			err = c.deadLetterAction("purge", args[2:])
+		}
+	case len(args) >= 1 && args[0] == "verify":
+		err = c.verify(args[1:])
+	}
+	switch {
+	case errors.Is(err, errUsage):
+		usage()
+		os.Exit(2)
+	case errors.Is(err, errVerifyFailed):
+		os.Exit(1)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "hlsctl:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage:
+  hlsctl [-api URL] dlq list [-limit N]
+  hlsctl [-api URL] dlq redrive (-all | MESSAGE_ID...)
+  hlsctl [-api URL] dlq purge (-all | MESSAGE_ID...)
+  hlsctl [-api URL] verify [-version N] [-deep] VIDEO_ID
+
+Authenticates with HLS_TOKEN, or logs in with API_USERNAME and API_PASSWORD.
+The dlq commands need the API's admin credentials.
+`)
+}
+
+// listDeadLetters prints the dead-letter queue as a table.
+func (c *client) listDeadLetters(args []string) error {
+	fs := flag.NewFlagSet("dlq list", flag.ExitOnError)
+	limit := fs.Int("limit", api.DefaultDeadLetterLimit, "maximum messages to list")
+	_ = fs.Parse(args)
+
+	var resp api.DeadLetterListResponse
+	path := "/admin/dlq?limit=" + strconv.Itoa(*limit)
+	if err := c.do(http.MethodGet, path, nil, &resp); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "MESSAGE ID\tVIDEO ID\tSTATUS\tRECEIVES\tATTEMPTS\tLAST ERROR")
+	for _, m := range resp.Messages {
+		videoID, status, attempts, lastErr := "-", "-", "-", "-"
+		if m.Job != nil {
+			videoID = m.Job.VideoID
+		}
+		if m.Video != nil {
+			status = string(m.Video.Status)
+			attempts = strconv.Itoa(m.Video.Attempts)
+			if m.Video.ErrorMessage != "" {
+				lastErr = truncate(m.Video.ErrorMessage, MaxErrorLength)
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", m.MessageID, videoID, status, m.ReceiveCount, attempts, lastErr)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("%d message(s)\n", resp.Count)
+	return nil
+}
+
+// deadLetterAction redrives or purges the selected messages.
+func (c *client) deadLetterAction(action string, args []string) error {
+	fs := flag.NewFlagSet("dlq "+action, flag.ExitOnError)
+	all := fs.Bool("all", false, "act on every message")
+	_ = fs.Parse(args)
+
+	req := api.DeadLetterActionRequest{MessageIDs: fs.Args(), All: *all}
+	if req.All == (len(req.MessageIDs) > 0) {
+		return errors.New("pass either -all or message IDs")
+	}
+
+	var resp api.DeadLetterActionResponse
+	if err := c.do(http.MethodPost, "/admin/dlq/"+action, req, &resp); err != nil {
+		return err
+	}
+	for _, id := range resp.MessageIDs {
+		fmt.Println(id)
+	}
+	fmt.Printf("%s: %d message(s)\n", action, resp.Count)
+	return nil
+}
+
+// verify checks a video's published output against its manifest and
+// prints any files that do not match.
+func (c *client) verify(args []string) error {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	version := fs.Int("version", -1, "output version to verify (default: the current one)")
+	deep := fs.Bool("deep", false, "download every file and compare its SHA-256")
+	_ = fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errUsage
+	}
+
+	req := api.VerifyRequest{Deep: *deep}
+	if *version >= 0 {
+		req.Version = version
+	}
+	c.http.Timeout = VerifyTimeout
+
+	var resp api.VerifyResponse
+	if err := c.do(http.MethodPost, "/videos/"+url.PathEscape(fs.Arg(0))+"/verify", req, &resp); err != nil {
+		return err
+	}
+
+	if len(resp.Problems) > 0 {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tPROBLEM")
+		for _, p := range resp.Problems {
+			fmt.Fprintf(tw, "%s\t%s\n", p.Path, p.Problem)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	check := "checksums"
+	if resp.Deep {
+		check = "content"
+	}
+	fmt.Printf("%s v%d: %d of %d file(s) (%d bytes) match their %s\n",
+		resp.VideoID, resp.Version, resp.Files-len(resp.Problems), resp.Files, resp.Bytes, check)
+	if !resp.Verified {
+		return errVerifyFailed
+	}
+	return nil
+}
+
+// client calls the API with a bearer token.
+type client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+}
+
+// do sends a JSON request and decodes the JSON response into out.
+func (c *client) do(method, path string, in, out any) error {
+	if err := c.authenticate(); err != nil {
+		return err
+	}
+
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return responseError(resp)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// authenticate takes the token from HLS_TOKEN or logs in.
+func (c *client) authenticate() error {
+	if c.token != "" {
+		return nil
+	}
+	if token := os.Getenv("HLS_TOKEN"); token != "" {
+		c.token = token
+		return nil
+	}
+
+	username, password := os.Getenv("API_USERNAME"), os.Getenv("API_PASSWORD")
+	if username == "" || password == "" {
+		return errors.New("set HLS_TOKEN, or API_USERNAME and API_PASSWORD")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.baseURL+"/login", nil)
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(username, password)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("login failed: %w", responseError(resp))
+	}
+
+	var login struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+		return fmt.Errorf("login failed: %w", err)
+	}
+	c.token = login.Token
+	return nil
+}
+
+// responseError reads an API error response.
+func responseError(resp *http.Response) error {
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiErr); err == nil && apiErr.Error != "" {
+		return fmt.Errorf("%s: %s", resp.Status, apiErr.Error)
+	}
+	return errors.New(resp.Status)
+}
+
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
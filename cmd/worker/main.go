@@ -12,7 +12,6 @@ import (
 	"time"
 
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/joho/godotenv"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -20,6 +19,7 @@ import (
 
 	"github.com/amillerrr/hls-pipeline/internal/config"
 	"github.com/amillerrr/hls-pipeline/internal/observability"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
 	"github.com/amillerrr/hls-pipeline/internal/storage"
 	"github.com/amillerrr/hls-pipeline/internal/transcoder"
 	"github.com/amillerrr/hls-pipeline/internal/worker"
@@ -73,26 +73,42 @@ func main() {
 	}
 	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
 
-	s3Client := s3.NewFromConfig(awsCfg)
 	sqsClient := sqs.NewFromConfig(awsCfg)
 
-	// Initialize video repository
-	videoRepo, err := storage.NewVideoRepository(context.Background(), cfg)
+	// Initialize object storage
+	objects, err := storage.NewObjectStore(cfg, awsCfg)
 	if err != nil {
-		log.Error("Failed to initialize video repository", "error", err)
+		log.Error("Failed to initialize object storage", "error", err)
 		os.Exit(1)
 	}
-	log.Info("DynamoDB video repository initialized")
+	log.Info("Object storage initialized", "backend", cfg.Storage.Backend)
+
+	// Initialize job queue
+	jobQueue, err := queue.New(cfg, sqsClient)
+	if err != nil {
+		log.Error("Failed to initialize job queue", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize video store
+	videos, err := storage.NewVideoStore(context.Background(), cfg)
+	if err != nil {
+		log.Error("Failed to initialize video store", "error", err)
+		os.Exit(1)
+	}
+	log.Info("Video store initialized", "backend", cfg.Database.Backend)
 
 	// Initialize transcoder
 	transcoderCfg := transcoder.DefaultFFmpegConfig(log)
+	transcoderCfg.Deinterlacer = cfg.Worker.Deinterlacer
 	tc := transcoder.NewTranscoder(transcoderCfg)
 
 	// Create worker
 	w := worker.New(&worker.Config{
-		S3Client:   s3Client,
-		SQSClient:  sqsClient,
-		VideoRepo:  videoRepo,
+		Objects:    objects,
+		Queue:      jobQueue,
+		Publisher:  jobQueue,
+		Videos:     videos,
 		Transcoder: tc,
 		AppConfig:  cfg,
 		Logger:     log,
@@ -114,7 +130,14 @@ func main() {
 		cancel()
 	}()
 
+	// Export per-lane queue depth
+	go jobQueue.ReportDepth(ctx, queue.DepthReportInterval, log)
+
+	// Delete superseded output versions past their retention
+	go w.RunJanitor(ctx, worker.JanitorInterval)
+
 	// Start polling
+	log.Info("Consuming queue lanes", "lanes", jobQueue.Configured())
 	w.Run(ctx)
 
 	// Shutdown metrics server
@@ -170,6 +170,9 @@ resource "aws_ecs_task_definition" "api" {
         { name = "AWS_REGION", value = var.aws_region },
         { name = "S3_BUCKET", value = aws_s3_bucket.raw_ingest.bucket },
         { name = "SQS_QUEUE_URL", value = aws_sqs_queue.video_queue.id },
+        { name = "SQS_QUEUE_URL_HIGH", value = aws_sqs_queue.video_queue_lane["high"].id },
+        { name = "SQS_QUEUE_URL_BULK", value = aws_sqs_queue.video_queue_lane["bulk"].id },
+        { name = "SQS_DLQ_URL", value = aws_sqs_queue.video_dlq.id },
         { name = "OTEL_EXPORTER_OTLP_ENDPOINT", value = "http://localhost:4317" },
         { name = "PROCESSED_BUCKET", value = aws_s3_bucket.processed.bucket },
         { name = "CDN_DOMAIN", value = "${var.subdomain_label}.${var.root_domain}" },
@@ -245,18 +248,22 @@ resource "aws_ecs_task_definition" "worker" {
 
   container_definitions = jsonencode([
     {
-      name      = "worker"
-      image     = "${aws_ecr_repository.worker.repository_url}:latest"
-      essential = true
+      name        = "worker"
+      image       = "${aws_ecr_repository.worker.repository_url}:latest"
+      essential   = true
+      stopTimeout = 120
       dependsOn = [{ containerName = "aws-otel-collector", condition = "START" }]
       environment = [
         { name = "AWS_REGION", value = var.aws_region },
         { name = "S3_BUCKET", value = aws_s3_bucket.raw_ingest.bucket },
         { name = "PROCESSED_BUCKET", value = aws_s3_bucket.processed.bucket },
         { name = "SQS_QUEUE_URL", value = aws_sqs_queue.video_queue.id },
+        { name = "SQS_QUEUE_URL_HIGH", value = aws_sqs_queue.video_queue_lane["high"].id },
+        { name = "SQS_QUEUE_URL_BULK", value = aws_sqs_queue.video_queue_lane["bulk"].id },
         { name = "DYNAMODB_TABLE", value = aws_dynamodb_table.videos.name },
         { name = "OTEL_EXPORTER_OTLP_ENDPOINT", value = "http://localhost:4317" },
         { name = "MAX_CONCURRENT_JOBS", value = "1" },
+        { name = "DRAIN_TIMEOUT_SECONDS", value = "100" },
         { name = "ENV", value = var.environment }
 
       ]
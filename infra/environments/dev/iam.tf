@@ -156,7 +156,30 @@ resource "aws_iam_role_policy" "api_sqs_send" {
         "sqs:SendMessage",
         "sqs:GetQueueAttributes"
       ]
-      Resource = aws_sqs_queue.video_queue.arn
+      Resource = concat(
+        [aws_sqs_queue.video_queue.arn],
+        [for q in aws_sqs_queue.video_queue_lane : q.arn]
+      )
+    }]
+  })
+}
+
+# API access to inspect, redrive and purge the DLQ
+resource "aws_iam_role_policy" "api_sqs_dlq_admin" {
+  name = "api-sqs-dlq-admin"
+  role = aws_iam_role.api_task_role.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect = "Allow"
+      Action = [
+        "sqs:ReceiveMessage",
+        "sqs:DeleteMessage",
+        "sqs:ChangeMessageVisibility",
+        "sqs:GetQueueAttributes"
+      ]
+      Resource = aws_sqs_queue.video_dlq.arn
     }]
   })
 }
@@ -290,7 +313,8 @@ resource "aws_iam_role_policy" "worker_s3_processed_write" {
           "s3:GetObject",
           "s3:HeadObject",
           "s3:DeleteObject",
-          "s3:ListBucket"
+          "s3:ListBucket",
+          "s3:AbortMultipartUpload"
         ]
         Resource = [
           aws_s3_bucket.processed.arn,
@@ -316,7 +340,10 @@ resource "aws_iam_role_policy" "worker_sqs_consume" {
         "sqs:GetQueueAttributes",
         "sqs:ChangeMessageVisibility"
       ]
-      Resource = aws_sqs_queue.video_queue.arn
+      Resource = concat(
+        [aws_sqs_queue.video_queue.arn],
+        [for q in aws_sqs_queue.video_queue_lane : q.arn]
+      )
     }]
   })
 }
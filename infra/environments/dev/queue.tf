@@ -20,6 +20,31 @@ resource "aws_sqs_queue" "video_queue" {
   }
 }
 
+# Priority lanes; the queue above is the normal lane
+resource "aws_sqs_queue" "video_queue_lane" {
+  for_each = toset(["high", "bulk"])
+
+  name                       = "hls-video-queue-${each.key}-${var.environment}"
+  delay_seconds              = 0
+  max_message_size           = 262144
+  message_retention_seconds  = 86400
+  receive_wait_time_seconds  = 20
+  visibility_timeout_seconds = 900
+
+  sqs_managed_sse_enabled = true
+
+  redrive_policy = jsonencode({
+    deadLetterTargetArn = aws_sqs_queue.video_dlq.arn
+    maxReceiveCount     = 3
+  })
+
+  tags = {
+    Name        = "hls-video-queue-${each.key}"
+    Environment = var.environment
+    Application = "hls-pipeline"
+  }
+}
+
 # Dead Letter Queue
 resource "aws_sqs_queue" "video_dlq" {
   name                      = "hls-video-dlq-${var.environment}"
@@ -39,7 +64,10 @@ resource "aws_sqs_queue_redrive_allow_policy" "video_dlq" {
 
   redrive_allow_policy = jsonencode({
     redrivePermission = "byQueue"
-    sourceQueueArns   = [aws_sqs_queue.video_queue.arn]
+    sourceQueueArns = concat(
+      [aws_sqs_queue.video_queue.arn],
+      [for q in aws_sqs_queue.video_queue_lane : q.arn]
+    )
   })
 }
 
@@ -124,6 +124,34 @@ resource "aws_s3_bucket_lifecycle_configuration" "processed_lifecycle" {
     #   storage_class = "GLACIER"
     # }
   }
+
+  # Checkpoints of failed jobs that were never retried
+  rule {
+    id     = "expire-scratch"
+    status = "Enabled"
+
+    filter {
+      prefix = "scratch/"
+    }
+
+    expiration {
+      days = 7
+    }
+  }
+
+  # Parts of multipart uploads a worker could not abort
+  rule {
+    id     = "abort-incomplete-uploads"
+    status = "Enabled"
+
+    filter {
+      prefix = ""
+    }
+
+    abort_incomplete_multipart_upload {
+      days_after_initiation = 1
+    }
+  }
 }
 
 resource "aws_s3_bucket_cors_configuration" "processed_cors" {
@@ -157,6 +185,15 @@ resource "aws_s3_bucket_policy" "processed_cloudfront" {
           "AWS:SourceArn" = aws_cloudfront_distribution.s3_distribution.arn
         }
       }
+      }, {
+      # Job checkpoints are intermediate files, not playable output
+      Sid    = "DenyCloudFrontScratch"
+      Effect = "Deny"
+      Principal = {
+        Service = "cloudfront.amazonaws.com"
+      }
+      Action   = "s3:GetObject"
+      Resource = "${aws_s3_bucket.processed.arn}/scratch/*"
     }]
   })
 }
@@ -0,0 +1,240 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amillerrr/hls-pipeline/internal/queue"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Dead-letter listing limits
+const (
+	DefaultDeadLetterLimit = 50
+	MaxDeadLetterLimit     = 500
+)
+
+// DeadLetterEntry is a dead-lettered job with its video record.
+type DeadLetterEntry struct {
+	MessageID    string                `json:"messageId"`
+	ReceiveCount int                   `json:"receiveCount"`
+	Job          *models.VideoJob      `json:"job,omitempty"`
+	Body         string                `json:"body,omitempty"` // Set when the body is not a valid job
+	Video        *models.VideoMetadata `json:"video,omitempty"`
+}
+
+// DeadLetterListResponse is the response payload for listing the DLQ.
+type DeadLetterListResponse struct {
+	Messages []DeadLetterEntry `json:"messages"`
+	Count    int               `json:"count"`
+}
+
+// DeadLetterActionRequest selects dead-lettered messages to act on. All must
+// be set explicitly to act on every message.
+type DeadLetterActionRequest struct {
+	MessageIDs []string `json:"messageIds"`
+	All        bool     `json:"all"`
+}
+
+// DeadLetterActionResponse reports the messages an action was applied to.
+type DeadLetterActionResponse struct {
+	MessageIDs []string `json:"messageIds"`
+	Count      int      `json:"count"`
+}
+
+// ListDeadLettersHandler lists dead-lettered jobs with their video records,
+// including each video's last error and attempt counts.
+func (h *Handlers) ListDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+	if h.deadLetters == nil {
+		h.writeError(ctx, w, http.StatusNotImplemented, "Dead-letter queue not configured")
+		return
+	}
+
+	limit := DefaultDeadLetterLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > MaxDeadLetterLimit {
+			h.writeError(ctx, w, http.StatusBadRequest, "limit must be between 1 and 500")
+			return
+		}
+		limit = parsed
+	}
+
+	ctx, span := tracer.Start(ctx, "list-dead-letters",
+		trace.WithAttributes(attribute.Int("limit", limit)))
+	defer span.End()
+
+	messages, err := h.deadLetters.List(ctx, limit)
+	if err != nil {
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to list dead-letter queue", "error", err)
+		h.writeError(ctx, w, http.StatusInternalServerError, "Failed to list dead-letter queue")
+		return
+	}
+
+	entries := make([]DeadLetterEntry, 0, len(messages))
+	for _, msg := range messages {
+		entry := DeadLetterEntry{MessageID: msg.ID, ReceiveCount: msg.ReceiveCount}
+
+		var job models.VideoJob
+		if err := json.Unmarshal([]byte(msg.Body), &job); err != nil || job.VideoID == "" {
+			entry.Body = msg.Body
+			entries = append(entries, entry)
+			continue
+		}
+		entry.Job = &job
+
+		if h.videos != nil {
+			video, err := h.videos.GetVideo(ctx, job.VideoID)
+			if err != nil && !errors.Is(err, models.ErrVideoNotFound) {
+				h.log.WarnContext(ctx, "Failed to get video for dead letter",
+					"videoId", job.VideoID,
+					"error", err,
+				)
+			}
+			entry.Video = video
+		}
+		entries = append(entries, entry)
+	}
+
+	h.writeJSON(ctx, w, http.StatusOK, DeadLetterListResponse{Messages: entries, Count: len(entries)})
+}
+
+// RedriveDeadLettersHandler moves selected dead-lettered jobs back to the
+// lanes they were published to and marks their videos queued again.
+func (h *Handlers) RedriveDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	req, ok := h.decodeDeadLetterAction(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "redrive-dead-letters")
+	defer span.End()
+
+	redriven, err := h.deadLetters.Redrive(ctx, req.MessageIDs, deadLetterLane, func(msg *queue.Message) func() {
+		return h.requeueVideo(ctx, msg)
+	})
+	if err != nil {
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to redrive dead letters", "redriven", len(redriven), "error", err)
+		h.writeError(ctx, w, http.StatusInternalServerError, "Failed to redrive dead letters")
+		return
+	}
+
+	h.log.InfoContext(ctx, "Redrove dead letters", "count", len(redriven))
+	h.writeJSON(ctx, w, http.StatusOK, deadLetterActionResponse(redriven))
+}
+
+// PurgeDeadLettersHandler deletes selected dead-lettered jobs.
+func (h *Handlers) PurgeDeadLettersHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	req, ok := h.decodeDeadLetterAction(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "purge-dead-letters")
+	defer span.End()
+
+	purged, err := h.deadLetters.Purge(ctx, req.MessageIDs)
+	if err != nil {
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to purge dead letters", "purged", len(purged), "error", err)
+		h.writeError(ctx, w, http.StatusInternalServerError, "Failed to purge dead letters")
+		return
+	}
+
+	h.log.InfoContext(ctx, "Purged dead letters", "count", len(purged))
+	h.writeJSON(ctx, w, http.StatusOK, deadLetterActionResponse(purged))
+}
+
+// decodeDeadLetterAction validates a redrive or purge request, writing the
+// error response if it is invalid.
+func (h *Handlers) decodeDeadLetterAction(w http.ResponseWriter, r *http.Request) (*DeadLetterActionRequest, bool) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return nil, false
+	}
+	if h.deadLetters == nil {
+		h.writeError(ctx, w, http.StatusNotImplemented, "Dead-letter queue not configured")
+		return nil, false
+	}
+
+	h.limitRequestBody(w, r)
+
+	var req DeadLetterActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(ctx, w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+	if req.All == (len(req.MessageIDs) > 0) {
+		h.writeError(ctx, w, http.StatusBadRequest, "either messageIds or all is required")
+		return nil, false
+	}
+	return &req, true
+}
+
+// requeueVideo marks the video of a job about to be redriven as queued, so
+// a worker receiving the job can claim it. The returned function marks the
+// video failed again if the job could not be published.
+func (h *Handlers) requeueVideo(ctx context.Context, msg *queue.Message) func() {
+	var job models.VideoJob
+	if h.videos == nil || json.Unmarshal([]byte(msg.Body), &job) != nil || job.VideoID == "" {
+		return nil
+	}
+	if err := h.videos.TransitionVideo(ctx, job.VideoID, models.StatusQueued, models.ActorAPI, "redriven from dead-letter queue"); err != nil {
+		h.log.WarnContext(ctx, "Failed to mark redriven video as queued",
+			"videoId", job.VideoID,
+			"messageId", msg.ID,
+			"error", err,
+		)
+		return nil
+	}
+	return func() {
+		if err := h.videos.TransitionVideo(ctx, job.VideoID, models.StatusFailed, models.ActorAPI, "redrive not published"); err != nil {
+			h.log.ErrorContext(ctx, "Failed to restore video status",
+				"videoId", job.VideoID,
+				"status", models.StatusFailed,
+				"error", err,
+			)
+		}
+	}
+}
+
+// deadLetterLane returns the lane a dead-lettered job was published to.
+func deadLetterLane(msg *queue.Message) queue.Lane {
+	var job models.VideoJob
+	if err := json.Unmarshal([]byte(msg.Body), &job); err != nil {
+		return queue.LaneNormal
+	}
+	lane, err := queue.ParseLane(job.Priority)
+	if err != nil {
+		return queue.LaneNormal
+	}
+	return lane
+}
+
+func deadLetterActionResponse(messages []*queue.Message) DeadLetterActionResponse {
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return DeadLetterActionResponse{MessageIDs: ids, Count: len(ids)}
+}
@@ -9,12 +9,10 @@ import (
 	"net/http"
 	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"github.com/google/uuid"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
@@ -22,6 +20,7 @@ import (
 
 	"github.com/amillerrr/hls-pipeline/internal/auth"
 	"github.com/amillerrr/hls-pipeline/internal/config"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
 	"github.com/amillerrr/hls-pipeline/internal/storage"
 	"github.com/amillerrr/hls-pipeline/pkg/models"
 )
@@ -34,6 +33,10 @@ const (
 	MaxFilenameLength      = 255
 	MaxListObjects         = 1000
 	MaxRequestBodySize     = 1 << 20 // 1 MB
+
+	// StorageRetryAfter is sent as Retry-After when storage is throttled
+	// or unavailable
+	StorageRetryAfter = 5 * time.Second
 )
 
 // Allowed video extensions and content types
@@ -57,33 +60,36 @@ var (
 
 // Handlers contains all HTTP handlers for the API.
 type Handlers struct {
-	cfg        *config.Config
-	log        *slog.Logger
-	s3Client   *storage.S3Client
-	sqsClient  *sqs.Client
-	videoRepo  *storage.VideoRepository
-	jwtService *auth.JWTService
+	cfg         *config.Config
+	log         *slog.Logger
+	objects     storage.ObjectStore
+	jobQueue    queue.LanePublisher
+	deadLetters *queue.DeadLetters
+	videos      storage.VideoStore
+	jwtService  *auth.JWTService
 }
 
 // HandlersConfig holds dependencies for handlers.
 type HandlersConfig struct {
-	Config     *config.Config
-	Logger     *slog.Logger
-	S3Client   *storage.S3Client
-	SQSClient  *sqs.Client
-	VideoRepo  *storage.VideoRepository
-	JWTService *auth.JWTService
+	Config      *config.Config
+	Logger      *slog.Logger
+	Objects     storage.ObjectStore
+	JobQueue    queue.LanePublisher
+	DeadLetters *queue.DeadLetters
+	Videos      storage.VideoStore
+	JWTService  *auth.JWTService
 }
 
 // NewHandlers creates a new Handlers instance.
 func NewHandlers(cfg *HandlersConfig) *Handlers {
 	return &Handlers{
-		cfg:        cfg.Config,
-		log:        cfg.Logger,
-		s3Client:   cfg.S3Client,
-		sqsClient:  cfg.SQSClient,
-		videoRepo:  cfg.VideoRepo,
-		jwtService: cfg.JWTService,
+		cfg:         cfg.Config,
+		log:         cfg.Logger,
+		objects:     cfg.Objects,
+		jobQueue:    cfg.JobQueue,
+		deadLetters: cfg.DeadLetters,
+		videos:      cfg.Videos,
+		jwtService:  cfg.JWTService,
 	}
 }
 
@@ -101,6 +107,18 @@ func (h *Handlers) writeError(ctx context.Context, w http.ResponseWriter, status
 	h.writeJSON(ctx, w, status, map[string]string{"error": message})
 }
 
+// writeStorageError writes the response for a failed storage call that is
+// not about a missing video or object: 503 with Retry-After when storage is
+// throttled or unavailable, so clients retry, and 500 with message otherwise.
+func (h *Handlers) writeStorageError(ctx context.Context, w http.ResponseWriter, err error, message string) {
+	if storage.IsRetryable(err) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(StorageRetryAfter.Seconds())))
+		h.writeError(ctx, w, http.StatusServiceUnavailable, "Storage temporarily unavailable")
+		return
+	}
+	h.writeError(ctx, w, http.StatusInternalServerError, message)
+}
+
 // limitRequestBody wraps the request body with a size limit.
 func (h *Handlers) limitRequestBody(w http.ResponseWriter, r *http.Request) {
 	r.Body = http.MaxBytesReader(w, r.Body, MaxRequestBodySize)
@@ -130,13 +148,17 @@ func (h *Handlers) LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if username != expectedUsername || password != expectedPassword {
+	var token string
+	switch {
+	case h.cfg.API.AdminUsername != "" && username == h.cfg.API.AdminUsername && password == h.cfg.API.AdminPassword:
+		token, err = h.jwtService.GenerateAdminToken(username)
+	case username == expectedUsername && password == expectedPassword:
+		token, err = h.jwtService.GenerateToken(username)
+	default:
 		h.log.WarnContext(ctx, "Failed login attempt", "username", username, "ip", clientIP)
 		h.writeError(ctx, w, http.StatusUnauthorized, "Invalid credentials")
 		return
 	}
-
-	token, err := h.jwtService.GenerateToken(username)
 	if err != nil {
 		h.log.ErrorContext(ctx, "Failed to generate token", "error", err)
 		h.writeError(ctx, w, http.StatusInternalServerError, "Failed to generate token")
@@ -218,7 +240,11 @@ func (h *Handlers) InitUploadHandler(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Generate presigned URL
-	presignedURL, err := h.s3Client.GeneratePresignedURL(ctx, h.cfg.AWS.RawBucket, s3Key, req.ContentType, PresignedURLExpiration)
+	presignedURL, err := h.objects.Presign(ctx, h.cfg.AWS.RawBucket, s3Key, storage.PresignOptions{
+		Method:      http.MethodPut,
+		ContentType: req.ContentType,
+		Expires:     PresignedURLExpiration,
+	})
 	if err != nil {
 		span.RecordError(err)
 		h.log.ErrorContext(ctx, "Failed to generate presigned URL",
@@ -250,12 +276,14 @@ type CompleteUploadRequest struct {
 	VideoID  string `json:"videoId"`
 	Key      string `json:"key"`
 	Filename string `json:"filename"`
+	Priority string `json:"priority,omitempty"` // high, normal or bulk
 }
 
 // CompleteUploadResponse is the response payload for completed uploads.
 type CompleteUploadResponse struct {
 	VideoID   string `json:"videoId"`
 	Status    string `json:"status"`
+	Priority  string `json:"priority"`
 	Message   string `json:"message"`
 	RequestID string `json:"requestId"`
 }
@@ -314,17 +342,21 @@ func (h *Handlers) CompleteUploadHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	lane, err := jobLane(req.Priority)
+	if err != nil {
+		h.writeError(ctx, w, http.StatusBadRequest, "priority must be high, normal or bulk")
+		return
+	}
+
 	span.SetAttributes(
 		attribute.String("video.id", req.VideoID),
 		attribute.String("video.key", req.Key),
+		attribute.String("queue.lane", string(lane)),
 	)
 
 	// Verify file exists in S3
-	headResult, err := h.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
-		Bucket: aws.String(h.cfg.AWS.RawBucket),
-		Key:    aws.String(req.Key),
-	})
-	if err != nil {
+	head, err := h.objects.Head(ctx, h.cfg.AWS.RawBucket, req.Key, storage.HeadOptions{})
+	if errors.Is(err, models.ErrObjectNotFound) {
 		span.RecordError(err)
 		h.log.WarnContext(ctx, "File not found in S3",
 			"key", req.Key,
@@ -335,34 +367,76 @@ func (h *Handlers) CompleteUploadHandler(w http.ResponseWriter, r *http.Request)
 		h.writeError(ctx, w, http.StatusNotFound, "Video file not found in S3")
 		return
 	}
-
-	var fileSizeBytes int64
-	if headResult.ContentLength != nil {
-		fileSizeBytes = *headResult.ContentLength
-		span.SetAttributes(attribute.Int64("video.size_bytes", fileSizeBytes))
+	if err != nil {
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to check uploaded file",
+			"key", req.Key,
+			"videoId", req.VideoID,
+			"requestId", requestID,
+			"error", err,
+		)
+		h.writeStorageError(ctx, w, err, "Failed to check uploaded file")
+		return
 	}
 
+	fileSizeBytes := head.Size
+	span.SetAttributes(attribute.Int64("video.size_bytes", fileSizeBytes))
+
 	// Create video record in DynamoDB
-	if h.videoRepo != nil {
-		_, err := h.videoRepo.CreateVideo(ctx, req.VideoID, req.Filename, req.Key, fileSizeBytes)
-		if err != nil {
-			h.log.WarnContext(ctx, "Failed to create video record in DynamoDB",
+	if h.videos != nil {
+		_, err := h.videos.CreateVideo(ctx, req.VideoID, req.Filename, req.Key, fileSizeBytes)
+		switch {
+		case errors.Is(err, models.ErrVideoExists):
+			// A repeated completion only queues a video that never got a
+			// job; anything further along already has one
+			existing, err := h.videos.GetVideo(ctx, req.VideoID)
+			if err != nil {
+				span.RecordError(err)
+				h.log.ErrorContext(ctx, "Failed to get existing video record",
+					"videoId", req.VideoID,
+					"error", err,
+					"requestId", requestID,
+				)
+				h.writeStorageError(ctx, w, err, "Failed to get video record")
+				return
+			}
+			if existing.Status != models.StatusPending {
+				h.log.WarnContext(ctx, "Upload already completed",
+					"videoId", req.VideoID,
+					"status", existing.Status,
+					"requestId", requestID,
+				)
+				h.writeError(ctx, w, http.StatusConflict, fmt.Sprintf("Video is already %s", existing.Status))
+				return
+			}
+			h.log.WarnContext(ctx, "Video record already exists, queuing pending video",
+				"videoId", req.VideoID,
+				"requestId", requestID,
+			)
+		case err != nil:
+			// Workers only process videos that have a record
+			span.RecordError(err)
+			h.log.ErrorContext(ctx, "Failed to create video record in DynamoDB",
 				"videoId", req.VideoID,
 				"error", err,
 				"requestId", requestID,
 			)
+			h.writeStorageError(ctx, w, err, "Failed to create video record")
+			return
 		}
 	}
 
 	// Queue processing job
-	message := map[string]string{
-		"videoId":  req.VideoID,
-		"s3Key":    req.Key,
-		"bucket":   h.cfg.AWS.RawBucket,
-		"filename": req.Filename,
+	job := models.VideoJob{
+		VideoID:  req.VideoID,
+		S3Key:    req.Key,
+		Bucket:   h.cfg.AWS.RawBucket,
+		Filename: req.Filename,
+		Priority: string(lane),
+		Version:  1, // Allocated by CreateVideo
 	}
 
-	messageBytes, err := json.Marshal(message)
+	messageBytes, err := json.Marshal(job)
 	if err != nil {
 		span.RecordError(err)
 		h.log.ErrorContext(ctx, "Failed to marshal message",
@@ -374,10 +448,19 @@ func (h *Handlers) CompleteUploadHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err = h.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-		QueueUrl:    aws.String(h.cfg.AWS.SQSQueueURL),
-		MessageBody: aws.String(string(messageBytes)),
-	})
+	// Mark the video queued before publishing, so a worker receiving the
+	// job finds it queued rather than moving it on first
+	if h.videos != nil {
+		if err := h.videos.TransitionVideo(ctx, req.VideoID, models.StatusQueued, models.ActorAPI, "job queued"); err != nil {
+			h.log.WarnContext(ctx, "Failed to mark video as queued",
+				"videoId", req.VideoID,
+				"error", err,
+				"requestId", requestID,
+			)
+		}
+	}
+
+	lane, err = h.jobQueue.PublishTo(ctx, lane, string(messageBytes))
 	if err != nil {
 		span.RecordError(err)
 		h.log.ErrorContext(ctx, "Failed to queue processing job",
@@ -385,23 +468,46 @@ func (h *Handlers) CompleteUploadHandler(w http.ResponseWriter, r *http.Request)
 			"videoId", req.VideoID,
 			"requestId", requestID,
 		)
+		// Fail the video whether or not it was marked queued, so it is not
+		// left pending without a job
+		if h.videos != nil {
+			if revertErr := h.videos.TransitionVideo(ctx, req.VideoID, models.StatusFailed, models.ActorAPI, "job not queued"); revertErr != nil {
+				h.log.ErrorContext(ctx, "Failed to restore video status",
+					"videoId", req.VideoID,
+					"status", models.StatusFailed,
+					"error", revertErr,
+				)
+			}
+		}
 		h.writeError(ctx, w, http.StatusInternalServerError, "Failed to queue job")
 		return
 	}
 
 	h.log.InfoContext(ctx, "Processing job queued",
 		"videoId", req.VideoID,
+		"lane", lane,
 		"requestId", requestID,
 	)
 
 	h.writeJSON(ctx, w, http.StatusAccepted, CompleteUploadResponse{
 		VideoID:   req.VideoID,
 		Status:    "processing",
+		Priority:  string(lane),
 		Message:   "Video queued for processing",
 		RequestID: requestID,
 	})
 }
 
+// jobLane picks the queue lane for a job from its requested priority, or
+// the normal lane if none is requested. Clients share one credential, so
+// the lane cannot depend on who sent the request.
+func jobLane(priority string) (queue.Lane, error) {
+	if priority == "" {
+		return queue.LaneNormal, nil
+	}
+	return queue.ParseLane(priority)
+}
+
 // LatestVideoResponse is the response payload for the latest video endpoint.
 type LatestVideoResponse struct {
 	VideoID     string `json:"videoId"`
@@ -421,8 +527,8 @@ func (h *Handlers) GetLatestVideoHandler(w http.ResponseWriter, r *http.Request)
 	ctx, span := tracer.Start(ctx, "get-latest-video")
 	defer span.End()
 
-	if h.videoRepo != nil {
-		video, err := h.videoRepo.GetLatestVideo(ctx)
+	if h.videos != nil {
+		video, err := h.videos.GetLatestVideo(ctx)
 		if err != nil {
 			if errors.Is(err, models.ErrVideoNotFound) {
 				h.writeError(ctx, w, http.StatusNotFound, "No processed videos found")
@@ -430,7 +536,7 @@ func (h *Handlers) GetLatestVideoHandler(w http.ResponseWriter, r *http.Request)
 			}
 			span.RecordError(err)
 			h.log.ErrorContext(ctx, "Failed to get latest video from DynamoDB", "error", err)
-			h.writeError(ctx, w, http.StatusInternalServerError, "Failed to retrieve video")
+			h.writeStorageError(ctx, w, err, "Failed to retrieve video")
 			return
 		}
 
@@ -449,6 +555,119 @@ func (h *Handlers) GetLatestVideoHandler(w http.ResponseWriter, r *http.Request)
 	h.writeError(ctx, w, http.StatusNotFound, "No processed videos found")
 }
 
+// GetVideoHandler returns the metadata and processing status of a single video,
+// including any rejection code assigned during input validation.
+func (h *Handlers) GetVideoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	videoID := r.PathValue("id")
+	if videoID == "" {
+		h.writeError(ctx, w, http.StatusBadRequest, "video id is required")
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "get-video",
+		trace.WithAttributes(attribute.String("video.id", videoID)))
+	defer span.End()
+
+	if h.videos == nil {
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	video, err := h.videos.GetVideo(ctx, videoID)
+	if err != nil {
+		if errors.Is(err, models.ErrVideoNotFound) {
+			h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+			return
+		}
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to get video from DynamoDB", "videoId", videoID, "error", err)
+		h.writeStorageError(ctx, w, err, "Failed to retrieve video")
+		return
+	}
+
+	h.writeJSON(ctx, w, http.StatusOK, video)
+}
+
+// CancelVideoResponse represents the response for a cancellation request.
+type CancelVideoResponse struct {
+	VideoID string `json:"videoId"`
+	Status  string `json:"status"`
+	Message string `json:"message"`
+}
+
+// CancelVideoHandler cancels a video. Videos still waiting for a worker are
+// cancelled immediately; videos being processed are flagged and cancelled by
+// their worker, which also removes any partial output.
+func (h *Handlers) CancelVideoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	videoID := r.PathValue("id")
+	if videoID == "" {
+		h.writeError(ctx, w, http.StatusBadRequest, "video id is required")
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "cancel-video",
+		trace.WithAttributes(attribute.String("video.id", videoID)))
+	defer span.End()
+
+	if h.videos == nil {
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	video, err := h.videos.GetVideo(ctx, videoID)
+	if err == nil {
+		switch video.Status {
+		case models.StatusPending, models.StatusQueued:
+			err = h.videos.TransitionVideo(ctx, videoID, models.StatusCancelled, models.ActorAPI, "cancelled by user")
+			if err == nil {
+				h.writeJSON(ctx, w, http.StatusOK, CancelVideoResponse{
+					VideoID: videoID,
+					Status:  string(models.StatusCancelled),
+					Message: "Video cancelled",
+				})
+				return
+			}
+		case models.StatusProcessing, models.StatusReprocessing:
+			err = h.videos.RequestCancellation(ctx, videoID)
+			if err == nil {
+				h.writeJSON(ctx, w, http.StatusAccepted, CancelVideoResponse{
+					VideoID: videoID,
+					Status:  string(video.Status),
+					Message: "Cancellation requested",
+				})
+				return
+			}
+		default:
+			err = fmt.Errorf("%w: cannot cancel %s video", models.ErrInvalidTransition, video.Status)
+		}
+	}
+
+	switch {
+	case errors.Is(err, models.ErrVideoNotFound):
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+	case errors.Is(err, models.ErrInvalidTransition):
+		h.writeError(ctx, w, http.StatusConflict, err.Error())
+	default:
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to cancel video", "videoId", videoID, "error", err)
+		h.writeStorageError(ctx, w, err, "Failed to cancel video")
+	}
+}
+
 // Validation functions
 
 func validateFilename(filename string) error {
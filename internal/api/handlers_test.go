@@ -2,10 +2,23 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/auth"
+	"github.com/amillerrr/hls-pipeline/internal/config"
+	"github.com/amillerrr/hls-pipeline/internal/health"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
+	"github.com/amillerrr/hls-pipeline/internal/storage"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
 )
 
 func TestValidateFilename(t *testing.T) {
@@ -247,6 +260,242 @@ func TestCompleteUploadHandler_MissingVideoID(t *testing.T) {
 	}
 }
 
+// headErrorStore is an ObjectStore whose Head fails with err.
+type headErrorStore struct {
+	storage.ObjectStore
+	err error
+}
+
+func (s headErrorStore) Head(context.Context, string, string, storage.HeadOptions) (*storage.ObjectInfo, error) {
+	return nil, s.err
+}
+
+func TestCompleteUploadHandler_HeadErrors(t *testing.T) {
+	tests := []struct {
+		name           string
+		err            error
+		want           int
+		wantRetryAfter bool
+	}{
+		{"not found", fmt.Errorf("%w: NoSuchKey", models.ErrObjectNotFound), http.StatusNotFound, false},
+		{"throttled", fmt.Errorf("%w: SlowDown", models.ErrThrottled), http.StatusServiceUnavailable, true},
+		{"unavailable", fmt.Errorf("%w: i/o timeout", models.ErrStorageUnavailable), http.StatusServiceUnavailable, true},
+		{"access denied", fmt.Errorf("%w: AccessDenied", models.ErrAccessDenied), http.StatusInternalServerError, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handlers{
+				cfg:     &config.Config{},
+				log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+				objects: headErrorStore{err: tt.err},
+			}
+
+			bodyBytes, _ := json.Marshal(CompleteUploadRequest{
+				VideoID:  "abc",
+				Key:      "uploads/abc/test.mp4",
+				Filename: "test.mp4",
+			})
+			req := httptest.NewRequest("POST", "/upload/complete", bytes.NewBuffer(bodyBytes))
+			rr := httptest.NewRecorder()
+
+			h.CompleteUploadHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+			if got := rr.Header().Get("Retry-After") != ""; got != tt.wantRetryAfter {
+				t.Errorf("Retry-After set = %v, want %v", got, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+// publishFunc adapts a function to queue.LanePublisher.
+type publishFunc func(ctx context.Context, lane queue.Lane, body string) (queue.Lane, error)
+
+func (f publishFunc) PublishTo(ctx context.Context, lane queue.Lane, body string) (queue.Lane, error) {
+	return f(ctx, lane, body)
+}
+
+func TestCompleteUploadHandler_QueuesBeforePublishing(t *testing.T) {
+	tests := []struct {
+		name       string
+		publishErr error
+		want       int
+		wantStatus models.VideoStatus
+	}{
+		{"published", nil, http.StatusAccepted, models.StatusQueued},
+		{"publish fails", errors.New("queue unavailable"), http.StatusInternalServerError, models.StatusFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			objects, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := objects.Put(ctx, "raw", "uploads/abc/test.mp4", bytes.NewReader([]byte("video")), storage.PutOptions{}); err != nil {
+				t.Fatal(err)
+			}
+			videos := storage.NewMemoryVideoStore()
+
+			var statusAtPublish models.VideoStatus
+			h := &Handlers{
+				cfg:     &config.Config{AWS: config.AWSConfig{RawBucket: "raw"}},
+				log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+				objects: objects,
+				videos:  videos,
+				jobQueue: publishFunc(func(ctx context.Context, lane queue.Lane, _ string) (queue.Lane, error) {
+					video, err := videos.GetVideo(ctx, "abc")
+					if err != nil {
+						t.Fatalf("GetVideo() error = %v", err)
+					}
+					statusAtPublish = video.Status
+					return lane, tt.publishErr
+				}),
+			}
+
+			bodyBytes, _ := json.Marshal(CompleteUploadRequest{
+				VideoID:  "abc",
+				Key:      "uploads/abc/test.mp4",
+				Filename: "test.mp4",
+			})
+			req := httptest.NewRequest("POST", "/upload/complete", bytes.NewBuffer(bodyBytes))
+			rr := httptest.NewRecorder()
+
+			h.CompleteUploadHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+			if statusAtPublish != models.StatusQueued {
+				t.Errorf("video status at publish = %s, want %s", statusAtPublish, models.StatusQueued)
+			}
+			video, err := videos.GetVideo(ctx, "abc")
+			if err != nil {
+				t.Fatalf("GetVideo() error = %v", err)
+			}
+			if video.Status != tt.wantStatus {
+				t.Errorf("video status = %s, want %s", video.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+// uploadedObjects returns an ObjectStore holding the raw upload of video abc.
+func uploadedObjects(t *testing.T) storage.ObjectStore {
+	t.Helper()
+	objects, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := objects.Put(context.Background(), "raw", "uploads/abc/test.mp4", bytes.NewReader([]byte("video")), storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	return objects
+}
+
+func completeUpload(h *Handlers) *httptest.ResponseRecorder {
+	bodyBytes, _ := json.Marshal(CompleteUploadRequest{
+		VideoID:  "abc",
+		Key:      "uploads/abc/test.mp4",
+		Filename: "test.mp4",
+	})
+	req := httptest.NewRequest("POST", "/upload/complete", bytes.NewBuffer(bodyBytes))
+	rr := httptest.NewRecorder()
+	h.CompleteUploadHandler(rr, req)
+	return rr
+}
+
+func TestCompleteUploadHandler_ExistingVideo(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      models.VideoStatus
+		want        int
+		wantPublish bool
+	}{
+		{"pending", models.StatusPending, http.StatusAccepted, true},
+		{"queued", models.StatusQueued, http.StatusConflict, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			videos := storage.NewMemoryVideoStore()
+			if _, err := videos.CreateVideo(ctx, "abc", "test.mp4", "uploads/abc/test.mp4", 5); err != nil {
+				t.Fatal(err)
+			}
+			if tt.status != models.StatusPending {
+				if err := videos.TransitionVideo(ctx, "abc", tt.status, models.ActorAPI, ""); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			published := false
+			h := &Handlers{
+				cfg:     &config.Config{AWS: config.AWSConfig{RawBucket: "raw"}},
+				log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+				objects: uploadedObjects(t),
+				videos:  videos,
+				jobQueue: publishFunc(func(_ context.Context, lane queue.Lane, _ string) (queue.Lane, error) {
+					published = true
+					return lane, nil
+				}),
+			}
+
+			rr := completeUpload(h)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+			if published != tt.wantPublish {
+				t.Errorf("published = %v, want %v", published, tt.wantPublish)
+			}
+		})
+	}
+}
+
+// queueErrStore is a VideoStore that cannot mark videos queued.
+type queueErrStore struct {
+	storage.VideoStore
+}
+
+func (s queueErrStore) TransitionVideo(ctx context.Context, videoID string, to models.VideoStatus, actor, reason string) error {
+	if to == models.StatusQueued {
+		return errors.New("table unavailable")
+	}
+	return s.VideoStore.TransitionVideo(ctx, videoID, to, actor, reason)
+}
+
+func TestCompleteUploadHandler_FailsUnqueuedVideo(t *testing.T) {
+	ctx := context.Background()
+	videos := storage.NewMemoryVideoStore()
+	h := &Handlers{
+		cfg:     &config.Config{AWS: config.AWSConfig{RawBucket: "raw"}},
+		log:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		objects: uploadedObjects(t),
+		videos:  queueErrStore{videos},
+		jobQueue: publishFunc(func(_ context.Context, lane queue.Lane, _ string) (queue.Lane, error) {
+			return lane, errors.New("queue unavailable")
+		}),
+	}
+
+	rr := completeUpload(h)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusInternalServerError)
+	}
+	video, err := videos.GetVideo(ctx, "abc")
+	if err != nil {
+		t.Fatalf("GetVideo() error = %v", err)
+	}
+	if video.Status != models.StatusFailed {
+		t.Errorf("video status = %s, want %s", video.Status, models.StatusFailed)
+	}
+}
+
 func TestGetLatestVideoHandler_InvalidMethod(t *testing.T) {
 	h := &Handlers{}
 
@@ -259,3 +508,443 @@ func TestGetLatestVideoHandler_InvalidMethod(t *testing.T) {
 		t.Errorf("Status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
 	}
 }
+
+func TestGetVideoHandler_InvalidMethod(t *testing.T) {
+	h := &Handlers{}
+
+	req := httptest.NewRequest("POST", "/videos/abc", nil)
+	req.SetPathValue("id", "abc")
+	rr := httptest.NewRecorder()
+
+	h.GetVideoHandler(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestGetVideoHandler_MissingID(t *testing.T) {
+	h := &Handlers{}
+
+	req := httptest.NewRequest("GET", "/videos/", nil)
+	rr := httptest.NewRecorder()
+
+	h.GetVideoHandler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestCancelVideoHandler_InvalidMethod(t *testing.T) {
+	h := &Handlers{}
+
+	req := httptest.NewRequest("GET", "/videos/abc/cancel", nil)
+	req.SetPathValue("id", "abc")
+	rr := httptest.NewRecorder()
+
+	h.CancelVideoHandler(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestCancelVideoHandler_MissingID(t *testing.T) {
+	h := &Handlers{}
+
+	req := httptest.NewRequest("POST", "/videos//cancel", nil)
+	rr := httptest.NewRecorder()
+
+	h.CancelVideoHandler(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Status = %d, want %d", rr.Code, http.StatusBadRequest)
+	}
+}
+
+func TestJobLane(t *testing.T) {
+	tests := []struct {
+		name     string
+		priority string
+		want     queue.Lane
+		wantErr  bool
+	}{
+		{"default", "", queue.LaneNormal, false},
+		{"high", "high", queue.LaneHigh, false},
+		{"bulk", "bulk", queue.LaneBulk, false},
+		{"unknown", "urgent", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := jobLane(tt.priority)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("jobLane() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("jobLane() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadLetterHandlers_NotConfigured(t *testing.T) {
+	h := &Handlers{}
+
+	tests := []struct {
+		name    string
+		method  string
+		handler http.HandlerFunc
+	}{
+		{"list", "GET", h.ListDeadLettersHandler},
+		{"redrive", "POST", h.RedriveDeadLettersHandler},
+		{"purge", "POST", h.PurgeDeadLettersHandler},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/dlq", bytes.NewBufferString(`{"all":true}`))
+			rr := httptest.NewRecorder()
+
+			tt.handler(rr, req)
+
+			if rr.Code != http.StatusNotImplemented {
+				t.Errorf("Status = %d, want %d", rr.Code, http.StatusNotImplemented)
+			}
+		})
+	}
+}
+
+func TestServer_AdminRoutes(t *testing.T) {
+	jwtService, err := auth.NewJWTService([]byte("test-secret-that-is-long-enough-for-testing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.Config{API: config.APIConfig{
+		Username:      "user",
+		Password:      "user-secret",
+		AdminUsername: "ops",
+		AdminPassword: "ops-secret",
+	}}
+	srv, err := NewServer(&ServerConfig{
+		Config:        cfg,
+		Logger:        slog.New(slog.NewTextHandler(io.Discard, nil)),
+		JWTService:    jwtService,
+		HealthChecker: health.NewChecker(&health.Config{}),
+	})
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	handler := srv.httpServer.Handler
+
+	login := func(username, password string) string {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.SetBasicAuth(username, password)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("login as %s: status = %d, want %d", username, rr.Code, http.StatusOK)
+		}
+		var resp map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+		return resp["token"]
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"user token", login("user", "user-secret"), http.StatusForbidden},
+		{"admin token", login("ops", "ops-secret"), http.StatusNotImplemented}, // No DLQ configured
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/dlq", nil)
+			req.RemoteAddr = "192.0.2.1:1234"
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadLetterAction_Validation(t *testing.T) {
+	dl, err := queue.NewDeadLetters(queue.NewMemoryQueue(), queue.NewLanes())
+	if err != nil {
+		t.Fatalf("NewDeadLetters() error = %v", err)
+	}
+	h := &Handlers{deadLetters: dl}
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"wrong method", "GET", `{"all":true}`, http.StatusMethodNotAllowed},
+		{"invalid json", "POST", `{`, http.StatusBadRequest},
+		{"no selection", "POST", `{}`, http.StatusBadRequest},
+		{"both ids and all", "POST", `{"all":true,"messageIds":["m1"]}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin/dlq/purge", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			h.PurgeDeadLettersHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeadLetterLane(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want queue.Lane
+	}{
+		{"priority", `{"videoId":"v1","priority":"high"}`, queue.LaneHigh},
+		{"no priority", `{"videoId":"v1"}`, queue.LaneNormal},
+		{"unknown priority", `{"videoId":"v1","priority":"urgent"}`, queue.LaneNormal},
+		{"not a job", `garbage`, queue.LaneNormal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := deadLetterLane(&queue.Message{Body: tt.body}); got != tt.want {
+				t.Errorf("deadLetterLane() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReprocessVideoHandler_Validation(t *testing.T) {
+	h := &Handlers{}
+
+	tests := []struct {
+		name   string
+		method string
+		id     string
+		body   string
+		want   int
+	}{
+		{"wrong method", "GET", "abc", "", http.StatusMethodNotAllowed},
+		{"missing id", "POST", "", "", http.StatusBadRequest},
+		{"invalid json", "POST", "abc", `{`, http.StatusBadRequest},
+		{"unknown profile", "POST", "abc", `{"profile":"4k"}`, http.StatusBadRequest},
+		{"unknown priority", "POST", "abc", `{"priority":"urgent"}`, http.StatusBadRequest},
+		{"no body, no repository", "POST", "abc", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/videos/"+tt.id+"/reprocess", bytes.NewBufferString(tt.body))
+			req.SetPathValue("id", tt.id)
+			rr := httptest.NewRecorder()
+
+			h.ReprocessVideoHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestBulkReprocessHandler(t *testing.T) {
+	h := &Handlers{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+	tooMany := make([]string, MaxBulkReprocess+1)
+	for i := range tooMany {
+		tooMany[i] = "v"
+	}
+	tooManyBody, _ := json.Marshal(BulkReprocessRequest{VideoIDs: tooMany})
+
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		want   int
+	}{
+		{"wrong method", "GET", "", http.StatusMethodNotAllowed},
+		{"no videos", "POST", `{"videoIds":[]}`, http.StatusBadRequest},
+		{"too many videos", "POST", string(tooManyBody), http.StatusBadRequest},
+		{"unknown profile", "POST", `{"videoIds":["a"],"profile":"4k"}`, http.StatusBadRequest},
+		{"per-video errors", "POST", `{"videoIds":["a","b","a"]}`, http.StatusAccepted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/videos/reprocess", bytes.NewBufferString(tt.body))
+			rr := httptest.NewRecorder()
+
+			h.BulkReprocessHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Fatalf("Status = %d, want %d", rr.Code, tt.want)
+			}
+			if rr.Code != http.StatusAccepted {
+				return
+			}
+
+			var resp BulkReprocessResponse
+			if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(resp.Results) != 2 || resp.Failed != 2 || resp.Queued != 0 {
+				t.Errorf("response = %+v, want two failed results", resp)
+			}
+		})
+	}
+}
+
+func TestRollbackVideoHandler_Validation(t *testing.T) {
+	h := &Handlers{}
+
+	tests := []struct {
+		name   string
+		method string
+		id     string
+		body   string
+		want   int
+	}{
+		{"wrong method", "GET", "abc", "", http.StatusMethodNotAllowed},
+		{"missing id", "POST", "", "", http.StatusBadRequest},
+		{"invalid json", "POST", "abc", `{`, http.StatusBadRequest},
+		{"negative version", "POST", "abc", `{"version":-1}`, http.StatusBadRequest},
+		{"no repository", "POST", "abc", `{"version":1}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/videos/"+tt.id+"/rollback", bytes.NewBufferString(tt.body))
+			req.SetPathValue("id", tt.id)
+			rr := httptest.NewRecorder()
+
+			h.RollbackVideoHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyVideoHandler_Validation(t *testing.T) {
+	h := &Handlers{}
+
+	tests := []struct {
+		name   string
+		method string
+		id     string
+		body   string
+		want   int
+	}{
+		{"wrong method", "GET", "abc", "", http.StatusMethodNotAllowed},
+		{"missing id", "POST", "", "", http.StatusBadRequest},
+		{"invalid json", "POST", "abc", `{`, http.StatusBadRequest},
+		{"negative version", "POST", "abc", `{"version":-1}`, http.StatusBadRequest},
+		{"no repository", "POST", "abc", `{"deep":true}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/videos/"+tt.id+"/verify", bytes.NewBufferString(tt.body))
+			req.SetPathValue("id", tt.id)
+			rr := httptest.NewRecorder()
+
+			h.VerifyVideoHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestObjectHandler(t *testing.T) {
+	ctx := context.Background()
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handlers{objects: store, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	presign := func(method, contentType string) string {
+		u, err := store.Presign(ctx, "raw", "uploads/a.mp4", storage.PresignOptions{Method: method, ContentType: contentType, Expires: time.Minute})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return u
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		contentType string
+		rangeHeader string
+		body        string
+		want        int
+		wantBody    string
+	}{
+		{"get before put", "GET", presign("GET", ""), "", "", "", http.StatusNotFound, ""},
+		{"put", "PUT", presign("PUT", "video/mp4"), "video/mp4", "", "0123456789", http.StatusOK, ""},
+		{"put other content type", "PUT", presign("PUT", "video/mp4"), "text/html", "", "<html>", http.StatusForbidden, ""},
+		{"get", "GET", presign("GET", ""), "", "", "", http.StatusOK, "0123456789"},
+		{"get range", "GET", presign("GET", ""), "", "bytes=2-4", "", http.StatusPartialContent, "234"},
+		{"head", "HEAD", presign("GET", ""), "", "", "", http.StatusOK, ""},
+		{"unsigned", "GET", "http://localhost:8080/storage/raw/uploads/a.mp4", "", "", "", http.StatusForbidden, ""},
+		{"wrong method", "POST", presign("GET", ""), "", "", "", http.StatusMethodNotAllowed, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewBufferString(tt.body))
+			req.SetPathValue("bucket", "raw")
+			req.SetPathValue("key", "uploads/a.mp4")
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			if tt.rangeHeader != "" {
+				req.Header.Set("Range", tt.rangeHeader)
+			}
+			rr := httptest.NewRecorder()
+
+			h.ObjectHandler(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("Status = %d, want %d", rr.Code, tt.want)
+			}
+			if tt.wantBody != "" && rr.Body.String() != tt.wantBody {
+				t.Errorf("Body = %q, want %q", rr.Body.String(), tt.wantBody)
+			}
+		})
+	}
+
+	// Without a local store every object is missing
+	req := httptest.NewRequest("GET", presign("GET", ""), nil)
+	req.SetPathValue("bucket", "raw")
+	req.SetPathValue("key", "uploads/a.mp4")
+	rr := httptest.NewRecorder()
+	(&Handlers{}).ObjectHandler(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Status without local store = %d, want %d", rr.Code, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amillerrr/hls-pipeline/internal/storage"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// ObjectHandler serves presigned URLs of the local object store: GET and
+// HEAD read an object, with range requests, and PUT stores one. Requests
+// are authorised by the URL's signature instead of a token. With any other
+// store it reports every object as missing.
+func (h *Handlers) ObjectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPut {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	bucket, key := r.PathValue("bucket"), r.PathValue("key")
+	local, ok := h.objects.(*storage.LocalStore)
+	if !ok || bucket == "" || key == "" {
+		h.writeError(ctx, w, http.StatusNotFound, "Object not found")
+		return
+	}
+
+	if err := local.VerifyURL(r, bucket, key); err != nil {
+		h.log.WarnContext(ctx, "Rejected object request", "bucket", bucket, "key", key, "error", err)
+		h.writeError(ctx, w, http.StatusForbidden, "Invalid or expired signature")
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "serve-object",
+		trace.WithAttributes(
+			attribute.String("object.bucket", bucket),
+			attribute.String("object.key", key),
+			attribute.String("http.method", r.Method),
+		))
+	defer span.End()
+
+	// Transfers of whole videos outlast the server's timeouts; the URL's
+	// expiry bounds them instead
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+
+	if r.Method == http.MethodPut {
+		info, err := local.Write(bucket, key, r.Body, storage.PutOptions{ContentType: r.Header.Get("Content-Type")})
+		if err != nil {
+			span.RecordError(err)
+			h.log.ErrorContext(ctx, "Failed to store object", "bucket", bucket, "key", key, "error", err)
+			h.writeError(ctx, w, http.StatusInternalServerError, "Failed to store object")
+			return
+		}
+		w.Header().Set("ETag", info.ETag)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	file, info, err := local.Open(bucket, key)
+	if err != nil {
+		if errors.Is(err, models.ErrObjectNotFound) {
+			h.writeError(ctx, w, http.StatusNotFound, "Object not found")
+			return
+		}
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to open object", "bucket", bucket, "key", key, "error", err)
+		h.writeError(ctx, w, http.StatusInternalServerError, "Failed to read object")
+		return
+	}
+	defer file.Close()
+
+	// ServeContent answers range and If-Match requests against the ETag
+	w.Header().Set("ETag", info.ETag)
+	if info.ContentType != "" {
+		w.Header().Set("Content-Type", info.ContentType)
+	}
+	http.ServeContent(w, r, key, info.LastModified, file)
+}
@@ -0,0 +1,271 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amillerrr/hls-pipeline/internal/queue"
+	"github.com/amillerrr/hls-pipeline/internal/storage"
+	"github.com/amillerrr/hls-pipeline/internal/transcoder"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// MaxBulkReprocess is the most videos one bulk reprocess request may name.
+const MaxBulkReprocess = 100
+
+// errRawObjectMissing means a video's source upload is no longer available.
+var errRawObjectMissing = errors.New("raw upload is not available")
+
+// ReprocessRequest is the optional request payload for reprocessing a video.
+type ReprocessRequest struct {
+	Profile  string `json:"profile,omitempty"`  // Encoding profile; defaults to the video's current one
+	Priority string `json:"priority,omitempty"` // high, normal or bulk
+}
+
+// BulkReprocessRequest is the request payload for reprocessing many videos.
+type BulkReprocessRequest struct {
+	VideoIDs []string `json:"videoIds"`
+	Profile  string   `json:"profile,omitempty"`
+	Priority string   `json:"priority,omitempty"`
+}
+
+// ReprocessResponse reports the job queued to reprocess a video.
+type ReprocessResponse struct {
+	VideoID  string `json:"videoId"`
+	Status   string `json:"status"`
+	Version  int    `json:"version,omitempty"` // Output version the job will write
+	Profile  string `json:"profile,omitempty"`
+	Priority string `json:"priority,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BulkReprocessResponse reports the outcome for each video in a bulk request.
+type BulkReprocessResponse struct {
+	Results []ReprocessResponse `json:"results"`
+	Queued  int                 `json:"queued"`
+	Failed  int                 `json:"failed"`
+}
+
+// ReprocessVideoHandler queues a job that re-encodes a video from its
+// retained raw upload into a new output version. Playback keeps serving the
+// current version until the job succeeds.
+func (h *Handlers) ReprocessVideoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	videoID := r.PathValue("id")
+	if videoID == "" {
+		h.writeError(ctx, w, http.StatusBadRequest, "video id is required")
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	// The body is optional
+	var req ReprocessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(ctx, w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	lane, ok := h.reprocessOptions(w, r, req.Profile, req.Priority)
+	if !ok {
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "reprocess-video",
+		trace.WithAttributes(attribute.String("video.id", videoID)))
+	defer span.End()
+
+	resp, err := h.reprocessVideo(ctx, videoID, req.Profile, lane)
+	switch {
+	case err == nil:
+		h.writeJSON(ctx, w, http.StatusAccepted, resp)
+	case errors.Is(err, models.ErrVideoNotFound):
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+	case errors.Is(err, models.ErrInvalidTransition), errors.Is(err, errRawObjectMissing):
+		h.writeError(ctx, w, http.StatusConflict, err.Error())
+	default:
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to reprocess video", "videoId", videoID, "error", err)
+		h.writeStorageError(ctx, w, err, "Failed to reprocess video")
+	}
+}
+
+// BulkReprocessHandler queues reprocessing jobs for up to MaxBulkReprocess
+// videos with the same profile and priority. Videos that cannot be
+// reprocessed are reported individually and do not stop the others.
+func (h *Handlers) BulkReprocessHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	var req BulkReprocessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(ctx, w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if len(req.VideoIDs) == 0 {
+		h.writeError(ctx, w, http.StatusBadRequest, "videoIds is required")
+		return
+	}
+	if len(req.VideoIDs) > MaxBulkReprocess {
+		h.writeError(ctx, w, http.StatusBadRequest, fmt.Sprintf("at most %d videoIds may be reprocessed at once", MaxBulkReprocess))
+		return
+	}
+
+	lane, ok := h.reprocessOptions(w, r, req.Profile, req.Priority)
+	if !ok {
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "bulk-reprocess",
+		trace.WithAttributes(attribute.Int("videos", len(req.VideoIDs))))
+	defer span.End()
+
+	resp := BulkReprocessResponse{Results: make([]ReprocessResponse, 0, len(req.VideoIDs))}
+	seen := make(map[string]bool, len(req.VideoIDs))
+	for _, videoID := range req.VideoIDs {
+		if videoID == "" || seen[videoID] {
+			continue
+		}
+		seen[videoID] = true
+
+		result, err := h.reprocessVideo(ctx, videoID, req.Profile, lane)
+		if err != nil {
+			if !errors.Is(err, models.ErrVideoNotFound) && !errors.Is(err, models.ErrInvalidTransition) &&
+				!errors.Is(err, errRawObjectMissing) {
+				h.log.ErrorContext(ctx, "Failed to reprocess video", "videoId", videoID, "error", err)
+			}
+			result = &ReprocessResponse{VideoID: videoID, Status: "error", Error: err.Error()}
+			resp.Failed++
+		} else {
+			resp.Queued++
+		}
+		resp.Results = append(resp.Results, *result)
+	}
+
+	h.log.InfoContext(ctx, "Bulk reprocess queued", "queued", resp.Queued, "failed", resp.Failed)
+	h.writeJSON(ctx, w, http.StatusAccepted, resp)
+}
+
+// reprocessOptions validates the profile and priority of a reprocess
+// request and returns the lane to use, writing the error response if they
+// are invalid.
+func (h *Handlers) reprocessOptions(w http.ResponseWriter, r *http.Request, profile, priority string) (queue.Lane, bool) {
+	ctx := r.Context()
+
+	if profile != "" {
+		if _, err := transcoder.ProfilePresets(profile); err != nil {
+			h.writeError(ctx, w, http.StatusBadRequest, err.Error())
+			return "", false
+		}
+	}
+
+	lane, err := jobLane(priority)
+	if err != nil {
+		h.writeError(ctx, w, http.StatusBadRequest, "priority must be high, normal or bulk")
+		return "", false
+	}
+	return lane, true
+}
+
+// reprocessVideo allocates a new output version for a video and queues a job
+// encoding its raw upload into it. If the job cannot be queued the video is
+// returned to its previous status.
+func (h *Handlers) reprocessVideo(ctx context.Context, videoID, profile string, lane queue.Lane) (*ReprocessResponse, error) {
+	if h.videos == nil {
+		return nil, models.ErrVideoNotFound
+	}
+
+	video, err := h.videos.GetVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+	if !video.Status.CanTransitionTo(models.StatusReprocessing) {
+		return nil, fmt.Errorf("%w: cannot reprocess %s video", models.ErrInvalidTransition, video.Status)
+	}
+	if video.S3RawKey == "" {
+		return nil, errRawObjectMissing
+	}
+	_, err = h.objects.Head(ctx, h.cfg.AWS.RawBucket, video.S3RawKey, storage.HeadOptions{})
+	if errors.Is(err, models.ErrObjectNotFound) {
+		h.log.WarnContext(ctx, "Raw upload not found for reprocessing",
+			"videoId", videoID,
+			"key", video.S3RawKey,
+			"error", err,
+		)
+		return nil, errRawObjectMissing
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to check raw upload: %w", err)
+	}
+
+	if profile == "" {
+		profile = video.Profile
+	}
+	if profile == "" {
+		profile = transcoder.DefaultProfile
+	}
+
+	updated, err := h.videos.ReprocessVideo(ctx, videoID, models.ActorAPI, "reprocess requested: "+profile)
+	if err != nil {
+		return nil, err
+	}
+
+	job := models.VideoJob{
+		VideoID:  videoID,
+		S3Key:    video.S3RawKey,
+		Bucket:   h.cfg.AWS.RawBucket,
+		Filename: video.Filename,
+		Priority: string(lane),
+		Profile:  profile,
+		Version:  updated.LatestVersion,
+	}
+
+	messageBytes, err := json.Marshal(job)
+	if err == nil {
+		lane, err = h.jobQueue.PublishTo(ctx, lane, string(messageBytes))
+	}
+	if err != nil {
+		if revertErr := h.videos.TransitionVideo(ctx, videoID, video.Status, models.ActorAPI, "reprocess job not queued"); revertErr != nil {
+			h.log.ErrorContext(ctx, "Failed to restore video status",
+				"videoId", videoID,
+				"status", video.Status,
+				"error", revertErr,
+			)
+		}
+		return nil, fmt.Errorf("failed to queue reprocess job: %w", err)
+	}
+
+	h.log.InfoContext(ctx, "Reprocess job queued",
+		"videoId", videoID,
+		"version", job.Version,
+		"profile", profile,
+		"lane", lane,
+	)
+
+	return &ReprocessResponse{
+		VideoID:  videoID,
+		Status:   string(models.StatusReprocessing),
+		Version:  job.Version,
+		Profile:  profile,
+		Priority: string(lane),
+	}, nil
+}
@@ -14,6 +14,7 @@ import (
 	"github.com/amillerrr/hls-pipeline/internal/auth"
 	"github.com/amillerrr/hls-pipeline/internal/config"
 	"github.com/amillerrr/hls-pipeline/internal/health"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
 	"github.com/amillerrr/hls-pipeline/internal/storage"
 )
 
@@ -40,9 +41,10 @@ type Server struct {
 type ServerConfig struct {
 	Config        *config.Config
 	Logger        *slog.Logger
-	S3Client      *storage.S3Client
-	SQSClient     health.SQSClient
-	VideoRepo     *storage.VideoRepository
+	Objects       storage.ObjectStore
+	JobQueue      queue.LanePublisher
+	DeadLetters   *queue.DeadLetters
+	Videos        storage.VideoStore
 	JWTService    *auth.JWTService
 	RateLimiter   *auth.RateLimiter
 	HealthChecker *health.Checker
@@ -51,11 +53,13 @@ type ServerConfig struct {
 // NewServer creates a new API server.
 func NewServer(cfg *ServerConfig) (*Server, error) {
 	handlers := NewHandlers(&HandlersConfig{
-		Config:     cfg.Config,
-		Logger:     cfg.Logger,
-		S3Client:   cfg.S3Client,
-		VideoRepo:  cfg.VideoRepo,
-		JWTService: cfg.JWTService,
+		Config:      cfg.Config,
+		Logger:      cfg.Logger,
+		Objects:     cfg.Objects,
+		JobQueue:    cfg.JobQueue,
+		DeadLetters: cfg.DeadLetters,
+		Videos:      cfg.Videos,
+		JWTService:  cfg.JWTService,
 	})
 
 	// Setup routing
@@ -67,10 +71,28 @@ func NewServer(cfg *ServerConfig) (*Server, error) {
 	mux.HandleFunc("/login", handlers.LoginHandler)
 	mux.HandleFunc("/latest", handlers.GetLatestVideoHandler)
 
+	// Presigned URLs of the local object store, authorised by signature
+	mux.HandleFunc(storage.LocalObjectPath+"{bucket}/{key...}", handlers.ObjectHandler)
+
 	// Protected endpoints
 	authMiddleware := cfg.JWTService.Middleware(cfg.RateLimiter)
 	mux.HandleFunc("/upload/init", authMiddleware(handlers.InitUploadHandler))
 	mux.HandleFunc("/upload/complete", authMiddleware(handlers.CompleteUploadHandler))
+	mux.HandleFunc("/videos/{id}", authMiddleware(handlers.GetVideoHandler))
+	mux.HandleFunc("/videos/{id}/cancel", authMiddleware(handlers.CancelVideoHandler))
+	mux.HandleFunc("/videos/{id}/reprocess", authMiddleware(handlers.ReprocessVideoHandler))
+	mux.HandleFunc("/videos/{id}/rollback", authMiddleware(handlers.RollbackVideoHandler))
+	mux.HandleFunc("/videos/{id}/verify", authMiddleware(handlers.VerifyVideoHandler))
+	mux.HandleFunc("/videos/reprocess", authMiddleware(handlers.BulkReprocessHandler))
+
+	// Admin endpoints, for tokens issued to the admin credentials
+	requireAdmin := auth.RequireRole(auth.RoleAdmin)
+	adminMiddleware := func(next http.HandlerFunc) http.HandlerFunc {
+		return authMiddleware(requireAdmin(next))
+	}
+	mux.HandleFunc("/admin/dlq", adminMiddleware(handlers.ListDeadLettersHandler))
+	mux.HandleFunc("/admin/dlq/redrive", adminMiddleware(handlers.RedriveDeadLettersHandler))
+	mux.HandleFunc("/admin/dlq/purge", adminMiddleware(handlers.PurgeDeadLettersHandler))
 
 	// Metrics endpoint (internal only)
 	mux.Handle("/metrics", internalOnlyMiddleware(promhttp.Handler()))
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amillerrr/hls-pipeline/internal/storage"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// VerifyConcurrency is how many stored files are checked at once.
+const VerifyConcurrency = 16
+
+// VerifyRequest selects the output version to verify, by default the one
+// being served. A deep check downloads every file and compares its content
+// hash instead of trusting the stored checksum.
+type VerifyRequest struct {
+	Version *int `json:"version,omitempty"`
+	Deep    bool `json:"deep,omitempty"`
+}
+
+// VerifyResponse reports how an output version's stored files compare to
+// its manifest.
+type VerifyResponse struct {
+	VideoID  string                    `json:"videoId"`
+	Version  int                       `json:"version"`
+	Deep     bool                      `json:"deep"`
+	Files    int                       `json:"files"`
+	Bytes    int64                     `json:"bytes"`
+	Verified bool                      `json:"verified"`
+	Problems []storage.ManifestProblem `json:"problems"`
+}
+
+// VerifyVideoHandler checks a published output version of a video against
+// its manifest.
+func (h *Handlers) VerifyVideoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	videoID := r.PathValue("id")
+	if videoID == "" {
+		h.writeError(ctx, w, http.StatusBadRequest, "video id is required")
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	// The body is optional
+	var req VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(ctx, w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Version != nil && *req.Version < 0 {
+		h.writeError(ctx, w, http.StatusBadRequest, "version must not be negative")
+		return
+	}
+
+	if h.videos == nil || h.objects == nil {
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "verify-video",
+		trace.WithAttributes(
+			attribute.String("video.id", videoID),
+			attribute.Bool("verify.deep", req.Deep),
+		))
+	defer span.End()
+
+	resp, err := h.verifyVideo(ctx, videoID, req)
+	if err == nil {
+		span.SetAttributes(attribute.Int("verify.problems", len(resp.Problems)))
+		h.writeJSON(ctx, w, http.StatusOK, resp)
+		return
+	}
+
+	switch {
+	case errors.Is(err, models.ErrVideoNotFound):
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+	case errors.Is(err, models.ErrVersionNotFound):
+		h.writeError(ctx, w, http.StatusNotFound, "Version not published")
+	case errors.Is(err, models.ErrManifestNotFound):
+		h.writeError(ctx, w, http.StatusNotFound, "Version has no manifest")
+	default:
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to verify video", "videoId", videoID, "error", err)
+		h.writeStorageError(ctx, w, err, "Failed to verify video")
+	}
+}
+
+// verifyVideo checks the requested output version of a video against its
+// manifest.
+func (h *Handlers) verifyVideo(ctx context.Context, videoID string, req VerifyRequest) (*VerifyResponse, error) {
+	video, err := h.videos.GetVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	version := video.CurrentVersion
+	if req.Version != nil {
+		version = *req.Version
+	}
+	if video.FindVersion(version) == nil {
+		return nil, fmt.Errorf("%w: version %d", models.ErrVersionNotFound, version)
+	}
+
+	bucket := h.cfg.AWS.ProcessedBucket
+	prefix := models.HLSPrefix(videoID, version)
+	manifest, err := storage.ReadManifest(ctx, h.objects, bucket, prefix)
+	if err != nil {
+		return nil, err
+	}
+	problems, err := storage.VerifyManifest(ctx, h.objects, bucket, prefix, manifest, VerifyConcurrency, req.Deep)
+	if err != nil {
+		return nil, err
+	}
+
+	if problems == nil {
+		problems = []storage.ManifestProblem{}
+	}
+	return &VerifyResponse{
+		VideoID:  videoID,
+		Version:  version,
+		Deep:     req.Deep,
+		Files:    len(manifest.Files),
+		Bytes:    manifest.TotalBytes(),
+		Verified: len(problems) == 0,
+		Problems: problems,
+	}, nil
+}
@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// RollbackRequest selects the output version to restore. Without a version
+// the most recently superseded one is restored.
+type RollbackRequest struct {
+	Version *int `json:"version,omitempty"`
+}
+
+// RollbackResponse reports the output version a video now serves.
+type RollbackResponse struct {
+	VideoID         string `json:"videoId"`
+	Version         int    `json:"version"`
+	PreviousVersion int    `json:"previousVersion"`
+	PlaybackURL     string `json:"playbackUrl"`
+}
+
+// RollbackVideoHandler switches a completed video's playback back to an
+// earlier output version that is still stored.
+func (h *Handlers) RollbackVideoHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if r.Method != http.MethodPost {
+		h.writeError(ctx, w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	videoID := r.PathValue("id")
+	if videoID == "" {
+		h.writeError(ctx, w, http.StatusBadRequest, "video id is required")
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	// The body is optional
+	var req RollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(ctx, w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+	if req.Version != nil && *req.Version < 0 {
+		h.writeError(ctx, w, http.StatusBadRequest, "version must not be negative")
+		return
+	}
+
+	if h.videos == nil {
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+		return
+	}
+	if h.cfg.AWS.CDNDomain == "" {
+		h.writeError(ctx, w, http.StatusNotImplemented, "CDN_DOMAIN not configured")
+		return
+	}
+
+	ctx, span := tracer.Start(ctx, "rollback-video",
+		trace.WithAttributes(attribute.String("video.id", videoID)))
+	defer span.End()
+
+	resp, err := h.rollbackVideo(ctx, videoID, req.Version)
+	if err == nil {
+		h.writeJSON(ctx, w, http.StatusOK, resp)
+		return
+	}
+
+	switch {
+	case errors.Is(err, models.ErrVideoNotFound):
+		h.writeError(ctx, w, http.StatusNotFound, "Video not found")
+	case errors.Is(err, models.ErrVersionNotFound):
+		h.writeError(ctx, w, http.StatusNotFound, "No stored version to roll back to")
+	case errors.Is(err, models.ErrInvalidTransition):
+		h.writeError(ctx, w, http.StatusConflict, err.Error())
+	default:
+		span.RecordError(err)
+		h.log.ErrorContext(ctx, "Failed to roll back video", "videoId", videoID, "error", err)
+		h.writeStorageError(ctx, w, err, "Failed to roll back video")
+	}
+}
+
+// rollbackVideo restores the given output version of a video, or the most
+// recently superseded one when version is nil.
+func (h *Handlers) rollbackVideo(ctx context.Context, videoID string, version *int) (*RollbackResponse, error) {
+	video, err := h.videos.GetVideo(ctx, videoID)
+	if err != nil {
+		return nil, err
+	}
+
+	target := video.PreviousVersion()
+	if version != nil {
+		target = video.FindVersion(*version)
+	}
+	if target == nil || target.Version == video.CurrentVersion {
+		return nil, models.ErrVersionNotFound
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("video.version", target.Version))
+
+	playbackURL := models.PlaybackURL(h.cfg.AWS.CDNDomain, videoID, target.Version)
+	if err := h.videos.RollbackVideo(ctx, videoID, target.Version, playbackURL); err != nil {
+		return nil, err
+	}
+
+	h.log.InfoContext(ctx, "Video rolled back",
+		"videoId", videoID,
+		"version", target.Version,
+		"previousVersion", video.CurrentVersion,
+	)
+
+	return &RollbackResponse{
+		VideoID:         videoID,
+		Version:         target.Version,
+		PreviousVersion: video.CurrentVersion,
+		PlaybackURL:     playbackURL,
+	}, nil
+}
@@ -312,3 +312,51 @@ func TestJWTService_Middleware(t *testing.T) {
 		}
 	})
 }
+
+func TestRequireRole(t *testing.T) {
+	handler := RequireRole(RoleAdmin)(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   int
+	}{
+		{"no claims", nil, http.StatusForbidden},
+		{"user", &Claims{Username: "user"}, http.StatusForbidden},
+		{"admin", &Claims{Username: "ops", Role: RoleAdmin}, http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/admin/dlq", nil)
+			if tt.claims != nil {
+				req = req.WithContext(SetClaimsInContext(req.Context(), tt.claims))
+			}
+			rr := httptest.NewRecorder()
+
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != tt.want {
+				t.Errorf("handler returned %d, want %d", rr.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWTService_GenerateAdminToken(t *testing.T) {
+	svc, _ := NewJWTService([]byte("test-secret-that-is-long-enough-for-testing"))
+
+	token, err := svc.GenerateAdminToken("ops")
+	if err != nil {
+		t.Fatalf("GenerateAdminToken() error = %v", err)
+	}
+	claims, err := svc.ValidateToken(token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error = %v", err)
+	}
+	if claims.Role != RoleAdmin {
+		t.Errorf("claims.Role = %q, want %q", claims.Role, RoleAdmin)
+	}
+}
@@ -17,6 +17,9 @@ const (
 	TokenExpiration = 24 * time.Hour
 )
 
+// RoleAdmin is the role of tokens issued for the admin credentials.
+const RoleAdmin = "admin"
+
 // Errors
 var (
 	ErrMissingSecret     = errors.New("JWT secret is not configured")
@@ -30,6 +33,7 @@ var (
 // Claims represents the JWT claims structure.
 type Claims struct {
 	Username string `json:"username"`
+	Role     string `json:"role,omitempty"`
 	jwt.RegisteredClaims
 }
 
@@ -52,6 +56,15 @@ func NewJWTService(secret []byte) (*JWTService, error) {
 
 // GenerateToken creates a new JWT token for the given username.
 func (s *JWTService) GenerateToken(username string) (string, error) {
+	return s.generateToken(username, "")
+}
+
+// GenerateAdminToken creates a new JWT token with the admin role.
+func (s *JWTService) GenerateAdminToken(username string) (string, error) {
+	return s.generateToken(username, RoleAdmin)
+}
+
+func (s *JWTService) generateToken(username, role string) (string, error) {
 	if username == "" {
 		return "", ErrEmptyUsername
 	}
@@ -61,6 +74,7 @@ func (s *JWTService) GenerateToken(username string) (string, error) {
 
 	claims := &Claims{
 		Username: username,
+		Role:     role,
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(now),
@@ -184,3 +198,18 @@ func (s *JWTService) Middleware(rateLimiter *RateLimiter) func(http.HandlerFunc)
 		}
 	}
 }
+
+// RequireRole creates an HTTP middleware that allows only requests whose
+// claims, set by Middleware, carry role.
+func RequireRole(role string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := GetClaimsFromContext(r.Context())
+			if !ok || claims.Role != role {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+	}
+}
@@ -14,6 +14,9 @@ type Config struct {
 	AWS            AWSConfig
 	API            APIConfig
 	Worker         WorkerConfig
+	Queue          QueueConfig
+	Storage        StorageConfig
+	Database       DatabaseConfig
 	Observability  ObservabilityConfig
 	CORS           CORSConfig
 }
@@ -26,6 +29,9 @@ type AWSConfig struct {
 	SQSQueueURL     string
 	DynamoDBTable   string
 	CDNDomain       string
+
+	// DynamoDB-compatible endpoint, such as DynamoDB Local, used instead of AWS
+	DynamoDBEndpoint string
 }
 
 // APIConfig holds API server configuration.
@@ -34,12 +40,104 @@ type APIConfig struct {
 	Username  string
 	Password  string
 	JWTSecret string
+
+	// Admin credentials log in with access to the /admin endpoints. The
+	// endpoints are closed when they are unset.
+	AdminUsername string
+	AdminPassword string
 }
 
 // WorkerConfig holds worker-specific configuration.
 type WorkerConfig struct {
+	ID                string
 	MaxConcurrentJobs int
 	MetricsPort       int
+	Deinterlacer      string
+	AnalysisEnabled   bool
+	PreviewEnabled    bool
+	MaxReceiveCount   int
+
+	// Seconds running jobs may finish after SIGTERM before being requeued
+	DrainTimeoutSeconds int
+
+	// Input limits enforced before transcoding
+	MaxInputDurationSeconds int
+	MaxInputWidth           int
+	MaxInputHeight          int
+
+	// Superseded output versions kept for rollback; older ones are deleted
+	// once superseded for longer than the retention period
+	KeepVersions          int
+	VersionRetentionHours int
+
+	// Save finished stages so a retried job resumes instead of restarting
+	CheckpointsEnabled bool
+
+	// How FFmpeg reads the raw upload: "download" copies it to local disk
+	// first, "stream" reads it from S3 through a presigned URL or stdin
+	IngestMode string
+
+	// S3 transfers: large files move in parts of TransferPartSizeMB with
+	// PartConcurrency parts in flight, and UploadConcurrency files are
+	// uploaded at once. Outputs of at least MultipartThresholdMB are
+	// uploaded in parts. Zero selects the default.
+	TransferPartSizeMB   int
+	PartConcurrency      int
+	UploadConcurrency    int
+	MultipartThresholdMB int
+
+	// Free disk space left untouched when admitting jobs
+	MinFreeDiskMB int
+
+	// Per-job FFmpeg limits. FFmpegThreads caps each process's threads and
+	// FFmpegNice lowers its priority; 0 leaves either unset. With a cgroup
+	// v2 parent the worker can write to, each job runs in its own group
+	// capped at FFmpegCPUMillicores and FFmpegMemoryMB, 0 being unlimited.
+	FFmpegThreads       int
+	FFmpegNice          int
+	FFmpegCgroupParent  string
+	FFmpegCPUMillicores int
+	FFmpegMemoryMB      int
+
+	// Attempt time limit for stages without their own. Zero selects the default.
+	StageTimeoutSeconds int
+}
+
+// QueueConfig holds job queue configuration.
+type QueueConfig struct {
+	Backend string
+	Dir     string
+
+	// Priority lanes. Only lanes with a weight are used; SQS lanes other
+	// than normal also need a queue URL.
+	LaneWeights map[string]int
+	LaneURLs    map[string]string
+
+	// SQS dead-letter queue, for inspection and redrive
+	DeadLetterURL string
+}
+
+// StorageConfig holds object storage configuration.
+type StorageConfig struct {
+	Backend string
+
+	// S3-compatible endpoint, such as MinIO or LocalStack, used instead of AWS
+	S3Endpoint string
+
+	// The local backend keeps objects under Dir and serves presigned URLs,
+	// signed with SigningSecret, from the API at URL
+	Dir           string
+	URL           string
+	SigningSecret string
+}
+
+// DatabaseConfig holds video metadata store configuration.
+type DatabaseConfig struct {
+	Backend string
+
+	// Connection string of the sqlite and postgres backends; a file path
+	// for SQLite
+	URL string
 }
 
 // ObservabilityConfig holds observability configuration.
@@ -59,6 +157,35 @@ const (
 	DefaultMaxConcurrentJobs = 1
 	DefaultOTLPEndpoint      = "localhost:4317"
 	DefaultRegion            = "us-west-2"
+	DefaultDeinterlacer      = "bwdif"
+	DefaultQueueBackend      = "sqs"
+	DefaultQueueDir          = "/tmp/hls-queue"
+	DefaultStorageBackend    = "s3"
+	DefaultStorageDir        = "/tmp/hls-storage"
+	DefaultStorageURL        = "http://localhost:8080"
+	DefaultDatabaseBackend   = "dynamodb"
+	DefaultMaxReceiveCount   = 3  // Matches the queue's redrive policy
+	DefaultDrainTimeout      = 25 // Seconds; keep below the ECS stopTimeout (30s default)
+	DefaultLaneWeights       = "high=6,normal=3,bulk=1"
+	DefaultIngestMode        = "download"
+
+	DefaultTransferPartSizeMB   = 16
+	DefaultPartConcurrency      = 8
+	DefaultUploadConcurrency    = 20
+	DefaultMultipartThresholdMB = 64
+	MinTransferPartSizeMB       = 5 // Smallest part S3 accepts in a multipart upload
+
+	DefaultMinFreeDiskMB = 1024
+
+	DefaultStageTimeoutSeconds = 4 * 60 * 60 // Matches the longest accepted input
+	MaxFFmpegNice              = 19
+
+	DefaultMaxInputDurationSeconds = 4 * 60 * 60 // 4 hours
+	DefaultMaxInputWidth           = 7680
+	DefaultMaxInputHeight          = 4320
+
+	DefaultKeepVersions          = 2
+	DefaultVersionRetentionHours = 7 * 24
 )
 
 // Load reads configuration from environment variables and returns a validated Config.
@@ -72,16 +199,75 @@ func Load() (*Config, error) {
 			SQSQueueURL:     os.Getenv("SQS_QUEUE_URL"),
 			DynamoDBTable:   os.Getenv("DYNAMODB_TABLE"),
 			CDNDomain:       os.Getenv("CDN_DOMAIN"),
+
+			DynamoDBEndpoint: os.Getenv("DYNAMODB_ENDPOINT"),
 		},
 		API: APIConfig{
 			Port:      getEnv("PORT", DefaultPort),
 			Username:  os.Getenv("API_USERNAME"),
 			Password:  os.Getenv("API_PASSWORD"),
 			JWTSecret: os.Getenv("JWT_SECRET"),
+
+			AdminUsername: os.Getenv("API_ADMIN_USERNAME"),
+			AdminPassword: os.Getenv("API_ADMIN_PASSWORD"),
 		},
 		Worker: WorkerConfig{
+			ID:                getEnv("WORKER_ID", defaultWorkerID()),
 			MaxConcurrentJobs: getEnvInt("MAX_CONCURRENT_JOBS", DefaultMaxConcurrentJobs),
 			MetricsPort:       getEnvInt("METRICS_PORT", DefaultMetricsPort),
+			Deinterlacer:      getEnv("DEINTERLACE_FILTER", DefaultDeinterlacer),
+			AnalysisEnabled:   getEnvBool("ANALYSIS_ENABLED", true),
+			PreviewEnabled:    getEnvBool("PREVIEW_ENABLED", false),
+			MaxReceiveCount:   getEnvInt("MAX_RECEIVE_COUNT", DefaultMaxReceiveCount),
+
+			DrainTimeoutSeconds: getEnvInt("DRAIN_TIMEOUT_SECONDS", DefaultDrainTimeout),
+
+			MaxInputDurationSeconds: getEnvInt("MAX_INPUT_DURATION_SECONDS", DefaultMaxInputDurationSeconds),
+			MaxInputWidth:           getEnvInt("MAX_INPUT_WIDTH", DefaultMaxInputWidth),
+			MaxInputHeight:          getEnvInt("MAX_INPUT_HEIGHT", DefaultMaxInputHeight),
+
+			KeepVersions:          getEnvCount("KEEP_VERSIONS", DefaultKeepVersions),
+			VersionRetentionHours: getEnvCount("VERSION_RETENTION_HOURS", DefaultVersionRetentionHours),
+
+			CheckpointsEnabled: getEnvBool("CHECKPOINTS_ENABLED", true),
+
+			IngestMode: getEnv("INGEST_MODE", DefaultIngestMode),
+
+			TransferPartSizeMB:   getEnvInt("TRANSFER_PART_SIZE_MB", DefaultTransferPartSizeMB),
+			PartConcurrency:      getEnvInt("TRANSFER_PART_CONCURRENCY", DefaultPartConcurrency),
+			UploadConcurrency:    getEnvInt("UPLOAD_CONCURRENCY", DefaultUploadConcurrency),
+			MultipartThresholdMB: getEnvInt("MULTIPART_THRESHOLD_MB", DefaultMultipartThresholdMB),
+
+			MinFreeDiskMB: getEnvInt("MIN_FREE_DISK_MB", DefaultMinFreeDiskMB),
+
+			FFmpegThreads:       getEnvInt("FFMPEG_THREADS", 0),
+			FFmpegNice:          getEnvInt("FFMPEG_NICE", 0),
+			FFmpegCgroupParent:  os.Getenv("FFMPEG_CGROUP_PARENT"),
+			FFmpegCPUMillicores: getEnvInt("FFMPEG_CPU_MILLICORES", 0),
+			FFmpegMemoryMB:      getEnvInt("FFMPEG_MEMORY_MB", 0),
+
+			StageTimeoutSeconds: getEnvInt("STAGE_TIMEOUT_SECONDS", DefaultStageTimeoutSeconds),
+		},
+		Queue: QueueConfig{
+			Backend:     getEnv("QUEUE_BACKEND", DefaultQueueBackend),
+			Dir:         getEnv("QUEUE_DIR", DefaultQueueDir),
+			LaneWeights: parseWeights(getEnv("QUEUE_LANE_WEIGHTS", DefaultLaneWeights)),
+			LaneURLs: map[string]string{
+				"high": os.Getenv("SQS_QUEUE_URL_HIGH"),
+				"bulk": os.Getenv("SQS_QUEUE_URL_BULK"),
+			},
+			DeadLetterURL: os.Getenv("SQS_DLQ_URL"),
+		},
+		Storage: StorageConfig{
+			Backend:       getEnv("STORAGE_BACKEND", DefaultStorageBackend),
+			S3Endpoint:    os.Getenv("S3_ENDPOINT"),
+			Dir:           getEnv("STORAGE_DIR", DefaultStorageDir),
+			URL:           getEnv("STORAGE_URL", DefaultStorageURL),
+			SigningSecret: os.Getenv("STORAGE_SIGNING_SECRET"),
+		},
+		Database: DatabaseConfig{
+			Backend: getEnv("DATABASE_BACKEND", DefaultDatabaseBackend),
+			URL:     os.Getenv("DATABASE_URL"),
 		},
 		Observability: ObservabilityConfig{
 			OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", DefaultOTLPEndpoint),
@@ -132,11 +318,12 @@ func (c *Config) ValidateAPI() error {
 	if c.AWS.RawBucket == "" {
 		errs = append(errs, "S3_BUCKET is required")
 	}
-	if c.AWS.SQSQueueURL == "" {
-		errs = append(errs, "SQS_QUEUE_URL is required")
-	}
-	if c.AWS.DynamoDBTable == "" {
-		errs = append(errs, "DYNAMODB_TABLE is required")
+	errs = append(errs, c.validateQueue()...)
+	errs = append(errs, c.validateStorage()...)
+	errs = append(errs, c.validateDatabase()...)
+
+	if (c.API.AdminUsername == "") != (c.API.AdminPassword == "") {
+		errs = append(errs, "API_ADMIN_USERNAME and API_ADMIN_PASSWORD must be set together")
 	}
 
 	// In production, require explicit credentials
@@ -172,14 +359,44 @@ func (c *Config) ValidateWorker() error {
 	if c.AWS.ProcessedBucket == "" {
 		errs = append(errs, "PROCESSED_BUCKET is required")
 	}
-	if c.AWS.SQSQueueURL == "" {
-		errs = append(errs, "SQS_QUEUE_URL is required")
-	}
+	errs = append(errs, c.validateQueue()...)
+	errs = append(errs, c.validateStorage()...)
+	errs = append(errs, c.validateDatabase()...)
 	if c.AWS.CDNDomain == "" {
 		errs = append(errs, "CDN_DOMAIN is required")
 	}
-	if c.AWS.DynamoDBTable == "" {
-		errs = append(errs, "DYNAMODB_TABLE is required")
+	if d := c.Worker.Deinterlacer; d != "" && d != "bwdif" && d != "yadif" {
+		errs = append(errs, "DEINTERLACE_FILTER must be bwdif or yadif")
+	}
+	if c.Worker.KeepVersions < 0 {
+		errs = append(errs, "KEEP_VERSIONS must not be negative")
+	}
+	if c.Worker.VersionRetentionHours < 0 {
+		errs = append(errs, "VERSION_RETENTION_HOURS must not be negative")
+	}
+	if m := c.Worker.IngestMode; m != "" && m != "download" && m != "stream" {
+		errs = append(errs, "INGEST_MODE must be download or stream")
+	}
+	if p := c.Worker.TransferPartSizeMB; p != 0 && p < MinTransferPartSizeMB {
+		errs = append(errs, fmt.Sprintf("TRANSFER_PART_SIZE_MB must be at least %d", MinTransferPartSizeMB))
+	}
+	if c.Worker.PartConcurrency < 0 || c.Worker.UploadConcurrency < 0 || c.Worker.MultipartThresholdMB < 0 {
+		errs = append(errs, "TRANSFER_PART_CONCURRENCY, UPLOAD_CONCURRENCY and MULTIPART_THRESHOLD_MB must not be negative")
+	}
+	if c.Worker.MinFreeDiskMB < 0 {
+		errs = append(errs, "MIN_FREE_DISK_MB must not be negative")
+	}
+	if c.Worker.FFmpegThreads < 0 || c.Worker.FFmpegCPUMillicores < 0 || c.Worker.FFmpegMemoryMB < 0 {
+		errs = append(errs, "FFMPEG_THREADS, FFMPEG_CPU_MILLICORES and FFMPEG_MEMORY_MB must not be negative")
+	}
+	if n := c.Worker.FFmpegNice; n < 0 || n > MaxFFmpegNice {
+		errs = append(errs, fmt.Sprintf("FFMPEG_NICE must be between 0 and %d", MaxFFmpegNice))
+	}
+	if (c.Worker.FFmpegCPUMillicores > 0 || c.Worker.FFmpegMemoryMB > 0) && c.Worker.FFmpegCgroupParent == "" {
+		errs = append(errs, "FFMPEG_CPU_MILLICORES and FFMPEG_MEMORY_MB require FFMPEG_CGROUP_PARENT")
+	}
+	if c.Worker.StageTimeoutSeconds < 0 {
+		errs = append(errs, "STAGE_TIMEOUT_SECONDS must not be negative")
 	}
 
 	if len(errs) > 0 {
@@ -189,6 +406,83 @@ func (c *Config) ValidateWorker() error {
 	return nil
 }
 
+// validateQueue validates the selected queue backend.
+func (c *Config) validateQueue() []string {
+	switch c.Queue.Backend {
+	case "sqs", "":
+		if c.AWS.SQSQueueURL == "" {
+			return []string{"SQS_QUEUE_URL is required"}
+		}
+	case "file":
+		if c.Queue.Dir == "" {
+			return []string{"QUEUE_DIR is required for the file queue backend"}
+		}
+	case "memory":
+	default:
+		return []string{"QUEUE_BACKEND must be sqs, file or memory"}
+	}
+
+	var errs []string
+	if c.Queue.LaneWeights != nil {
+		if _, ok := c.Queue.LaneWeights["normal"]; !ok {
+			errs = append(errs, "QUEUE_LANE_WEIGHTS must include the normal lane")
+		}
+		for lane, weight := range c.Queue.LaneWeights {
+			if !isLane(lane) {
+				errs = append(errs, fmt.Sprintf("QUEUE_LANE_WEIGHTS has unknown lane %q", lane))
+			} else if weight < 1 {
+				errs = append(errs, fmt.Sprintf("QUEUE_LANE_WEIGHTS weight for %s must be a positive integer", lane))
+			}
+		}
+	}
+	return errs
+}
+
+// validateStorage validates the selected object storage backend.
+func (c *Config) validateStorage() []string {
+	switch c.Storage.Backend {
+	case "s3", "":
+		return nil
+	case "local":
+		var errs []string
+		if c.Storage.Dir == "" {
+			errs = append(errs, "STORAGE_DIR is required for the local storage backend")
+		}
+		if c.Storage.URL == "" {
+			errs = append(errs, "STORAGE_URL is required for the local storage backend")
+		}
+		if c.Storage.SigningSecret == "" {
+			errs = append(errs, "STORAGE_SIGNING_SECRET is required for the local storage backend")
+		}
+		return errs
+	default:
+		return []string{"STORAGE_BACKEND must be s3 or local"}
+	}
+}
+
+// validateDatabase validates the selected video metadata store.
+func (c *Config) validateDatabase() []string {
+	switch c.Database.Backend {
+	case "dynamodb", "":
+		if c.AWS.DynamoDBTable == "" {
+			return []string{"DYNAMODB_TABLE is required"}
+		}
+		return nil
+	case "sqlite", "postgres":
+		if c.Database.URL == "" {
+			return []string{"DATABASE_URL is required for the " + c.Database.Backend + " database backend"}
+		}
+		return nil
+	default:
+		return []string{"DATABASE_BACKEND must be dynamodb, sqlite or postgres"}
+	}
+}
+
+// isLane reports whether name is a supported queue lane.
+func isLane(name string) bool {
+	return name == "high" || name == "normal" || name == "bulk"
+}
+
 // IsProduction returns true if running in production environment.
 func (c *Config) IsProduction() bool {
 	env := strings.ToLower(c.Environment)
@@ -239,6 +533,15 @@ func getEnv(key, defaultValue string) string {
 	return defaultValue
 }
 
+// defaultWorkerID identifies this process by host name and PID.
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "worker"
+	}
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
 func getEnvInt(key string, defaultValue int) int {
 	if value := os.Getenv(key); value != "" {
 		if intVal, err := strconv.Atoi(value); err == nil && intVal > 0 {
@@ -248,6 +551,53 @@ func getEnvInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// getEnvCount is getEnvInt for settings where 0 is meaningful. Negative
+// values are returned as they are, for validation to reject.
+func getEnvCount(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if intVal, err := strconv.Atoi(value); err == nil {
+			return intVal
+		}
+	}
+	return defaultValue
+}
+
+func getEnvBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolVal, err := strconv.ParseBool(value); err == nil {
+			return boolVal
+		}
+	}
+	return defaultValue
+}
+
+// parsePairs parses a comma-separated list of key=value pairs, skipping
+// entries without a key.
+func parsePairs(value string) map[string]string {
+	pairs := make(map[string]string)
+	for _, part := range strings.Split(value, ",") {
+		key, val, _ := strings.Cut(part, "=")
+		if key = strings.TrimSpace(key); key != "" {
+			pairs[key] = strings.TrimSpace(val)
+		}
+	}
+	return pairs
+}
+
+// parseWeights parses key=weight pairs. Invalid weights are kept as 0 so
+// validation can report them.
+func parseWeights(value string) map[string]int {
+	weights := make(map[string]int)
+	for key, val := range parsePairs(value) {
+		weight, err := strconv.Atoi(val)
+		if err != nil {
+			weight = 0
+		}
+		weights[key] = weight
+	}
+	return weights
+}
+
 func getEnvSlice(key string, defaultValue []string) []string {
 	if value := os.Getenv(key); value != "" {
 		parts := strings.Split(value, ",")
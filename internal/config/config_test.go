@@ -89,6 +89,329 @@ func TestValidateWorker_AllPresent(t *testing.T) {
 	}
 }
 
+func TestValidateWorker_QueueBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		queue   QueueConfig
+		sqsURL  string
+		wantErr bool
+	}{
+		{"sqs with url", QueueConfig{Backend: "sqs"}, "url", false},
+		{"sqs without url", QueueConfig{Backend: "sqs"}, "", true},
+		{"file without sqs url", QueueConfig{Backend: "file", Dir: "/tmp/q"}, "", false},
+		{"file without dir", QueueConfig{Backend: "file"}, "", true},
+		{"memory", QueueConfig{Backend: "memory"}, "", false},
+		{"unknown", QueueConfig{Backend: "kafka"}, "url", true},
+		{"lane weights", QueueConfig{Backend: "memory", LaneWeights: map[string]int{"high": 6, "normal": 3, "bulk": 1}}, "", false},
+		{"lanes without normal", QueueConfig{Backend: "memory", LaneWeights: map[string]int{"high": 1}}, "", true},
+		{"unknown lane", QueueConfig{Backend: "memory", LaneWeights: map[string]int{"normal": 1, "urgent": 2}}, "", true},
+		{"invalid weight", QueueConfig{Backend: "memory", LaneWeights: map[string]int{"normal": 0}}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Environment: "dev",
+				AWS: AWSConfig{
+					RawBucket:       "raw",
+					ProcessedBucket: "processed",
+					SQSQueueURL:     tt.sqsURL,
+					CDNDomain:       "cdn.test",
+					DynamoDBTable:   "table",
+				},
+				Queue: tt.queue,
+			}
+			err := cfg.ValidateWorker()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWorker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWorker_StorageBackend(t *testing.T) {
+	tests := []struct {
+		name    string
+		storage StorageConfig
+		wantErr bool
+	}{
+		{"default", StorageConfig{}, false},
+		{"s3 with endpoint", StorageConfig{Backend: "s3", S3Endpoint: "http://localhost:9000"}, false},
+		{"local", StorageConfig{Backend: "local", Dir: "/tmp/s", URL: "http://localhost:8080", SigningSecret: "secret"}, false},
+		{"local without secret", StorageConfig{Backend: "local", Dir: "/tmp/s", URL: "http://localhost:8080"}, true},
+		{"local without dir", StorageConfig{Backend: "local", URL: "http://localhost:8080", SigningSecret: "secret"}, true},
+		{"unknown", StorageConfig{Backend: "gcs"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Environment: "dev",
+				AWS: AWSConfig{
+					RawBucket:       "raw",
+					ProcessedBucket: "processed",
+					SQSQueueURL:     "url",
+					CDNDomain:       "cdn.test",
+					DynamoDBTable:   "table",
+				},
+				Storage: tt.storage,
+			}
+			err := cfg.ValidateWorker()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWorker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAPI_DatabaseBackend(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    string
+		database DatabaseConfig
+		wantErr  bool
+	}{
+		{"default", "table", DatabaseConfig{}, false},
+		{"dynamodb without table", "", DatabaseConfig{Backend: "dynamodb"}, true},
+		{"sqlite", "", DatabaseConfig{Backend: "sqlite", URL: "/tmp/videos.db"}, false},
+		{"sqlite without url", "", DatabaseConfig{Backend: "sqlite"}, true},
+		{"postgres", "", DatabaseConfig{Backend: "postgres", URL: "postgres://localhost/hls"}, false},
+		{"unknown", "table", DatabaseConfig{Backend: "mysql", URL: "url"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Environment: "dev",
+				AWS: AWSConfig{
+					RawBucket:     "raw",
+					SQSQueueURL:   "url",
+					DynamoDBTable: tt.table,
+				},
+				Database: tt.database,
+			}
+			err := cfg.ValidateAPI()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateAPI_AdminCredentials(t *testing.T) {
+	tests := []struct {
+		name    string
+		api     APIConfig
+		wantErr bool
+	}{
+		{"none", APIConfig{}, false},
+		{"both", APIConfig{AdminUsername: "ops", AdminPassword: "secret"}, false},
+		{"username only", APIConfig{AdminUsername: "ops"}, true},
+		{"password only", APIConfig{AdminPassword: "secret"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Environment: "dev",
+				AWS: AWSConfig{
+					RawBucket:     "raw",
+					SQSQueueURL:   "url",
+					DynamoDBTable: "table",
+				},
+				API: tt.api,
+			}
+			err := cfg.ValidateAPI()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAPI() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWorker_VersionRetention(t *testing.T) {
+	tests := []struct {
+		name    string
+		keep    int
+		hours   int
+		wantErr bool
+	}{
+		{"defaults", DefaultKeepVersions, DefaultVersionRetentionHours, false},
+		{"keep none", 0, 0, false},
+		{"negative keep", -1, 24, true},
+		{"negative retention", 2, -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Environment: "dev",
+				AWS: AWSConfig{
+					RawBucket:       "raw",
+					ProcessedBucket: "processed",
+					SQSQueueURL:     "url",
+					CDNDomain:       "cdn.test",
+					DynamoDBTable:   "table",
+				},
+				Worker: WorkerConfig{KeepVersions: tt.keep, VersionRetentionHours: tt.hours},
+			}
+			err := cfg.ValidateWorker()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWorker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoad_VersionRetention(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int
+		wantErr bool
+	}{
+		{"", DefaultKeepVersions, false},
+		{"0", 0, false},
+		{"-1", -1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run("KEEP_VERSIONS="+tt.value, func(t *testing.T) {
+			t.Setenv("S3_BUCKET", "raw")
+			t.Setenv("PROCESSED_BUCKET", "processed")
+			t.Setenv("SQS_QUEUE_URL", "url")
+			t.Setenv("DYNAMODB_TABLE", "table")
+			t.Setenv("CDN_DOMAIN", "cdn.test")
+			t.Setenv("KEEP_VERSIONS", tt.value)
+			t.Setenv("VERSION_RETENTION_HOURS", tt.value)
+
+			cfg, err := Load()
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			wantHours := tt.want
+			if tt.value == "" {
+				wantHours = DefaultVersionRetentionHours
+			}
+			if cfg.Worker.KeepVersions != tt.want || cfg.Worker.VersionRetentionHours != wantHours {
+				t.Errorf("KeepVersions = %d, VersionRetentionHours = %d, want %d and %d",
+					cfg.Worker.KeepVersions, cfg.Worker.VersionRetentionHours, tt.want, wantHours)
+			}
+			if err := cfg.ValidateWorker(); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWorker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWorker_IngestMode(t *testing.T) {
+	for mode, wantErr := range map[string]bool{"": false, "download": false, "stream": false, "mount": true} {
+		cfg := &Config{
+			Environment: "dev",
+			AWS: AWSConfig{
+				RawBucket:       "raw",
+				ProcessedBucket: "processed",
+				SQSQueueURL:     "url",
+				CDNDomain:       "cdn.test",
+				DynamoDBTable:   "table",
+			},
+			Worker: WorkerConfig{IngestMode: mode},
+		}
+		err := cfg.ValidateWorker()
+		if (err != nil) != wantErr {
+			t.Errorf("ValidateWorker() with INGEST_MODE=%q error = %v, wantErr %v", mode, err, wantErr)
+		}
+	}
+}
+
+func TestValidateWorker_Transfers(t *testing.T) {
+	tests := []struct {
+		name    string
+		worker  WorkerConfig
+		wantErr bool
+	}{
+		{"unset", WorkerConfig{}, false},
+		{"defaults", WorkerConfig{
+			TransferPartSizeMB:   DefaultTransferPartSizeMB,
+			PartConcurrency:      DefaultPartConcurrency,
+			UploadConcurrency:    DefaultUploadConcurrency,
+			MultipartThresholdMB: DefaultMultipartThresholdMB,
+		}, false},
+		{"part too small", WorkerConfig{TransferPartSizeMB: 1}, true},
+		{"negative concurrency", WorkerConfig{PartConcurrency: -1}, true},
+		{"negative threshold", WorkerConfig{MultipartThresholdMB: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Environment: "dev",
+				AWS: AWSConfig{
+					RawBucket:       "raw",
+					ProcessedBucket: "processed",
+					SQSQueueURL:     "url",
+					CDNDomain:       "cdn.test",
+					DynamoDBTable:   "table",
+				},
+				Worker: tt.worker,
+			}
+			err := cfg.ValidateWorker()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWorker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateWorker_ProcessLimits(t *testing.T) {
+	tests := []struct {
+		name    string
+		worker  WorkerConfig
+		wantErr bool
+	}{
+		{"unset", WorkerConfig{}, false},
+		{"threads and nice", WorkerConfig{FFmpegThreads: 4, FFmpegNice: 10}, false},
+		{"cgroup caps", WorkerConfig{FFmpegCgroupParent: "/sys/fs/cgroup/worker", FFmpegCPUMillicores: 2000, FFmpegMemoryMB: 4096}, false},
+		{"negative threads", WorkerConfig{FFmpegThreads: -1}, true},
+		{"nice too high", WorkerConfig{FFmpegNice: 20}, true},
+		{"negative nice", WorkerConfig{FFmpegNice: -5}, true},
+		{"caps without cgroup", WorkerConfig{FFmpegMemoryMB: 4096}, true},
+		{"negative stage timeout", WorkerConfig{StageTimeoutSeconds: -1}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Environment: "dev",
+				AWS: AWSConfig{
+					RawBucket:       "raw",
+					ProcessedBucket: "processed",
+					SQSQueueURL:     "url",
+					CDNDomain:       "cdn.test",
+					DynamoDBTable:   "table",
+				},
+				Worker: tt.worker,
+			}
+			err := cfg.ValidateWorker()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateWorker() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseWeights(t *testing.T) {
+	got := parseWeights("high=6, normal = 3,bulk=x,=2")
+	want := map[string]int{"high": 6, "normal": 3, "bulk": 0}
+	if len(got) != len(want) {
+		t.Fatalf("parseWeights() = %v, want %v", got, want)
+	}
+	for lane, weight := range want {
+		if got[lane] != weight {
+			t.Errorf("parseWeights()[%q] = %d, want %d", lane, got[lane], weight)
+		}
+	}
+}
+
 func TestIsProduction(t *testing.T) {
 	tests := []struct {
 		env  string
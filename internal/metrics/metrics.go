@@ -17,6 +17,16 @@ var (
 		[]string{"status"},
 	)
 
+	// ProcessingFailures counts failed processing attempts by error class.
+	ProcessingFailures = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hls",
+			Name:      "video_processing_failures_total",
+			Help:      "Total number of failed processing attempts by error class",
+		},
+		[]string{"class"},
+	)
+
 	// ProcessingDuration tracks the time taken to process videos.
 	ProcessingDuration = promauto.NewHistogramVec(
 		prometheus.HistogramOpts{
@@ -67,6 +77,128 @@ var (
 		},
 	)
 
+	// DownloadThroughput tracks the transfer rate of source downloads.
+	DownloadThroughput = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "hls",
+			Name:      "video_download_throughput_bytes_per_second",
+			Help:      "Transfer rate of source downloads from S3",
+			Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 11), // 1 MiB/s to 1 GiB/s
+		},
+	)
+
+	// UploadThroughput tracks the transfer rate of output uploads.
+	UploadThroughput = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "hls",
+			Name:      "video_upload_throughput_bytes_per_second",
+			Help:      "Transfer rate of output uploads to S3",
+			Buckets:   prometheus.ExponentialBuckets(1<<20, 2, 11), // 1 MiB/s to 1 GiB/s
+		},
+	)
+
+	// DownloadBytes counts the bytes downloaded from S3. Divided by the sum
+	// of DownloadDuration it gives the download throughput.
+	DownloadBytes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "hls",
+			Name:      "video_download_bytes_total",
+			Help:      "Bytes of videos downloaded from S3",
+		},
+	)
+
+	// UploadBytes counts the bytes uploaded to S3. Divided by the sum of
+	// UploadDuration it gives the upload throughput.
+	UploadBytes = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "hls",
+			Name:      "video_upload_bytes_total",
+			Help:      "Bytes of HLS files uploaded to S3",
+		},
+	)
+
+	// JobPeakRSS tracks the largest resident set of any FFmpeg or ffprobe
+	// process of a job.
+	JobPeakRSS = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "hls",
+			Name:      "job_peak_rss_bytes",
+			Help:      "Peak resident memory of a job's largest FFmpeg process",
+			Buckets:   prometheus.ExponentialBuckets(64<<20, 2, 9), // 64 MiB to 16 GiB
+		},
+	)
+
+	// JobCPUTime tracks the CPU time used by all FFmpeg and ffprobe
+	// processes of a job.
+	JobCPUTime = promauto.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: "hls",
+			Name:      "job_cpu_seconds",
+			Help:      "User and system CPU time of a job's FFmpeg processes",
+			Buckets:   prometheus.ExponentialBuckets(10, 3, 9), // 10s to about 18h
+		},
+	)
+
+	// StageDuration tracks the time taken by each pipeline stage by outcome.
+	StageDuration = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: "hls",
+			Name:      "pipeline_stage_duration_seconds",
+			Help:      "Time taken by each processing pipeline stage",
+			Buckets:   []float64{1, 5, 10, 30, 60, 120, 300, 600},
+		},
+		[]string{"stage", "status"},
+	)
+
+	// LeaseExtensions counts successful queue lease extensions for running jobs.
+	LeaseExtensions = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "hls",
+			Name:      "queue_lease_extensions_total",
+			Help:      "Total number of queue message lease extensions",
+		},
+	)
+
+	// LeasesLost counts jobs abandoned because their queue lease was lost.
+	LeasesLost = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: "hls",
+			Name:      "queue_leases_lost_total",
+			Help:      "Total number of jobs whose queue message lease was lost",
+		},
+	)
+
+	// JobsDeferred counts jobs returned to the queue before being claimed
+	// because the worker lacked the resources to run them.
+	JobsDeferred = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hls",
+			Name:      "jobs_deferred_total",
+			Help:      "Total number of jobs deferred by admission control",
+		},
+		[]string{"reason"},
+	)
+
+	// QueueDepth tracks the number of messages waiting in each queue lane.
+	QueueDepth = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Namespace: "hls",
+			Name:      "queue_depth",
+			Help:      "Number of messages waiting in each queue lane",
+		},
+		[]string{"lane"},
+	)
+
+	// QueueMessagesReceived counts messages received from each queue lane.
+	QueueMessagesReceived = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: "hls",
+			Name:      "queue_messages_received_total",
+			Help:      "Total number of messages received by queue lane",
+		},
+		[]string{"lane"},
+	)
+
 	// TranscodeDuration tracks the time taken for FFmpeg transcoding.
 	TranscodeDuration = promauto.NewHistogram(
 		prometheus.HistogramOpts{
@@ -140,9 +272,15 @@ func RecordSuccess() {
 	VideosProcessed.WithLabelValues("success").Inc()
 }
 
-// RecordFailure records a failed video processing.
-func RecordFailure() {
+// RecordFailure records a failed video processing attempt and its error class.
+func RecordFailure(class string) {
 	VideosProcessed.WithLabelValues("failed").Inc()
+	ProcessingFailures.WithLabelValues(class).Inc()
+}
+
+// RecordCancelled records a video whose processing was cancelled.
+func RecordCancelled() {
+	VideosProcessed.WithLabelValues("cancelled").Inc()
 }
 
 // RecordQuality records the SSIM quality score.
@@ -0,0 +1,132 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Dead-letter inspection settings
+const (
+	// inspectLease hides messages from other inspections while a list,
+	// redrive or purge walks the queue.
+	inspectLease = 30 * time.Second
+
+	// inspectBatch is the most messages SQS returns per receive.
+	inspectBatch = 10
+
+	// inspectWait makes SQS query all its servers rather than a sample.
+	inspectWait = time.Second
+)
+
+// DeadLetters gives operators access to a dead-letter queue: listing the
+// messages in it, redriving them to their lanes and purging them.
+type DeadLetters struct {
+	queue    laneBackend
+	target   LanePublisher
+	waitTime time.Duration
+}
+
+// NewDeadLetters creates access to dlq. Redriven messages are published to
+// target.
+func NewDeadLetters(dlq Queue, target LanePublisher) (*DeadLetters, error) {
+	backend, ok := dlq.(laneBackend)
+	if !ok {
+		return nil, fmt.Errorf("dead-letter queue does not support inspection")
+	}
+	return &DeadLetters{queue: backend, target: target, waitTime: inspectWait}, nil
+}
+
+// List returns up to max messages without removing them.
+func (d *DeadLetters) List(ctx context.Context, max int) ([]*Message, error) {
+	var listed []*Message
+	defer func() { d.release(ctx, listed) }()
+
+	for len(listed) < max {
+		batch, err := d.queue.receive(ctx, min(inspectBatch, max-len(listed)), inspectLease, d.waitTime)
+		if err != nil {
+			return listed, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		listed = append(listed, batch...)
+	}
+	return listed, nil
+}
+
+// Redrive publishes the messages with the given IDs, or every message if
+// ids is empty, to the lane chosen by route and removes them from the
+// dead-letter queue. It returns the redriven messages.
+//
+// If prepare is not nil it is called before each message is published, so
+// a consumer never sees the message before its state is ready, and the
+// function it returns, if not nil, undoes that when the publish fails.
+func (d *DeadLetters) Redrive(ctx context.Context, ids []string, route func(*Message) Lane, prepare func(*Message) (undo func())) ([]*Message, error) {
+	return d.each(ctx, ids, func(msg *Message) error {
+		var undo func()
+		if prepare != nil {
+			undo = prepare(msg)
+		}
+		if _, err := d.target.PublishTo(ctx, route(msg), msg.Body); err != nil {
+			if undo != nil {
+				undo()
+			}
+			return err
+		}
+		return nil
+	})
+}
+
+// Purge deletes the messages with the given IDs, or every message if ids is
+// empty. It returns the deleted messages.
+func (d *DeadLetters) Purge(ctx context.Context, ids []string) ([]*Message, error) {
+	return d.each(ctx, ids, func(*Message) error { return nil })
+}
+
+// each walks the queue calling fn on each selected message and deleting it
+// once fn succeeds. Other messages are made visible again afterwards.
+func (d *DeadLetters) each(ctx context.Context, ids []string, fn func(*Message) error) ([]*Message, error) {
+	selected := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		selected[id] = true
+	}
+
+	var done, skipped []*Message
+	defer func() { d.release(ctx, skipped) }()
+
+	for len(ids) == 0 || len(done) < len(ids) {
+		batch, err := d.queue.receive(ctx, inspectBatch, inspectLease, d.waitTime)
+		if err != nil {
+			return done, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		for i, msg := range batch {
+			if len(ids) > 0 && !selected[msg.ID] {
+				skipped = append(skipped, msg)
+				continue
+			}
+			if err := fn(msg); err != nil {
+				skipped = append(skipped, batch[i:]...)
+				return done, fmt.Errorf("message %s: %w", msg.ID, err)
+			}
+			if err := d.queue.Ack(ctx, msg); err != nil {
+				skipped = append(skipped, batch[i+1:]...)
+				return done, fmt.Errorf("message %s: %w", msg.ID, err)
+			}
+			done = append(done, msg)
+		}
+	}
+	return done, nil
+}
+
+// release makes inspected messages visible again.
+func (d *DeadLetters) release(ctx context.Context, messages []*Message) {
+	ctx = context.WithoutCancel(ctx)
+	for _, msg := range messages {
+		_ = d.queue.Nack(ctx, msg, 0)
+	}
+}
@@ -0,0 +1,322 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File queue layout
+const (
+	fileMessageExt   = ".msg"
+	fileTmpDir       = "tmp"
+	filePollInterval = 250 * time.Millisecond
+)
+
+// FileQueue is a durable Queue stored as files in a local directory. It is
+// safe to share between processes on the same host.
+//
+// Each message is one file named <id>.<receives>.<visible-at>.<token>.msg.
+// State changes are atomic renames, so of several processes racing to claim
+// a message only one rename succeeds.
+type FileQueue struct {
+	dir      string
+	waitTime time.Duration
+	redrive  *RedrivePolicy
+
+	// mu serialises settlement of this process's own leases
+	mu sync.Mutex
+}
+
+// fileEntry is the parsed state of a message file.
+type fileEntry struct {
+	id           string
+	receiveCount int
+	visibleAt    time.Time
+	token        string
+}
+
+// NewFileQueue creates a queue rooted at dir, creating it if needed.
+func NewFileQueue(dir string) (*FileQueue, error) {
+	if dir == "" {
+		return nil, errors.New("queue directory is required")
+	}
+	if err := os.MkdirAll(filepath.Join(dir, fileTmpDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create queue directory: %w", err)
+	}
+	return &FileQueue{dir: dir, waitTime: DefaultWaitTime}, nil
+}
+
+// SetRedrivePolicy configures dead-lettering of repeatedly received messages.
+func (q *FileQueue) SetRedrivePolicy(policy *RedrivePolicy) {
+	q.redrive = policy
+}
+
+// Publish writes the message to a temporary file and moves it into the queue.
+func (q *FileQueue) Publish(ctx context.Context, body string) error {
+	return q.PublishAfter(ctx, body, 0)
+}
+
+// PublishAfter publishes a message that becomes visible after delay.
+func (q *FileQueue) PublishAfter(ctx context.Context, body string, delay time.Duration) error {
+	entry := fileEntry{
+		id:    fmt.Sprintf("%019d-%s", time.Now().UnixNano(), newHandle()),
+		token: newHandle(),
+	}
+	if delay > 0 {
+		entry.visibleAt = time.Now().Add(delay)
+	}
+
+	tmpPath := filepath.Join(q.dir, fileTmpDir, entry.id)
+	if err := writeFileSync(tmpPath, []byte(body)); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	if err := os.Rename(tmpPath, q.path(entry)); err != nil {
+		_ = os.Remove(tmpPath)
+		return fmt.Errorf("failed to enqueue message: %w", err)
+	}
+	return nil
+}
+
+// Receive polls the directory for visible messages until the wait time elapses.
+func (q *FileQueue) Receive(ctx context.Context, max int, lease time.Duration) ([]*Message, error) {
+	return q.receive(ctx, max, lease, q.waitTime)
+}
+
+func (q *FileQueue) receive(ctx context.Context, max int, lease, waitTime time.Duration) ([]*Message, error) {
+	deadline := time.Now().Add(waitTime)
+	for {
+		messages, err := q.claim(max, lease)
+		if err != nil || len(messages) > 0 {
+			return messages, err
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, nil
+		}
+
+		timer := time.NewTimer(min(wait, filePollInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Ack deletes the message file.
+func (q *FileQueue) Ack(ctx context.Context, msg *Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, err := q.lookup(msg)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(q.path(entry)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrLeaseLost
+		}
+		return fmt.Errorf("failed to delete message: %w", err)
+	}
+	return nil
+}
+
+// Nack makes the message visible again after delay.
+func (q *FileQueue) Nack(ctx context.Context, msg *Message, delay time.Duration) error {
+	return q.setVisibility(msg, delay)
+}
+
+// ExtendLease keeps the message hidden for lease from now.
+func (q *FileQueue) ExtendLease(ctx context.Context, msg *Message, lease time.Duration) error {
+	return q.setVisibility(msg, lease)
+}
+
+// Depth returns the number of messages waiting to be received.
+func (q *FileQueue) Depth(ctx context.Context) (int, error) {
+	entries, err := q.list()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	depth := 0
+	for _, entry := range entries {
+		if !entry.visibleAt.After(now) {
+			depth++
+		}
+	}
+	return depth, nil
+}
+
+func (q *FileQueue) setVisibility(msg *Message, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entry, err := q.lookup(msg)
+	if err != nil {
+		return err
+	}
+
+	updated := entry
+	updated.visibleAt = time.Now().Add(timeout)
+	if err := os.Rename(q.path(entry), q.path(updated)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return ErrLeaseLost
+		}
+		return fmt.Errorf("failed to update message visibility: %w", err)
+	}
+	return nil
+}
+
+// claim leases up to max visible messages in publish order.
+func (q *FileQueue) claim(max int, lease time.Duration) ([]*Message, error) {
+	entries, err := q.list()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var messages []*Message
+	for _, entry := range entries {
+		if len(messages) >= max {
+			break
+		}
+		if entry.visibleAt.After(now) {
+			continue
+		}
+
+		claimed := fileEntry{
+			id:           entry.id,
+			receiveCount: entry.receiveCount + 1,
+			visibleAt:    now.Add(lease),
+			token:        newHandle(),
+		}
+		if err := os.Rename(q.path(entry), q.path(claimed)); err != nil {
+			// Another consumer won the race for this message
+			continue
+		}
+
+		body, err := os.ReadFile(q.path(claimed))
+		if err != nil {
+			return messages, fmt.Errorf("failed to read message: %w", err)
+		}
+
+		if q.redrive.exceeded(claimed.receiveCount) {
+			// Left hidden under our lease if the dead-letter publish fails
+			if err := q.redrive.DeadLetter.Publish(context.Background(), string(body)); err == nil {
+				_ = os.Remove(q.path(claimed))
+			}
+			continue
+		}
+		messages = append(messages, &Message{
+			ID:           claimed.id,
+			Body:         string(body),
+			ReceiveCount: claimed.receiveCount,
+			Handle:       claimed.id + "." + claimed.token,
+		})
+	}
+	return messages, nil
+}
+
+// lookup finds the file currently leased under msg's handle.
+func (q *FileQueue) lookup(msg *Message) (fileEntry, error) {
+	id, token, ok := strings.Cut(msg.Handle, ".")
+	if !ok {
+		return fileEntry{}, ErrLeaseLost
+	}
+	matches, err := filepath.Glob(filepath.Join(q.dir, id+".*."+token+fileMessageExt))
+	if err != nil {
+		return fileEntry{}, fmt.Errorf("failed to find message: %w", err)
+	}
+	if len(matches) == 0 {
+		return fileEntry{}, ErrLeaseLost
+	}
+	entry, ok := parseFileEntry(filepath.Base(matches[0]))
+	if !ok {
+		return fileEntry{}, ErrLeaseLost
+	}
+	return entry, nil
+}
+
+// list returns all messages sorted by publish order.
+func (q *FileQueue) list() ([]fileEntry, error) {
+	dirEntries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queue directory: %w", err)
+	}
+
+	var entries []fileEntry
+	for _, d := range dirEntries {
+		if d.IsDir() {
+			continue
+		}
+		if entry, ok := parseFileEntry(d.Name()); ok {
+			entries = append(entries, entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].id < entries[j].id })
+	return entries, nil
+}
+
+func (q *FileQueue) path(entry fileEntry) string {
+	var visibleAt int64
+	if !entry.visibleAt.IsZero() {
+		visibleAt = entry.visibleAt.UnixNano()
+	}
+	name := fmt.Sprintf("%s.%d.%d.%s%s", entry.id, entry.receiveCount, visibleAt, entry.token, fileMessageExt)
+	return filepath.Join(q.dir, name)
+}
+
+// parseFileEntry parses a message file name.
+func parseFileEntry(name string) (fileEntry, bool) {
+	base, ok := strings.CutSuffix(name, fileMessageExt)
+	if !ok {
+		return fileEntry{}, false
+	}
+	parts := strings.Split(base, ".")
+	if len(parts) != 4 {
+		return fileEntry{}, false
+	}
+
+	count, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return fileEntry{}, false
+	}
+	visibleAt, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return fileEntry{}, false
+	}
+
+	entry := fileEntry{id: parts[0], receiveCount: count, token: parts[3]}
+	if visibleAt > 0 {
+		entry.visibleAt = time.Unix(0, visibleAt)
+	}
+	return entry, true
+}
+
+// writeFileSync writes data and flushes it to disk before returning.
+func writeFileSync(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,287 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+)
+
+// Lane is a priority class of jobs with its own queue.
+type Lane string
+
+// Supported lanes, highest priority first.
+const (
+	LaneHigh   Lane = "high"
+	LaneNormal Lane = "normal"
+	LaneBulk   Lane = "bulk"
+)
+
+// AllLanes lists the supported lanes, highest priority first.
+var AllLanes = []Lane{LaneHigh, LaneNormal, LaneBulk}
+
+// DepthReportInterval is how often ReportDepth samples lane depths.
+const DepthReportInterval = 30 * time.Second
+
+// ParseLane returns the lane with the given name.
+func ParseLane(name string) (Lane, error) {
+	for _, lane := range AllLanes {
+		if string(lane) == name {
+			return lane, nil
+		}
+	}
+	return "", fmt.Errorf("unknown queue lane: %q", name)
+}
+
+// LanePublisher sends jobs to a priority lane.
+type LanePublisher interface {
+	// PublishTo sends a message to the given lane, or to the normal lane if
+	// that lane is not configured, and returns the lane used.
+	PublishTo(ctx context.Context, lane Lane, body string) (Lane, error)
+}
+
+// DelayedLanePublisher sends jobs to a priority lane that are held back
+// for a while first.
+type DelayedLanePublisher interface {
+	// PublishToAfter sends a message to the given lane like PublishTo,
+	// which is not delivered before delay has passed.
+	PublishToAfter(ctx context.Context, lane Lane, body string, delay time.Duration) (Lane, error)
+}
+
+// laneBackend is a queue that Lanes can poll without blocking.
+type laneBackend interface {
+	Queue
+	DelayedPublisher
+	receive(ctx context.Context, max int, lease, waitTime time.Duration) ([]*Message, error)
+	Depth(ctx context.Context) (int, error)
+}
+
+// laneQueue is one lane's queue and its smooth weighted round-robin state.
+type laneQueue struct {
+	lane    Lane
+	weight  int
+	current int
+	queue   laneBackend
+}
+
+// Lanes is a Queue spread over priority lanes. Receive shares polls between
+// lanes in proportion to their weights, so a backlog in one lane cannot
+// starve the others. Messages are tagged with their lane so they are
+// settled on the queue they came from.
+type Lanes struct {
+	mu          sync.Mutex
+	lanes       []*laneQueue
+	waitTime    time.Duration
+	deadLetters *DeadLetters
+}
+
+// NewLanes creates an empty set of lanes.
+func NewLanes() *Lanes {
+	return &Lanes{waitTime: DefaultWaitTime}
+}
+
+// Add configures a lane backed by q and polled with the given weight.
+func (l *Lanes) Add(lane Lane, weight int, q Queue) error {
+	backend, ok := q.(laneBackend)
+	if !ok {
+		return fmt.Errorf("queue for lane %s does not support lanes", lane)
+	}
+	if weight < 1 {
+		return fmt.Errorf("lane %s weight must be positive", lane)
+	}
+	if l.lookup(lane) != nil {
+		return fmt.Errorf("lane %s already configured", lane)
+	}
+
+	l.lanes = append(l.lanes, &laneQueue{lane: lane, weight: weight, queue: backend})
+	return nil
+}
+
+// Configured returns the configured lanes, highest priority first.
+func (l *Lanes) Configured() []Lane {
+	var lanes []Lane
+	for _, lane := range AllLanes {
+		if l.lookup(lane) != nil {
+			lanes = append(lanes, lane)
+		}
+	}
+	return lanes
+}
+
+// DeadLetters returns access to the lanes' dead-letter queue, or nil if it
+// is not configured.
+func (l *Lanes) DeadLetters() *DeadLetters {
+	return l.deadLetters
+}
+
+// Publish sends a message to the normal lane.
+func (l *Lanes) Publish(ctx context.Context, body string) error {
+	_, err := l.PublishTo(ctx, LaneNormal, body)
+	return err
+}
+
+// PublishTo sends a message to the given lane, falling back to the normal
+// lane if it is not configured.
+func (l *Lanes) PublishTo(ctx context.Context, lane Lane, body string) (Lane, error) {
+	return l.PublishToAfter(ctx, lane, body, 0)
+}
+
+// PublishToAfter sends a message to the given lane like PublishTo, which
+// is not delivered before delay has passed.
+func (l *Lanes) PublishToAfter(ctx context.Context, lane Lane, body string, delay time.Duration) (Lane, error) {
+	lq := l.lookup(lane)
+	if lq == nil {
+		lq = l.lookup(LaneNormal)
+	}
+	if lq == nil {
+		return "", fmt.Errorf("no queue configured for lane %s", lane)
+	}
+	return lq.lane, lq.queue.PublishAfter(ctx, body, delay)
+}
+
+// Receive polls every lane without waiting, starting with the lane chosen by
+// the weighted schedule, and returns the first messages found. If all lanes
+// are empty it long-polls the chosen lane for a share of the wait time.
+func (l *Lanes) Receive(ctx context.Context, max int, lease time.Duration) ([]*Message, error) {
+	order := l.schedule()
+	if len(order) == 0 {
+		return nil, fmt.Errorf("no queue lanes configured")
+	}
+
+	if len(order) > 1 {
+		for _, lq := range order {
+			messages, err := lq.queue.receive(ctx, max, lease, 0)
+			if err != nil || len(messages) > 0 {
+				return tagLane(lq.lane, messages), err
+			}
+		}
+	}
+
+	messages, err := order[0].queue.receive(ctx, max, lease, l.waitTime/time.Duration(len(order)))
+	return tagLane(order[0].lane, messages), err
+}
+
+// Ack removes a processed message from its lane.
+func (l *Lanes) Ack(ctx context.Context, msg *Message) error {
+	lq, err := l.laneOf(msg)
+	if err != nil {
+		return err
+	}
+	return lq.queue.Ack(ctx, msg)
+}
+
+// Nack returns a message to its lane after delay.
+func (l *Lanes) Nack(ctx context.Context, msg *Message, delay time.Duration) error {
+	lq, err := l.laneOf(msg)
+	if err != nil {
+		return err
+	}
+	return lq.queue.Nack(ctx, msg, delay)
+}
+
+// ExtendLease keeps a message hidden for lease from now.
+func (l *Lanes) ExtendLease(ctx context.Context, msg *Message, lease time.Duration) error {
+	lq, err := l.laneOf(msg)
+	if err != nil {
+		return err
+	}
+	return lq.queue.ExtendLease(ctx, msg, lease)
+}
+
+// Depths returns the number of messages waiting in each lane.
+func (l *Lanes) Depths(ctx context.Context) (map[Lane]int, error) {
+	depths := make(map[Lane]int, len(l.lanes))
+	for _, lq := range l.lanes {
+		depth, err := lq.queue.Depth(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("lane %s: %w", lq.lane, err)
+		}
+		depths[lq.lane] = depth
+	}
+	return depths, nil
+}
+
+// ReportDepth exports lane depths as metrics every interval until the
+// context is cancelled.
+func (l *Lanes) ReportDepth(ctx context.Context, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		depths, err := l.Depths(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.WarnContext(ctx, "Failed to read queue depth", "error", err)
+		}
+		for lane, depth := range depths {
+			metrics.QueueDepth.WithLabelValues(string(lane)).Set(float64(depth))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// schedule picks the next lane by smooth weighted round-robin and returns it
+// followed by the remaining lanes in priority order.
+func (l *Lanes) schedule() []*laneQueue {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.lanes) == 0 {
+		return nil
+	}
+
+	total := 0
+	var picked *laneQueue
+	for _, lq := range l.lanes {
+		lq.current += lq.weight
+		total += lq.weight
+		if picked == nil || lq.current > picked.current {
+			picked = lq
+		}
+	}
+	picked.current -= total
+
+	order := []*laneQueue{picked}
+	for _, lane := range AllLanes {
+		if lq := l.lookup(lane); lq != nil && lq != picked {
+			order = append(order, lq)
+		}
+	}
+	return order
+}
+
+func (l *Lanes) lookup(lane Lane) *laneQueue {
+	for _, lq := range l.lanes {
+		if lq.lane == lane {
+			return lq
+		}
+	}
+	return nil
+}
+
+// laneOf returns the lane a received message came from.
+func (l *Lanes) laneOf(msg *Message) (*laneQueue, error) {
+	lq := l.lookup(msg.Lane)
+	if lq == nil {
+		return nil, fmt.Errorf("%w: unknown lane %q", ErrLeaseLost, msg.Lane)
+	}
+	return lq, nil
+}
+
+// tagLane records the lane messages were received from.
+func tagLane(lane Lane, messages []*Message) []*Message {
+	for _, msg := range messages {
+		msg.Lane = lane
+	}
+	if len(messages) > 0 {
+		metrics.QueueMessagesReceived.WithLabelValues(string(lane)).Add(float64(len(messages)))
+	}
+	return messages
+}
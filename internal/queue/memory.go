@@ -0,0 +1,229 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a message held by MemoryQueue.
+type memoryEntry struct {
+	id           string
+	body         string
+	receiveCount int
+	visibleAt    time.Time
+	handle       string
+}
+
+// MemoryQueue is an in-process Queue for tests and single-process runs.
+// Messages are lost when the process exits.
+type MemoryQueue struct {
+	mu       sync.Mutex
+	entries  []*memoryEntry
+	notify   chan struct{}
+	nextID   int
+	waitTime time.Duration
+	redrive  *RedrivePolicy
+}
+
+// NewMemoryQueue creates an empty in-memory queue.
+func NewMemoryQueue() *MemoryQueue {
+	return &MemoryQueue{
+		notify:   make(chan struct{}),
+		waitTime: DefaultWaitTime,
+	}
+}
+
+// SetRedrivePolicy configures dead-lettering of repeatedly received messages.
+func (q *MemoryQueue) SetRedrivePolicy(policy *RedrivePolicy) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.redrive = policy
+}
+
+// Publish appends a message to the queue.
+func (q *MemoryQueue) Publish(ctx context.Context, body string) error {
+	return q.PublishAfter(ctx, body, 0)
+}
+
+// PublishAfter appends a message that becomes visible after delay.
+func (q *MemoryQueue) PublishAfter(ctx context.Context, body string, delay time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.nextID++
+	entry := &memoryEntry{
+		id:   fmt.Sprintf("mem-%d", q.nextID),
+		body: body,
+	}
+	if delay > 0 {
+		entry.visibleAt = time.Now().Add(delay)
+	}
+	q.entries = append(q.entries, entry)
+	q.wake()
+	return nil
+}
+
+// Receive waits for visible messages until the wait time elapses.
+func (q *MemoryQueue) Receive(ctx context.Context, max int, lease time.Duration) ([]*Message, error) {
+	return q.receive(ctx, max, lease, q.waitTime)
+}
+
+func (q *MemoryQueue) receive(ctx context.Context, max int, lease, waitTime time.Duration) ([]*Message, error) {
+	deadline := time.Now().Add(waitTime)
+	for {
+		q.mu.Lock()
+		messages := q.claim(max, lease)
+		notify := q.notify
+		next := q.nextVisible()
+		q.mu.Unlock()
+
+		if len(messages) > 0 {
+			return messages, nil
+		}
+
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return nil, nil
+		}
+		if !next.IsZero() {
+			wait = min(wait, time.Until(next))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// Ack removes the message from the queue.
+func (q *MemoryQueue) Ack(ctx context.Context, msg *Message) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i, e := range q.entries {
+		if e.id == msg.ID {
+			if e.handle != msg.Handle {
+				return ErrLeaseLost
+			}
+			q.entries = append(q.entries[:i], q.entries[i+1:]...)
+			return nil
+		}
+	}
+	return ErrLeaseLost
+}
+
+// Nack makes the message visible again after delay.
+func (q *MemoryQueue) Nack(ctx context.Context, msg *Message, delay time.Duration) error {
+	return q.setVisibility(msg, delay)
+}
+
+// ExtendLease keeps the message hidden for lease from now.
+func (q *MemoryQueue) ExtendLease(ctx context.Context, msg *Message, lease time.Duration) error {
+	return q.setVisibility(msg, lease)
+}
+
+// Depth returns the number of messages waiting to be received.
+func (q *MemoryQueue) Depth(ctx context.Context) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	depth := 0
+	for _, e := range q.entries {
+		if !e.visibleAt.After(now) {
+			depth++
+		}
+	}
+	return depth, nil
+}
+
+func (q *MemoryQueue) setVisibility(msg *Message, timeout time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	e := q.find(msg)
+	if e == nil {
+		return ErrLeaseLost
+	}
+	e.visibleAt = time.Now().Add(timeout)
+	q.wake()
+	return nil
+}
+
+// claim leases up to max visible messages. Callers must hold q.mu.
+func (q *MemoryQueue) claim(max int, lease time.Duration) []*Message {
+	now := time.Now()
+	var messages []*Message
+	kept := q.entries[:0]
+	for _, e := range q.entries {
+		if len(messages) >= max || e.visibleAt.After(now) {
+			kept = append(kept, e)
+			continue
+		}
+		if q.redrive.exceeded(e.receiveCount + 1) {
+			if err := q.redrive.DeadLetter.Publish(context.Background(), e.body); err == nil {
+				continue
+			}
+		}
+		kept = append(kept, e)
+
+		e.receiveCount++
+		e.visibleAt = now.Add(lease)
+		e.handle = newHandle()
+		messages = append(messages, &Message{
+			ID:           e.id,
+			Body:         e.body,
+			ReceiveCount: e.receiveCount,
+			Handle:       e.handle,
+		})
+	}
+	q.entries = kept
+	return messages
+}
+
+// nextVisible returns when the earliest hidden message becomes visible.
+// Callers must hold q.mu.
+func (q *MemoryQueue) nextVisible() time.Time {
+	now := time.Now()
+	var next time.Time
+	for _, e := range q.entries {
+		if e.visibleAt.After(now) && (next.IsZero() || e.visibleAt.Before(next)) {
+			next = e.visibleAt
+		}
+	}
+	return next
+}
+
+// find returns the entry currently leased under msg's handle. Callers must
+// hold q.mu.
+func (q *MemoryQueue) find(msg *Message) *memoryEntry {
+	for _, e := range q.entries {
+		if e.id == msg.ID && e.handle == msg.Handle {
+			return e
+		}
+	}
+	return nil
+}
+
+// wake unblocks waiting receivers. Callers must hold q.mu.
+func (q *MemoryQueue) wake() {
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// newHandle returns a random receipt handle.
+func newHandle() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,187 @@
+// Package queue provides job queue backends for the HLS pipeline.
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/config"
+)
+
+// Supported queue backends.
+const (
+	BackendSQS    = "sqs"
+	BackendMemory = "memory"
+	BackendFile   = "file"
+)
+
+// DefaultWaitTime is how long Receive blocks waiting for a message.
+const DefaultWaitTime = 20 * time.Second
+
+// DeadLetterDir is the subdirectory of QUEUE_DIR holding the file backend's
+// dead-letter queue.
+const DeadLetterDir = "dlq"
+
+// Errors
+var (
+	// ErrLeaseLost is returned when a message's lease expired or it was
+	// acknowledged elsewhere, so the receipt handle is no longer valid.
+	ErrLeaseLost = errors.New("message lease lost")
+)
+
+// Message is a job received from a queue.
+type Message struct {
+	ID           string
+	Body         string
+	ReceiveCount int
+
+	// Handle identifies this delivery of the message. It changes on every
+	// receive, so a stale handle cannot ack a message redelivered elsewhere.
+	Handle string
+
+	// Lane is the priority lane the message was received from, when
+	// received through Lanes.
+	Lane Lane
+}
+
+// Publisher sends jobs to a queue.
+type Publisher interface {
+	Publish(ctx context.Context, body string) error
+}
+
+// DelayedPublisher sends jobs that are held back for a while first.
+type DelayedPublisher interface {
+	// PublishAfter sends a message that is not delivered before delay has
+	// passed.
+	PublishAfter(ctx context.Context, body string, delay time.Duration) error
+}
+
+// Consumer receives and settles jobs from a queue.
+type Consumer interface {
+	// Receive waits for up to max messages and hides them from other
+	// consumers for the lease duration.
+	Receive(ctx context.Context, max int, lease time.Duration) ([]*Message, error)
+
+	// Ack removes a processed message from the queue.
+	Ack(ctx context.Context, msg *Message) error
+
+	// Nack returns a message to the queue after delay.
+	Nack(ctx context.Context, msg *Message, delay time.Duration) error
+
+	// ExtendLease keeps a message hidden for lease from now.
+	ExtendLease(ctx context.Context, msg *Message, lease time.Duration) error
+}
+
+// Queue is a backend that can both publish and consume.
+type Queue interface {
+	Publisher
+	Consumer
+}
+
+// RedrivePolicy moves messages that have been received too many times to a
+// dead-letter queue, mirroring the SQS redrive policy for local backends.
+type RedrivePolicy struct {
+	DeadLetter  Publisher
+	MaxReceives int
+}
+
+// exceeded reports whether a message about to be delivered for the given
+// receive count should be dead-lettered instead.
+func (p *RedrivePolicy) exceeded(receiveCount int) bool {
+	return p != nil && p.DeadLetter != nil && p.MaxReceives > 0 && receiveCount > p.MaxReceives
+}
+
+// New creates the lanes selected by the configuration. Each lane with a
+// weight gets its own queue: SQS lanes other than normal need their own
+// queue URL, and file lanes other than normal live in a subdirectory of
+// QUEUE_DIR named after the lane. The SQS client is only used by the SQS
+// backend and may be nil otherwise. Local backends share a dead-letter queue
+// and dead-letter messages after the worker's MaxReceiveCount; the SQS
+// dead-letter queue is only inspectable if its URL is configured.
+func New(cfg *config.Config, sqsClient SQSAPI) (*Lanes, error) {
+	var deadLetter Queue
+	switch cfg.Queue.Backend {
+	case BackendSQS, "":
+		if sqsClient == nil {
+			return nil, errors.New("SQS client is required for the sqs queue backend")
+		}
+		if cfg.Queue.DeadLetterURL != "" {
+			deadLetter = NewSQSQueue(sqsClient, cfg.Queue.DeadLetterURL)
+		}
+	case BackendFile:
+		dlq, err := NewFileQueue(filepath.Join(cfg.Queue.Dir, DeadLetterDir))
+		if err != nil {
+			return nil, err
+		}
+		deadLetter = dlq
+	case BackendMemory:
+		deadLetter = NewMemoryQueue()
+	default:
+		return nil, fmt.Errorf("unknown queue backend: %s", cfg.Queue.Backend)
+	}
+	// SQS applies its own redrive policy
+	var redrive *RedrivePolicy
+	if deadLetter != nil {
+		redrive = &RedrivePolicy{DeadLetter: deadLetter, MaxReceives: cfg.Worker.MaxReceiveCount}
+	}
+
+	weights := cfg.Queue.LaneWeights
+	if len(weights) == 0 {
+		weights = map[string]int{string(LaneNormal): 1}
+	}
+
+	lanes := NewLanes()
+	for _, lane := range AllLanes {
+		weight, ok := weights[string(lane)]
+		if !ok {
+			continue
+		}
+
+		var q Queue
+		switch cfg.Queue.Backend {
+		case BackendSQS, "":
+			url := cfg.AWS.SQSQueueURL
+			if lane != LaneNormal {
+				url = cfg.Queue.LaneURLs[string(lane)]
+			}
+			if url == "" {
+				continue
+			}
+			q = NewSQSQueue(sqsClient, url)
+		case BackendFile:
+			dir := cfg.Queue.Dir
+			if lane != LaneNormal {
+				dir = filepath.Join(dir, string(lane))
+			}
+			fq, err := NewFileQueue(dir)
+			if err != nil {
+				return nil, err
+			}
+			fq.SetRedrivePolicy(redrive)
+			q = fq
+		case BackendMemory:
+			mq := NewMemoryQueue()
+			mq.SetRedrivePolicy(redrive)
+			q = mq
+		}
+
+		if err := lanes.Add(lane, weight, q); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(lanes.Configured()) == 0 {
+		return nil, errors.New("no queue lanes configured")
+	}
+	if deadLetter != nil {
+		dl, err := NewDeadLetters(deadLetter, lanes)
+		if err != nil {
+			return nil, err
+		}
+		lanes.deadLetters = dl
+	}
+	return lanes, nil
+}
@@ -0,0 +1,621 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+const testWaitTime = 50 * time.Millisecond
+
+// backends returns a fresh instance of each local queue implementation.
+func backends(t *testing.T) map[string]func() Queue {
+	t.Helper()
+	return map[string]func() Queue{
+		"memory": func() Queue {
+			q := NewMemoryQueue()
+			q.waitTime = testWaitTime
+			return q
+		},
+		"file": func() Queue {
+			q, err := NewFileQueue(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileQueue() error = %v", err)
+			}
+			q.waitTime = testWaitTime
+			return q
+		},
+	}
+}
+
+// receiveOne receives a single message and fails the test if there is none.
+func receiveOne(t *testing.T, q Queue, lease time.Duration) *Message {
+	t.Helper()
+	msgs, err := q.Receive(context.Background(), 1, lease)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("Receive() returned %d messages, want 1", len(msgs))
+	}
+	return msgs[0]
+}
+
+// expectEmpty fails the test if a message is received.
+func expectEmpty(t *testing.T, q Queue) {
+	t.Helper()
+	msgs, err := q.Receive(context.Background(), 1, time.Minute)
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+	if len(msgs) != 0 {
+		t.Fatalf("Receive() returned %d messages, want 0", len(msgs))
+	}
+}
+
+func TestQueue_PublishReceiveAck(t *testing.T) {
+	ctx := context.Background()
+	for name, newQueue := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			if err := q.Publish(ctx, "first"); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			if err := q.Publish(ctx, "second"); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			msg := receiveOne(t, q, time.Minute)
+			if msg.Body != "first" {
+				t.Errorf("Body = %q, want first", msg.Body)
+			}
+			if msg.ReceiveCount != 1 {
+				t.Errorf("ReceiveCount = %d, want 1", msg.ReceiveCount)
+			}
+			if err := q.Ack(ctx, msg); err != nil {
+				t.Fatalf("Ack() error = %v", err)
+			}
+
+			msg = receiveOne(t, q, time.Minute)
+			if msg.Body != "second" {
+				t.Errorf("Body = %q, want second", msg.Body)
+			}
+			if err := q.Ack(ctx, msg); err != nil {
+				t.Fatalf("Ack() error = %v", err)
+			}
+
+			expectEmpty(t, q)
+		})
+	}
+}
+
+func TestQueue_LeaseExpiryRedelivers(t *testing.T) {
+	ctx := context.Background()
+	for name, newQueue := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			if err := q.Publish(ctx, "job"); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			first := receiveOne(t, q, 10*time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+
+			second := receiveOne(t, q, time.Minute)
+			if second.ReceiveCount != 2 {
+				t.Errorf("ReceiveCount = %d, want 2", second.ReceiveCount)
+			}
+
+			// The first delivery's handle is stale once redelivered
+			if err := q.Ack(ctx, first); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("Ack(stale) error = %v, want ErrLeaseLost", err)
+			}
+			if err := q.ExtendLease(ctx, first, time.Minute); !errors.Is(err, ErrLeaseLost) {
+				t.Errorf("ExtendLease(stale) error = %v, want ErrLeaseLost", err)
+			}
+			if err := q.Ack(ctx, second); err != nil {
+				t.Errorf("Ack() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestQueue_NackAndExtendLease(t *testing.T) {
+	ctx := context.Background()
+	for name, newQueue := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			if err := q.Publish(ctx, "job"); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+
+			msg := receiveOne(t, q, 10*time.Millisecond)
+			if err := q.ExtendLease(ctx, msg, time.Minute); err != nil {
+				t.Fatalf("ExtendLease() error = %v", err)
+			}
+			time.Sleep(20 * time.Millisecond)
+			expectEmpty(t, q)
+
+			if err := q.Nack(ctx, msg, 0); err != nil {
+				t.Fatalf("Nack() error = %v", err)
+			}
+			msg = receiveOne(t, q, time.Minute)
+			if msg.ReceiveCount != 2 {
+				t.Errorf("ReceiveCount = %d, want 2", msg.ReceiveCount)
+			}
+
+			if err := q.Nack(ctx, msg, time.Minute); err != nil {
+				t.Fatalf("Nack() error = %v", err)
+			}
+			expectEmpty(t, q)
+		})
+	}
+}
+
+func TestQueue_PublishAfter(t *testing.T) {
+	ctx := context.Background()
+	for name, newQueue := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			delayed, ok := q.(DelayedPublisher)
+			if !ok {
+				t.Fatalf("%T does not implement DelayedPublisher", q)
+			}
+			if err := delayed.PublishAfter(ctx, "job", 100*time.Millisecond); err != nil {
+				t.Fatalf("PublishAfter() error = %v", err)
+			}
+			expectEmpty(t, q)
+
+			time.Sleep(100 * time.Millisecond)
+			msg := receiveOne(t, q, time.Minute)
+			if msg.Body != "job" || msg.ReceiveCount != 1 {
+				t.Errorf("received %q, ReceiveCount %d, want job on its first delivery", msg.Body, msg.ReceiveCount)
+			}
+		})
+	}
+}
+
+func TestQueue_RedrivePolicy(t *testing.T) {
+	ctx := context.Background()
+	for name, newQueue := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			dlq := newQueue()
+			policy := &RedrivePolicy{DeadLetter: dlq, MaxReceives: 2}
+			switch q := q.(type) {
+			case *MemoryQueue:
+				q.SetRedrivePolicy(policy)
+			case *FileQueue:
+				q.SetRedrivePolicy(policy)
+			}
+
+			if err := q.Publish(ctx, "poison"); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			for range 2 {
+				msg := receiveOne(t, q, time.Minute)
+				if err := q.Nack(ctx, msg, 0); err != nil {
+					t.Fatalf("Nack() error = %v", err)
+				}
+			}
+
+			expectEmpty(t, q)
+			msg := receiveOne(t, dlq, time.Minute)
+			if msg.Body != "poison" {
+				t.Errorf("dead-lettered Body = %q, want poison", msg.Body)
+			}
+		})
+	}
+}
+
+func TestQueue_ReceiveHonoursContext(t *testing.T) {
+	for name, newQueue := range backends(t) {
+		t.Run(name, func(t *testing.T) {
+			q := newQueue()
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			if _, err := q.Receive(ctx, 1, time.Minute); !errors.Is(err, context.Canceled) {
+				t.Errorf("Receive() error = %v, want context.Canceled", err)
+			}
+		})
+	}
+}
+
+func TestFileQueue_SharedDirectory(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	publisher, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatalf("NewFileQueue() error = %v", err)
+	}
+	const total = 20
+	for range total {
+		if err := publisher.Publish(ctx, "job"); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	// Separate instances stand in for separate processes
+	var mu sync.Mutex
+	seen := make(map[string]int)
+	var wg sync.WaitGroup
+	for range 4 {
+		consumer, err := NewFileQueue(dir)
+		if err != nil {
+			t.Fatalf("NewFileQueue() error = %v", err)
+		}
+		consumer.waitTime = testWaitTime
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				msgs, err := consumer.Receive(ctx, 1, time.Minute)
+				if err != nil || len(msgs) == 0 {
+					return
+				}
+				mu.Lock()
+				seen[msgs[0].ID]++
+				mu.Unlock()
+				_ = consumer.Ack(ctx, msgs[0])
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(seen) != total {
+		t.Errorf("received %d distinct messages, want %d", len(seen), total)
+	}
+	for id, n := range seen {
+		if n != 1 {
+			t.Errorf("message %s delivered %d times, want 1", id, n)
+		}
+	}
+}
+
+func TestFileQueue_Durable(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	q, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatalf("NewFileQueue() error = %v", err)
+	}
+	if err := q.Publish(ctx, "survives restart"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	reopened, err := NewFileQueue(dir)
+	if err != nil {
+		t.Fatalf("NewFileQueue() error = %v", err)
+	}
+	reopened.waitTime = testWaitTime
+
+	msg := receiveOne(t, reopened, time.Minute)
+	if msg.Body != "survives restart" {
+		t.Errorf("Body = %q, want %q", msg.Body, "survives restart")
+	}
+}
+
+func TestParseFileEntry(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		wantOK bool
+		count  int
+	}{
+		{"fresh", "0001-ab.0.0.cd.msg", true, 0},
+		{"leased", "0001-ab.3.1700000000000000000.cd.msg", true, 3},
+		{"wrong extension", "0001-ab.0.0.cd.tmp", false, 0},
+		{"missing parts", "0001-ab.0.msg", false, 0},
+		{"bad count", "0001-ab.x.0.cd.msg", false, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry, ok := parseFileEntry(tt.file)
+			if ok != tt.wantOK {
+				t.Fatalf("parseFileEntry(%q) ok = %v, want %v", tt.file, ok, tt.wantOK)
+			}
+			if ok && entry.receiveCount != tt.count {
+				t.Errorf("receiveCount = %d, want %d", entry.receiveCount, tt.count)
+			}
+		})
+	}
+}
+
+// newTestLanes returns lanes backed by memory queues with the given weights.
+func newTestLanes(t *testing.T, weights map[Lane]int) *Lanes {
+	t.Helper()
+	lanes := NewLanes()
+	lanes.waitTime = testWaitTime
+	for _, lane := range AllLanes {
+		weight, ok := weights[lane]
+		if !ok {
+			continue
+		}
+		q := NewMemoryQueue()
+		q.waitTime = testWaitTime
+		if err := lanes.Add(lane, weight, q); err != nil {
+			t.Fatalf("Add(%s) error = %v", lane, err)
+		}
+	}
+	return lanes
+}
+
+func TestLanes_WeightedFairness(t *testing.T) {
+	ctx := context.Background()
+	lanes := newTestLanes(t, map[Lane]int{LaneHigh: 2, LaneNormal: 1, LaneBulk: 1})
+	for _, lane := range AllLanes {
+		for range 10 {
+			if _, err := lanes.PublishTo(ctx, lane, string(lane)); err != nil {
+				t.Fatalf("PublishTo() error = %v", err)
+			}
+		}
+	}
+
+	got := make(map[Lane]int)
+	for range 8 {
+		msg := receiveOne(t, lanes, time.Minute)
+		if msg.Body != string(msg.Lane) {
+			t.Errorf("message from %s has Body %q", msg.Lane, msg.Body)
+		}
+		got[msg.Lane]++
+		if err := lanes.Ack(ctx, msg); err != nil {
+			t.Fatalf("Ack() error = %v", err)
+		}
+	}
+
+	want := map[Lane]int{LaneHigh: 4, LaneNormal: 2, LaneBulk: 2}
+	for lane, n := range want {
+		if got[lane] != n {
+			t.Errorf("received %d from %s, want %d (all: %v)", got[lane], lane, n, got)
+		}
+	}
+}
+
+func TestLanes_ReceivesFromAnyNonEmptyLane(t *testing.T) {
+	ctx := context.Background()
+	lanes := newTestLanes(t, map[Lane]int{LaneHigh: 10, LaneNormal: 5, LaneBulk: 1})
+	if _, err := lanes.PublishTo(ctx, LaneBulk, "job"); err != nil {
+		t.Fatalf("PublishTo() error = %v", err)
+	}
+
+	msg := receiveOne(t, lanes, time.Minute)
+	if msg.Lane != LaneBulk {
+		t.Errorf("Lane = %s, want %s", msg.Lane, LaneBulk)
+	}
+	expectEmpty(t, lanes)
+}
+
+func TestLanes_SettlesOnSourceLane(t *testing.T) {
+	ctx := context.Background()
+	lanes := newTestLanes(t, map[Lane]int{LaneNormal: 1, LaneBulk: 1})
+	if _, err := lanes.PublishTo(ctx, LaneBulk, "job"); err != nil {
+		t.Fatalf("PublishTo() error = %v", err)
+	}
+
+	msg := receiveOne(t, lanes, time.Minute)
+	if err := lanes.Nack(ctx, msg, 0); err != nil {
+		t.Fatalf("Nack() error = %v", err)
+	}
+
+	depths, err := lanes.Depths(ctx)
+	if err != nil {
+		t.Fatalf("Depths() error = %v", err)
+	}
+	if depths[LaneBulk] != 1 || depths[LaneNormal] != 0 {
+		t.Errorf("Depths() = %v, want bulk=1 normal=0", depths)
+	}
+
+	if err := lanes.Ack(ctx, &Message{ID: msg.ID, Handle: msg.Handle, Lane: LaneHigh}); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Ack() on unknown lane error = %v, want ErrLeaseLost", err)
+	}
+}
+
+func TestLanes_PublishFallsBackToNormal(t *testing.T) {
+	lanes := newTestLanes(t, map[Lane]int{LaneNormal: 1})
+
+	got, err := lanes.PublishTo(context.Background(), LaneHigh, "job")
+	if err != nil {
+		t.Fatalf("PublishTo() error = %v", err)
+	}
+	if got != LaneNormal {
+		t.Errorf("PublishTo() lane = %s, want %s", got, LaneNormal)
+	}
+	if msg := receiveOne(t, lanes, time.Minute); msg.Lane != LaneNormal {
+		t.Errorf("Lane = %s, want %s", msg.Lane, LaneNormal)
+	}
+}
+
+// newTestDeadLetters returns a memory dead-letter queue holding the given
+// bodies and access to it redriving into lanes.
+func newTestDeadLetters(t *testing.T, lanes *Lanes, bodies ...string) (*DeadLetters, *MemoryQueue) {
+	t.Helper()
+	dlq := NewMemoryQueue()
+	dlq.waitTime = testWaitTime
+	for _, body := range bodies {
+		if err := dlq.Publish(context.Background(), body); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+	dl, err := NewDeadLetters(dlq, lanes)
+	if err != nil {
+		t.Fatalf("NewDeadLetters() error = %v", err)
+	}
+	dl.waitTime = testWaitTime
+	return dl, dlq
+}
+
+func TestDeadLetters_ListLeavesMessages(t *testing.T) {
+	dl, dlq := newTestDeadLetters(t, newTestLanes(t, map[Lane]int{LaneNormal: 1}), "a", "b", "c")
+
+	listed, err := dl.List(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(listed) != 2 {
+		t.Fatalf("List() returned %d messages, want 2", len(listed))
+	}
+
+	depth, err := dlq.Depth(context.Background())
+	if err != nil {
+		t.Fatalf("Depth() error = %v", err)
+	}
+	if depth != 3 {
+		t.Errorf("Depth() after List = %d, want 3", depth)
+	}
+}
+
+func TestDeadLetters_RedriveSelected(t *testing.T) {
+	ctx := context.Background()
+	lanes := newTestLanes(t, map[Lane]int{LaneNormal: 1, LaneBulk: 1})
+	dl, dlq := newTestDeadLetters(t, lanes, "keep", "move")
+
+	listed, err := dl.List(ctx, 10)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var moveID string
+	for _, msg := range listed {
+		if msg.Body == "move" {
+			moveID = msg.ID
+		}
+	}
+
+	redriven, err := dl.Redrive(ctx, []string{moveID}, func(*Message) Lane { return LaneBulk }, nil)
+	if err != nil {
+		t.Fatalf("Redrive() error = %v", err)
+	}
+	if len(redriven) != 1 || redriven[0].ID != moveID {
+		t.Fatalf("Redrive() = %v, want only %s", redriven, moveID)
+	}
+
+	msg := receiveOne(t, lanes, time.Minute)
+	if msg.Body != "move" || msg.Lane != LaneBulk {
+		t.Errorf("redriven message = %q on %s, want move on bulk", msg.Body, msg.Lane)
+	}
+	if left := receiveOne(t, dlq, time.Minute); left.Body != "keep" {
+		t.Errorf("remaining dead letter = %q, want keep", left.Body)
+	}
+}
+
+// failingPublisher is a LanePublisher whose publishes fail.
+type failingPublisher struct{}
+
+func (failingPublisher) PublishTo(context.Context, Lane, string) (Lane, error) {
+	return "", errors.New("publish failed")
+}
+
+func TestDeadLetters_RedrivePrepare(t *testing.T) {
+	ctx := context.Background()
+	lanes := newTestLanes(t, map[Lane]int{LaneNormal: 1})
+	dl, dlq := newTestDeadLetters(t, lanes, "a")
+
+	var published bool
+	_, err := dl.Redrive(ctx, nil, func(*Message) Lane { return LaneNormal }, func(*Message) func() {
+		// The message must not be deliverable before it is prepared
+		depths, err := lanes.Depths(ctx)
+		if err != nil {
+			t.Fatalf("Depths() error = %v", err)
+		}
+		published = depths[LaneNormal] > 0
+		return func() { t.Error("undo called after a successful publish") }
+	})
+	if err != nil {
+		t.Fatalf("Redrive() error = %v", err)
+	}
+	if published {
+		t.Error("message published before prepare")
+	}
+	receiveOne(t, lanes, time.Minute)
+
+	// A failed publish undoes the preparation and keeps the dead letter
+	if err := dlq.Publish(ctx, "b"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	dl.target = failingPublisher{}
+	var undone bool
+	redriven, err := dl.Redrive(ctx, nil, func(*Message) Lane { return LaneNormal }, func(*Message) func() {
+		return func() { undone = true }
+	})
+	if err == nil || len(redriven) != 0 {
+		t.Fatalf("Redrive() = %v, %v, want an error", redriven, err)
+	}
+	if !undone {
+		t.Error("undo not called after a failed publish")
+	}
+	if left := receiveOne(t, dlq, time.Minute); left.Body != "b" {
+		t.Errorf("remaining dead letter = %q, want b", left.Body)
+	}
+}
+
+func TestDeadLetters_PurgeAll(t *testing.T) {
+	ctx := context.Background()
+	dl, dlq := newTestDeadLetters(t, newTestLanes(t, map[Lane]int{LaneNormal: 1}), "a", "b", "c")
+
+	purged, err := dl.Purge(ctx, nil)
+	if err != nil {
+		t.Fatalf("Purge() error = %v", err)
+	}
+	if len(purged) != 3 {
+		t.Errorf("Purge() removed %d messages, want 3", len(purged))
+	}
+	expectEmpty(t, dlq)
+}
+
+// staleSQS is an SQSAPI whose settlement calls fail with err.
+type staleSQS struct {
+	SQSAPI
+	err error
+}
+
+func (c *staleSQS) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	return nil, c.err
+}
+
+func (c *staleSQS) ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error) {
+	return nil, c.err
+}
+
+func TestSQSQueue_StaleHandle(t *testing.T) {
+	expired := &smithy.GenericAPIError{
+		Code:    "InvalidParameterValue",
+		Message: "Value AQEB... for parameter ReceiptHandle is invalid. Reason: The receipt handle has expired.",
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"expired handle", &smithy.OperationError{ServiceID: "SQS", Err: expired}, true},
+		{"invalid handle", &types.ReceiptHandleIsInvalid{}, true},
+		{"not in flight", &types.MessageNotInflight{}, true},
+		{"other invalid parameter", &smithy.GenericAPIError{Code: "InvalidParameterValue", Message: "Value 50000 for parameter VisibilityTimeout is invalid."}, false},
+		{"throttled", &smithy.GenericAPIError{Code: "ThrottlingException"}, false},
+	}
+
+	ctx := context.Background()
+	msg := &Message{ID: "m1", Handle: "AQEB..."}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewSQSQueue(&staleSQS{err: tt.err}, "https://sqs/queue")
+			for op, err := range map[string]error{
+				"Ack":         q.Ack(ctx, msg),
+				"ExtendLease": q.ExtendLease(ctx, msg, time.Minute),
+				"Nack":        q.Nack(ctx, msg, 0),
+			} {
+				if got := errors.Is(err, ErrLeaseLost); got != tt.want {
+					t.Errorf("%s() error = %v, lease lost = %v, want %v", op, err, got, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go"
+)
+
+// SQSAPI defines the SQS operations used by SQSQueue.
+type SQSAPI interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	ChangeMessageVisibility(ctx context.Context, params *sqs.ChangeMessageVisibilityInput, optFns ...func(*sqs.Options)) (*sqs.ChangeMessageVisibilityOutput, error)
+	GetQueueAttributes(ctx context.Context, params *sqs.GetQueueAttributesInput, optFns ...func(*sqs.Options)) (*sqs.GetQueueAttributesOutput, error)
+}
+
+// SQSQueue is a Queue backed by an Amazon SQS queue.
+type SQSQueue struct {
+	client   SQSAPI
+	queueURL string
+	waitTime time.Duration
+}
+
+// NewSQSQueue creates a Queue for the given SQS queue URL.
+func NewSQSQueue(client SQSAPI, queueURL string) *SQSQueue {
+	return &SQSQueue{
+		client:   client,
+		queueURL: queueURL,
+		waitTime: DefaultWaitTime,
+	}
+}
+
+// maxSQSDelay is the longest delay SQS accepts on a message.
+const maxSQSDelay = 15 * time.Minute
+
+// Publish sends a message to the queue.
+func (q *SQSQueue) Publish(ctx context.Context, body string) error {
+	return q.PublishAfter(ctx, body, 0)
+}
+
+// PublishAfter sends a message that is delivered after delay, of at most
+// 15 minutes.
+func (q *SQSQueue) PublishAfter(ctx context.Context, body string, delay time.Duration) error {
+	_, err := q.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:     aws.String(q.queueURL),
+		MessageBody:  aws.String(body),
+		DelaySeconds: int32(min(delay, maxSQSDelay).Seconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	return nil
+}
+
+// Receive long-polls the queue for up to max messages.
+func (q *SQSQueue) Receive(ctx context.Context, max int, lease time.Duration) ([]*Message, error) {
+	return q.receive(ctx, max, lease, q.waitTime)
+}
+
+func (q *SQSQueue) receive(ctx context.Context, max int, lease, waitTime time.Duration) ([]*Message, error) {
+	result, err := q.client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+		QueueUrl:            aws.String(q.queueURL),
+		MaxNumberOfMessages: int32(max),
+		WaitTimeSeconds:     int32(waitTime.Seconds()),
+		VisibilityTimeout:   int32(lease.Seconds()),
+		MessageSystemAttributeNames: []types.MessageSystemAttributeName{
+			types.MessageSystemAttributeNameApproximateReceiveCount,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to receive messages: %w", err)
+	}
+
+	messages := make([]*Message, 0, len(result.Messages))
+	for _, m := range result.Messages {
+		count, err := strconv.Atoi(m.Attributes[string(types.MessageSystemAttributeNameApproximateReceiveCount)])
+		if err != nil {
+			count = 1
+		}
+		messages = append(messages, &Message{
+			ID:           aws.ToString(m.MessageId),
+			Body:         aws.ToString(m.Body),
+			ReceiveCount: count,
+			Handle:       aws.ToString(m.ReceiptHandle),
+		})
+	}
+	return messages, nil
+}
+
+// Ack deletes the message from the queue.
+func (q *SQSQueue) Ack(ctx context.Context, msg *Message) error {
+	_, err := q.client.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(q.queueURL),
+		ReceiptHandle: aws.String(msg.Handle),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete message: %w", mapSQSError(err))
+	}
+	return nil
+}
+
+// Nack makes the message visible again after delay.
+func (q *SQSQueue) Nack(ctx context.Context, msg *Message, delay time.Duration) error {
+	return q.changeVisibility(ctx, msg, delay)
+}
+
+// ExtendLease keeps the message hidden for lease from now.
+func (q *SQSQueue) ExtendLease(ctx context.Context, msg *Message, lease time.Duration) error {
+	return q.changeVisibility(ctx, msg, lease)
+}
+
+// Depth returns the approximate number of messages waiting to be received.
+func (q *SQSQueue) Depth(ctx context.Context) (int, error) {
+	result, err := q.client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(q.queueURL),
+		AttributeNames: []types.QueueAttributeName{types.QueueAttributeNameApproximateNumberOfMessages},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get queue attributes: %w", err)
+	}
+	depth, err := strconv.Atoi(result.Attributes[string(types.QueueAttributeNameApproximateNumberOfMessages)])
+	if err != nil {
+		return 0, fmt.Errorf("invalid queue depth: %w", err)
+	}
+	return depth, nil
+}
+
+func (q *SQSQueue) changeVisibility(ctx context.Context, msg *Message, timeout time.Duration) error {
+	_, err := q.client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+		QueueUrl:          aws.String(q.queueURL),
+		ReceiptHandle:     aws.String(msg.Handle),
+		VisibilityTimeout: int32(timeout.Seconds()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to change message visibility: %w", mapSQSError(err))
+	}
+	return nil
+}
+
+// mapSQSError converts stale receipt handle errors into ErrLeaseLost. SQS
+// reports an expired handle as a generic InvalidParameterValue naming the
+// receipt handle rather than with a typed error.
+func mapSQSError(err error) error {
+	var invalidHandle *types.ReceiptHandleIsInvalid
+	var notInflight *types.MessageNotInflight
+	if errors.As(err, &invalidHandle) || errors.As(err, &notInflight) || isExpiredHandle(err) {
+		return fmt.Errorf("%w: %v", ErrLeaseLost, err)
+	}
+	return err
+}
+
+// isExpiredHandle reports whether err rejects a receipt handle as an
+// invalid parameter value.
+func isExpiredHandle(err error) bool {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) || apiErr.ErrorCode() != "InvalidParameterValue" {
+		return false
+	}
+	return strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "receipt handle")
+}
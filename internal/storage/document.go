@@ -0,0 +1,520 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// videoDocuments stores whole videos by ID. It is the primitive shared by
+// the SQL and in-memory video stores; documentStore implements the
+// VideoStore rules on top of it, mirroring the conditions VideoRepository
+// sends to DynamoDB.
+type videoDocuments interface {
+	// load returns a video or models.ErrVideoNotFound.
+	load(ctx context.Context, videoID string) (*models.VideoMetadata, error)
+
+	// update reads a video, applies fn and writes the result atomically,
+	// returning the written video. A missing video is passed to fn as a zero
+	// video with exists false and created if fn succeeds. If fn returns
+	// errNoChange nothing is written.
+	update(ctx context.Context, videoID string, fn func(video *models.VideoMetadata, exists bool) error) (*models.VideoMetadata, error)
+
+	// setLatest points the latest pointer at a video; latest returns its ID,
+	// or an empty ID if no video has completed.
+	setLatest(ctx context.Context, videoID, processedAt string) error
+	latest(ctx context.Context) (string, error)
+
+	// list returns up to limit listed videos whose list key is below after,
+	// or all of them if after is empty, in descending key order.
+	list(ctx context.Context, limit int, after string) ([]models.VideoMetadata, error)
+}
+
+// errNoChange is returned by an update function that has nothing to write.
+var errNoChange = errors.New("no change")
+
+// videoDocument is the stored form of a video: its JSON representation plus
+// the lease and stage ownership the API representation leaves out.
+type videoDocument struct {
+	*models.VideoMetadata
+	LeaseOwner     string `json:"leaseOwner,omitempty"`
+	LeaseExpiresAt int64  `json:"leaseExpiresAt,omitempty"`
+	StagesOwner    string `json:"stagesOwner,omitempty"`
+}
+
+// encodeVideo encodes a video as a document.
+func encodeVideo(video *models.VideoMetadata) ([]byte, error) {
+	data, err := json.Marshal(videoDocument{
+		VideoMetadata:  video,
+		LeaseOwner:     video.LeaseOwner,
+		LeaseExpiresAt: video.LeaseExpiresAt,
+		StagesOwner:    video.StagesOwner,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal video: %w", err)
+	}
+	return data, nil
+}
+
+// decodeVideo decodes a document written by encodeVideo.
+func decodeVideo(data []byte) (*models.VideoMetadata, error) {
+	doc := videoDocument{VideoMetadata: &models.VideoMetadata{}}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal video: %w", err)
+	}
+	video := doc.VideoMetadata
+	video.LeaseOwner = doc.LeaseOwner
+	video.LeaseExpiresAt = doc.LeaseExpiresAt
+	video.StagesOwner = doc.StagesOwner
+	return video, nil
+}
+
+// listKey orders videos for listing, newest first, like the GSI1 sort key
+// of VideoRepository. Videos not created through CreateVideo have none and
+// are not listed.
+func listKey(video *models.VideoMetadata) string {
+	if video.CreatedAt == "" {
+		return ""
+	}
+	return video.CreatedAt + "#" + video.VideoID
+}
+
+// documentStore implements VideoStore on videoDocuments.
+type documentStore struct {
+	docs videoDocuments
+}
+
+// modify applies fn to an existing video.
+func (s *documentStore) modify(ctx context.Context, videoID string, fn func(video *models.VideoMetadata) error) (*models.VideoMetadata, error) {
+	return s.docs.update(ctx, videoID, func(video *models.VideoMetadata, exists bool) error {
+		if !exists {
+			return models.ErrVideoNotFound
+		}
+		return fn(video)
+	})
+}
+
+// setStatus moves a video to a new status, recording the change in its
+// history.
+func setStatus(video *models.VideoMetadata, to models.VideoStatus, actor, reason, now string) {
+	video.Status = to
+	video.UpdatedAt = now
+	video.StatusHistory = append(video.StatusHistory, models.StatusTransition{
+		Status: to,
+		At:     now,
+		Actor:  actor,
+		Reason: reason,
+	})
+}
+
+// clearLease removes a video's processing lease.
+func clearLease(video *models.VideoMetadata) {
+	video.LeaseOwner = ""
+	video.LeaseExpiresAt = 0
+}
+
+// CreateVideo creates a new video metadata record.
+func (s *documentStore) CreateVideo(ctx context.Context, videoID, filename, s3RawKey string, fileSizeBytes int64) (*models.VideoMetadata, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	return s.docs.update(ctx, videoID, func(video *models.VideoMetadata, exists bool) error {
+		if exists {
+			return fmt.Errorf("%w: %s", models.ErrVideoExists, videoID)
+		}
+		*video = models.VideoMetadata{
+			VideoID:       videoID,
+			Filename:      filename,
+			Status:        models.StatusPending,
+			S3RawKey:      s3RawKey,
+			FileSizeBytes: fileSizeBytes,
+			LatestVersion: 1,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			StatusHistory: []models.StatusTransition{
+				{Status: models.StatusPending, At: now, Actor: models.ActorAPI, Reason: "upload completed"},
+			},
+		}
+		return nil
+	})
+}
+
+// GetVideo retrieves video metadata by ID.
+func (s *documentStore) GetVideo(ctx context.Context, videoID string) (*models.VideoMetadata, error) {
+	return s.docs.load(ctx, videoID)
+}
+
+// ClaimVideo takes the processing lease on a video and moves it to
+// processing. See VideoRepository.ClaimVideo.
+func (s *documentStore) ClaimVideo(ctx context.Context, videoID, owner string, lease time.Duration, receiveCount, version int) (*models.VideoMetadata, error) {
+	now := time.Now().UTC()
+
+	return s.docs.update(ctx, videoID, func(video *models.VideoMetadata, exists bool) error {
+		if !exists {
+			return models.ErrVideoNotFound
+		}
+		leaseFree := video.LeaseOwner == "" || video.LeaseOwner == owner || video.LeaseExpiresAt < now.Unix()
+		current := version <= 0 || video.LatestVersion <= version
+		if !video.Status.CanTransitionTo(models.StatusProcessing) || !leaseFree || !current {
+			return claimError(video, version)
+		}
+
+		setStatus(video, models.StatusProcessing, owner, "claimed", now.Format(time.RFC3339))
+		video.LeaseOwner = owner
+		video.LeaseExpiresAt = now.Add(lease).Unix()
+		video.ReceiveCount = receiveCount
+		video.Attempts++
+		return nil
+	})
+}
+
+// TransitionVideo moves a video to a new status without touching other
+// attributes, recording the change in its history.
+func (s *documentStore) TransitionVideo(ctx context.Context, videoID string, to models.VideoStatus, actor, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if !video.Status.CanTransitionTo(to) {
+			return transitionError(video, to)
+		}
+		setStatus(video, to, actor, reason, now)
+		return nil
+	})
+	return err
+}
+
+// ReprocessVideo moves a video to reprocessing and allocates the next output
+// version for the new job.
+func (s *documentStore) ReprocessVideo(ctx context.Context, videoID, actor, reason string) (*models.VideoMetadata, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	return s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if !video.Status.CanTransitionTo(models.StatusReprocessing) {
+			return transitionError(video, models.StatusReprocessing)
+		}
+		setStatus(video, models.StatusReprocessing, actor, reason, now)
+		video.LatestVersion++
+		return nil
+	})
+}
+
+// RenewVideoLease extends the processing lease held by owner.
+func (s *documentStore) RenewVideoLease(ctx context.Context, videoID, owner string, lease time.Duration) error {
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if video.LeaseOwner != owner {
+			return models.ErrLeaseNotHeld
+		}
+		video.LeaseExpiresAt = time.Now().Add(lease).Unix()
+		return nil
+	})
+	return err
+}
+
+// ReleaseVideoLease gives up the processing lease held by owner without
+// changing the video's status.
+func (s *documentStore) ReleaseVideoLease(ctx context.Context, videoID, owner string) error {
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if video.LeaseOwner != owner {
+			return models.ErrLeaseNotHeld
+		}
+		clearLease(video)
+		return nil
+	})
+	return err
+}
+
+// ReleaseVideo returns a video whose processing was interrupted to pending,
+// or reprocessing if it serves a published version, and releases owner's
+// lease, without recording a failure.
+func (s *documentStore) ReleaseVideo(ctx context.Context, videoID, owner, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if video.LeaseOwner != owner || !video.Status.CanTransitionTo(models.StatusPending) {
+			return transitionError(video, models.StatusPending)
+		}
+		setStatus(video, requeueStatus(video), owner, reason, now)
+		clearLease(video)
+		return nil
+	})
+	return err
+}
+
+// RequestCancellation flags a video being processed for cancellation.
+func (s *documentStore) RequestCancellation(ctx context.Context, videoID string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if video.Status != models.StatusProcessing && video.Status != models.StatusReprocessing {
+			return fmt.Errorf("%w: cannot cancel %s video", models.ErrInvalidTransition, video.Status)
+		}
+		video.CancelRequested = true
+		video.UpdatedAt = now
+		return nil
+	})
+	return err
+}
+
+// CancelVideo moves a video whose processing was stopped on request to
+// cancelled, or back to completed if it still serves a published version,
+// and releases owner's lease.
+func (s *documentStore) CancelVideo(ctx context.Context, videoID, owner, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		to, reason := attemptOutcome(video, models.StatusCancelled, reason)
+		if video.LeaseOwner != owner || !video.Status.CanTransitionTo(to) {
+			return transitionError(video, to)
+		}
+		setStatus(video, to, owner, reason, now)
+		clearLease(video)
+		video.CancelRequested = false
+		return nil
+	})
+	return err
+}
+
+// CompleteVideoProcessing marks a video as completed, publishes its output
+// version, releases owner's lease and updates the latest pointer.
+func (s *documentStore) CompleteVideoProcessing(ctx context.Context, videoID, owner, playbackURL, hlsPrefix string, output models.OutputVersion) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if !video.Status.CanTransitionTo(models.StatusCompleted) {
+			return fmt.Errorf("%w: %s to %s", models.ErrInvalidTransition, video.Status, models.StatusCompleted)
+		}
+		if video.LeaseOwner != owner {
+			return models.ErrLeaseNotHeld
+		}
+
+		video.Versions = models.PublishVersion(storedVersions(video), output, now)
+		setStatus(video, models.StatusCompleted, owner, "processed", now)
+		video.ProcessedAt = now
+		video.PlaybackURL = playbackURL
+		video.S3HLSPrefix = hlsPrefix
+		video.QualityPresets = output.Presets
+		video.CurrentVersion = output.Version
+		video.Profile = output.Profile
+		clearLease(video)
+		video.CancelRequested = false
+		video.Checkpoints = nil
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete video: %w", err)
+	}
+
+	if err := s.docs.setLatest(ctx, videoID, now); err != nil {
+		return fmt.Errorf("failed to update latest pointer: %w", err)
+	}
+
+	return nil
+}
+
+// RollbackVideo makes a stored output version of a completed video current
+// again, switching its playback URL back to that version.
+func (s *documentStore) RollbackVideo(ctx context.Context, videoID string, version int, playbackURL string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if video.Status != models.StatusCompleted {
+			return fmt.Errorf("%w: cannot roll back %s video", models.ErrInvalidTransition, video.Status)
+		}
+		if version == video.CurrentVersion {
+			return fmt.Errorf("%w: version %d is already current", models.ErrInvalidTransition, version)
+		}
+		versions, ok := models.RestoreVersion(video.Versions, version, now)
+		if !ok {
+			return fmt.Errorf("%w: version %d", models.ErrVersionNotFound, version)
+		}
+		target := versions[len(versions)-1]
+
+		video.UpdatedAt = now
+		video.PlaybackURL = playbackURL
+		video.S3HLSPrefix = models.HLSPrefix(videoID, version)
+		video.QualityPresets = target.Presets
+		video.CurrentVersion = version
+		video.Profile = target.Profile
+		video.Versions = versions
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll back video: %w", err)
+	}
+
+	return nil
+}
+
+// PruneVersions removes the given versions from a video's stored versions,
+// skipping the current one, and returns the versions removed.
+func (s *documentStore) PruneVersions(ctx context.Context, videoID string, prune []int) ([]int, error) {
+	var removed []int
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		removed = nil
+		var kept []models.OutputVersion
+		for _, entry := range video.Versions {
+			if entry.Version != video.CurrentVersion && slices.Contains(prune, entry.Version) {
+				removed = append(removed, entry.Version)
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		if len(removed) == 0 {
+			return errNoChange
+		}
+		video.Versions = kept
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune versions: %w", err)
+	}
+
+	return removed, nil
+}
+
+// endAttempt ends owner's processing attempt with a status change, if the
+// lease is free or owner's, and releases the lease. Failures of videos that
+// still serve a published version return them to completed; see
+// attemptOutcome.
+func (s *documentStore) endAttempt(ctx context.Context, videoID, owner string, to models.VideoStatus, reason string, apply func(video *models.VideoMetadata)) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		to, reason := attemptOutcome(video, to, reason)
+		if !video.Status.CanTransitionTo(to) || (video.LeaseOwner != "" && video.LeaseOwner != owner) {
+			return transitionError(video, to)
+		}
+		if to == models.StatusPending {
+			to = requeueStatus(video)
+		}
+		setStatus(video, to, owner, reason, now)
+		clearLease(video)
+		apply(video)
+		return nil
+	})
+	return err
+}
+
+// FailVideoProcessing marks a video as failed with the class of the failure
+// and releases owner's lease.
+func (s *documentStore) FailVideoProcessing(ctx context.Context, videoID, owner, errorMessage string, class models.ErrorClass) error {
+	return s.endAttempt(ctx, videoID, owner, models.StatusFailed, errorMessage, func(video *models.VideoMetadata) {
+		video.ErrorMessage = errorMessage
+		video.ErrorClass = class
+		video.CancelRequested = false
+	})
+}
+
+// RetryVideoProcessing returns a video to pending, or reprocessing if it
+// serves a published version, after a transient failure, keeping the error,
+// and releases owner's lease.
+func (s *documentStore) RetryVideoProcessing(ctx context.Context, videoID, owner, errorMessage string, class models.ErrorClass) error {
+	return s.endAttempt(ctx, videoID, owner, models.StatusPending, errorMessage, func(video *models.VideoMetadata) {
+		video.ErrorMessage = errorMessage
+		video.ErrorClass = class
+	})
+}
+
+// RejectVideo marks a video as failed because its input did not pass
+// validation and releases owner's lease.
+func (s *documentStore) RejectVideo(ctx context.Context, videoID, owner string, code models.RejectionCode, reason string) error {
+	return s.endAttempt(ctx, videoID, owner, models.StatusFailed, "rejected: "+string(code), func(video *models.VideoMetadata) {
+		video.ErrorMessage = reason
+		video.ErrorClass = models.ErrorClassPermanent
+		video.RejectionCode = code
+		video.RejectionReason = reason
+		video.CancelRequested = false
+	})
+}
+
+// UpdateVideoAnalysis stores the content analysis summary on a video.
+func (s *documentStore) UpdateVideoAnalysis(ctx context.Context, videoID string, summary models.AnalysisSummary) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		video.Analysis = &summary
+		video.UpdatedAt = now
+		return nil
+	})
+	return err
+}
+
+// UpdateVideoPreview stores the animated preview locations on a video.
+func (s *documentStore) UpdateVideoPreview(ctx context.Context, videoID string, preview models.PreviewAssets) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		video.Preview = &preview
+		video.UpdatedAt = now
+		return nil
+	})
+	return err
+}
+
+// RecordStages stores the pipeline stage records of owner's processing
+// attempt. See VideoRepository.RecordStages.
+func (s *documentStore) RecordStages(ctx context.Context, videoID, owner string, stages []models.StageRun) error {
+	_, err := s.docs.update(ctx, videoID, func(video *models.VideoMetadata, exists bool) error {
+		if !exists || (video.LeaseOwner != owner && (video.LeaseOwner != "" || video.StagesOwner != owner)) {
+			return models.ErrLeaseNotHeld
+		}
+		video.Stages = stages
+		video.StagesOwner = owner
+		return nil
+	})
+	return err
+}
+
+// SaveCheckpoint appends a stage checkpoint to a video while owner holds
+// its processing lease.
+func (s *documentStore) SaveCheckpoint(ctx context.Context, videoID, owner string, checkpoint models.Checkpoint) error {
+	_, err := s.modify(ctx, videoID, func(video *models.VideoMetadata) error {
+		if video.LeaseOwner != owner {
+			return models.ErrLeaseNotHeld
+		}
+		video.Checkpoints = append(video.Checkpoints, checkpoint)
+		return nil
+	})
+	return err
+}
+
+// GetLatestVideo retrieves the most recently processed video.
+func (s *documentStore) GetLatestVideo(ctx context.Context) (*models.VideoMetadata, error) {
+	videoID, err := s.docs.latest(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if videoID == "" {
+		return nil, models.ErrVideoNotFound
+	}
+	return s.docs.load(ctx, videoID)
+}
+
+// ListVideos retrieves videos in reverse chronological order. The cursor
+// encodes the list key of the last video returned.
+func (s *documentStore) ListVideos(ctx context.Context, limit int32, cursor string) ([]models.VideoMetadata, string, error) {
+	var after string
+	if cursor != "" {
+		key, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil || len(key) == 0 {
+			return nil, "", fmt.Errorf("%w: %s", models.ErrInvalidCursor, cursor)
+		}
+		after = string(key)
+	}
+
+	videos, err := s.docs.list(ctx, int(limit), after)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var next string
+	if limit > 0 && len(videos) == int(limit) {
+		next = base64.RawURLEncoding.EncodeToString([]byte(listKey(&videos[len(videos)-1])))
+	}
+	return videos, next, nil
+}
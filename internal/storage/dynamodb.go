@@ -2,8 +2,13 @@ package storage
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
@@ -40,7 +45,12 @@ func NewVideoRepository(ctx context.Context, cfg *config.Config) (*VideoReposito
 	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
 
 	return &VideoRepository{
-		client:    dynamodb.NewFromConfig(awsCfg),
+		client: dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+			// DynamoDB Local or another compatible endpoint
+			if cfg.AWS.DynamoDBEndpoint != "" {
+				o.BaseEndpoint = aws.String(cfg.AWS.DynamoDBEndpoint)
+			}
+		}),
 		tableName: cfg.AWS.DynamoDBTable,
 	}, nil
 }
@@ -67,8 +77,12 @@ func (r *VideoRepository) CreateVideo(ctx context.Context, videoID, filename, s3
 		Status:        models.StatusPending,
 		S3RawKey:      s3RawKey,
 		FileSizeBytes: fileSizeBytes,
+		LatestVersion: 1,
 		CreatedAt:     now,
 		UpdatedAt:     now,
+		StatusHistory: []models.StatusTransition{
+			{Status: models.StatusPending, At: now, Actor: models.ActorAPI, Reason: "upload completed"},
+		},
 	}
 
 	item, err := attributevalue.MarshalMap(video)
@@ -84,9 +98,9 @@ func (r *VideoRepository) CreateVideo(ctx context.Context, videoID, filename, s3
 	if err != nil {
 		var condErr *types.ConditionalCheckFailedException
 		if errors.As(err, &condErr) {
-			return nil, fmt.Errorf("video already exists: %s", videoID)
+			return nil, fmt.Errorf("%w: %s", models.ErrVideoExists, videoID)
 		}
-		return nil, fmt.Errorf("failed to create video: %w", err)
+		return nil, fmt.Errorf("failed to create video: %w", awsError(err))
 	}
 
 	return video, nil
@@ -102,7 +116,7 @@ func (r *VideoRepository) GetVideo(ctx context.Context, videoID string) (*models
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get video: %w", err)
+		return nil, fmt.Errorf("failed to get video: %w", awsError(err))
 	}
 
 	if result.Item == nil {
@@ -117,75 +131,508 @@ func (r *VideoRepository) GetVideo(ctx context.Context, videoID string) (*models
 	return &video, nil
 }
 
-// UpdateVideoProcessing marks a video as processing.
-func (r *VideoRepository) UpdateVideoProcessing(ctx context.Context, videoID string) error {
-	now := time.Now().UTC().Format(time.RFC3339)
+// ClaimVideo takes the processing lease on a video and moves it to
+// processing. The claim succeeds if the lease is free, expired or already
+// held by owner. It returns ErrVideoNotFound for unknown videos rather than
+// creating them, ErrVideoAlreadyCompleted for finished videos,
+// ErrVideoCancelled for cancelled ones, ErrStaleJob if a newer output
+// version than the job's has been allocated,
+// ErrInvalidTransition if the video cannot be processed from its current
+// status and ErrLeaseHeld if another worker holds a live lease. The queue's
+// receive count for the job is recorded alongside the attempt.
+func (r *VideoRepository) ClaimVideo(ctx context.Context, videoID, owner string, lease time.Duration, receiveCount, version int) (*models.VideoMetadata, error) {
+	now := time.Now().UTC()
 
-	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	values := map[string]types.AttributeValue{
+		":status":     &types.AttributeValueMemberS{Value: string(models.StatusProcessing)},
+		":video_id":   &types.AttributeValueMemberS{Value: videoID},
+		":updated_at": &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		":owner":      &types.AttributeValueMemberS{Value: owner},
+		":expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(lease).Unix(), 10)},
+		":now":        &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+		":one":        &types.AttributeValueMemberN{Value: "1"},
+		":receives":   &types.AttributeValueMemberN{Value: strconv.Itoa(receiveCount)},
+	}
+	// Jobs for superseded versions must not overwrite newer output
+	versionCond := ""
+	if version > 0 {
+		values[":version"] = &types.AttributeValueMemberN{Value: strconv.Itoa(version)}
+		versionCond = " AND (attribute_not_exists(latest_version) OR latest_version <= :version)"
+	}
+	statusCond, history, err := statusChange(models.StatusProcessing, owner, "claimed", values)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.tableName),
 		Key: map[string]types.AttributeValue{
 			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
 			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
 		},
-		UpdateExpression: aws.String("SET #status = :status, updated_at = :updated_at"),
+		UpdateExpression: aws.String(`
+			SET #status = :status,
+			    video_id = :video_id,
+			    updated_at = :updated_at,
+			    lease_owner = :owner,
+			    lease_expires_at = :expires_at,
+			    receive_count = :receives,
+			    ` + history + `
+			ADD attempts :one
+		`),
+		ConditionExpression: aws.String(`
+			attribute_exists(pk) AND
+			(attribute_not_exists(#status) OR ` + statusCond + `) AND
+			(attribute_not_exists(lease_owner) OR lease_owner = :owner OR lease_expires_at < :now)
+		` + versionCond),
 		ExpressionAttributeNames: map[string]string{
 			"#status": "status",
 		},
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return nil, r.claimConflict(ctx, videoID, version)
+		}
+		return nil, fmt.Errorf("failed to claim video: %w", awsError(err))
+	}
+
+	var video models.VideoMetadata
+	if err := attributevalue.UnmarshalMap(result.Attributes, &video); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal video: %w", err)
+	}
+
+	return &video, nil
+}
+
+// claimConflict explains why a claim's condition failed.
+func (r *VideoRepository) claimConflict(ctx context.Context, videoID string, version int) error {
+	video, err := r.GetVideo(ctx, videoID)
+	if err != nil {
+		return err
+	}
+	return claimError(video, version)
+}
+
+// leaseConflict explains why a write conditional on holding the lease failed.
+func (r *VideoRepository) leaseConflict(ctx context.Context, videoID string) error {
+	if _, err := r.GetVideo(ctx, videoID); err != nil {
+		return err
+	}
+	return models.ErrLeaseNotHeld
+}
+
+// transitionConflict explains why a status change's condition failed: the
+// video is missing, its status does not allow the change, or the lease is
+// held by another worker.
+func (r *VideoRepository) transitionConflict(ctx context.Context, videoID string, to models.VideoStatus) error {
+	video, err := r.GetVideo(ctx, videoID)
+	if err != nil {
+		return err
+	}
+	return transitionError(video, to)
+}
+
+// attemptOutcome reads a video and returns the status and history reason an
+// attempt ending in to leaves it in (see attemptOutcome), with a condition
+// that holds while the video is as read: serving a published version or not.
+func (r *VideoRepository) attemptOutcome(ctx context.Context, videoID string, to models.VideoStatus, reason string) (models.VideoStatus, string, string, error) {
+	video, err := r.GetVideo(ctx, videoID)
+	if err != nil {
+		return "", "", "", err
+	}
+	to, reason = attemptOutcome(video, to, reason)
+	return to, reason, servedCondition(video), nil
+}
+
+// requeueStatus reads a video and returns the status an interrupted or
+// retried attempt leaves it in (see requeueStatus), with a condition that
+// holds while the video is as read.
+func (r *VideoRepository) requeueStatus(ctx context.Context, videoID string) (models.VideoStatus, string, error) {
+	video, err := r.GetVideo(ctx, videoID)
+	if err != nil {
+		return "", "", err
+	}
+	return requeueStatus(video), servedCondition(video), nil
+}
+
+// servedCondition returns a condition that holds while a video is, as in
+// video, serving a published version or not.
+func servedCondition(video *models.VideoMetadata) string {
+	if video.PlaybackURL != "" {
+		return "attribute_exists(playback_url)"
+	}
+	return "attribute_not_exists(playback_url)"
+}
+
+// statusChange prepares a status change to the given status. It returns a
+// condition restricting the current status to the legal sources of to and a
+// SET clause appending the change to the status history, adding the values
+// both reference to values.
+func statusChange(to models.VideoStatus, actor, reason string, values map[string]types.AttributeValue) (condition, history string, err error) {
+	return statusChangeFrom(models.TransitionSources(to), to, actor, reason, values)
+}
+
+// statusChangeFrom is statusChange for a change to to from sources other
+// than its legal ones.
+func statusChangeFrom(sources []models.VideoStatus, to models.VideoStatus, actor, reason string, values map[string]types.AttributeValue) (condition, history string, err error) {
+	placeholders := make([]string, len(sources))
+	for i, source := range sources {
+		placeholders[i] = fmt.Sprintf(":from%d", i)
+		values[placeholders[i]] = &types.AttributeValueMemberS{Value: string(source)}
+	}
+
+	entry, err := attributevalue.MarshalMap(models.StatusTransition{
+		Status: to,
+		At:     time.Now().UTC().Format(time.RFC3339),
+		Actor:  actor,
+		Reason: reason,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to marshal status transition: %w", err)
+	}
+	values[":history"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{
+		&types.AttributeValueMemberM{Value: entry},
+	}}
+	values[":empty_list"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{}}
+
+	condition = fmt.Sprintf("#status IN (%s)", strings.Join(placeholders, ", "))
+	history = "status_history = list_append(if_not_exists(status_history, :empty_list), :history)"
+	return condition, history, nil
+}
+
+// TransitionVideo moves a video to a new status without touching other
+// attributes, recording the change in its history. It returns
+// ErrInvalidTransition if the current status does not allow the change.
+func (r *VideoRepository) TransitionVideo(ctx context.Context, videoID string, to models.VideoStatus, actor, reason string) error {
+	values := map[string]types.AttributeValue{
+		":status":     &types.AttributeValueMemberS{Value: string(to)},
+		":updated_at": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	}
+	statusCond, history, err := statusChange(to, actor, reason, values)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, updated_at = :updated_at, " + history),
+		ConditionExpression: aws.String("attribute_exists(pk) AND " + statusCond),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.transitionConflict(ctx, videoID, to)
+		}
+		return fmt.Errorf("failed to update video status: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// ReprocessVideo moves a video to reprocessing and allocates the next output
+// version for the new job. It returns the updated video, whose
+// LatestVersion is the allocated version, or ErrInvalidTransition if the
+// video cannot be reprocessed from its current status.
+func (r *VideoRepository) ReprocessVideo(ctx context.Context, videoID, actor, reason string) (*models.VideoMetadata, error) {
+	values := map[string]types.AttributeValue{
+		":status":     &types.AttributeValueMemberS{Value: string(models.StatusReprocessing)},
+		":updated_at": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		":one":        &types.AttributeValueMemberN{Value: "1"},
+	}
+	statusCond, history, err := statusChange(models.StatusReprocessing, actor, reason, values)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, updated_at = :updated_at, " + history + " ADD latest_version :one"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND " + statusCond),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return nil, r.transitionConflict(ctx, videoID, models.StatusReprocessing)
+		}
+		return nil, fmt.Errorf("failed to reprocess video: %w", awsError(err))
+	}
+
+	var video models.VideoMetadata
+	if err := attributevalue.UnmarshalMap(result.Attributes, &video); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal video: %w", err)
+	}
+
+	return &video, nil
+}
+
+// RenewVideoLease extends the processing lease held by owner.
+func (r *VideoRepository) RenewVideoLease(ctx context.Context, videoID, owner string, lease time.Duration) error {
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:    aws.String("SET lease_expires_at = :expires_at"),
+		ConditionExpression: aws.String("lease_owner = :owner"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":status":     &types.AttributeValueMemberS{Value: string(models.StatusProcessing)},
-			":updated_at": &types.AttributeValueMemberS{Value: now},
+			":owner":      &types.AttributeValueMemberS{Value: owner},
+			":expires_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(time.Now().Add(lease).Unix(), 10)},
 		},
-		ConditionExpression: aws.String("attribute_exists(pk)"),
 	})
 	if err != nil {
 		var condErr *types.ConditionalCheckFailedException
 		if errors.As(err, &condErr) {
-			return models.ErrVideoNotFound
+			return r.leaseConflict(ctx, videoID)
 		}
-		return fmt.Errorf("failed to update video: %w", err)
+		return fmt.Errorf("failed to renew video lease: %w", awsError(err))
 	}
 
 	return nil
 }
 
-// CompleteVideoProcessing marks a video as completed and updates the latest pointer.
-func (r *VideoRepository) CompleteVideoProcessing(ctx context.Context, videoID, playbackURL, hlsPrefix string, presets []models.QualityPreset) error {
-	now := time.Now().UTC().Format(time.RFC3339)
+// ReleaseVideoLease gives up the processing lease held by owner without
+// changing the video's status.
+func (r *VideoRepository) ReleaseVideoLease(ctx context.Context, videoID, owner string) error {
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:    aws.String("REMOVE lease_owner, lease_expires_at"),
+		ConditionExpression: aws.String("lease_owner = :owner"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.leaseConflict(ctx, videoID)
+		}
+		return fmt.Errorf("failed to release video lease: %w", awsError(err))
+	}
+
+	return nil
+}
 
-	presetsAV, err := attributevalue.MarshalList(presets)
+// ReleaseVideo returns a video whose processing was interrupted to pending,
+// or reprocessing if it serves a published version, and releases owner's
+// lease, without recording a failure.
+func (r *VideoRepository) ReleaseVideo(ctx context.Context, videoID, owner, reason string) error {
+	to, servedCond, err := r.requeueStatus(ctx, videoID)
 	if err != nil {
-		return fmt.Errorf("failed to marshal presets: %w", err)
+		return err
+	}
+	values := map[string]types.AttributeValue{
+		":owner":      &types.AttributeValueMemberS{Value: owner},
+		":status":     &types.AttributeValueMemberS{Value: string(to)},
+		":updated_at": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	}
+	statusCond, history, err := statusChangeFrom(models.TransitionSources(models.StatusPending), to, owner, reason, values)
+	if err != nil {
+		return err
 	}
 
-	// Update video record
 	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.tableName),
 		Key: map[string]types.AttributeValue{
 			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
 			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
 		},
-		UpdateExpression: aws.String(`
-			SET #status = :status, 
-			    updated_at = :updated_at, 
-			    processed_at = :processed_at,
-			    playback_url = :playback_url,
-			    s3_hls_prefix = :hls_prefix,
-			    quality_presets = :presets
-		`),
+		UpdateExpression:    aws.String("SET #status = :status, updated_at = :updated_at, " + history + " REMOVE lease_owner, lease_expires_at"),
+		ConditionExpression: aws.String("lease_owner = :owner AND " + statusCond + " AND " + servedCond),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.transitionConflict(ctx, videoID, models.StatusPending)
+		}
+		return fmt.Errorf("failed to release video: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// RequestCancellation flags a video being processed for cancellation. The
+// worker holding its lease notices the flag and stops. It returns
+// ErrInvalidTransition if the video is not being processed.
+func (r *VideoRepository) RequestCancellation(ctx context.Context, videoID string) error {
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:    aws.String("SET cancel_requested = :true, updated_at = :updated_at"),
+		ConditionExpression: aws.String("#status IN (:processing, :reprocessing)"),
 		ExpressionAttributeNames: map[string]string{
 			"#status": "status",
 		},
 		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":true":         &types.AttributeValueMemberBOOL{Value: true},
+			":updated_at":   &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+			":processing":   &types.AttributeValueMemberS{Value: string(models.StatusProcessing)},
+			":reprocessing": &types.AttributeValueMemberS{Value: string(models.StatusReprocessing)},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			video, getErr := r.GetVideo(ctx, videoID)
+			if getErr != nil {
+				return getErr
+			}
+			return fmt.Errorf("%w: cannot cancel %s video", models.ErrInvalidTransition, video.Status)
+		}
+		return fmt.Errorf("failed to request cancellation: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// CancelVideo moves a video whose processing was stopped on request to
+// cancelled, or back to completed if it still serves a published version,
+// and releases owner's lease. It returns ErrInvalidTransition if the video
+// was already cancelled.
+func (r *VideoRepository) CancelVideo(ctx context.Context, videoID, owner, reason string) error {
+	to, reason, servedCond, err := r.attemptOutcome(ctx, videoID, models.StatusCancelled, reason)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":owner":      &types.AttributeValueMemberS{Value: owner},
+		":status":     &types.AttributeValueMemberS{Value: string(to)},
+		":updated_at": &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	}
+	statusCond, history, err := statusChange(to, owner, reason, values)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:    aws.String("SET #status = :status, updated_at = :updated_at, " + history + " REMOVE lease_owner, lease_expires_at, cancel_requested"),
+		ConditionExpression: aws.String("lease_owner = :owner AND " + statusCond + " AND " + servedCond),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.transitionConflict(ctx, videoID, to)
+		}
+		return fmt.Errorf("failed to cancel video: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// CompleteVideoProcessing marks a video as completed, releases owner's lease
+// and updates the latest pointer. The output version is published in the
+// same conditional write: the playback URL, prefix, profile and presets
+// switch to it and the version it replaces is marked superseded, so playback
+// moves to new output only when the job succeeds. It returns ErrLeaseNotHeld
+// if owner no longer holds the lease.
+func (r *VideoRepository) CompleteVideoProcessing(ctx context.Context, videoID, owner, playbackURL, hlsPrefix string, output models.OutputVersion) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	presetsAV, err := attributevalue.MarshalList(output.Presets)
+	if err != nil {
+		return fmt.Errorf("failed to marshal presets: %w", err)
+	}
+
+	err = r.updateVersions(ctx, videoID, func(video *models.VideoMetadata) (*dynamodb.UpdateItemInput, error) {
+		if !video.Status.CanTransitionTo(models.StatusCompleted) {
+			return nil, fmt.Errorf("%w: %s to %s", models.ErrInvalidTransition, video.Status, models.StatusCompleted)
+		}
+		if video.LeaseOwner != owner {
+			return nil, models.ErrLeaseNotHeld
+		}
+
+		versionsAV, err := attributevalue.MarshalList(models.PublishVersion(storedVersions(video), output, now))
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal versions: %w", err)
+		}
+
+		values := map[string]types.AttributeValue{
+			":owner":        &types.AttributeValueMemberS{Value: owner},
 			":status":       &types.AttributeValueMemberS{Value: string(models.StatusCompleted)},
 			":updated_at":   &types.AttributeValueMemberS{Value: now},
 			":processed_at": &types.AttributeValueMemberS{Value: now},
 			":playback_url": &types.AttributeValueMemberS{Value: playbackURL},
 			":hls_prefix":   &types.AttributeValueMemberS{Value: hlsPrefix},
 			":presets":      &types.AttributeValueMemberL{Value: presetsAV},
-		},
+			":version":      &types.AttributeValueMemberN{Value: strconv.Itoa(output.Version)},
+			":profile":      &types.AttributeValueMemberS{Value: output.Profile},
+			":versions":     &types.AttributeValueMemberL{Value: versionsAV},
+		}
+		statusCond, history, err := statusChange(models.StatusCompleted, owner, "processed", values)
+		if err != nil {
+			return nil, err
+		}
+
+		return &dynamodb.UpdateItemInput{
+			TableName: aws.String(r.tableName),
+			Key: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+				"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+			},
+			UpdateExpression: aws.String(`
+				SET #status = :status,
+				    updated_at = :updated_at,
+				    processed_at = :processed_at,
+				    playback_url = :playback_url,
+				    s3_hls_prefix = :hls_prefix,
+				    quality_presets = :presets,
+				    current_version = :version,
+				    profile = :profile,
+				    versions = :versions,
+				    versions_rev = :versions_next,
+				    ` + history + `
+				REMOVE lease_owner, lease_expires_at, cancel_requested, checkpoints
+			`),
+			ConditionExpression: aws.String("lease_owner = :owner AND " + statusCond + " AND " + versionsGuard(video, values)),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "status",
+			},
+			ExpressionAttributeValues: values,
+		}, nil
 	})
 	if err != nil {
-		return fmt.Errorf("failed to complete video: %w", err)
+		return fmt.Errorf("failed to complete video: %w", awsError(err))
 	}
 
 	// Update LATEST pointer
@@ -202,34 +649,470 @@ func (r *VideoRepository) CompleteVideoProcessing(ctx context.Context, videoID,
 		Item:      latestItem,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to update latest pointer: %w", err)
+		return fmt.Errorf("failed to update latest pointer: %w", awsError(err))
 	}
 
 	return nil
 }
 
-// FailVideoProcessing marks a video as failed.
-func (r *VideoRepository) FailVideoProcessing(ctx context.Context, videoID, errorMessage string) error {
+// RollbackVideo makes a stored output version of a completed video current
+// again, switching its playback URL back to that version. It returns
+// ErrVersionNotFound if the version is not stored and ErrInvalidTransition
+// if the video is not completed or the version is already current.
+func (r *VideoRepository) RollbackVideo(ctx context.Context, videoID string, version int, playbackURL string) error {
 	now := time.Now().UTC().Format(time.RFC3339)
 
-	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+	err := r.updateVersions(ctx, videoID, func(video *models.VideoMetadata) (*dynamodb.UpdateItemInput, error) {
+		if video.Status != models.StatusCompleted {
+			return nil, fmt.Errorf("%w: cannot roll back %s video", models.ErrInvalidTransition, video.Status)
+		}
+		if version == video.CurrentVersion {
+			return nil, fmt.Errorf("%w: version %d is already current", models.ErrInvalidTransition, version)
+		}
+		versions, ok := models.RestoreVersion(video.Versions, version, now)
+		if !ok {
+			return nil, fmt.Errorf("%w: version %d", models.ErrVersionNotFound, version)
+		}
+		target := versions[len(versions)-1]
+
+		versionsAV, err := attributevalue.MarshalList(versions)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal versions: %w", err)
+		}
+		presetsAV, err := attributevalue.MarshalList(target.Presets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal presets: %w", err)
+		}
+
+		values := map[string]types.AttributeValue{
+			":completed":    &types.AttributeValueMemberS{Value: string(models.StatusCompleted)},
+			":updated_at":   &types.AttributeValueMemberS{Value: now},
+			":playback_url": &types.AttributeValueMemberS{Value: playbackURL},
+			":hls_prefix":   &types.AttributeValueMemberS{Value: models.HLSPrefix(videoID, version)},
+			":presets":      &types.AttributeValueMemberL{Value: presetsAV},
+			":version":      &types.AttributeValueMemberN{Value: strconv.Itoa(version)},
+			":profile":      &types.AttributeValueMemberS{Value: target.Profile},
+			":versions":     &types.AttributeValueMemberL{Value: versionsAV},
+			":current":      &types.AttributeValueMemberN{Value: strconv.Itoa(video.CurrentVersion)},
+		}
+
+		return &dynamodb.UpdateItemInput{
+			TableName: aws.String(r.tableName),
+			Key: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+				"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+			},
+			UpdateExpression: aws.String(`
+				SET updated_at = :updated_at,
+				    playback_url = :playback_url,
+				    s3_hls_prefix = :hls_prefix,
+				    quality_presets = :presets,
+				    current_version = :version,
+				    profile = :profile,
+				    versions = :versions,
+				    versions_rev = :versions_next
+			`),
+			ConditionExpression: aws.String("#status = :completed AND current_version = :current AND " + versionsGuard(video, values)),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "status",
+			},
+			ExpressionAttributeValues: values,
+		}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to roll back video: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// PruneVersions removes the given versions from a video's stored versions,
+// skipping the current one, and returns the versions removed. Their objects
+// must be deleted by the caller afterwards.
+func (r *VideoRepository) PruneVersions(ctx context.Context, videoID string, prune []int) ([]int, error) {
+	var removed []int
+	err := r.updateVersions(ctx, videoID, func(video *models.VideoMetadata) (*dynamodb.UpdateItemInput, error) {
+		removed = nil
+		var kept []models.OutputVersion
+		for _, entry := range video.Versions {
+			if entry.Version != video.CurrentVersion && slices.Contains(prune, entry.Version) {
+				removed = append(removed, entry.Version)
+				continue
+			}
+			kept = append(kept, entry)
+		}
+		if len(removed) == 0 {
+			return nil, nil
+		}
+
+		versionsAV, err := attributevalue.MarshalList(kept)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal versions: %w", err)
+		}
+
+		values := map[string]types.AttributeValue{
+			":versions": &types.AttributeValueMemberL{Value: versionsAV},
+			":current":  &types.AttributeValueMemberN{Value: strconv.Itoa(video.CurrentVersion)},
+		}
+
+		return &dynamodb.UpdateItemInput{
+			TableName: aws.String(r.tableName),
+			Key: map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+				"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+			},
+			UpdateExpression:          aws.String("SET versions = :versions, versions_rev = :versions_next"),
+			ConditionExpression:       aws.String("current_version = :current AND " + versionsGuard(video, values)),
+			ExpressionAttributeValues: values,
+		}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune versions: %w", awsError(err))
+	}
+
+	return removed, nil
+}
+
+// maxVersionWrites bounds the attempts of a read-modify-write of a video's
+// stored versions.
+const maxVersionWrites = 3
+
+// updateVersions reads a video, builds an update of its stored versions with
+// build and applies it, re-reading and retrying if the video changed in
+// between. build checks the video's state on every attempt and returns a nil
+// input if there is nothing to write.
+func (r *VideoRepository) updateVersions(ctx context.Context, videoID string, build func(*models.VideoMetadata) (*dynamodb.UpdateItemInput, error)) error {
+	for attempt := 1; ; attempt++ {
+		video, err := r.GetVideo(ctx, videoID)
+		if err != nil {
+			return err
+		}
+
+		input, err := build(video)
+		if err != nil || input == nil {
+			return err
+		}
+
+		_, err = r.client.UpdateItem(ctx, input)
+		var condErr *types.ConditionalCheckFailedException
+		if err == nil || !errors.As(err, &condErr) || attempt == maxVersionWrites {
+			return err
+		}
+	}
+}
+
+// versionsGuard returns a condition that holds while the video's stored
+// versions are unchanged since it was read, adding its values to values.
+// The guard compares versions_rev, which every write of versions sets to
+// :versions_next, so a prune and a publish in between cannot go unnoticed
+// the way they would if the versions were only counted.
+func versionsGuard(video *models.VideoMetadata, values map[string]types.AttributeValue) string {
+	values[":versions_next"] = &types.AttributeValueMemberN{Value: strconv.Itoa(video.VersionsRev + 1)}
+	if video.VersionsRev == 0 {
+		return "attribute_not_exists(versions_rev)"
+	}
+	values[":versions_rev"] = &types.AttributeValueMemberN{Value: strconv.Itoa(video.VersionsRev)}
+	return "versions_rev = :versions_rev"
+}
+
+// storedVersions returns a video's stored versions. Videos processed before
+// versioning get an entry for their unversioned output so it can be rolled
+// back to.
+func storedVersions(video *models.VideoMetadata) []models.OutputVersion {
+	if len(video.Versions) > 0 || video.PlaybackURL == "" {
+		return video.Versions
+	}
+	return []models.OutputVersion{{
+		Version:     video.CurrentVersion,
+		Profile:     video.Profile,
+		Presets:     video.QualityPresets,
+		PublishedAt: video.ProcessedAt,
+	}}
+}
+
+// FailVideoProcessing marks a video as failed with the class of the failure
+// and releases owner's lease. A video that still serves a published version
+// returns to completed instead, keeping the error.
+func (r *VideoRepository) FailVideoProcessing(ctx context.Context, videoID, owner, errorMessage string, class models.ErrorClass) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	to, reason, servedCond, err := r.attemptOutcome(ctx, videoID, models.StatusFailed, errorMessage)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":owner":      &types.AttributeValueMemberS{Value: owner},
+		":status":     &types.AttributeValueMemberS{Value: string(to)},
+		":updated_at": &types.AttributeValueMemberS{Value: now},
+		":error":      &types.AttributeValueMemberS{Value: errorMessage},
+		":class":      &types.AttributeValueMemberS{Value: string(class)},
+	}
+	statusCond, history, err := statusChange(to, owner, reason, values)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
 		TableName: aws.String(r.tableName),
 		Key: map[string]types.AttributeValue{
 			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
 			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
 		},
-		UpdateExpression: aws.String("SET #status = :status, updated_at = :updated_at, error_message = :error"),
+		UpdateExpression:    aws.String("SET #status = :status, updated_at = :updated_at, error_message = :error, error_class = :class, " + history + " REMOVE lease_owner, lease_expires_at, cancel_requested"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND " + statusCond + " AND " + servedCond + " AND (attribute_not_exists(lease_owner) OR lease_owner = :owner)"),
 		ExpressionAttributeNames: map[string]string{
 			"#status": "status",
 		},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.transitionConflict(ctx, videoID, to)
+		}
+		return fmt.Errorf("failed to mark video as failed: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// RetryVideoProcessing returns a video to pending, or reprocessing if it
+// serves a published version, after a transient failure, keeping the error so clients can see why processing is delayed. owner's
+// lease is released so the next delivery can claim the video.
+func (r *VideoRepository) RetryVideoProcessing(ctx context.Context, videoID, owner, errorMessage string, class models.ErrorClass) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	to, servedCond, err := r.requeueStatus(ctx, videoID)
+	if err != nil {
+		return err
+	}
+	values := map[string]types.AttributeValue{
+		":owner":      &types.AttributeValueMemberS{Value: owner},
+		":status":     &types.AttributeValueMemberS{Value: string(to)},
+		":updated_at": &types.AttributeValueMemberS{Value: now},
+		":error":      &types.AttributeValueMemberS{Value: errorMessage},
+		":class":      &types.AttributeValueMemberS{Value: string(class)},
+	}
+	statusCond, history, err := statusChangeFrom(models.TransitionSources(models.StatusPending), to, owner, errorMessage, values)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression: aws.String("SET #status = :status, updated_at = :updated_at, error_message = :error, error_class = :class, " + history + " REMOVE lease_owner, lease_expires_at"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+		ConditionExpression:       aws.String("attribute_exists(pk) AND " + statusCond + " AND " + servedCond + " AND (attribute_not_exists(lease_owner) OR lease_owner = :owner)"),
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.transitionConflict(ctx, videoID, models.StatusPending)
+		}
+		return fmt.Errorf("failed to mark video for retry: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// UpdateVideoAnalysis stores the content analysis summary on a video.
+func (r *VideoRepository) UpdateVideoAnalysis(ctx context.Context, videoID string, summary models.AnalysisSummary) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	summaryAV, err := attributevalue.MarshalMap(summary)
+	if err != nil {
+		return fmt.Errorf("failed to marshal analysis summary: %w", err)
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression: aws.String("SET analysis = :analysis, updated_at = :updated_at"),
 		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":status":     &types.AttributeValueMemberS{Value: string(models.StatusFailed)},
+			":analysis":   &types.AttributeValueMemberM{Value: summaryAV},
 			":updated_at": &types.AttributeValueMemberS{Value: now},
-			":error":      &types.AttributeValueMemberS{Value: errorMessage},
 		},
+		ConditionExpression: aws.String("attribute_exists(pk)"),
 	})
 	if err != nil {
-		return fmt.Errorf("failed to mark video as failed: %w", err)
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return models.ErrVideoNotFound
+		}
+		return fmt.Errorf("failed to update video analysis: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// UpdateVideoPreview stores the animated preview locations on a video.
+func (r *VideoRepository) UpdateVideoPreview(ctx context.Context, videoID string, preview models.PreviewAssets) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	previewAV, err := attributevalue.MarshalMap(preview)
+	if err != nil {
+		return fmt.Errorf("failed to marshal preview: %w", err)
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression: aws.String("SET preview = :preview, updated_at = :updated_at"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":preview":    &types.AttributeValueMemberM{Value: previewAV},
+			":updated_at": &types.AttributeValueMemberS{Value: now},
+		},
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return models.ErrVideoNotFound
+		}
+		return fmt.Errorf("failed to update video preview: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// RecordStages stores the pipeline stage records of owner's processing
+// attempt. It is allowed while owner holds the lease and, once the attempt
+// has released it, while the stored records are still owner's, so the final
+// stages can be recorded after the video is completed or failed. It returns
+// ErrLeaseNotHeld if another worker has taken the video over.
+func (r *VideoRepository) RecordStages(ctx context.Context, videoID, owner string, stages []models.StageRun) error {
+	stagesAV, err := attributevalue.MarshalList(stages)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stages: %w", err)
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression: aws.String("SET stages = :stages, stages_owner = :owner"),
+		ConditionExpression: aws.String(
+			"lease_owner = :owner OR (attribute_not_exists(lease_owner) AND stages_owner = :owner)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":stages": &types.AttributeValueMemberL{Value: stagesAV},
+			":owner":  &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return models.ErrLeaseNotHeld
+		}
+		return fmt.Errorf("failed to record stages: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// SaveCheckpoint appends a stage checkpoint to a video while owner holds
+// its processing lease.
+func (r *VideoRepository) SaveCheckpoint(ctx context.Context, videoID, owner string, checkpoint models.Checkpoint) error {
+	checkpointAV, err := attributevalue.MarshalMap(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression:    aws.String("SET checkpoints = list_append(if_not_exists(checkpoints, :empty), :checkpoint)"),
+		ConditionExpression: aws.String("lease_owner = :owner"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":checkpoint": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+				&types.AttributeValueMemberM{Value: checkpointAV},
+			}},
+			":empty": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+			":owner": &types.AttributeValueMemberS{Value: owner},
+		},
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.leaseConflict(ctx, videoID)
+		}
+		return fmt.Errorf("failed to save checkpoint: %w", awsError(err))
+	}
+
+	return nil
+}
+
+// RejectVideo marks a video as failed because its input did not pass
+// validation and releases owner's lease. A video that still serves a
+// published version returns to completed instead, keeping the rejection.
+func (r *VideoRepository) RejectVideo(ctx context.Context, videoID, owner string, code models.RejectionCode, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	to, historyReason, servedCond, err := r.attemptOutcome(ctx, videoID, models.StatusFailed, "rejected: "+string(code))
+	if err != nil {
+		return err
+	}
+
+	values := map[string]types.AttributeValue{
+		":owner":      &types.AttributeValueMemberS{Value: owner},
+		":status":     &types.AttributeValueMemberS{Value: string(to)},
+		":updated_at": &types.AttributeValueMemberS{Value: now},
+		":error":      &types.AttributeValueMemberS{Value: reason},
+		":class":      &types.AttributeValueMemberS{Value: string(models.ErrorClassPermanent)},
+		":code":       &types.AttributeValueMemberS{Value: string(code)},
+		":reason":     &types.AttributeValueMemberS{Value: reason},
+	}
+	statusCond, history, err := statusChange(to, owner, historyReason, values)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("VIDEO#%s", videoID)},
+			"sk": &types.AttributeValueMemberS{Value: "METADATA"},
+		},
+		UpdateExpression: aws.String(`
+			SET #status = :status,
+			    updated_at = :updated_at,
+			    error_message = :error,
+			    error_class = :class,
+			    rejection_code = :code,
+			    rejection_reason = :reason,
+			    ` + history + `
+			REMOVE lease_owner, lease_expires_at, cancel_requested
+		`),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: values,
+		ConditionExpression:       aws.String("attribute_exists(pk) AND " + statusCond + " AND " + servedCond + " AND (attribute_not_exists(lease_owner) OR lease_owner = :owner)"),
+	})
+	if err != nil {
+		var condErr *types.ConditionalCheckFailedException
+		if errors.As(err, &condErr) {
+			return r.transitionConflict(ctx, videoID, to)
+		}
+		return fmt.Errorf("failed to reject video: %w", awsError(err))
 	}
 
 	return nil
@@ -246,7 +1129,7 @@ func (r *VideoRepository) GetLatestVideo(ctx context.Context) (*models.VideoMeta
 		},
 	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get latest video pointer: %w", err)
+		return nil, fmt.Errorf("failed to get latest video pointer: %w", awsError(err))
 	}
 
 	if result.Item == nil {
@@ -268,8 +1151,9 @@ func (r *VideoRepository) GetLatestVideo(ctx context.Context) (*models.VideoMeta
 	return r.GetVideo(ctx, videoIDVal.Value)
 }
 
-// ListVideos retrieves videos in reverse chronological order.
-func (r *VideoRepository) ListVideos(ctx context.Context, limit int32, startKey map[string]types.AttributeValue) ([]models.VideoMetadata, map[string]types.AttributeValue, error) {
+// ListVideos retrieves videos in reverse chronological order. The cursor
+// encodes the query's last evaluated key.
+func (r *VideoRepository) ListVideos(ctx context.Context, limit int32, cursor string) ([]models.VideoMetadata, string, error) {
 	input := &dynamodb.QueryInput{
 		TableName:              aws.String(r.tableName),
 		IndexName:              aws.String("GSI1"),
@@ -281,19 +1165,61 @@ func (r *VideoRepository) ListVideos(ctx context.Context, limit int32, startKey
 		Limit:            aws.Int32(limit),
 	}
 
-	if startKey != nil {
+	if cursor != "" {
+		startKey, err := decodeStartKey(cursor)
+		if err != nil {
+			return nil, "", err
+		}
 		input.ExclusiveStartKey = startKey
 	}
 
 	result, err := r.client.Query(ctx, input)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to list videos: %w", err)
+		return nil, "", fmt.Errorf("failed to list videos: %w", awsError(err))
 	}
 
 	var videos []models.VideoMetadata
 	if err := attributevalue.UnmarshalListOfMaps(result.Items, &videos); err != nil {
-		return nil, nil, fmt.Errorf("failed to unmarshal videos: %w", err)
+		return nil, "", fmt.Errorf("failed to unmarshal videos: %w", err)
 	}
 
-	return videos, result.LastEvaluatedKey, nil
+	next, err := encodeStartKey(result.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", err
+	}
+	return videos, next, nil
+}
+
+// encodeStartKey encodes a query's last evaluated key, whose attributes are
+// all strings, as a cursor.
+func encodeStartKey(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	values := make(map[string]string, len(key))
+	if err := attributevalue.UnmarshalMap(key, &values); err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeStartKey decodes a cursor returned by encodeStartKey.
+func decodeStartKey(cursor string) (map[string]types.AttributeValue, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidCursor, err)
+	}
+	var values map[string]string
+	if err := json.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidCursor, err)
+	}
+	key, err := attributevalue.MarshalMap(values)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrInvalidCursor, err)
+	}
+	return key, nil
 }
@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// accessDeniedCodes are the AWS error codes for requests refused because of
+// the caller's credentials or permissions.
+var accessDeniedCodes = map[string]bool{
+	"AccessDenied":                true,
+	"AccessDeniedException":       true,
+	"AllAccessDisabled":           true,
+	"Forbidden":                   true,
+	"InvalidAccessKeyId":          true,
+	"InvalidClientTokenId":        true,
+	"SignatureDoesNotMatch":       true,
+	"UnrecognizedClientException": true,
+}
+
+// unavailableCodes are the AWS error codes for requests the service failed
+// to handle, beyond those the SDK retries as timeouts. Expired tokens are
+// included: they come from credential rotation, and the next request picks
+// up refreshed credentials.
+var unavailableCodes = map[string]bool{
+	"ExpiredToken":                true,
+	"ExpiredTokenException":       true,
+	"InternalError":               true,
+	"InternalFailure":             true,
+	"InternalServerError":         true,
+	"ServiceUnavailable":          true,
+	"ServiceUnavailableException": true,
+}
+
+// awsError maps AWS errors that are not about a particular object or item
+// to ErrThrottled, ErrAccessDenied or ErrStorageUnavailable, keeping the
+// original error in the chain. Other errors are returned unchanged.
+func awsError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var code string
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code = apiErr.ErrorCode()
+	}
+	var status int
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) {
+		status = respErr.HTTPStatusCode()
+	}
+
+	switch {
+	case isThrottle(code, status):
+		return fmt.Errorf("%w: %w", models.ErrThrottled, err)
+	case isUnavailable(err, code, status):
+		return fmt.Errorf("%w: %w", models.ErrStorageUnavailable, err)
+	case accessDeniedCodes[code] || status == http.StatusForbidden:
+		return fmt.Errorf("%w: %w", models.ErrAccessDenied, err)
+	}
+	return err
+}
+
+func isThrottle(code string, status int) bool {
+	_, ok := retry.DefaultThrottleErrorCodes[code]
+	return ok || status == http.StatusTooManyRequests
+}
+
+func isUnavailable(err error, code string, status int) bool {
+	if _, ok := retry.DefaultRetryableErrorCodes[code]; ok || unavailableCodes[code] {
+		return true
+	}
+	if status >= http.StatusInternalServerError {
+		return true
+	}
+
+	// Requests that never got a response: connection failures and timeouts
+	var sendErr *smithyhttp.RequestSendError
+	var netErr net.Error
+	return errors.As(err, &sendErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// IsRetryable reports whether err is a storage error that may succeed if
+// the request is repeated later.
+func IsRetryable(err error) bool {
+	return errors.Is(err, models.ErrThrottled) || errors.Is(err, models.ErrStorageUnavailable)
+}
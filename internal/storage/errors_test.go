@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// responseError builds the error the SDK returns for a failed S3 call.
+func responseError(status int, err error) error {
+	return &smithy.OperationError{
+		ServiceID:     "S3",
+		OperationName: "HeadObject",
+		Err: &awshttp.ResponseError{
+			ResponseError: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: status}},
+				Err:      err,
+			},
+		},
+	}
+}
+
+func TestS3Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"no such key", responseError(404, &types.NoSuchKey{}), models.ErrObjectNotFound},
+		{"head not found", responseError(404, &smithy.GenericAPIError{Code: "NotFound"}), models.ErrObjectNotFound},
+		{"precondition failed", responseError(412, &smithy.GenericAPIError{Code: "PreconditionFailed"}), models.ErrObjectChanged},
+		{"access denied", responseError(403, &smithy.GenericAPIError{Code: "AccessDenied"}), models.ErrAccessDenied},
+		{"head forbidden", responseError(403, &smithy.GenericAPIError{Code: "Forbidden"}), models.ErrAccessDenied},
+		{"invalid access key", responseError(403, &smithy.GenericAPIError{Code: "InvalidAccessKeyId"}), models.ErrAccessDenied},
+		{"expired token", responseError(400, &smithy.GenericAPIError{Code: "ExpiredToken"}), models.ErrStorageUnavailable},
+		{"expired token exception", responseError(400, &smithy.GenericAPIError{Code: "ExpiredTokenException"}), models.ErrStorageUnavailable},
+		{"expired token forbidden", responseError(403, &smithy.GenericAPIError{Code: "ExpiredToken"}), models.ErrStorageUnavailable},
+		{"slow down", responseError(503, &smithy.GenericAPIError{Code: "SlowDown"}), models.ErrThrottled},
+		{"too many requests", responseError(429, &smithy.GenericAPIError{Code: "TooManyRequests"}), models.ErrThrottled},
+		{"internal error", responseError(500, &smithy.GenericAPIError{Code: "InternalError"}), models.ErrStorageUnavailable},
+		{"request timeout", responseError(400, &smithy.GenericAPIError{Code: "RequestTimeout"}), models.ErrStorageUnavailable},
+		{"connection refused", &smithy.OperationError{Err: &smithyhttp.RequestSendError{Err: errors.New("connection refused")}}, models.ErrStorageUnavailable},
+		{"deadline exceeded", &smithy.OperationError{Err: context.DeadlineExceeded}, models.ErrStorageUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s3Error(tt.err)
+			if !errors.Is(got, tt.want) {
+				t.Errorf("s3Error() = %v, want %v", got, tt.want)
+			}
+			if !errors.Is(got, tt.err) {
+				t.Errorf("s3Error() = %v, lost the original error", got)
+			}
+		})
+	}
+}
+
+func TestS3Error_NoSuchBucket(t *testing.T) {
+	err := responseError(404, &types.NoSuchBucket{})
+	got := s3Error(err)
+	if errors.Is(got, models.ErrObjectNotFound) {
+		t.Errorf("s3Error() = %v, want a missing bucket not reported as a missing object", got)
+	}
+	if !errors.Is(got, err) {
+		t.Errorf("s3Error() = %v, lost the original error", got)
+	}
+}
+
+func TestAWSError_Unmapped(t *testing.T) {
+	for _, err := range []error{
+		responseError(400, &smithy.GenericAPIError{Code: "ValidationException"}),
+		context.Canceled,
+	} {
+		got := awsError(err)
+		if got != err {
+			t.Errorf("awsError(%v) = %v, want it unchanged", err, got)
+		}
+		if IsRetryable(got) {
+			t.Errorf("IsRetryable(%v) = true, want false", got)
+		}
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{models.ErrThrottled, true},
+		{models.ErrStorageUnavailable, true},
+		{models.ErrAccessDenied, false},
+		{models.ErrObjectNotFound, false},
+		{nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
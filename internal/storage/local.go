@@ -0,0 +1,458 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Local store layout
+const (
+	localMetaDir = ".meta" // Object metadata, mirroring the bucket layout
+	localTmpDir  = ".tmp"  // Objects being written
+
+	// LocalObjectPath is the API path local presigned URLs are served under.
+	LocalObjectPath = "/storage/"
+)
+
+// Presigned URL query parameters
+const (
+	signMethodParam      = "X-Method"
+	signExpiresParam     = "X-Expires"
+	signContentTypeParam = "X-Content-Type"
+	signSignatureParam   = "X-Signature"
+)
+
+// LocalStore is an ObjectStore kept on the local filesystem, for running
+// without AWS. Each bucket is a directory under the root and each object a
+// file at its key, with its ETag and checksum kept alongside. Presigned
+// URLs point at the API, which serves them after checking their HMAC
+// signature; see VerifyURL.
+type LocalStore struct {
+	dir     string
+	baseURL *url.URL
+	secret  []byte
+	now     func() time.Time
+}
+
+// localMeta is the stored metadata of a local object.
+type localMeta struct {
+	Size           int64  `json:"size"`
+	ETag           string `json:"etag"`
+	ContentType    string `json:"contentType,omitempty"`
+	ChecksumSHA256 string `json:"checksumSha256"`
+}
+
+// NewLocalStore creates a store rooted at dir, creating it if needed.
+// Presigned URLs are issued under baseURL and signed with secret.
+func NewLocalStore(dir, baseURL string, secret []byte) (*LocalStore, error) {
+	if dir == "" {
+		return nil, errors.New("storage directory is required")
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("signing secret is required")
+	}
+	base, err := url.Parse(baseURL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid storage URL: %q", baseURL)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, localTmpDir), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	return &LocalStore{dir: dir, baseURL: base, secret: secret, now: time.Now}, nil
+}
+
+// Get opens an object, or the part of it selected by opts.Range.
+func (s *LocalStore) Get(ctx context.Context, bucket, key string, opts GetOptions) (io.ReadCloser, *ObjectInfo, error) {
+	file, info, err := s.Open(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if opts.IfMatch != "" && opts.IfMatch != info.ETag {
+		file.Close()
+		return nil, nil, fmt.Errorf("%w: %s/%s", models.ErrObjectChanged, bucket, key)
+	}
+	if opts.Range == "" {
+		return file, info, nil
+	}
+
+	off, n, err := parseRange(opts.Range, info.Size)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	part := *info
+	part.Size = n
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, off, n), file}, &part, nil
+}
+
+// Open opens an object's file and returns it with the object's metadata.
+// The caller closes the file.
+func (s *LocalStore) Open(bucket, key string) (*os.File, *ObjectInfo, error) {
+	path, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, localError(bucket, key, err)
+	}
+	info, err := s.info(bucket, key, file)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+// Put stores an object.
+func (s *LocalStore) Put(ctx context.Context, bucket, key string, body io.ReadSeeker, opts PutOptions) error {
+	_, err := s.Write(bucket, key, body, opts)
+	return err
+}
+
+// Write stores an object read from body and returns its metadata. The
+// object is replaced atomically, so readers see the old or new content.
+func (s *LocalStore) Write(bucket, key string, body io.Reader, opts PutOptions) (*ObjectInfo, error) {
+	path, err := s.objectPath(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, localTmpDir), "object-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	md5Hash := md5.New()
+	shaHash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, md5Hash, shaHash), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", key, err)
+	}
+
+	meta := localMeta{
+		Size:           size,
+		ETag:           `"` + hex.EncodeToString(md5Hash.Sum(nil)) + `"`,
+		ContentType:    opts.ContentType,
+		ChecksumSHA256: base64.StdEncoding.EncodeToString(shaHash.Sum(nil)),
+	}
+	if opts.ChecksumSHA256 != "" && opts.ChecksumSHA256 != meta.ChecksumSHA256 {
+		return nil, fmt.Errorf("%w: %s", models.ErrChecksumMismatch, key)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return nil, fmt.Errorf("failed to store %s: %w", key, err)
+	}
+	if err := s.writeMeta(bucket, key, meta); err != nil {
+		return nil, err
+	}
+
+	info := meta.objectInfo(key)
+	if fi, err := os.Stat(path); err == nil {
+		info.LastModified = fi.ModTime()
+	}
+	return info, nil
+}
+
+// Head returns an object's metadata. Local objects are never stored in
+// parts, so the part number is ignored.
+func (s *LocalStore) Head(ctx context.Context, bucket, key string, opts HeadOptions) (*ObjectInfo, error) {
+	file, info, err := s.Open(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	file.Close()
+	return info, nil
+}
+
+// List returns every object under prefix. Objects placed in the store
+// directly, without metadata, are listed without an ETag or checksum.
+func (s *LocalStore) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	root, err := s.bucketPath(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	var objects []ObjectInfo
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		info := &ObjectInfo{Key: key, Size: fi.Size()}
+		if meta, err := s.readMeta(bucket, key); err == nil && meta.Size == fi.Size() {
+			info = meta.objectInfo(key)
+		}
+		info.LastModified = fi.ModTime()
+		info.ChecksumSHA256 = ""
+		objects = append(objects, *info)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+
+	slices.SortFunc(objects, func(a, b ObjectInfo) int { return strings.Compare(a.Key, b.Key) })
+	return objects, nil
+}
+
+// Delete removes objects and their metadata.
+func (s *LocalStore) Delete(ctx context.Context, bucket string, keys ...string) error {
+	for _, key := range keys {
+		path, err := s.objectPath(bucket, key)
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete %s: %w", key, err)
+		}
+		if err := os.Remove(s.metaPath(bucket, key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to delete metadata of %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// Presign returns an API URL for the object, signed for one method until
+// it expires. A PUT URL also fixes the upload's content type.
+func (s *LocalStore) Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error) {
+	if opts.Method != http.MethodGet && opts.Method != http.MethodPut {
+		return "", fmt.Errorf("cannot presign %s requests", opts.Method)
+	}
+	if _, err := s.objectPath(bucket, key); err != nil {
+		return "", err
+	}
+
+	expires := strconv.FormatInt(s.now().Add(opts.Expires).Unix(), 10)
+	u := s.baseURL.JoinPath(LocalObjectPath, bucket, key)
+	query := url.Values{}
+	query.Set(signMethodParam, opts.Method)
+	query.Set(signExpiresParam, expires)
+	if opts.ContentType != "" {
+		query.Set(signContentTypeParam, opts.ContentType)
+	}
+	query.Set(signSignatureParam, s.sign(opts.Method, bucket, key, expires, opts.ContentType))
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// VerifyURL checks that a request was made with a URL from Presign for
+// the object that has not expired. A GET URL also allows HEAD requests and
+// a PUT must be sent with the signed content type.
+func (s *LocalStore) VerifyURL(r *http.Request, bucket, key string) error {
+	query := r.URL.Query()
+	method := query.Get(signMethodParam)
+	expires := query.Get(signExpiresParam)
+	contentType := query.Get(signContentTypeParam)
+
+	want := s.sign(method, bucket, key, expires, contentType)
+	if !hmac.Equal([]byte(query.Get(signSignatureParam)), []byte(want)) {
+		return fmt.Errorf("%w: signature does not match", models.ErrInvalidSignature)
+	}
+	if r.Method != method && !(r.Method == http.MethodHead && method == http.MethodGet) {
+		return fmt.Errorf("%w: signed for %s", models.ErrInvalidSignature, method)
+	}
+	expiry, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || s.now().Unix() > expiry {
+		return fmt.Errorf("%w: expired", models.ErrInvalidSignature)
+	}
+	if method == http.MethodPut && r.Header.Get("Content-Type") != contentType {
+		return fmt.Errorf("%w: signed for content type %q", models.ErrInvalidSignature, contentType)
+	}
+	return nil
+}
+
+// sign returns the hex HMAC-SHA256 of a presigned request's fields.
+func (s *LocalStore) sign(method, bucket, key, expires, contentType string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strings.Join([]string{method, bucket, key, expires, contentType}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// info returns the metadata of the open object file, hashing it if its
+// stored metadata is missing or stale.
+func (s *LocalStore) info(bucket, key string, file *os.File) (*ObjectInfo, error) {
+	fi, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return nil, fmt.Errorf("%w: %s/%s", models.ErrObjectNotFound, bucket, key)
+	}
+
+	meta, err := s.readMeta(bucket, key)
+	if err != nil || meta.Size != fi.Size() {
+		md5Hash := md5.New()
+		shaHash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(md5Hash, shaHash), file); err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", key, err)
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		meta = &localMeta{
+			Size:           fi.Size(),
+			ETag:           `"` + hex.EncodeToString(md5Hash.Sum(nil)) + `"`,
+			ChecksumSHA256: base64.StdEncoding.EncodeToString(shaHash.Sum(nil)),
+		}
+	}
+
+	info := meta.objectInfo(key)
+	info.LastModified = fi.ModTime()
+	return info, nil
+}
+
+// objectInfo returns the metadata as an ObjectInfo.
+func (m *localMeta) objectInfo(key string) *ObjectInfo {
+	return &ObjectInfo{
+		Key:            key,
+		Size:           m.Size,
+		ETag:           m.ETag,
+		ContentType:    m.ContentType,
+		ChecksumSHA256: m.ChecksumSHA256,
+		HasSHA256:      m.ChecksumSHA256 != "",
+		MD5ETag:        true,
+	}
+}
+
+// readMeta reads an object's stored metadata.
+func (s *LocalStore) readMeta(bucket, key string) (*localMeta, error) {
+	data, err := os.ReadFile(s.metaPath(bucket, key))
+	if err != nil {
+		return nil, err
+	}
+	var meta localMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// writeMeta atomically replaces an object's stored metadata.
+func (s *LocalStore) writeMeta(bucket, key string, meta localMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	path := s.metaPath(bucket, key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create metadata directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Join(s.dir, localTmpDir), "meta-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metadata of %s: %w", key, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// bucketPath returns the directory of a bucket.
+func (s *LocalStore) bucketPath(bucket string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || strings.HasPrefix(bucket, ".") {
+		return "", fmt.Errorf("invalid bucket name: %q", bucket)
+	}
+	return filepath.Join(s.dir, bucket), nil
+}
+
+// objectPath returns the file of an object. Keys must stay within their
+// bucket.
+func (s *LocalStore) objectPath(bucket, key string) (string, error) {
+	root, err := s.bucketPath(bucket)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(key, "/") || !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("%w: %q", models.ErrInvalidKeyFormat, key)
+	}
+	return filepath.Join(root, filepath.FromSlash(key)), nil
+}
+
+// metaPath returns the metadata file of an object.
+func (s *LocalStore) metaPath(bucket, key string) string {
+	return filepath.Join(s.dir, localMetaDir, bucket, filepath.FromSlash(key)+".json")
+}
+
+// localError maps a missing file to ErrObjectNotFound.
+func localError(bucket, key string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%w: %s/%s", models.ErrObjectNotFound, bucket, key)
+	}
+	return err
+}
+
+// parseRange parses a single "bytes=first-last" or "bytes=first-" range
+// of an object of size bytes, returning its offset and length.
+func parseRange(header string, size int64) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	first, last, found := strings.Cut(spec, "-")
+	if !ok || !found {
+		return 0, 0, fmt.Errorf("unsupported range: %s", header)
+	}
+	off, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || off < 0 || off >= size {
+		return 0, 0, fmt.Errorf("unsatisfiable range: %s", header)
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < off {
+			return 0, 0, fmt.Errorf("unsatisfiable range: %s", header)
+		}
+		end = min(end, size-1)
+	}
+	return off, end - off + 1, nil
+}
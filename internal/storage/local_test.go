@@ -0,0 +1,220 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+func newTestLocalStore(t *testing.T) *LocalStore {
+	t.Helper()
+	store, err := NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("test-secret"))
+	if err != nil {
+		t.Fatalf("NewLocalStore() error = %v", err)
+	}
+	return store
+}
+
+func TestLocalStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLocalStore(t)
+	content := []byte("0123456789abcdef")
+	digest := sha256.Sum256(content)
+	checksum := base64.StdEncoding.EncodeToString(digest[:])
+
+	err := store.Put(ctx, "raw", "uploads/a.mp4", bytes.NewReader(content), PutOptions{
+		ContentType:    "video/mp4",
+		ChecksumSHA256: checksum,
+	})
+	if err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+
+	head, err := store.Head(ctx, "raw", "uploads/a.mp4", HeadOptions{})
+	if err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+	md5Sum := md5.Sum(content)
+	if want := `"` + hex.EncodeToString(md5Sum[:]) + `"`; head.ETag != want {
+		t.Errorf("ETag = %s, want %s", head.ETag, want)
+	}
+	if head.Size != int64(len(content)) || head.ChecksumSHA256 != checksum || head.ContentType != "video/mp4" {
+		t.Errorf("Head() = %+v", head)
+	}
+
+	body, info, err := store.Get(ctx, "raw", "uploads/a.mp4", GetOptions{Range: "bytes=4-7", IfMatch: head.ETag})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+	if string(got) != "4567" || info.Size != 4 {
+		t.Errorf("Get() range = %q (size %d), want 4567", got, info.Size)
+	}
+
+	if _, _, err := store.Get(ctx, "raw", "uploads/a.mp4", GetOptions{IfMatch: `"stale"`}); !errors.Is(err, models.ErrObjectChanged) {
+		t.Errorf("Get() with stale ETag error = %v, want ErrObjectChanged", err)
+	}
+	if err := store.Put(ctx, "raw", "uploads/b.mp4", bytes.NewReader(content), PutOptions{ChecksumSHA256: "bad"}); !errors.Is(err, models.ErrChecksumMismatch) {
+		t.Errorf("Put() with bad checksum error = %v, want ErrChecksumMismatch", err)
+	}
+
+	if err := store.Put(ctx, "raw", "uploads/c.mp4", bytes.NewReader(nil), PutOptions{}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if err := store.Put(ctx, "raw", "other/d.mp4", bytes.NewReader(nil), PutOptions{}); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	objects, err := store.List(ctx, "raw", "uploads/")
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(objects) != 2 || objects[0].Key != "uploads/a.mp4" || objects[1].Key != "uploads/c.mp4" || !objects[0].HasSHA256 {
+		t.Errorf("List() = %+v", objects)
+	}
+
+	if err := store.Delete(ctx, "raw", "uploads/a.mp4", "uploads/missing.mp4"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := store.Head(ctx, "raw", "uploads/a.mp4", HeadOptions{}); !errors.Is(err, models.ErrObjectNotFound) {
+		t.Errorf("Head() after delete error = %v, want ErrObjectNotFound", err)
+	}
+	if objects, _ := store.List(ctx, "missing", ""); len(objects) != 0 {
+		t.Errorf("List() of missing bucket = %+v, want none", objects)
+	}
+}
+
+func TestLocalStore_InvalidKeys(t *testing.T) {
+	store := newTestLocalStore(t)
+
+	tests := []struct {
+		name   string
+		bucket string
+		key    string
+	}{
+		{"parent directory", "raw", "../escape"},
+		{"nested parent", "raw", "a/../../escape"},
+		{"absolute", "raw", "/etc/passwd"},
+		{"directory", "raw", "uploads/"},
+		{"empty key", "raw", ""},
+		{"bucket with slash", "a/b", "key"},
+		{"hidden bucket", ".meta", "key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := store.Write(tt.bucket, tt.key, bytes.NewReader(nil), PutOptions{}); err == nil {
+				t.Errorf("Write(%q, %q) succeeded, want error", tt.bucket, tt.key)
+			}
+		})
+	}
+}
+
+func TestLocalStore_VerifyURL(t *testing.T) {
+	ctx := context.Background()
+	store := newTestLocalStore(t)
+	now := time.Unix(1_700_000_000, 0)
+	store.now = func() time.Time { return now }
+
+	getURL, err := store.Presign(ctx, "raw", "uploads/a b.mp4", PresignOptions{Method: http.MethodGet, Expires: time.Minute})
+	if err != nil {
+		t.Fatalf("Presign() error = %v", err)
+	}
+	putURL, err := store.Presign(ctx, "raw", "uploads/a b.mp4", PresignOptions{Method: http.MethodPut, ContentType: "video/mp4", Expires: time.Minute})
+	if err != nil {
+		t.Fatalf("Presign() error = %v", err)
+	}
+	tampered := func(rawURL, param, value string) string {
+		u, _ := url.Parse(rawURL)
+		q := u.Query()
+		q.Set(param, value)
+		u.RawQuery = q.Encode()
+		return u.String()
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		url         string
+		key         string
+		contentType string
+		after       time.Duration
+		wantErr     bool
+	}{
+		{"get", http.MethodGet, getURL, "uploads/a b.mp4", "", 0, false},
+		{"head with get url", http.MethodHead, getURL, "uploads/a b.mp4", "", 0, false},
+		{"put", http.MethodPut, putURL, "uploads/a b.mp4", "video/mp4", 0, false},
+		{"put with get url", http.MethodPut, getURL, "uploads/a b.mp4", "video/mp4", 0, true},
+		{"put with other content type", http.MethodPut, putURL, "uploads/a b.mp4", "text/html", 0, true},
+		{"other key", http.MethodGet, getURL, "uploads/other.mp4", "", 0, true},
+		{"extended expiry", http.MethodGet, tampered(getURL, signExpiresParam, "9999999999"), "uploads/a b.mp4", "", 0, true},
+		{"expired", http.MethodGet, getURL, "uploads/a b.mp4", "", 2 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store.now = func() time.Time { return now.Add(tt.after) }
+			req := httptest.NewRequest(tt.method, tt.url, nil)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			err := store.VerifyURL(req, "raw", tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("VerifyURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, models.ErrInvalidSignature) {
+				t.Errorf("VerifyURL() error = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		header  string
+		off, n  int64
+		wantErr bool
+	}{
+		{"bytes=0-9", 0, 10, false},
+		{"bytes=90-", 90, 10, false},
+		{"bytes=95-200", 95, 5, false},
+		{"bytes=100-", 0, 0, true},
+		{"bytes=5-1", 0, 0, true},
+		{"bytes=-10", 0, 0, true},
+		{"items=0-1", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			off, n, err := parseRange(tt.header, 100)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRange() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if off != tt.off || n != tt.n {
+				t.Errorf("parseRange() = %d, %d, want %d, %d", off, n, tt.off, tt.n)
+			}
+		})
+	}
+}
+
+func TestS3Client_ImplementsMultipart(t *testing.T) {
+	var store ObjectStore = &S3Client{}
+	if _, ok := store.(MultipartStore); !ok {
+		t.Error("S3Client does not implement MultipartStore")
+	}
+	if _, ok := ObjectStore(&LocalStore{}).(MultipartStore); ok {
+		t.Error("LocalStore implements MultipartStore")
+	}
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// ManifestProblem is a stored file that does not match its manifest entry.
+type ManifestProblem struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+}
+
+// ReadManifest fetches the manifest of the output version under prefix. It
+// returns ErrManifestNotFound if the version has none.
+func ReadManifest(ctx context.Context, store ObjectStore, bucket, prefix string) (*models.Manifest, error) {
+	body, _, err := store.Get(ctx, bucket, prefix+models.ManifestFilename, GetOptions{})
+	if err != nil {
+		if errors.Is(err, models.ErrObjectNotFound) {
+			return nil, fmt.Errorf("%w: %s", models.ErrManifestNotFound, prefix)
+		}
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	defer body.Close()
+
+	var manifest models.Manifest
+	if err := json.NewDecoder(body).Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+// VerifyManifest checks that every file in manifest is stored under prefix
+// with its size and stored checksum, running concurrency checks at once. A deep
+// check also downloads each file and compares its SHA-256. Mismatched and
+// missing files are returned as problems, sorted by path; the error reports
+// files that could not be checked.
+func VerifyManifest(ctx context.Context, store ObjectStore, bucket, prefix string, manifest *models.Manifest, concurrency int, deep bool) ([]ManifestProblem, error) {
+	var (
+		mu       sync.Mutex
+		problems []ManifestProblem
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	sem := make(chan struct{}, max(concurrency, 1))
+
+	for _, file := range manifest.Files {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(file models.ManifestFile) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			problem, err := verifyFile(ctx, store, bucket, prefix+file.Path, file, deep)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err != nil:
+				if firstErr == nil {
+					firstErr = fmt.Errorf("failed to check %s: %w", file.Path, err)
+				}
+			case problem != "":
+				problems = append(problems, ManifestProblem{Path: file.Path, Problem: problem})
+			}
+		}(file)
+	}
+	wg.Wait()
+
+	slices.SortFunc(problems, func(a, b ManifestProblem) int { return strings.Compare(a.Path, b.Path) })
+	return problems, firstErr
+}
+
+// verifyFile checks one stored object against its manifest entry, returning
+// what is wrong with it, if anything.
+func verifyFile(ctx context.Context, store ObjectStore, bucket, key string, file models.ManifestFile, deep bool) (string, error) {
+	head, err := store.Head(ctx, bucket, key, HeadOptions{})
+	if err != nil {
+		if errors.Is(err, models.ErrObjectNotFound) {
+			return "missing", nil
+		}
+		return "", err
+	}
+
+	if head.Size != file.Size {
+		return fmt.Sprintf("has %d bytes, want %d", head.Size, file.Size), nil
+	}
+	switch checksum := head.ChecksumSHA256; checksum {
+	case file.Checksum:
+	case "":
+		return "stored without a SHA-256 checksum", nil
+	default:
+		return fmt.Sprintf("has checksum %s, want %s", checksum, file.Checksum), nil
+	}
+	if !deep {
+		return "", nil
+	}
+
+	body, _, err := store.Get(ctx, bucket, key, GetOptions{IfMatch: head.ETag})
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, body); err != nil {
+		return "", err
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != file.SHA256 {
+		return fmt.Sprintf("content has SHA-256 %s, want %s", sum, file.SHA256), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// MemoryVideoStore keeps videos in memory, for tests and single-process
+// development. Videos are stored encoded, so callers never share them.
+type MemoryVideoStore struct {
+	documentStore
+
+	mu       sync.Mutex
+	videos   map[string][]byte
+	latestID string
+}
+
+// NewMemoryVideoStore creates an empty in-memory video store.
+func NewMemoryVideoStore() *MemoryVideoStore {
+	s := &MemoryVideoStore{videos: make(map[string][]byte)}
+	s.documentStore = documentStore{docs: s}
+	return s
+}
+
+func (s *MemoryVideoStore) load(_ context.Context, videoID string) (*models.VideoMetadata, error) {
+	s.mu.Lock()
+	data, ok := s.videos[videoID]
+	s.mu.Unlock()
+	if !ok {
+		return nil, models.ErrVideoNotFound
+	}
+	return decodeVideo(data)
+}
+
+func (s *MemoryVideoStore) update(_ context.Context, videoID string, fn func(video *models.VideoMetadata, exists bool) error) (*models.VideoMetadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	video := &models.VideoMetadata{}
+	data, exists := s.videos[videoID]
+	if exists {
+		var err error
+		if video, err = decodeVideo(data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fn(video, exists); err != nil {
+		if errors.Is(err, errNoChange) {
+			return video, nil
+		}
+		return nil, err
+	}
+
+	data, err := encodeVideo(video)
+	if err != nil {
+		return nil, err
+	}
+	s.videos[videoID] = data
+	return video, nil
+}
+
+func (s *MemoryVideoStore) setLatest(_ context.Context, videoID, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.latestID = videoID
+	return nil
+}
+
+func (s *MemoryVideoStore) latest(context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.latestID, nil
+}
+
+func (s *MemoryVideoStore) list(_ context.Context, limit int, after string) ([]models.VideoMetadata, error) {
+	s.mu.Lock()
+	var videos []models.VideoMetadata
+	for _, data := range s.videos {
+		video, err := decodeVideo(data)
+		if err != nil {
+			s.mu.Unlock()
+			return nil, err
+		}
+		if key := listKey(video); key != "" && (after == "" || key < after) {
+			videos = append(videos, *video)
+		}
+	}
+	s.mu.Unlock()
+
+	slices.SortFunc(videos, func(a, b models.VideoMetadata) int {
+		return strings.Compare(listKey(&b), listKey(&a))
+	})
+	if limit > 0 && len(videos) > limit {
+		videos = videos[:limit]
+	}
+	return videos, nil
+}
@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+
+	"github.com/amillerrr/hls-pipeline/internal/config"
+)
+
+// Object storage backends
+const (
+	BackendS3    = "s3"
+	BackendLocal = "local"
+)
+
+// ObjectStore stores objects in buckets. It is implemented by S3Client and
+// by LocalStore, which keeps objects on the local filesystem. Reads of
+// missing objects return models.ErrObjectNotFound.
+type ObjectStore interface {
+	// Get opens an object for reading. The caller closes the body.
+	Get(ctx context.Context, bucket, key string, opts GetOptions) (io.ReadCloser, *ObjectInfo, error)
+
+	// Put stores an object, replacing any object with the same key. If a
+	// checksum is given the store rejects content that does not match it.
+	Put(ctx context.Context, bucket, key string, body io.ReadSeeker, opts PutOptions) error
+
+	// Head returns an object's metadata, including its SHA-256 checksum.
+	Head(ctx context.Context, bucket, key string, opts HeadOptions) (*ObjectInfo, error)
+
+	// List returns every object whose key starts with prefix, sorted by key.
+	List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error)
+
+	// Delete removes objects. Keys that do not exist are ignored.
+	Delete(ctx context.Context, bucket string, keys ...string) error
+
+	// Presign returns a URL that allows one method on an object without
+	// other credentials until it expires.
+	Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error)
+}
+
+// ExpiringSigner is implemented by object stores whose presigned URLs stop
+// working when the credentials that signed them expire, whatever expiry the
+// URLs were given.
+type ExpiringSigner interface {
+	// SigningExpiry returns when the current signing credentials expire,
+	// or the zero time if they do not.
+	SigningExpiry(ctx context.Context) (time.Time, error)
+}
+
+// MultipartStore is implemented by object stores that accept uploads in
+// parts. Each part carries its SHA-256 checksum and the stored object gets
+// the composite checksum of its parts.
+type MultipartStore interface {
+	CreateMultipart(ctx context.Context, bucket, key string, opts PutOptions) (string, error)
+	PutPart(ctx context.Context, bucket, key, uploadID string, number int32, body io.ReadSeeker, size int64, checksum string) (string, error)
+	CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []CompletedPart) error
+	AbortMultipart(ctx context.Context, bucket, key, uploadID string) error
+}
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ETag         string // Quoted, as S3 reports it
+	ContentType  string
+	LastModified time.Time
+
+	// ChecksumSHA256 is the base64 SHA-256 checksum the object was stored
+	// with, empty if it has none. Listings do not report the value, only
+	// whether there is one.
+	ChecksumSHA256 string
+	HasSHA256      bool
+
+	// MD5ETag is set when the ETag is known to be the MD5 of the content,
+	// or of its parts' MD5s for a multipart object. AWS S3 only makes such
+	// ETags for unencrypted and SSE-S3 objects; SSE-KMS, SSE-C and
+	// S3-compatible services may not.
+	MD5ETag bool
+}
+
+// GetOptions qualify a read.
+type GetOptions struct {
+	Range   string // HTTP Range header, such as "bytes=0-1023"
+	IfMatch string // Fail with models.ErrObjectChanged unless the ETag matches
+}
+
+// PutOptions describe a stored object.
+type PutOptions struct {
+	ContentType    string
+	ChecksumSHA256 string // Base64 digest of the content
+}
+
+// HeadOptions qualify a metadata request.
+type HeadOptions struct {
+	PartNumber int32 // Report the size of this part of a multipart object
+}
+
+// PresignOptions describe the request a presigned URL allows.
+type PresignOptions struct {
+	Method      string // GET or PUT
+	ContentType string // Required Content-Type of a PUT
+	Expires     time.Duration
+}
+
+// CompletedPart is an uploaded part of a multipart upload.
+type CompletedPart struct {
+	Number         int32
+	ETag           string
+	ChecksumSHA256 string
+}
+
+// NewObjectStore creates the object store selected by the configuration.
+// The S3 store is created from awsCfg, pointed at the custom endpoint if
+// one is set.
+func NewObjectStore(cfg *config.Config, awsCfg aws.Config) (ObjectStore, error) {
+	switch cfg.Storage.Backend {
+	case BackendS3, "":
+		return NewS3ClientFromAWSConfig(awsCfg, S3Endpoint(cfg.Storage.S3Endpoint)), nil
+	case BackendLocal:
+		return NewLocalStore(cfg.Storage.Dir, cfg.Storage.URL, []byte(cfg.Storage.SigningSecret))
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage.Backend)
+	}
+}
@@ -2,20 +2,30 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"slices"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 
 	"github.com/amillerrr/hls-pipeline/internal/config"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
 )
 
 // Default timeout for S3 operations
 const DefaultS3Timeout = 30 * time.Second
 
+// MaxDeleteKeys is the most keys one DeleteObjects request accepts.
+const MaxDeleteKeys = 1000
+
 // S3Client wraps the AWS S3 client with additional functionality.
 type S3Client struct {
 	*s3.Client
@@ -34,7 +44,7 @@ func NewS3Client(ctx context.Context, cfg *config.Config) (*S3Client, error) {
 	// Add OpenTelemetry instrumentation
 	otelaws.AppendMiddlewares(&awsCfg.APIOptions)
 
-	client := s3.NewFromConfig(awsCfg)
+	client := s3.NewFromConfig(awsCfg, S3Endpoint(cfg.Storage.S3Endpoint))
 
 	return &S3Client{
 		Client:        client,
@@ -43,14 +53,26 @@ func NewS3Client(ctx context.Context, cfg *config.Config) (*S3Client, error) {
 }
 
 // NewS3ClientFromAWSConfig creates a new S3 client from an existing AWS config.
-func NewS3ClientFromAWSConfig(awsCfg aws.Config) *S3Client {
-	client := s3.NewFromConfig(awsCfg)
+func NewS3ClientFromAWSConfig(awsCfg aws.Config, optFns ...func(*s3.Options)) *S3Client {
+	client := s3.NewFromConfig(awsCfg, optFns...)
 	return &S3Client{
 		Client:        client,
 		presignClient: s3.NewPresignClient(client),
 	}
 }
 
+// S3Endpoint points a client at an S3-compatible service such as MinIO or
+// LocalStack, addressing buckets by path. An empty endpoint keeps AWS.
+func S3Endpoint(endpoint string) func(*s3.Options) {
+	return func(o *s3.Options) {
+		if endpoint == "" {
+			return
+		}
+		o.BaseEndpoint = aws.String(endpoint)
+		o.UsePathStyle = true
+	}
+}
+
 // GeneratePresignedURL generates a presigned URL for uploading an object.
 func (c *S3Client) GeneratePresignedURL(ctx context.Context, bucket, key, contentType string, lifetime time.Duration) (string, error) {
 	ctx, cancel := context.WithTimeout(ctx, DefaultS3Timeout)
@@ -81,11 +103,12 @@ func (c *S3Client) ObjectExists(ctx context.Context, bucket, key string) (bool,
 		Key:    aws.String(key),
 	})
 
-	if err != nil {
-		// Check if it's a "not found" error
-		// Note: In production, you'd want to check for specific error types
+	if err = s3Error(err); errors.Is(err, models.ErrObjectNotFound) {
 		return false, nil
 	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check object: %w", err)
+	}
 
 	return true, nil
 }
@@ -101,7 +124,7 @@ func (c *S3Client) GetObjectSize(ctx context.Context, bucket, key string) (int64
 	})
 
 	if err != nil {
-		return 0, fmt.Errorf("failed to get object metadata: %w", err)
+		return 0, fmt.Errorf("failed to get object metadata: %w", s3Error(err))
 	}
 
 	if result.ContentLength != nil {
@@ -110,3 +133,254 @@ func (c *S3Client) GetObjectSize(ctx context.Context, bucket, key string) (int64
 
 	return 0, nil
 }
+
+// Get opens an object for reading.
+func (c *S3Client) Get(ctx context.Context, bucket, key string, opts GetOptions) (io.ReadCloser, *ObjectInfo, error) {
+	out, err := c.GetObject(ctx, &s3.GetObjectInput{
+		Bucket:  aws.String(bucket),
+		Key:     aws.String(key),
+		Range:   optionalString(opts.Range),
+		IfMatch: optionalString(opts.IfMatch),
+	})
+	if err != nil {
+		return nil, nil, s3Error(err)
+	}
+	return out.Body, &ObjectInfo{
+		Key:            key,
+		Size:           aws.ToInt64(out.ContentLength),
+		ETag:           aws.ToString(out.ETag),
+		ContentType:    aws.ToString(out.ContentType),
+		LastModified:   aws.ToTime(out.LastModified),
+		ChecksumSHA256: aws.ToString(out.ChecksumSHA256),
+		HasSHA256:      out.ChecksumSHA256 != nil,
+		MD5ETag:        c.md5ETag(out.ServerSideEncryption, out.SSECustomerAlgorithm),
+	}, nil
+}
+
+// Put stores an object.
+func (c *S3Client) Put(ctx context.Context, bucket, key string, body io.ReadSeeker, opts PutOptions) error {
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: optionalString(opts.ContentType),
+	}
+	if opts.ChecksumSHA256 != "" {
+		input.ChecksumAlgorithm = types.ChecksumAlgorithmSha256
+		input.ChecksumSHA256 = aws.String(opts.ChecksumSHA256)
+	}
+	_, err := c.PutObject(ctx, input)
+	return s3Error(err)
+}
+
+// Head returns an object's metadata.
+func (c *S3Client) Head(ctx context.Context, bucket, key string, opts HeadOptions) (*ObjectInfo, error) {
+	input := &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	if opts.PartNumber > 0 {
+		input.PartNumber = aws.Int32(opts.PartNumber)
+	}
+	out, err := c.HeadObject(ctx, input)
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return &ObjectInfo{
+		Key:            key,
+		Size:           aws.ToInt64(out.ContentLength),
+		ETag:           aws.ToString(out.ETag),
+		ContentType:    aws.ToString(out.ContentType),
+		LastModified:   aws.ToTime(out.LastModified),
+		ChecksumSHA256: aws.ToString(out.ChecksumSHA256),
+		HasSHA256:      out.ChecksumSHA256 != nil,
+		MD5ETag:        c.md5ETag(out.ServerSideEncryption, out.SSECustomerAlgorithm),
+	}, nil
+}
+
+// md5ETag reports whether AWS S3 gives an object with this encryption an
+// MD5 ETag: only unencrypted and SSE-S3 objects get one. ETags from a
+// custom endpoint are never trusted to be MD5s.
+func (c *S3Client) md5ETag(sse types.ServerSideEncryption, sseCustomerAlgorithm *string) bool {
+	if c.Options().BaseEndpoint != nil || sseCustomerAlgorithm != nil {
+		return false
+	}
+	return sse == "" || sse == types.ServerSideEncryptionAes256
+}
+
+// List returns every object under prefix.
+func (c *S3Client) List(ctx context.Context, bucket, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	paginator := s3.NewListObjectsV2Paginator(c.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, s3Error(err)
+		}
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.ToString(obj.Key),
+				Size:         aws.ToInt64(obj.Size),
+				ETag:         aws.ToString(obj.ETag),
+				LastModified: aws.ToTime(obj.LastModified),
+				HasSHA256:    slices.Contains(obj.ChecksumAlgorithm, types.ChecksumAlgorithmSha256),
+			})
+		}
+	}
+	return objects, nil
+}
+
+// Delete removes objects, MaxDeleteKeys per request.
+func (c *S3Client) Delete(ctx context.Context, bucket string, keys ...string) error {
+	for batch := range slices.Chunk(keys, MaxDeleteKeys) {
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for i, key := range batch {
+			objects[i] = types.ObjectIdentifier{Key: aws.String(key)}
+		}
+		out, err := c.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{Objects: objects, Quiet: aws.Bool(true)},
+		})
+		if err != nil {
+			return s3Error(err)
+		}
+		if len(out.Errors) > 0 {
+			return fmt.Errorf("failed to delete %s: %s", aws.ToString(out.Errors[0].Key), aws.ToString(out.Errors[0].Message))
+		}
+	}
+	return nil
+}
+
+// Presign returns a presigned GET or PUT URL for an object.
+func (c *S3Client) Presign(ctx context.Context, bucket, key string, opts PresignOptions) (string, error) {
+	expires := s3.WithPresignExpires(opts.Expires)
+	switch opts.Method {
+	case http.MethodGet:
+		req, err := c.presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+		}, expires)
+		if err != nil {
+			return "", fmt.Errorf("failed to presign request: %w", err)
+		}
+		return req.URL, nil
+	case http.MethodPut:
+		return c.GeneratePresignedURL(ctx, bucket, key, opts.ContentType, opts.Expires)
+	default:
+		return "", fmt.Errorf("cannot presign %s requests", opts.Method)
+	}
+}
+
+// SigningExpiry returns when the credentials that sign presigned URLs
+// expire. Temporary credentials, such as those of an IAM role, are
+// refreshed before they run out, so this is the expiry of the current ones.
+func (c *S3Client) SigningExpiry(ctx context.Context) (time.Time, error) {
+	provider := c.Options().Credentials
+	if provider == nil {
+		return time.Time{}, nil
+	}
+	creds, err := provider.Retrieve(ctx)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to retrieve credentials: %w", err)
+	}
+	if !creds.CanExpire {
+		return time.Time{}, nil
+	}
+	return creds.Expires, nil
+}
+
+// CreateMultipart starts a multipart upload with composite SHA-256
+// checksums and returns its upload ID.
+func (c *S3Client) CreateMultipart(ctx context.Context, bucket, key string, opts PutOptions) (string, error) {
+	out, err := c.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		ContentType:       optionalString(opts.ContentType),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ChecksumType:      types.ChecksumTypeComposite,
+	})
+	if err != nil {
+		return "", s3Error(err)
+	}
+	return aws.ToString(out.UploadId), nil
+}
+
+// PutPart uploads one part with its base64 SHA-256 checksum and returns
+// the part's ETag.
+func (c *S3Client) PutPart(ctx context.Context, bucket, key, uploadID string, number int32, body io.ReadSeeker, size int64, checksum string) (string, error) {
+	out, err := c.UploadPart(ctx, &s3.UploadPartInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		UploadId:          aws.String(uploadID),
+		PartNumber:        aws.Int32(number),
+		Body:              body,
+		ContentLength:     aws.Int64(size),
+		ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+		ChecksumSHA256:    aws.String(checksum),
+	})
+	if err != nil {
+		return "", s3Error(err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
+// CompleteMultipart assembles the uploaded parts into the object.
+func (c *S3Client) CompleteMultipart(ctx context.Context, bucket, key, uploadID string, parts []CompletedPart) error {
+	completed := make([]types.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = types.CompletedPart{
+			ETag:           aws.String(part.ETag),
+			PartNumber:     aws.Int32(part.Number),
+			ChecksumSHA256: aws.String(part.ChecksumSHA256),
+		}
+	}
+	_, err := c.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	return s3Error(err)
+}
+
+// AbortMultipart discards a multipart upload and its parts.
+func (c *S3Client) AbortMultipart(ctx context.Context, bucket, key, uploadID string) error {
+	_, err := c.AbortMultipartUpload(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	return s3Error(err)
+}
+
+// s3Error maps S3 errors for missing and changed objects to their
+// sentinel errors, and other service errors with awsError. HEAD responses
+// have no body, so the SDK reports a missing object as NotFound. Other 404s,
+// such as NoSuchBucket, are configuration errors and are not mapped.
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NoSuchKey", "NotFound":
+			return fmt.Errorf("%w: %w", models.ErrObjectNotFound, err)
+		case "PreconditionFailed":
+			return fmt.Errorf("%w: %w", models.ErrObjectChanged, err)
+		}
+	}
+	return awsError(err)
+}
+
+// optionalString returns nil for an empty string, leaving the field unset.
+func optionalString(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
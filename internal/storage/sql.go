@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // Registers the pgx driver
+	_ "modernc.org/sqlite"             // Registers the sqlite driver
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// SQL drivers supported by SQLVideoStore
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "pgx"
+)
+
+// sqlitePragmas are set on every SQLite connection: waiting for other
+// processes' writes instead of failing, and write-ahead logging so the API's
+// reads do not block the worker's writes.
+var sqlitePragmas = []string{"busy_timeout(5000)", "journal_mode(WAL)"}
+
+// maxDocumentWrites bounds the attempts of a read-modify-write of a video
+// that keeps being changed by other writers.
+const maxDocumentWrites = 5
+
+// SQLVideoStore keeps videos in SQLite or Postgres, for self-hosted
+// deployments without DynamoDB. Each video is a JSON document with a
+// revision; a write applies only if the revision is unchanged since the
+// video was read, and is retried otherwise.
+type SQLVideoStore struct {
+	documentStore
+
+	db     *sql.DB
+	driver string
+}
+
+// NewSQLVideoStore opens the database at dsn with the given driver and
+// creates the video tables if they do not exist. For SQLite the DSN is a
+// file path.
+func NewSQLVideoStore(ctx context.Context, driver, dsn string) (*SQLVideoStore, error) {
+	if dsn == "" {
+		return nil, errors.New("database URL is required")
+	}
+
+	if driver == DriverSQLite {
+		dsn = sqliteDSN(dsn)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	if driver == DriverSQLite {
+		// SQLite allows a single writer; one connection avoids busy errors
+		// between this process's own writes
+		db.SetMaxOpenConns(1)
+	}
+
+	s, err := NewSQLVideoStoreFromDB(ctx, db, driver)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// sqliteDSN adds the sqlitePragmas the DSN does not set itself. They are
+// applied whenever database/sql opens a connection, unlike a PRAGMA
+// statement, which only affects the connection that runs it.
+func sqliteDSN(dsn string) string {
+	var params []string
+	for _, pragma := range sqlitePragmas {
+		name, _, _ := strings.Cut(pragma, "(")
+		if !strings.Contains(dsn, name) {
+			params = append(params, "_pragma="+pragma)
+		}
+	}
+	if len(params) == 0 {
+		return dsn
+	}
+	sep := "?"
+	if strings.Contains(dsn, "?") {
+		sep = "&"
+	}
+	return dsn + sep + strings.Join(params, "&")
+}
+
+// NewSQLVideoStoreFromDB creates a SQLVideoStore on an open database and
+// creates the video tables if they do not exist.
+func NewSQLVideoStoreFromDB(ctx context.Context, db *sql.DB, driver string) (*SQLVideoStore, error) {
+	s := &SQLVideoStore{db: db, driver: driver}
+	s.documentStore = documentStore{docs: s}
+	if err := s.migrate(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the database.
+func (s *SQLVideoStore) Close() error {
+	return s.db.Close()
+}
+
+// migrate creates the video tables.
+func (s *SQLVideoStore) migrate(ctx context.Context) error {
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS videos (
+			video_id TEXT PRIMARY KEY,
+			list_key TEXT NOT NULL,
+			revision BIGINT NOT NULL,
+			document TEXT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS videos_list_key ON videos (list_key)`,
+		`CREATE TABLE IF NOT EXISTS latest_video (
+			id INTEGER PRIMARY KEY,
+			video_id TEXT NOT NULL,
+			processed_at TEXT NOT NULL
+		)`,
+	}
+	if s.driver == DriverPostgres {
+		// List keys compare byte-wise, like DynamoDB sort keys
+		statements[0] = strings.Replace(statements[0], "list_key TEXT", `list_key TEXT COLLATE "C"`, 1)
+	}
+
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create video tables: %w", err)
+		}
+	}
+	return nil
+}
+
+// query rewrites a query's ? placeholders for the driver.
+func (s *SQLVideoStore) query(query string) string {
+	if s.driver != DriverPostgres {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func (s *SQLVideoStore) load(ctx context.Context, videoID string) (*models.VideoMetadata, error) {
+	var data string
+	err := s.db.QueryRowContext(ctx, s.query(`SELECT document FROM videos WHERE video_id = ?`), videoID).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, models.ErrVideoNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get video: %w", err)
+	}
+	return decodeVideo([]byte(data))
+}
+
+func (s *SQLVideoStore) update(ctx context.Context, videoID string, fn func(video *models.VideoMetadata, exists bool) error) (*models.VideoMetadata, error) {
+	for attempt := 1; ; attempt++ {
+		var data string
+		var revision int64
+		err := s.db.QueryRowContext(ctx, s.query(`SELECT document, revision FROM videos WHERE video_id = ?`), videoID).Scan(&data, &revision)
+		exists := !errors.Is(err, sql.ErrNoRows)
+		if err != nil && exists {
+			return nil, fmt.Errorf("failed to get video: %w", err)
+		}
+
+		video := &models.VideoMetadata{}
+		if exists {
+			if video, err = decodeVideo([]byte(data)); err != nil {
+				return nil, err
+			}
+		}
+
+		if err := fn(video, exists); err != nil {
+			if errors.Is(err, errNoChange) {
+				return video, nil
+			}
+			return nil, err
+		}
+
+		encoded, err := encodeVideo(video)
+		if err != nil {
+			return nil, err
+		}
+
+		var result sql.Result
+		if exists {
+			result, err = s.db.ExecContext(ctx,
+				s.query(`UPDATE videos SET document = ?, list_key = ?, revision = revision + 1 WHERE video_id = ? AND revision = ?`),
+				string(encoded), listKey(video), videoID, revision)
+		} else {
+			result, err = s.db.ExecContext(ctx,
+				s.query(`INSERT INTO videos (video_id, list_key, revision, document) VALUES (?, ?, 1, ?) ON CONFLICT (video_id) DO NOTHING`),
+				videoID, listKey(video), string(encoded))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to write video: %w", err)
+		}
+		written, err := result.RowsAffected()
+		if err != nil {
+			return nil, fmt.Errorf("failed to write video: %w", err)
+		}
+		if written == 1 {
+			return video, nil
+		}
+
+		// Another writer changed the video since it was read
+		if attempt == maxDocumentWrites {
+			return nil, fmt.Errorf("failed to write video %s: changed by %d concurrent writes", videoID, attempt)
+		}
+	}
+}
+
+func (s *SQLVideoStore) setLatest(ctx context.Context, videoID, processedAt string) error {
+	_, err := s.db.ExecContext(ctx, s.query(`
+		INSERT INTO latest_video (id, video_id, processed_at) VALUES (1, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET video_id = excluded.video_id, processed_at = excluded.processed_at
+	`), videoID, processedAt)
+	return err
+}
+
+func (s *SQLVideoStore) latest(ctx context.Context) (string, error) {
+	var videoID string
+	err := s.db.QueryRowContext(ctx, `SELECT video_id FROM latest_video WHERE id = 1`).Scan(&videoID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get latest video pointer: %w", err)
+	}
+	return videoID, nil
+}
+
+func (s *SQLVideoStore) list(ctx context.Context, limit int, after string) ([]models.VideoMetadata, error) {
+	query := `SELECT document FROM videos WHERE list_key <> ''`
+	var args []any
+	if after != "" {
+		query += ` AND list_key < ?`
+		args = append(args, after)
+	}
+	query += ` ORDER BY list_key DESC`
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.query(query), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+	defer rows.Close()
+
+	var videos []models.VideoMetadata
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, fmt.Errorf("failed to list videos: %w", err)
+		}
+		video, err := decodeVideo([]byte(data))
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, *video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list videos: %w", err)
+	}
+	return videos, nil
+}
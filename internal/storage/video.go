@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/config"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Video store backends
+const (
+	BackendDynamoDB = "dynamodb"
+	BackendSQLite   = "sqlite"
+	BackendPostgres = "postgres"
+)
+
+// VideoStore stores video metadata. It is implemented by VideoRepository on
+// DynamoDB, by SQLVideoStore on SQLite or Postgres and by MemoryVideoStore,
+// which keeps videos in memory for tests. Every backend enforces the same
+// status transitions and lease rules; reads of missing videos return
+// models.ErrVideoNotFound.
+type VideoStore interface {
+	// CreateVideo creates a pending video. It fails if the video exists.
+	CreateVideo(ctx context.Context, videoID, filename, s3RawKey string, fileSizeBytes int64) (*models.VideoMetadata, error)
+	GetVideo(ctx context.Context, videoID string) (*models.VideoMetadata, error)
+
+	// GetLatestVideo returns the most recently completed video.
+	GetLatestVideo(ctx context.Context) (*models.VideoMetadata, error)
+
+	// ListVideos returns up to limit videos, newest first, starting after
+	// cursor. The returned cursor is empty after the last page.
+	ListVideos(ctx context.Context, limit int32, cursor string) ([]models.VideoMetadata, string, error)
+
+	// Status changes requested by the API
+	TransitionVideo(ctx context.Context, videoID string, to models.VideoStatus, actor, reason string) error
+	ReprocessVideo(ctx context.Context, videoID, actor, reason string) (*models.VideoMetadata, error)
+	RequestCancellation(ctx context.Context, videoID string) error
+	RollbackVideo(ctx context.Context, videoID string, version int, playbackURL string) error
+
+	// Processing lease, held by the worker processing a video
+	ClaimVideo(ctx context.Context, videoID, owner string, lease time.Duration, receiveCount, version int) (*models.VideoMetadata, error)
+	RenewVideoLease(ctx context.Context, videoID, owner string, lease time.Duration) error
+	ReleaseVideoLease(ctx context.Context, videoID, owner string) error
+
+	// Outcomes of owner's processing attempt. Failing, rejecting or
+	// cancelling a video that still serves a published version returns it
+	// to completed; retrying or releasing it returns it to reprocessing
+	// rather than pending.
+	CompleteVideoProcessing(ctx context.Context, videoID, owner, playbackURL, hlsPrefix string, output models.OutputVersion) error
+	FailVideoProcessing(ctx context.Context, videoID, owner, errorMessage string, class models.ErrorClass) error
+	RetryVideoProcessing(ctx context.Context, videoID, owner, errorMessage string, class models.ErrorClass) error
+	RejectVideo(ctx context.Context, videoID, owner string, code models.RejectionCode, reason string) error
+	ReleaseVideo(ctx context.Context, videoID, owner, reason string) error
+	CancelVideo(ctx context.Context, videoID, owner, reason string) error
+
+	// Progress and derived data of a processing attempt
+	RecordStages(ctx context.Context, videoID, owner string, stages []models.StageRun) error
+	SaveCheckpoint(ctx context.Context, videoID, owner string, checkpoint models.Checkpoint) error
+	UpdateVideoAnalysis(ctx context.Context, videoID string, summary models.AnalysisSummary) error
+	UpdateVideoPreview(ctx context.Context, videoID string, preview models.PreviewAssets) error
+
+	// PruneVersions removes stored output versions other than the current
+	// one and returns those removed.
+	PruneVersions(ctx context.Context, videoID string, prune []int) ([]int, error)
+}
+
+// NewVideoStore creates the video store selected by cfg.Database.Backend.
+func NewVideoStore(ctx context.Context, cfg *config.Config) (VideoStore, error) {
+	switch cfg.Database.Backend {
+	case BackendDynamoDB, "":
+		return NewVideoRepository(ctx, cfg)
+	case BackendSQLite:
+		return NewSQLVideoStore(ctx, DriverSQLite, cfg.Database.URL)
+	case BackendPostgres:
+		return NewSQLVideoStore(ctx, DriverPostgres, cfg.Database.URL)
+	default:
+		return nil, fmt.Errorf("unknown database backend: %s", cfg.Database.Backend)
+	}
+}
+
+// claimError explains why video cannot be claimed for a job of the given
+// output version.
+func claimError(video *models.VideoMetadata, version int) error {
+	if video.Status == models.StatusCompleted {
+		return models.ErrVideoAlreadyCompleted
+	}
+	if video.Status == models.StatusCancelled {
+		return models.ErrVideoCancelled
+	}
+	if version > 0 && video.LatestVersion > version {
+		return fmt.Errorf("%w: version %d, latest %d", models.ErrStaleJob, version, video.LatestVersion)
+	}
+	if !video.Status.CanTransitionTo(models.StatusProcessing) {
+		return fmt.Errorf("%w: %s to %s", models.ErrInvalidTransition, video.Status, models.StatusProcessing)
+	}
+	return models.ErrLeaseHeld
+}
+
+// attemptOutcome returns the status a processing attempt that ends in to
+// leaves video in, and the reason to record for it. A failed or cancelled
+// attempt on a video that still serves a published version, such as a
+// reprocess, returns it to completed: its output keeps playing, and the
+// failure is recorded in the status history.
+func attemptOutcome(video *models.VideoMetadata, to models.VideoStatus, reason string) (models.VideoStatus, string) {
+	if (to == models.StatusFailed || to == models.StatusCancelled) && video.PlaybackURL != "" {
+		return models.StatusCompleted, fmt.Sprintf("%s, version %d kept: %s", to, video.CurrentVersion, reason)
+	}
+	return to, reason
+}
+
+// requeueStatus returns the status a video waits in for another attempt
+// after its processing is interrupted or retried: pending on its first
+// processing, or reprocessing if it still serves a published version, so
+// it is not shown as never processed. Either is entered from the statuses
+// pending may be.
+func requeueStatus(video *models.VideoMetadata) models.VideoStatus {
+	if video.PlaybackURL != "" {
+		return models.StatusReprocessing
+	}
+	return models.StatusPending
+}
+
+// transitionError explains why video cannot move to the given status:
+// its status does not allow the change, or the lease is held by another
+// worker.
+func transitionError(video *models.VideoMetadata, to models.VideoStatus) error {
+	if !video.Status.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s to %s", models.ErrInvalidTransition, video.Status, to)
+	}
+	return models.ErrLeaseNotHeld
+}
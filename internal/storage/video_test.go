@@ -0,0 +1,787 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// The conformance suite runs against every VideoStore backend. Postgres
+// and DynamoDB Local are used when TEST_POSTGRES_URL and
+// TEST_DYNAMODB_ENDPOINT are set; the Postgres database is emptied first.
+
+func TestMemoryVideoStore(t *testing.T) {
+	testVideoStore(t, func(t *testing.T) VideoStore {
+		return NewMemoryVideoStore()
+	})
+}
+
+func TestSQLiteVideoStore(t *testing.T) {
+	testVideoStore(t, func(t *testing.T) VideoStore {
+		store, err := NewSQLVideoStore(context.Background(), DriverSQLite, filepath.Join(t.TempDir(), "videos.db"))
+		if err != nil {
+			t.Fatalf("NewSQLVideoStore() error = %v", err)
+		}
+		t.Cleanup(func() { store.Close() })
+		return store
+	})
+}
+
+func TestPostgresVideoStore(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_URL")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_URL not set")
+	}
+
+	testVideoStore(t, func(t *testing.T) VideoStore {
+		ctx := context.Background()
+		db, err := sql.Open(DriverPostgres, dsn)
+		if err != nil {
+			t.Fatalf("sql.Open() error = %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if _, err := db.ExecContext(ctx, `DROP TABLE IF EXISTS videos, latest_video`); err != nil {
+			t.Fatalf("failed to drop tables: %v", err)
+		}
+		store, err := NewSQLVideoStoreFromDB(ctx, db, DriverPostgres)
+		if err != nil {
+			t.Fatalf("NewSQLVideoStoreFromDB() error = %v", err)
+		}
+		return store
+	})
+}
+
+func TestDynamoDBVideoStore(t *testing.T) {
+	endpoint := os.Getenv("TEST_DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("TEST_DYNAMODB_ENDPOINT not set")
+	}
+
+	client := dynamodb.New(dynamodb.Options{
+		Region:       "us-west-2",
+		BaseEndpoint: aws.String(endpoint),
+		Credentials: aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "local", SecretAccessKey: "local"}, nil
+		}),
+	})
+
+	testVideoStore(t, func(t *testing.T) VideoStore {
+		ctx := context.Background()
+		table := fmt.Sprintf("videos-%d", time.Now().UnixNano())
+		_, err := client.CreateTable(ctx, &dynamodb.CreateTableInput{
+			TableName:   aws.String(table),
+			BillingMode: types.BillingModePayPerRequest,
+			AttributeDefinitions: []types.AttributeDefinition{
+				{AttributeName: aws.String("pk"), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String("sk"), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String("gsi1pk"), AttributeType: types.ScalarAttributeTypeS},
+				{AttributeName: aws.String("gsi1sk"), AttributeType: types.ScalarAttributeTypeS},
+			},
+			KeySchema: []types.KeySchemaElement{
+				{AttributeName: aws.String("pk"), KeyType: types.KeyTypeHash},
+				{AttributeName: aws.String("sk"), KeyType: types.KeyTypeRange},
+			},
+			GlobalSecondaryIndexes: []types.GlobalSecondaryIndex{{
+				IndexName: aws.String("GSI1"),
+				KeySchema: []types.KeySchemaElement{
+					{AttributeName: aws.String("gsi1pk"), KeyType: types.KeyTypeHash},
+					{AttributeName: aws.String("gsi1sk"), KeyType: types.KeyTypeRange},
+				},
+				Projection: &types.Projection{ProjectionType: types.ProjectionTypeAll},
+			}},
+		})
+		if err != nil {
+			t.Fatalf("CreateTable() error = %v", err)
+		}
+		t.Cleanup(func() {
+			client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(table)})
+		})
+		return NewVideoRepositoryFromClient(client, table)
+	})
+}
+
+// testVideoStore runs the conformance suite, with a new store per test.
+func testVideoStore(t *testing.T, newStore func(t *testing.T) VideoStore) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, store VideoStore)
+	}{
+		{"create and get", testCreateAndGet},
+		{"claim lease", testClaimLease},
+		{"claim conflicts", testClaimConflicts},
+		{"transitions", testTransitions},
+		{"complete and latest", testCompleteAndLatest},
+		{"versions", testVersions},
+		{"attempt outcomes", testAttemptOutcomes},
+		{"failed reprocess", testFailedReprocess},
+		{"requeue", testRequeue},
+		{"cancellation", testCancellation},
+		{"stages and checkpoints", testStagesAndCheckpoints},
+		{"derived assets", testDerivedAssets},
+		{"list", testList},
+		{"concurrent claims", testConcurrentClaims},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStore(t))
+		})
+	}
+}
+
+// createClaimed creates a video and claims it for owner.
+func createClaimed(t *testing.T, store VideoStore, videoID, owner string) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := store.CreateVideo(ctx, videoID, "clip.mp4", "uploads/"+videoID+".mp4", 1024); err != nil {
+		t.Fatalf("CreateVideo() error = %v", err)
+	}
+	if _, err := store.ClaimVideo(ctx, videoID, owner, time.Minute, 1, 1); err != nil {
+		t.Fatalf("ClaimVideo() error = %v", err)
+	}
+}
+
+// mustGet returns a stored video.
+func mustGet(t *testing.T, store VideoStore, videoID string) *models.VideoMetadata {
+	t.Helper()
+	video, err := store.GetVideo(context.Background(), videoID)
+	if err != nil {
+		t.Fatalf("GetVideo() error = %v", err)
+	}
+	return video
+}
+
+// wantErr fails the test unless err matches target.
+func wantErr(t *testing.T, op string, err, target error) {
+	t.Helper()
+	if !errors.Is(err, target) {
+		t.Errorf("%s error = %v, want %v", op, err, target)
+	}
+}
+
+// output returns an output version for completion.
+func output(version int) models.OutputVersion {
+	return models.OutputVersion{
+		Version:     version,
+		Profile:     "standard",
+		Presets:     []models.QualityPreset{{Name: "720p", Width: 1280, Height: 720, Bitrate: 2800000}},
+		PublishedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+}
+
+func testCreateAndGet(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+
+	created, err := store.CreateVideo(ctx, "v1", "clip.mp4", "uploads/v1.mp4", 1024)
+	if err != nil {
+		t.Fatalf("CreateVideo() error = %v", err)
+	}
+	if created.Status != models.StatusPending || created.LatestVersion != 1 {
+		t.Errorf("CreateVideo() = %+v", created)
+	}
+
+	video := mustGet(t, store, "v1")
+	if video.Filename != "clip.mp4" || video.S3RawKey != "uploads/v1.mp4" || video.FileSizeBytes != 1024 {
+		t.Errorf("GetVideo() = %+v", video)
+	}
+	if len(video.StatusHistory) != 1 || video.StatusHistory[0].Actor != models.ActorAPI {
+		t.Errorf("StatusHistory = %+v", video.StatusHistory)
+	}
+
+	_, err = store.CreateVideo(ctx, "v1", "other.mp4", "uploads/other.mp4", 1)
+	wantErr(t, "CreateVideo() of existing video", err, models.ErrVideoExists)
+	_, err = store.GetVideo(ctx, "missing")
+	wantErr(t, "GetVideo() of missing video", err, models.ErrVideoNotFound)
+}
+
+func testClaimLease(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	createClaimed(t, store, "v1", "w1")
+
+	video := mustGet(t, store, "v1")
+	if video.Status != models.StatusProcessing || video.LeaseOwner != "w1" || video.Attempts != 1 || video.ReceiveCount != 1 {
+		t.Errorf("claimed video = %+v", video)
+	}
+
+	_, err := store.ClaimVideo(ctx, "v1", "w2", time.Minute, 2, 1)
+	wantErr(t, "ClaimVideo() of leased video", err, models.ErrLeaseHeld)
+	wantErr(t, "RenewVideoLease() by other worker", store.RenewVideoLease(ctx, "v1", "w2", time.Minute), models.ErrLeaseNotHeld)
+	wantErr(t, "RenewVideoLease() of missing video", store.RenewVideoLease(ctx, "missing", "w1", time.Minute), models.ErrVideoNotFound)
+
+	// Jobs for unknown videos must not create them
+	_, err = store.ClaimVideo(ctx, "missing", "w1", time.Minute, 1, 1)
+	wantErr(t, "ClaimVideo() of missing video", err, models.ErrVideoNotFound)
+	if _, err := store.GetVideo(ctx, "missing"); !errors.Is(err, models.ErrVideoNotFound) {
+		t.Errorf("GetVideo() after claim of missing video error = %v, want ErrVideoNotFound", err)
+	}
+
+	// The holder may claim again, counting another attempt
+	video, err = store.ClaimVideo(ctx, "v1", "w1", time.Minute, 2, 1)
+	if err != nil {
+		t.Fatalf("ClaimVideo() by holder error = %v", err)
+	}
+	if video.Attempts != 2 || video.ReceiveCount != 2 {
+		t.Errorf("reclaimed video attempts = %d, receives = %d, want 2, 2", video.Attempts, video.ReceiveCount)
+	}
+
+	if err := store.RenewVideoLease(ctx, "v1", "w1", time.Minute); err != nil {
+		t.Errorf("RenewVideoLease() error = %v", err)
+	}
+	if err := store.ReleaseVideoLease(ctx, "v1", "w1"); err != nil {
+		t.Fatalf("ReleaseVideoLease() error = %v", err)
+	}
+	if video := mustGet(t, store, "v1"); video.LeaseOwner != "" || video.Status != models.StatusProcessing {
+		t.Errorf("released video = %+v", video)
+	}
+
+	// Expired leases may be taken over
+	if _, err := store.ClaimVideo(ctx, "v1", "w2", -time.Minute, 3, 1); err != nil {
+		t.Fatalf("ClaimVideo() of released video error = %v", err)
+	}
+	if _, err := store.ClaimVideo(ctx, "v1", "w3", time.Minute, 4, 1); err != nil {
+		t.Fatalf("ClaimVideo() of expired lease error = %v", err)
+	}
+
+	if err := store.ReleaseVideo(ctx, "v1", "w3", "shutting down"); err != nil {
+		t.Fatalf("ReleaseVideo() error = %v", err)
+	}
+	if video := mustGet(t, store, "v1"); video.Status != models.StatusPending || video.LeaseOwner != "" {
+		t.Errorf("released video = %+v", video)
+	}
+	wantErr(t, "ReleaseVideo() without lease", store.ReleaseVideo(ctx, "v1", "w3", "again"), models.ErrInvalidTransition)
+}
+
+func testClaimConflicts(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+
+	createClaimed(t, store, "done", "w1")
+	if err := store.CompleteVideoProcessing(ctx, "done", "w1", "https://cdn/done", models.HLSPrefix("done", 1), output(1)); err != nil {
+		t.Fatalf("CompleteVideoProcessing() error = %v", err)
+	}
+	_, err := store.ClaimVideo(ctx, "done", "w2", time.Minute, 1, 1)
+	wantErr(t, "ClaimVideo() of completed video", err, models.ErrVideoAlreadyCompleted)
+
+	createClaimed(t, store, "cancelled", "w1")
+	if err := store.RequestCancellation(ctx, "cancelled"); err != nil {
+		t.Fatalf("RequestCancellation() error = %v", err)
+	}
+	if err := store.CancelVideo(ctx, "cancelled", "w1", "cancelled by user"); err != nil {
+		t.Fatalf("CancelVideo() error = %v", err)
+	}
+	_, err = store.ClaimVideo(ctx, "cancelled", "w2", time.Minute, 1, 1)
+	wantErr(t, "ClaimVideo() of cancelled video", err, models.ErrVideoCancelled)
+
+	// A job for version 1 is stale once version 2 is allocated
+	if _, err := store.ReprocessVideo(ctx, "done", models.ActorAPI, "reprocess"); err != nil {
+		t.Fatalf("ReprocessVideo() error = %v", err)
+	}
+	_, err = store.ClaimVideo(ctx, "done", "w2", time.Minute, 1, 1)
+	wantErr(t, "ClaimVideo() for superseded version", err, models.ErrStaleJob)
+	if _, err := store.ClaimVideo(ctx, "done", "w2", time.Minute, 1, 2); err != nil {
+		t.Errorf("ClaimVideo() for latest version error = %v", err)
+	}
+}
+
+func testTransitions(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	if _, err := store.CreateVideo(ctx, "v1", "clip.mp4", "uploads/v1.mp4", 1); err != nil {
+		t.Fatalf("CreateVideo() error = %v", err)
+	}
+
+	if err := store.TransitionVideo(ctx, "v1", models.StatusQueued, models.ActorAPI, "job queued"); err != nil {
+		t.Fatalf("TransitionVideo() error = %v", err)
+	}
+	video := mustGet(t, store, "v1")
+	if video.Status != models.StatusQueued || len(video.StatusHistory) != 2 || video.StatusHistory[1].Reason != "job queued" {
+		t.Errorf("transitioned video = %+v", video)
+	}
+
+	wantErr(t, "TransitionVideo() to completed", store.TransitionVideo(ctx, "v1", models.StatusCompleted, models.ActorAPI, ""), models.ErrInvalidTransition)
+	wantErr(t, "TransitionVideo() of missing video", store.TransitionVideo(ctx, "missing", models.StatusQueued, models.ActorAPI, ""), models.ErrVideoNotFound)
+	_, err := store.ReprocessVideo(ctx, "v1", models.ActorAPI, "reprocess")
+	wantErr(t, "ReprocessVideo() of queued video", err, models.ErrInvalidTransition)
+}
+
+func testCompleteAndLatest(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+
+	_, err := store.GetLatestVideo(ctx)
+	wantErr(t, "GetLatestVideo() of empty store", err, models.ErrVideoNotFound)
+
+	createClaimed(t, store, "v1", "w1")
+	err = store.CompleteVideoProcessing(ctx, "v1", "w2", "https://cdn/v1", models.HLSPrefix("v1", 1), output(1))
+	wantErr(t, "CompleteVideoProcessing() by other worker", err, models.ErrLeaseNotHeld)
+
+	if err := store.SaveCheckpoint(ctx, "v1", "w1", models.Checkpoint{Stage: "transcode", Version: 1}); err != nil {
+		t.Fatalf("SaveCheckpoint() error = %v", err)
+	}
+	if err := store.CompleteVideoProcessing(ctx, "v1", "w1", "https://cdn/v1", models.HLSPrefix("v1", 1), output(1)); err != nil {
+		t.Fatalf("CompleteVideoProcessing() error = %v", err)
+	}
+
+	video := mustGet(t, store, "v1")
+	if video.Status != models.StatusCompleted || video.PlaybackURL != "https://cdn/v1" || video.CurrentVersion != 1 || video.ProcessedAt == "" {
+		t.Errorf("completed video = %+v", video)
+	}
+	if video.LeaseOwner != "" || len(video.Checkpoints) != 0 || len(video.Versions) != 1 || len(video.QualityPresets) != 1 {
+		t.Errorf("completed video lease = %q, checkpoints = %v, versions = %v", video.LeaseOwner, video.Checkpoints, video.Versions)
+	}
+
+	latest, err := store.GetLatestVideo(ctx)
+	if err != nil {
+		t.Fatalf("GetLatestVideo() error = %v", err)
+	}
+	if latest.VideoID != "v1" {
+		t.Errorf("GetLatestVideo() = %s, want v1", latest.VideoID)
+	}
+
+	err = store.CompleteVideoProcessing(ctx, "v1", "w1", "https://cdn/v1", models.HLSPrefix("v1", 1), output(1))
+	wantErr(t, "CompleteVideoProcessing() of completed video", err, models.ErrInvalidTransition)
+}
+
+func testVersions(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	createClaimed(t, store, "v1", "w1")
+	if err := store.CompleteVideoProcessing(ctx, "v1", "w1", "https://cdn/v1", models.HLSPrefix("v1", 1), output(1)); err != nil {
+		t.Fatalf("CompleteVideoProcessing() error = %v", err)
+	}
+
+	video, err := store.ReprocessVideo(ctx, "v1", models.ActorAPI, "reprocess")
+	if err != nil {
+		t.Fatalf("ReprocessVideo() error = %v", err)
+	}
+	if video.Status != models.StatusReprocessing || video.LatestVersion != 2 {
+		t.Errorf("ReprocessVideo() = status %s, latest %d", video.Status, video.LatestVersion)
+	}
+	if _, err := store.ClaimVideo(ctx, "v1", "w1", time.Minute, 1, 2); err != nil {
+		t.Fatalf("ClaimVideo() error = %v", err)
+	}
+	if err := store.CompleteVideoProcessing(ctx, "v1", "w1", "https://cdn/v1/v2", models.HLSPrefix("v1", 2), output(2)); err != nil {
+		t.Fatalf("CompleteVideoProcessing() error = %v", err)
+	}
+
+	if err := store.RollbackVideo(ctx, "v1", 1, "https://cdn/v1/v1"); err != nil {
+		t.Fatalf("RollbackVideo() error = %v", err)
+	}
+	video = mustGet(t, store, "v1")
+	if video.CurrentVersion != 1 || video.PlaybackURL != "https://cdn/v1/v1" || video.S3HLSPrefix != models.HLSPrefix("v1", 1) {
+		t.Errorf("rolled back video = %+v", video)
+	}
+
+	wantErr(t, "RollbackVideo() to current version", store.RollbackVideo(ctx, "v1", 1, ""), models.ErrInvalidTransition)
+	wantErr(t, "RollbackVideo() to missing version", store.RollbackVideo(ctx, "v1", 9, ""), models.ErrVersionNotFound)
+
+	removed, err := store.PruneVersions(ctx, "v1", []int{1, 2})
+	if err != nil {
+		t.Fatalf("PruneVersions() error = %v", err)
+	}
+	if !slices.Equal(removed, []int{2}) {
+		t.Errorf("PruneVersions() = %v, want [2]", removed)
+	}
+	if removed, err := store.PruneVersions(ctx, "v1", []int{2}); err != nil || len(removed) != 0 {
+		t.Errorf("PruneVersions() again = %v, %v, want none", removed, err)
+	}
+	if video := mustGet(t, store, "v1"); len(video.Versions) != 1 || video.Versions[0].Version != 1 {
+		t.Errorf("pruned versions = %+v", video.Versions)
+	}
+}
+
+func testAttemptOutcomes(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+
+	createClaimed(t, store, "failed", "w1")
+	err := store.FailVideoProcessing(ctx, "failed", "w2", "boom", models.ErrorClassPermanent)
+	wantErr(t, "FailVideoProcessing() by other worker", err, models.ErrLeaseNotHeld)
+	if err := store.FailVideoProcessing(ctx, "failed", "w1", "boom", models.ErrorClassPermanent); err != nil {
+		t.Fatalf("FailVideoProcessing() error = %v", err)
+	}
+	video := mustGet(t, store, "failed")
+	if video.Status != models.StatusFailed || video.ErrorMessage != "boom" || video.ErrorClass != models.ErrorClassPermanent || video.LeaseOwner != "" {
+		t.Errorf("failed video = %+v", video)
+	}
+
+	createClaimed(t, store, "retried", "w1")
+	if err := store.RetryVideoProcessing(ctx, "retried", "w1", "throttled", models.ErrorClassTransient); err != nil {
+		t.Fatalf("RetryVideoProcessing() error = %v", err)
+	}
+	video = mustGet(t, store, "retried")
+	if video.Status != models.StatusPending || video.ErrorMessage != "throttled" || video.LeaseOwner != "" {
+		t.Errorf("retried video = %+v", video)
+	}
+
+	createClaimed(t, store, "rejected", "w1")
+	if err := store.RejectVideo(ctx, "rejected", "w1", models.RejectDurationExceeded, "input too long"); err != nil {
+		t.Fatalf("RejectVideo() error = %v", err)
+	}
+	video = mustGet(t, store, "rejected")
+	if video.Status != models.StatusFailed || video.RejectionCode != models.RejectDurationExceeded || video.RejectionReason != "input too long" || video.ErrorClass != models.ErrorClassPermanent {
+		t.Errorf("rejected video = %+v", video)
+	}
+	if last := video.StatusHistory[len(video.StatusHistory)-1]; last.Reason != "rejected: duration_exceeded" {
+		t.Errorf("rejection history reason = %q", last.Reason)
+	}
+
+	err = store.FailVideoProcessing(ctx, "missing", "w1", "boom", models.ErrorClassPermanent)
+	wantErr(t, "FailVideoProcessing() of missing video", err, models.ErrVideoNotFound)
+}
+
+func testFailedReprocess(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		status models.VideoStatus
+		end    func(videoID string) error
+	}{
+		{"failed", models.StatusFailed, func(videoID string) error {
+			return store.FailVideoProcessing(ctx, videoID, "w1", "boom", models.ErrorClassPermanent)
+		}},
+		{"rejected", models.StatusFailed, func(videoID string) error {
+			return store.RejectVideo(ctx, videoID, "w1", models.RejectDurationExceeded, "input too long")
+		}},
+		{"cancelled", models.StatusCancelled, func(videoID string) error {
+			return store.CancelVideo(ctx, videoID, "w1", "cancelled by user")
+		}},
+	}
+
+	for _, tt := range tests {
+		createClaimed(t, store, tt.name, "w1")
+		if err := store.CompleteVideoProcessing(ctx, tt.name, "w1", "https://cdn/v1", models.HLSPrefix(tt.name, 1), output(1)); err != nil {
+			t.Fatalf("CompleteVideoProcessing() error = %v", err)
+		}
+		if _, err := store.ReprocessVideo(ctx, tt.name, models.ActorAPI, "reprocess"); err != nil {
+			t.Fatalf("ReprocessVideo() error = %v", err)
+		}
+		if _, err := store.ClaimVideo(ctx, tt.name, "w1", time.Minute, 1, 2); err != nil {
+			t.Fatalf("ClaimVideo() error = %v", err)
+		}
+		if err := tt.end(tt.name); err != nil {
+			t.Fatalf("%s reprocess error = %v", tt.name, err)
+		}
+
+		video := mustGet(t, store, tt.name)
+		if video.Status != models.StatusCompleted || video.CurrentVersion != 1 || video.PlaybackURL != "https://cdn/v1" || video.LeaseOwner != "" {
+			t.Errorf("%s reprocess left video = %+v", tt.name, video)
+		}
+		if last := video.StatusHistory[len(video.StatusHistory)-1]; !strings.HasPrefix(last.Reason, string(tt.status)+", version 1 kept") {
+			t.Errorf("%s reprocess history reason = %q", tt.name, last.Reason)
+		}
+	}
+}
+
+func testRequeue(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name      string
+		published bool
+		want      models.VideoStatus
+		end       func(videoID string) error
+	}{
+		{"retried", false, models.StatusPending, func(videoID string) error {
+			return store.RetryVideoProcessing(ctx, videoID, "w1", "timeout", models.ErrorClassTransient)
+		}},
+		{"released", false, models.StatusPending, func(videoID string) error {
+			return store.ReleaseVideo(ctx, videoID, "w1", "worker shutting down")
+		}},
+		{"retried reprocess", true, models.StatusReprocessing, func(videoID string) error {
+			return store.RetryVideoProcessing(ctx, videoID, "w1", "timeout", models.ErrorClassTransient)
+		}},
+		{"released reprocess", true, models.StatusReprocessing, func(videoID string) error {
+			return store.ReleaseVideo(ctx, videoID, "w1", "worker shutting down")
+		}},
+	}
+
+	for _, tt := range tests {
+		createClaimed(t, store, tt.name, "w1")
+		version := 1
+		if tt.published {
+			if err := store.CompleteVideoProcessing(ctx, tt.name, "w1", "https://cdn/v1", models.HLSPrefix(tt.name, 1), output(1)); err != nil {
+				t.Fatalf("CompleteVideoProcessing() error = %v", err)
+			}
+			if _, err := store.ReprocessVideo(ctx, tt.name, models.ActorAPI, "reprocess"); err != nil {
+				t.Fatalf("ReprocessVideo() error = %v", err)
+			}
+			version = 2
+			if _, err := store.ClaimVideo(ctx, tt.name, "w1", time.Minute, 1, version); err != nil {
+				t.Fatalf("ClaimVideo() error = %v", err)
+			}
+		}
+		if err := tt.end(tt.name); err != nil {
+			t.Fatalf("%s error = %v", tt.name, err)
+		}
+
+		video := mustGet(t, store, tt.name)
+		if video.Status != tt.want || video.LeaseOwner != "" {
+			t.Errorf("%s video = %+v, want %s", tt.name, video, tt.want)
+		}
+		if tt.published && (video.CurrentVersion != 1 || video.PlaybackURL != "https://cdn/v1") {
+			t.Errorf("%s video lost its published version: %+v", tt.name, video)
+		}
+		if _, err := store.ClaimVideo(ctx, tt.name, "w2", time.Minute, 2, version); err != nil {
+			t.Errorf("%s ClaimVideo() again error = %v", tt.name, err)
+		}
+	}
+}
+
+func testCancellation(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	if _, err := store.CreateVideo(ctx, "v1", "clip.mp4", "uploads/v1.mp4", 1); err != nil {
+		t.Fatalf("CreateVideo() error = %v", err)
+	}
+	wantErr(t, "RequestCancellation() of pending video", store.RequestCancellation(ctx, "v1"), models.ErrInvalidTransition)
+	wantErr(t, "RequestCancellation() of missing video", store.RequestCancellation(ctx, "missing"), models.ErrVideoNotFound)
+
+	if _, err := store.ClaimVideo(ctx, "v1", "w1", time.Minute, 1, 1); err != nil {
+		t.Fatalf("ClaimVideo() error = %v", err)
+	}
+	if err := store.RequestCancellation(ctx, "v1"); err != nil {
+		t.Fatalf("RequestCancellation() error = %v", err)
+	}
+	if video := mustGet(t, store, "v1"); !video.CancelRequested {
+		t.Error("CancelRequested = false after RequestCancellation()")
+	}
+
+	wantErr(t, "CancelVideo() by other worker", store.CancelVideo(ctx, "v1", "w2", "cancelled"), models.ErrLeaseNotHeld)
+	if err := store.CancelVideo(ctx, "v1", "w1", "cancelled by user"); err != nil {
+		t.Fatalf("CancelVideo() error = %v", err)
+	}
+	video := mustGet(t, store, "v1")
+	if video.Status != models.StatusCancelled || video.CancelRequested || video.LeaseOwner != "" {
+		t.Errorf("cancelled video = %+v", video)
+	}
+}
+
+func testStagesAndCheckpoints(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	stages := []models.StageRun{{Name: "transcode", Status: models.StageSucceeded, Attempts: 1}}
+
+	wantErr(t, "RecordStages() of missing video", store.RecordStages(ctx, "missing", "w1", stages), models.ErrLeaseNotHeld)
+
+	createClaimed(t, store, "v1", "w1")
+	wantErr(t, "RecordStages() by other worker", store.RecordStages(ctx, "v1", "w2", stages), models.ErrLeaseNotHeld)
+	wantErr(t, "SaveCheckpoint() by other worker", store.SaveCheckpoint(ctx, "v1", "w2", models.Checkpoint{Stage: "probe"}), models.ErrLeaseNotHeld)
+	if err := store.RecordStages(ctx, "v1", "w1", stages); err != nil {
+		t.Fatalf("RecordStages() error = %v", err)
+	}
+	for _, stage := range []string{"probe", "transcode"} {
+		if err := store.SaveCheckpoint(ctx, "v1", "w1", models.Checkpoint{Stage: stage, Version: 1}); err != nil {
+			t.Fatalf("SaveCheckpoint() error = %v", err)
+		}
+	}
+
+	// Stages may still be recorded after the attempt releases the lease
+	if err := store.RetryVideoProcessing(ctx, "v1", "w1", "throttled", models.ErrorClassTransient); err != nil {
+		t.Fatalf("RetryVideoProcessing() error = %v", err)
+	}
+	if err := store.RecordStages(ctx, "v1", "w1", stages); err != nil {
+		t.Errorf("RecordStages() after release error = %v", err)
+	}
+	wantErr(t, "RecordStages() by other worker after release", store.RecordStages(ctx, "v1", "w2", stages), models.ErrLeaseNotHeld)
+
+	video := mustGet(t, store, "v1")
+	if len(video.Stages) != 1 || video.StagesOwner != "w1" || len(video.Checkpoints) != 2 || video.Checkpoints[1].Stage != "transcode" {
+		t.Errorf("video stages = %+v, checkpoints = %+v", video.Stages, video.Checkpoints)
+	}
+}
+
+func testDerivedAssets(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	summary := models.AnalysisSummary{SceneChangeCount: 4, TimelineKey: "hls/v1/timeline.json"}
+	preview := models.PreviewAssets{WebPKey: "hls/v1/preview.webp"}
+
+	wantErr(t, "UpdateVideoAnalysis() of missing video", store.UpdateVideoAnalysis(ctx, "missing", summary), models.ErrVideoNotFound)
+	wantErr(t, "UpdateVideoPreview() of missing video", store.UpdateVideoPreview(ctx, "missing", preview), models.ErrVideoNotFound)
+
+	if _, err := store.CreateVideo(ctx, "v1", "clip.mp4", "uploads/v1.mp4", 1); err != nil {
+		t.Fatalf("CreateVideo() error = %v", err)
+	}
+	if err := store.UpdateVideoAnalysis(ctx, "v1", summary); err != nil {
+		t.Fatalf("UpdateVideoAnalysis() error = %v", err)
+	}
+	if err := store.UpdateVideoPreview(ctx, "v1", preview); err != nil {
+		t.Fatalf("UpdateVideoPreview() error = %v", err)
+	}
+	video := mustGet(t, store, "v1")
+	if video.Analysis == nil || *video.Analysis != summary || video.Preview == nil || *video.Preview != preview {
+		t.Errorf("video analysis = %+v, preview = %+v", video.Analysis, video.Preview)
+	}
+}
+
+func testList(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	for i := range 5 {
+		if _, err := store.CreateVideo(ctx, fmt.Sprintf("v%d", i), "clip.mp4", "uploads/clip.mp4", 1); err != nil {
+			t.Fatalf("CreateVideo() error = %v", err)
+		}
+	}
+
+	var listed []models.VideoMetadata
+	cursor := ""
+	for page := 0; ; page++ {
+		if page > 5 {
+			t.Fatal("ListVideos() did not finish")
+		}
+		videos, next, err := store.ListVideos(ctx, 2, cursor)
+		if err != nil {
+			t.Fatalf("ListVideos() error = %v", err)
+		}
+		if len(videos) > 2 {
+			t.Fatalf("ListVideos() returned %d videos, limit 2", len(videos))
+		}
+		listed = append(listed, videos...)
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if len(listed) != 5 {
+		t.Fatalf("ListVideos() listed %d videos, want 5", len(listed))
+	}
+	newestFirst := slices.IsSortedFunc(listed, func(a, b models.VideoMetadata) int {
+		return strings.Compare(listKey(&b), listKey(&a))
+	})
+	if !newestFirst {
+		t.Errorf("ListVideos() order = %v", listed)
+	}
+
+	_, _, err := store.ListVideos(ctx, 2, "not a cursor!")
+	wantErr(t, "ListVideos() with invalid cursor", err, models.ErrInvalidCursor)
+}
+
+func testConcurrentClaims(t *testing.T, store VideoStore) {
+	ctx := context.Background()
+	if _, err := store.CreateVideo(ctx, "v1", "clip.mp4", "uploads/v1.mp4", 1); err != nil {
+		t.Fatalf("CreateVideo() error = %v", err)
+	}
+
+	const workers = 8
+	errs := make([]error, workers)
+	var wg sync.WaitGroup
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = store.ClaimVideo(ctx, "v1", fmt.Sprintf("w%d", i), time.Minute, 1, 1)
+		}()
+	}
+	wg.Wait()
+
+	claimed := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			claimed++
+		case !errors.Is(err, models.ErrLeaseHeld):
+			t.Errorf("ClaimVideo() error = %v, want ErrLeaseHeld", err)
+		}
+	}
+	if claimed != 1 {
+		t.Errorf("%d concurrent claims succeeded, want 1", claimed)
+	}
+	if video := mustGet(t, store, "v1"); video.Attempts != 1 {
+		t.Errorf("Attempts = %d, want 1", video.Attempts)
+	}
+}
+
+func TestSQLVideoStore_Placeholders(t *testing.T) {
+	query := `UPDATE videos SET document = ? WHERE video_id = ? AND revision = ?`
+
+	if got := (&SQLVideoStore{driver: DriverSQLite}).query(query); got != query {
+		t.Errorf("sqlite query = %s", got)
+	}
+	want := `UPDATE videos SET document = $1 WHERE video_id = $2 AND revision = $3`
+	if got := (&SQLVideoStore{driver: DriverPostgres}).query(query); got != want {
+		t.Errorf("postgres query = %s, want %s", got, want)
+	}
+}
+
+func TestSQLiteVideoStore_PragmasOnEveryConnection(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewSQLVideoStore(ctx, DriverSQLite, filepath.Join(t.TempDir(), "videos.db"))
+	if err != nil {
+		t.Fatalf("NewSQLVideoStore() error = %v", err)
+	}
+	defer store.Close()
+
+	// Without idle connections every query runs on a new connection
+	store.db.SetMaxIdleConns(0)
+	for range 2 {
+		var timeout int
+		if err := store.db.QueryRowContext(ctx, `PRAGMA busy_timeout`).Scan(&timeout); err != nil {
+			t.Fatalf("busy_timeout query error = %v", err)
+		}
+		if timeout != 5000 {
+			t.Errorf("busy_timeout = %d, want 5000", timeout)
+		}
+		var mode string
+		if err := store.db.QueryRowContext(ctx, `PRAGMA journal_mode`).Scan(&mode); err != nil {
+			t.Fatalf("journal_mode query error = %v", err)
+		}
+		if mode != "wal" {
+			t.Errorf("journal_mode = %s, want wal", mode)
+		}
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"/tmp/v.db", "/tmp/v.db?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"},
+		{"file:/tmp/v.db?mode=rwc", "file:/tmp/v.db?mode=rwc&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"},
+		{"/tmp/v.db?_pragma=busy_timeout(100)", "/tmp/v.db?_pragma=busy_timeout(100)&_pragma=journal_mode(WAL)"},
+	}
+
+	for _, tt := range tests {
+		if got := sqliteDSN(tt.dsn); got != tt.want {
+			t.Errorf("sqliteDSN(%q) = %q, want %q", tt.dsn, got, tt.want)
+		}
+	}
+}
+
+func TestVersionsGuard(t *testing.T) {
+	tests := []struct {
+		name     string
+		rev      int
+		wantCond string
+		wantNext string
+	}{
+		{"never written", 0, "attribute_not_exists(versions_rev)", "1"},
+		{"written", 4, "versions_rev = :versions_rev", "5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := map[string]types.AttributeValue{}
+			cond := versionsGuard(&models.VideoMetadata{VersionsRev: tt.rev}, values)
+			if cond != tt.wantCond {
+				t.Errorf("versionsGuard() = %q, want %q", cond, tt.wantCond)
+			}
+			next, ok := values[":versions_next"].(*types.AttributeValueMemberN)
+			if !ok || next.Value != tt.wantNext {
+				t.Errorf(":versions_next = %v, want %s", values[":versions_next"], tt.wantNext)
+			}
+			if rev, ok := values[":versions_rev"].(*types.AttributeValueMemberN); tt.rev > 0 && (!ok || rev.Value != strconv.Itoa(tt.rev)) {
+				t.Errorf(":versions_rev = %v, want %d", values[":versions_rev"], tt.rev)
+			}
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package transcoder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Analysis thresholds
+const (
+	BlackMinDuration     = 0.5  // Seconds of black before a segment is reported
+	BlackPixelThreshold  = 0.10 // Luma ratio below which a pixel counts as black
+	SilenceNoiseFloor    = "-50dB"
+	SilenceMinDuration   = 2.0 // Seconds of silence before a segment is reported
+	SceneChangeThreshold = 0.4 // FFmpeg scene score above which a frame is a cut
+
+	// EdgeTolerance is how close (in seconds) a segment must be to the start
+	// or end of the source to count as leading or trailing.
+	EdgeTolerance = 0.1
+
+	// PosterMinOffset keeps the poster frame clear of the cut itself.
+	PosterMinOffset = 0.5
+
+	// TimelineFilename is the analysis document written next to the playlists.
+	TimelineFilename = "timeline.json"
+)
+
+// Analyze runs black, silence and scene-change detection over the input.
+func (t *Transcoder) Analyze(ctx context.Context, videoID, inputPath string, probe *ProbeResult) (*models.Timeline, error) {
+	ctx, span := tracer.Start(ctx, "analyze-content")
+	defer span.End()
+
+	args := buildAnalysisArgs(inputPath, probe, t.limits.Threads)
+
+	cmd, finish, err := t.command(ctx, "ffmpeg", args...)
+	if err != nil {
+		return nil, fmt.Errorf("analysis ffmpeg failed: %w", err)
+	}
+	defer finish()
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("analysis ffmpeg failed: %w", err)
+	}
+
+	timeline := parseAnalysisOutput(&stderr)
+	timeline.VideoID = videoID
+	timeline.GeneratedAt = time.Now().UTC().Format(time.RFC3339)
+	if probe != nil {
+		timeline.DurationSeconds = probe.DurationSeconds
+	}
+
+	// A black segment running to EOF is reported without an end
+	for i := range timeline.BlackSegments {
+		if timeline.BlackSegments[i].End == 0 {
+			timeline.BlackSegments[i].End = timeline.DurationSeconds
+		}
+	}
+	for i := range timeline.Silences {
+		if timeline.Silences[i].End == 0 {
+			timeline.Silences[i].End = timeline.DurationSeconds
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("analysis.black_segments", len(timeline.BlackSegments)),
+		attribute.Int("analysis.silences", len(timeline.Silences)),
+		attribute.Int("analysis.scene_changes", len(timeline.SceneChanges)),
+	)
+
+	return timeline, nil
+}
+
+// buildAnalysisArgs constructs a single decode pass that runs every detector,
+// decoding with at most threads threads if it is not 0.
+func buildAnalysisArgs(inputPath string, probe *ProbeResult, threads int) []string {
+	args := append([]string{"-hide_banner", "-nostats"}, threadArgs(threads)...)
+	args = append(args,
+		"-i", inputPath,
+		"-vf", fmt.Sprintf("blackdetect=d=%g:pix_th=%.2f,select='gt(scene,%g)',metadata=print:key=lavfi.scene_score",
+			BlackMinDuration, BlackPixelThreshold, SceneChangeThreshold),
+	)
+
+	if probe == nil || probe.HasAudio {
+		args = append(args, "-af", fmt.Sprintf("silencedetect=noise=%s:d=%g", SilenceNoiseFloor, SilenceMinDuration))
+	} else {
+		args = append(args, "-an")
+	}
+
+	return append(args, "-f", "null", "-")
+}
+
+// parseAnalysisOutput extracts detector events from FFmpeg's log output.
+func parseAnalysisOutput(r *bytes.Buffer) *models.Timeline {
+	timeline := &models.Timeline{
+		BlackSegments: []models.TimeRange{},
+		Silences:      []models.TimeRange{},
+		SceneChanges:  []models.SceneChange{},
+	}
+
+	var pendingScene *models.SceneChange
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case strings.Contains(line, "black_start:"):
+			timeline.BlackSegments = append(timeline.BlackSegments, models.TimeRange{
+				Start: logField(line, "black_start:"),
+				End:   logField(line, "black_end:"),
+			})
+
+		case strings.Contains(line, "silence_start:"):
+			timeline.Silences = append(timeline.Silences, models.TimeRange{
+				Start: logField(line, "silence_start:"),
+			})
+
+		case strings.Contains(line, "silence_end:"):
+			if n := len(timeline.Silences); n > 0 {
+				timeline.Silences[n-1].End = logField(line, "silence_end:")
+			}
+
+		case strings.Contains(line, "pts_time:"):
+			// metadata=print emits the frame header first, then its keys
+			pendingScene = &models.SceneChange{Time: logField(line, "pts_time:")}
+
+		case strings.Contains(line, "lavfi.scene_score="):
+			if pendingScene != nil {
+				pendingScene.Score = logField(line, "lavfi.scene_score=")
+				timeline.SceneChanges = append(timeline.SceneChanges, *pendingScene)
+				pendingScene = nil
+			}
+		}
+	}
+
+	return timeline
+}
+
+// logField parses the number following key in an FFmpeg log line.
+func logField(line, key string) float64 {
+	idx := strings.Index(line, key)
+	if idx == -1 {
+		return 0
+	}
+	fields := strings.Fields(line[idx+len(key):])
+	if len(fields) == 0 {
+		return 0
+	}
+	v, _ := strconv.ParseFloat(fields[0], 64)
+	return v
+}
+
+// SummarizeTimeline condenses a timeline into the summary stored on the video record.
+func SummarizeTimeline(timeline *models.Timeline, timelineKey string) models.AnalysisSummary {
+	summary := models.AnalysisSummary{
+		SilenceCount:     len(timeline.Silences),
+		SceneChangeCount: len(timeline.SceneChanges),
+		TrimEndSeconds:   timeline.DurationSeconds,
+		TimelineKey:      timelineKey,
+	}
+
+	for _, b := range timeline.BlackSegments {
+		if b.Start <= EdgeTolerance {
+			summary.LeadingBlackSeconds = b.End
+			summary.TrimStartSeconds = b.End
+		}
+		if timeline.DurationSeconds > 0 && b.End >= timeline.DurationSeconds-EdgeTolerance && b.Start > EdgeTolerance {
+			summary.TrailingBlackSeconds = b.Duration()
+			summary.TrimEndSeconds = b.Start
+		}
+	}
+
+	for _, s := range timeline.Silences {
+		summary.LongestSilenceSeconds = max(summary.LongestSilenceSeconds, s.Duration())
+	}
+
+	summary.PosterTimeSeconds = choosePosterTime(timeline, summary.TrimStartSeconds, summary.TrimEndSeconds)
+
+	return summary
+}
+
+// choosePosterTime picks a frame just after the first real cut inside the
+// trimmed content, falling back to a point 10% into it.
+func choosePosterTime(timeline *models.Timeline, trimStart, trimEnd float64) float64 {
+	for _, sc := range timeline.SceneChanges {
+		candidate := sc.Time + PosterMinOffset
+		if sc.Time < trimStart || candidate >= trimEnd {
+			continue
+		}
+		if inAnyRange(timeline.BlackSegments, candidate) {
+			continue
+		}
+		return candidate
+	}
+
+	if trimEnd <= trimStart {
+		return trimStart
+	}
+	return trimStart + (trimEnd-trimStart)*0.1
+}
+
+func inAnyRange(ranges []models.TimeRange, t float64) bool {
+	for _, r := range ranges {
+		if r.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTimeline writes the timeline document into the HLS output directory.
+func WriteTimeline(hlsDir string, timeline *models.Timeline) error {
+	data, err := json.MarshalIndent(timeline, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal timeline: %w", err)
+	}
+	return os.WriteFile(filepath.Join(hlsDir, TimelineFilename), data, 0644)
+}
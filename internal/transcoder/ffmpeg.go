@@ -8,6 +8,9 @@ import (
 	"log/slog"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -21,27 +24,35 @@ import (
 const (
 	// HLSSegmentDuration is the duration of each HLS segment in seconds.
 	HLSSegmentDuration = 6
+
+	// PipeInput is the input name of a source streamed to FFmpeg's stdin;
+	// see WithStdin.
+	PipeInput = "pipe:0"
 )
 
 var tracer = otel.Tracer("hls-transcoder")
 
 // FFmpegConfig holds configuration for FFmpeg execution.
 type FFmpegConfig struct {
-	Presets []Preset
-	Logger  *slog.Logger
+	Presets      []Preset
+	Deinterlacer string
+	Logger       *slog.Logger
 }
 
 // DefaultFFmpegConfig returns the default FFmpeg configuration.
 func DefaultFFmpegConfig(logger *slog.Logger) *FFmpegConfig {
 	return &FFmpegConfig{
-		Presets: DefaultPresets,
-		Logger:  logger,
+		Presets:      DefaultPresets,
+		Deinterlacer: DeinterlacerBWDIF,
+		Logger:       logger,
 	}
 }
 
 // Transcoder handles video transcoding operations.
 type Transcoder struct {
 	config *FFmpegConfig
+	stdin  func(ctx context.Context) (io.ReadCloser, error) // Opens PipeInput
+	limits ProcessLimits
 }
 
 // NewTranscoder creates a new Transcoder with the given configuration.
@@ -50,14 +61,30 @@ func NewTranscoder(config *FFmpegConfig) *Transcoder {
 }
 
 // TranscodeToHLS transcodes the input video to HLS format with multiple quality levels.
-func (t *Transcoder) TranscodeToHLS(ctx context.Context, videoID, inputPath, hlsDir string) error {
+// The probe result drives input normalisation; if nil, the input is only scaled.
+func (t *Transcoder) TranscodeToHLS(ctx context.Context, videoID, inputPath, hlsDir string, probe *ProbeResult) error {
 	ctx, span := tracer.Start(ctx, "transcode-hls")
 	defer span.End()
 
 	start := time.Now()
 
+	norm := NewNormalization(probe, t.config.Deinterlacer)
+	span.SetAttributes(
+		attribute.Int("normalize.rotation", norm.Rotation),
+		attribute.Bool("normalize.deinterlace", norm.Deinterlace),
+		attribute.String("normalize.frame_rate", norm.FrameRate.String()),
+		attribute.Int("normalize.gop_size", norm.GOPSize()),
+	)
+	t.config.Logger.InfoContext(ctx, "Input normalisation",
+		"videoId", videoID,
+		"rotation", norm.Rotation,
+		"deinterlace", norm.Deinterlace,
+		"frameRate", norm.FrameRate.String(),
+		"gopSize", norm.GOPSize(),
+	)
+
 	// Run FFmpeg transcoding
-	if err := t.runFFmpeg(ctx, inputPath, hlsDir); err != nil {
+	if err := t.runFFmpeg(ctx, inputPath, hlsDir, norm); err != nil {
 		return err
 	}
 
@@ -73,12 +100,16 @@ func (t *Transcoder) TranscodeToHLS(ctx context.Context, videoID, inputPath, hls
 }
 
 // runFFmpeg executes the FFmpeg command for HLS transcoding.
-func (t *Transcoder) runFFmpeg(ctx context.Context, inputPath, hlsDir string) error {
+func (t *Transcoder) runFFmpeg(ctx context.Context, inputPath, hlsDir string, norm Normalization) error {
 	ctx, span := tracer.Start(ctx, "ffmpeg-execute")
 	defer span.End()
 
-	args := t.buildFFmpegArgs(inputPath, hlsDir)
-	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
+	args := t.buildFFmpegArgs(inputPath, hlsDir, norm)
+	cmd, finish, err := t.command(ctx, "ffmpeg", args...)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrFFmpegFailed, err)
+	}
+	defer finish()
 
 	stderrPipe, err := cmd.StderrPipe()
 	if err != nil {
@@ -124,38 +155,55 @@ func (t *Transcoder) runFFmpeg(ctx context.Context, inputPath, hlsDir string) er
 }
 
 // buildFFmpegArgs constructs the FFmpeg command arguments.
-func (t *Transcoder) buildFFmpegArgs(inputPath, hlsDir string) []string {
+func (t *Transcoder) buildFFmpegArgs(inputPath, hlsDir string, norm Normalization) []string {
 	presets := t.config.Presets
+	gop := fmt.Sprintf("%d", norm.GOPSize())
+
+	var args []string
 
-	args := []string{
+	// Rotation is applied explicitly by the normalisation filters
+	if norm.Rotation != 0 {
+		args = append(args, "-noautorotate")
+	}
+
+	args = append(args, threadArgs(t.limits.Threads)...)
+	args = append(args,
 		"-i", inputPath,
-		"-preset", "veryfast",
-		"-c:v", "libx264",
-		"-profile:v", "main",
-		"-level", "4.1",
-		"-g", "100",
-		"-keyint_min", "100",
-		"-sc_threshold", "0",
-		"-flags", "+cgop",
-		"-filter_complex", BuildFilterComplex(presets),
-	}
-
-	// Add output streams for each quality preset
+		"-filter_complex", BuildNormalizedFilterComplex(presets, norm),
+	)
+
+	// Add output streams for each quality preset. Encoder options are
+	// per-output in FFmpeg, so each rendition carries its own GOP settings.
 	for i, preset := range presets {
 		streamArgs := []string{
 			"-map", fmt.Sprintf("[v%dout]", i+1),
 			"-map", "0:a?",
-			fmt.Sprintf("-c:v:%d", i), "libx264",
-			fmt.Sprintf("-b:v:%d", i), preset.Bitrate,
-			fmt.Sprintf("-maxrate:v:%d", i), preset.MaxRate,
-			fmt.Sprintf("-bufsize:v:%d", i), preset.BufSize,
-			fmt.Sprintf("-c:a:%d", i), "aac",
-			fmt.Sprintf("-b:a:%d", i), preset.AudioBPS,
+			"-c:v", "libx264",
+		}
+		streamArgs = append(streamArgs, threadArgs(t.limits.Threads)...)
+		streamArgs = append(streamArgs,
+			"-preset", "veryfast",
+			"-profile:v", "main",
+			"-level", "4.1",
+			"-g", gop,
+			"-keyint_min", gop,
+			"-sc_threshold", "0",
+			"-flags", "+cgop",
+		)
+		if norm.FrameRate.Valid() {
+			streamArgs = append(streamArgs, "-fps_mode", "cfr")
+		}
+		streamArgs = append(streamArgs,
+			"-b:v", preset.Bitrate,
+			"-maxrate:v", preset.MaxRate,
+			"-bufsize:v", preset.BufSize,
+			"-c:a", "aac",
+			"-b:a", preset.AudioBPS,
 			"-hls_time", fmt.Sprintf("%d", HLSSegmentDuration),
 			"-hls_list_size", "0",
 			"-hls_segment_filename", filepath.Join(hlsDir, preset.Name, "seg_%03d.ts"),
 			filepath.Join(hlsDir, preset.Name, "playlist.m3u8"),
-		}
+		)
 		args = append(args, streamArgs...)
 	}
 
@@ -170,7 +218,7 @@ func (t *Transcoder) monitorOutput(ctx context.Context, r io.Reader) {
 		case <-ctx.Done():
 			return
 		default:
-			line := scanner.Text()
+			line := redactOutput(scanner.Text())
 			if strings.Contains(line, "frame=") || strings.Contains(line, "time=") {
 				t.config.Logger.Debug("FFmpeg progress", "output", line)
 			} else if strings.Contains(line, "error") || strings.Contains(line, "Error") {
@@ -183,6 +231,82 @@ func (t *Transcoder) monitorOutput(ctx context.Context, r io.Reader) {
 	}
 }
 
+// urlQuery matches a URL's query string, where a presigned URL carries its
+// credentials.
+var urlQuery = regexp.MustCompile(`(https?://[^\s?'"]+)\?[^\s'"]*`)
+
+// redactOutput removes URL query strings from FFmpeg output, which echoes
+// its input URL in errors, so presigned credentials do not reach the logs.
+func redactOutput(output string) string {
+	return urlQuery.ReplaceAllString(output, "$1?REDACTED")
+}
+
+// WithPresets returns a Transcoder that encodes the given ladder with the
+// same settings as t.
+func (t *Transcoder) WithPresets(presets []Preset) *Transcoder {
+	config := *t.config
+	config.Presets = presets
+	c := *t
+	c.config = &config
+	return &c
+}
+
+// WithStdin returns a Transcoder that reads the input PipeInput from a
+// stream opened by open. Every FFmpeg or ffprobe run reading PipeInput opens
+// its own stream, so open is called once per run.
+func (t *Transcoder) WithStdin(open func(ctx context.Context) (io.ReadCloser, error)) *Transcoder {
+	c := *t
+	c.stdin = open
+	return &c
+}
+
+// command builds an FFmpeg or ffprobe command within the process limits. A
+// command reading PipeInput gets a fresh stream on stdin. The returned
+// function closes it and records the command's resource usage; it must be
+// called once the command has exited.
+func (t *Transcoder) command(ctx context.Context, name string, args ...string) (*exec.Cmd, func(), error) {
+	if name == "ffmpeg" {
+		args = append(globalThreadArgs(t.limits.Threads), args...)
+	}
+	var cmd *exec.Cmd
+	if t.limits.Nice > 0 {
+		// nice execs the command, so the process and its usage stay the same
+		cmd = exec.CommandContext(ctx, "nice", append([]string{"-n", strconv.Itoa(t.limits.Nice), name}, args...)...)
+	} else {
+		cmd = exec.CommandContext(ctx, name, args...)
+	}
+	if t.limits.Cgroup != nil {
+		t.limits.Cgroup.apply(cmd)
+	}
+	finish := func() { t.limits.Usage.add(cmd.ProcessState) }
+
+	if !slices.Contains(args, PipeInput) {
+		return cmd, finish, nil
+	}
+	if t.stdin == nil {
+		return nil, nil, fmt.Errorf("%s reads %s but no input stream is configured", name, PipeInput)
+	}
+	stream, err := t.stdin(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open input stream: %w", err)
+	}
+	cmd.Stdin = stream
+	return cmd, func() {
+		_ = stream.Close()
+		finish()
+	}, nil
+}
+
+// run runs FFmpeg with the given arguments, discarding its output.
+func (t *Transcoder) run(ctx context.Context, args ...string) error {
+	cmd, finish, err := t.command(ctx, "ffmpeg", args...)
+	if err != nil {
+		return err
+	}
+	defer finish()
+	return cmd.Run()
+}
+
 // GetPresets returns the configured presets.
 func (t *Transcoder) GetPresets() []Preset {
 	return t.config.Presets
@@ -202,32 +326,37 @@ func (t *Transcoder) CalculateQualityMetrics(ctx context.Context, inputPath, hls
 	}()
 
 	// Extract frame from source at 1 second
-	err := exec.CommandContext(ctx, "ffmpeg",
-		"-y", "-ss", "00:00:01", "-i", inputPath,
+	threads := threadArgs(t.limits.Threads)
+	refArgs := append([]string{"-y", "-ss", "00:00:01"}, threads...)
+	if err := t.run(ctx, append(refArgs,
+		"-i", inputPath,
 		"-vf", "scale=1280:720", "-vframes", "1", refFrame,
-	).Run()
-	if err != nil {
+	)...); err != nil {
 		t.config.Logger.Warn("Failed to extract reference frame (video too short?)", "error", err)
 		return
 	}
 
 	// Extract frame from 720p output
 	playlist720 := filepath.Join(hlsDir, "720p", "playlist.m3u8")
-	err = exec.CommandContext(ctx, "ffmpeg",
-		"-y", "-ss", "00:00:01", "-i", playlist720,
+	distArgs := append([]string{"-y", "-ss", "00:00:01"}, threads...)
+	if err := t.run(ctx, append(distArgs,
+		"-i", playlist720,
 		"-vframes", "1", distFrame,
-	).Run()
-	if err != nil {
+	)...); err != nil {
 		t.config.Logger.Warn("Failed to extract dist frame", "error", err)
 		return
 	}
 
 	// Calculate SSIM
-	ssimCmd := exec.CommandContext(ctx, "ffmpeg",
+	ssimCmd, finish, err := t.command(ctx, "ffmpeg",
 		"-i", refFrame, "-i", distFrame,
 		"-lavfi", "ssim", "-f", "null", "-")
-
+	if err != nil {
+		t.config.Logger.Warn("Failed to calculate SSIM", "error", err)
+		return
+	}
 	output, err := ssimCmd.CombinedOutput()
+	finish()
 	if err != nil {
 		t.config.Logger.Warn("Failed to calculate SSIM", "error", err)
 		return
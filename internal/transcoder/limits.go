@@ -0,0 +1,182 @@
+package transcoder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ProcessLimits bounds the FFmpeg and ffprobe processes of one job.
+type ProcessLimits struct {
+	// Threads caps the decoder, filter and encoder threads of each FFmpeg
+	// process; 0 lets FFmpeg size them to the machine.
+	Threads int
+
+	// Nice is the niceness processes run at, so encodes yield the CPU to
+	// the worker itself; 0 leaves it unchanged.
+	Nice int
+
+	// Cgroup, if not nil, is the job's cgroup; every process is started in
+	// it and shares its CPU and memory caps.
+	Cgroup *Cgroup
+
+	// Usage, if not nil, accumulates the resource usage of every process.
+	Usage *ProcessUsage
+}
+
+// WithLimits returns a Transcoder that runs its processes within limits.
+func (t *Transcoder) WithLimits(limits ProcessLimits) *Transcoder {
+	c := *t
+	c.limits = limits
+	return &c
+}
+
+// threadArgs returns the option capping FFmpeg's decoder or encoder threads
+// at n, or nothing if n is 0. Like other per-file options it applies to the
+// input or output that follows it.
+func threadArgs(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	return []string{"-threads", strconv.Itoa(n)}
+}
+
+// globalThreadArgs returns the options capping FFmpeg's filter threads at n,
+// or nothing if n is 0.
+func globalThreadArgs(n int) []string {
+	if n <= 0 {
+		return nil
+	}
+	return []string{"-filter_threads", strconv.Itoa(n), "-filter_complex_threads", strconv.Itoa(n)}
+}
+
+// ProcessUsage accumulates the resource usage of a job's processes. It is
+// safe for concurrent use.
+type ProcessUsage struct {
+	mu        sync.Mutex
+	processes int
+	cpu       time.Duration
+	peakRSS   int64
+}
+
+// add records a finished process.
+func (u *ProcessUsage) add(state *os.ProcessState) {
+	if u == nil || state == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.processes++
+	u.cpu += state.UserTime() + state.SystemTime()
+	u.peakRSS = max(u.peakRSS, maxRSS(state))
+}
+
+// Processes returns the number of processes recorded.
+func (u *ProcessUsage) Processes() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.processes
+}
+
+// CPUTime returns the user and system CPU time of every process.
+func (u *ProcessUsage) CPUTime() time.Duration {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.cpu
+}
+
+// PeakRSSBytes returns the largest resident set of any single process, or
+// 0 where the platform does not report it.
+func (u *ProcessUsage) PeakRSSBytes() int64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.peakRSS
+}
+
+// Cgroup is a cgroup v2 group capping the CPU and memory of the processes
+// started in it. The worker needs a delegated parent group it can write to.
+type Cgroup struct {
+	path string
+	dir  *os.File // Passed to the kernel when starting processes
+}
+
+// NewCgroup creates the group name under parent, enabling the cpu and
+// memory controllers for it. cpuMillicores and memoryBytes cap the group;
+// 0 leaves that resource unlimited.
+func NewCgroup(parent, name string, cpuMillicores int, memoryBytes int64) (*Cgroup, error) {
+	if !cgroupsSupported {
+		return nil, fmt.Errorf("cgroups: %w", errors.ErrUnsupported)
+	}
+
+	// Controllers may already be enabled, or only enableable by the delegator
+	_ = os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+cpu +memory"), 0)
+
+	path := filepath.Join(parent, name)
+	if err := os.Mkdir(path, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup: %w", err)
+	}
+	c := &Cgroup{path: path}
+
+	var err error
+	if cpuMillicores > 0 {
+		// Quota per 100ms period
+		err = c.write("cpu.max", fmt.Sprintf("%d 100000", cpuMillicores*100))
+	}
+	if err == nil && memoryBytes > 0 {
+		err = c.write("memory.max", strconv.FormatInt(memoryBytes, 10))
+		if err == nil {
+			// Without swap the memory cap is a hard limit
+			_ = c.write("memory.swap.max", "0")
+		}
+	}
+	if err == nil {
+		c.dir, err = os.Open(path)
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return nil, err
+	}
+	return c, nil
+}
+
+// write sets one of the group's interface files.
+func (c *Cgroup) write(file, value string) error {
+	if err := os.WriteFile(filepath.Join(c.path, file), []byte(value), 0); err != nil {
+		return fmt.Errorf("failed to set %s: %w", file, err)
+	}
+	return nil
+}
+
+// OOMKills returns how many processes in the group the kernel killed for
+// exceeding its memory cap.
+func (c *Cgroup) OOMKills() int {
+	data, err := os.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if value, ok := bytes.CutPrefix(scanner.Bytes(), []byte("oom_kill ")); ok {
+			n, _ := strconv.Atoi(string(value))
+			return n
+		}
+	}
+	return 0
+}
+
+// Close removes the group. Every process started in it must have exited.
+func (c *Cgroup) Close() error {
+	if c.dir != nil {
+		c.dir.Close()
+	}
+	if err := os.Remove(c.path); err != nil {
+		return fmt.Errorf("failed to remove cgroup: %w", err)
+	}
+	return nil
+}
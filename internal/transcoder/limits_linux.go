@@ -0,0 +1,27 @@
+package transcoder
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// cgroupsSupported reports whether processes can be started in a cgroup.
+const cgroupsSupported = true
+
+// apply starts cmd's process directly in the group.
+func (c *Cgroup) apply(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+}
+
+// maxRSS returns the peak resident set of an exited process in bytes.
+func maxRSS(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return usage.Maxrss * 1024 // Reported in KiB
+	}
+	return 0
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package transcoder
+
+import (
+	"os"
+	"os/exec"
+)
+
+// cgroupsSupported reports whether processes can be started in a cgroup.
+const cgroupsSupported = false
+
+// apply is never called, as no Cgroup can be created.
+func (c *Cgroup) apply(cmd *exec.Cmd) {}
+
+// maxRSS is not reported on this platform.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,128 @@
+package transcoder
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// KeyframeIntervalSeconds is the target GOP duration. It divides
+	// HLSSegmentDuration evenly so every segment starts on a keyframe.
+	KeyframeIntervalSeconds = 2
+
+	// LegacyGOPSize is the fixed GOP length used when no probe data is available.
+	LegacyGOPSize = 100
+
+	// MaxOutputFrameRate caps the constant frame rate of the output.
+	MaxOutputFrameRate = 60
+)
+
+// Supported deinterlacing filters.
+const (
+	DeinterlacerBWDIF = "bwdif"
+	DeinterlacerYADIF = "yadif"
+)
+
+// StandardFrameRates are the constant frame rates outputs are snapped to.
+var StandardFrameRates = []Rational{
+	{24000, 1001},
+	{24, 1},
+	{25, 1},
+	{30000, 1001},
+	{30, 1},
+	{48, 1},
+	{50, 1},
+	{60000, 1001},
+	{60, 1},
+}
+
+// Normalization describes the input-normalisation stage applied before scaling.
+type Normalization struct {
+	Rotation     int // Clockwise degrees (0, 90, 180, 270)
+	Deinterlace  bool
+	Deinterlacer string
+	FrameRate    Rational // Target constant frame rate; zero leaves timing untouched
+}
+
+// NewNormalization derives the normalisation stage from probe data.
+// A nil probe, or one without a video stream, yields a no-op normalisation.
+func NewNormalization(probe *ProbeResult, deinterlacer string) Normalization {
+	if probe == nil || probe.Video == nil {
+		return Normalization{}
+	}
+	v := probe.Video
+
+	if deinterlacer != DeinterlacerYADIF {
+		deinterlacer = DeinterlacerBWDIF
+	}
+
+	// Prefer the average rate: for VFR sources it reflects what viewers
+	// actually see, while r_frame_rate is often the container timebase.
+	rate := v.AvgFrameRate
+	if !rate.Valid() {
+		rate = v.RealFrameRate
+	}
+
+	return Normalization{
+		Rotation:     v.Rotation,
+		Deinterlace:  v.IsInterlaced(),
+		Deinterlacer: deinterlacer,
+		FrameRate:    SnapFrameRate(rate),
+	}
+}
+
+// Filters returns the ordered video filters for this normalisation.
+func (n Normalization) Filters() []string {
+	var filters []string
+
+	// Deinterlace first: field order refers to the stored orientation
+	if n.Deinterlace {
+		switch n.Deinterlacer {
+		case DeinterlacerYADIF:
+			filters = append(filters, "yadif=mode=send_frame:parity=auto:deint=all")
+		default:
+			filters = append(filters, "bwdif=mode=send_frame:parity=auto:deint=all")
+		}
+	}
+
+	switch n.Rotation {
+	case 90:
+		filters = append(filters, "transpose=clock")
+	case 180:
+		filters = append(filters, "hflip", "vflip")
+	case 270:
+		filters = append(filters, "transpose=cclock")
+	}
+
+	if n.FrameRate.Valid() {
+		filters = append(filters, fmt.Sprintf("fps=%s", n.FrameRate))
+	}
+
+	return filters
+}
+
+// GOPSize returns the keyframe interval in frames for the target frame rate.
+func (n Normalization) GOPSize() int {
+	if !n.FrameRate.Valid() {
+		return LegacyGOPSize
+	}
+	return int(math.Round(n.FrameRate.Float() * KeyframeIntervalSeconds))
+}
+
+// SnapFrameRate returns the standard frame rate closest to the given rate,
+// or a zero Rational if the rate is unknown.
+func SnapFrameRate(rate Rational) Rational {
+	if !rate.Valid() {
+		return Rational{}
+	}
+
+	fps := min(rate.Float(), MaxOutputFrameRate)
+	best := StandardFrameRates[0]
+	bestDiff := math.Abs(best.Float() - fps)
+	for _, candidate := range StandardFrameRates[1:] {
+		if diff := math.Abs(candidate.Float() - fps); diff < bestDiff {
+			best, bestDiff = candidate, diff
+		}
+	}
+	return best
+}
@@ -1,6 +1,7 @@
 package transcoder
 
 import (
+	"bufio"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -32,3 +33,66 @@ func CreateOutputDirectories(hlsDir string, presets []Preset) error {
 	}
 	return nil
 }
+
+// ValidateOutput checks that hlsDir holds a complete HLS output for presets:
+// a master playlist listing every rendition, and for each rendition a
+// finished media playlist whose segments all exist and are not empty.
+func ValidateOutput(hlsDir string, presets []Preset) error {
+	master, err := os.ReadFile(filepath.Join(hlsDir, "master.m3u8"))
+	if err != nil {
+		return fmt.Errorf("missing master playlist: %w", err)
+	}
+
+	for _, preset := range presets {
+		playlist := preset.Name + "/playlist.m3u8"
+		if !strings.Contains(string(master), playlist) {
+			return fmt.Errorf("master playlist does not list %s", preset.Name)
+		}
+		if err := validateMediaPlaylist(filepath.Join(hlsDir, preset.Name), "playlist.m3u8"); err != nil {
+			return fmt.Errorf("rendition %s: %w", preset.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateMediaPlaylist checks that a media playlist in dir is finished and
+// that its segments exist and are not empty.
+func validateMediaPlaylist(dir, name string) error {
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return fmt.Errorf("missing playlist: %w", err)
+	}
+	defer file.Close()
+
+	var segments int
+	var ended bool
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "#EXT-X-ENDLIST":
+			ended = true
+		case line == "" || strings.HasPrefix(line, "#"):
+		default:
+			info, err := os.Stat(filepath.Join(dir, filepath.FromSlash(line)))
+			if err != nil {
+				return fmt.Errorf("missing segment %s", line)
+			}
+			if info.Size() == 0 {
+				return fmt.Errorf("empty segment %s", line)
+			}
+			segments++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read playlist: %w", err)
+	}
+
+	if segments == 0 {
+		return fmt.Errorf("playlist has no segments")
+	}
+	if !ended {
+		return fmt.Errorf("playlist is not finished")
+	}
+	return nil
+}
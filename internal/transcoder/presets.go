@@ -26,6 +26,28 @@ var DefaultPresets = []Preset{
 	{"480p", 854, 480, "1M", "1.1M", "2M", "96k", 1100000},
 }
 
+// DefaultProfile is the encoding profile used when a job does not name one.
+const DefaultProfile = "standard"
+
+// Profiles are the named ladders a video can be encoded with.
+var Profiles = map[string][]Preset{
+	DefaultProfile: DefaultPresets,
+	"mobile":       DefaultPresets[1:], // 720p and 480p only
+}
+
+// ProfilePresets returns the ladder of the named profile, or of the default
+// profile if name is empty.
+func ProfilePresets(name string) ([]Preset, error) {
+	if name == "" {
+		name = DefaultProfile
+	}
+	presets, ok := Profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown encoding profile: %q", name)
+	}
+	return presets, nil
+}
+
 // ToModelPresets converts transcoder presets to model presets for storage.
 func ToModelPresets(presets []Preset) []models.QualityPreset {
 	result := make([]models.QualityPreset, len(presets))
@@ -42,6 +64,12 @@ func ToModelPresets(presets []Preset) []models.QualityPreset {
 
 // BuildFilterComplex generates the FFmpeg filter_complex string for multi-resolution output.
 func BuildFilterComplex(presets []Preset) string {
+	return BuildNormalizedFilterComplex(presets, Normalization{})
+}
+
+// BuildNormalizedFilterComplex generates the filter_complex string with the
+// input-normalisation filters applied once before the stream is split.
+func BuildNormalizedFilterComplex(presets []Preset, norm Normalization) string {
 	n := len(presets)
 	if n == 0 {
 		return ""
@@ -55,7 +83,12 @@ func BuildFilterComplex(presets []Preset) string {
 
 	// Build the complete filter complex
 	var filter strings.Builder
-	filter.WriteString(fmt.Sprintf("[0:v]split=%d%s;", n, splitOutputs.String()))
+	filter.WriteString("[0:v]")
+	for _, f := range norm.Filters() {
+		filter.WriteString(f)
+		filter.WriteString(",")
+	}
+	filter.WriteString(fmt.Sprintf("split=%d%s;", n, splitOutputs.String()))
 
 	// Build scale filters for each preset
 	for i, preset := range presets {
@@ -0,0 +1,135 @@
+package transcoder
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Preview configuration
+const (
+	PreviewClipCount    = 5
+	PreviewClipSeconds  = 1.0
+	PreviewWidth        = 320
+	PreviewFrameRate    = 12
+	PreviewDir          = "preview"
+	PreviewWebPFilename = "preview.webp"
+	PreviewMP4Filename  = "preview.mp4"
+)
+
+// PreviewResult holds the local paths of the generated teaser files.
+type PreviewResult struct {
+	WebPPath string
+	MP4Path  string
+}
+
+// GeneratePreview builds a short muted teaser from evenly spaced clips of the
+// input and writes it as animated WebP and MP4 under hlsDir/preview.
+func (t *Transcoder) GeneratePreview(ctx context.Context, inputPath, hlsDir string, probe *ProbeResult) (*PreviewResult, error) {
+	ctx, span := tracer.Start(ctx, "generate-preview")
+	defer span.End()
+
+	if probe == nil || probe.Video == nil || probe.DurationSeconds <= 0 {
+		return nil, fmt.Errorf("preview requires probe data with a video stream")
+	}
+	if inputPath == PipeInput {
+		return nil, fmt.Errorf("preview requires a seekable input")
+	}
+
+	previewDir := filepath.Join(hlsDir, PreviewDir)
+	if err := os.MkdirAll(previewDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create preview directory: %w", err)
+	}
+
+	result := &PreviewResult{
+		WebPPath: filepath.Join(previewDir, PreviewWebPFilename),
+		MP4Path:  filepath.Join(previewDir, PreviewMP4Filename),
+	}
+
+	// FFmpeg autorotates each clip input, so only deinterlacing is carried over
+	norm := NewNormalization(probe, t.config.Deinterlacer)
+	norm.Rotation = 0
+	norm.FrameRate = Rational{PreviewFrameRate, 1}
+
+	starts := PreviewClipStarts(probe.DurationSeconds, PreviewClipCount, PreviewClipSeconds)
+	args := buildPreviewArgs(inputPath, starts, PreviewClipSeconds, norm, t.limits.Threads, result)
+
+	cmd, finish, err := t.command(ctx, "ffmpeg", args...)
+	if err != nil {
+		return nil, fmt.Errorf("preview ffmpeg failed: %w", err)
+	}
+	output, err := cmd.CombinedOutput()
+	finish()
+	if err != nil {
+		return nil, fmt.Errorf("preview ffmpeg failed: %w: %s", err, lastLine(output))
+	}
+
+	return result, nil
+}
+
+// PreviewClipStarts returns evenly spaced clip start times, avoiding the very
+// start and end of the source. Short sources yield a single clip from zero.
+func PreviewClipStarts(duration float64, count int, clipSeconds float64) []float64 {
+	if count <= 0 || duration <= float64(count)*clipSeconds {
+		return []float64{0}
+	}
+
+	starts := make([]float64, count)
+	for i := range starts {
+		center := duration * float64(i+1) / float64(count+1)
+		starts[i] = max(0, center-clipSeconds/2)
+	}
+	return starts
+}
+
+// buildPreviewArgs seeks each clip as a separate input and concatenates them.
+// Each decoder and encoder uses at most threads threads if it is not 0.
+func buildPreviewArgs(inputPath string, starts []float64, clipSeconds float64, norm Normalization, threads int, out *PreviewResult) []string {
+	args := []string{"-y", "-hide_banner", "-nostats"}
+	for _, start := range starts {
+		args = append(args,
+			"-ss", fmt.Sprintf("%.3f", start),
+			"-t", fmt.Sprintf("%.3f", clipSeconds),
+		)
+		args = append(args, threadArgs(threads)...)
+		args = append(args, "-i", inputPath)
+	}
+
+	var filter strings.Builder
+	var concatInputs strings.Builder
+	for i := range starts {
+		filter.WriteString(fmt.Sprintf("[%d:v]", i))
+		for _, f := range norm.Filters() {
+			filter.WriteString(f)
+			filter.WriteString(",")
+		}
+		filter.WriteString(fmt.Sprintf("setpts=PTS-STARTPTS[c%d];", i))
+		concatInputs.WriteString(fmt.Sprintf("[c%d]", i))
+	}
+	filter.WriteString(fmt.Sprintf("%sconcat=n=%d:v=1:a=0,scale=%d:-2,split=2[webp][mp4]",
+		concatInputs.String(), len(starts), PreviewWidth))
+
+	args = append(args,
+		"-filter_complex", filter.String(),
+		"-map", "[webp]", "-an",
+		"-c:v", "libwebp", "-loop", "0", "-quality", "60",
+	)
+	args = append(args, threadArgs(threads)...)
+	args = append(args,
+		out.WebPPath,
+		"-map", "[mp4]", "-an",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "28",
+		"-pix_fmt", "yuv420p", "-movflags", "+faststart",
+	)
+	args = append(args, threadArgs(threads)...)
+	return append(args, out.MP4Path)
+}
+
+// lastLine returns the final non-empty line of FFmpeg output for error
+// context, redacted like logged output.
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return redactOutput(lines[len(lines)-1])
+}
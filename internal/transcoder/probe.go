@@ -0,0 +1,197 @@
+package transcoder
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProbeResult holds the subset of ffprobe output used to drive transcoding.
+type ProbeResult struct {
+	FormatName      string
+	DurationSeconds float64
+	SizeBytes       int64
+	Video           *VideoStreamInfo
+	HasAudio        bool
+}
+
+// VideoStreamInfo describes the primary video stream of an input.
+type VideoStreamInfo struct {
+	Codec         string
+	Width         int
+	Height        int
+	Rotation      int // Clockwise degrees needed for upright display (0, 90, 180, 270)
+	FieldOrder    string
+	AvgFrameRate  Rational
+	RealFrameRate Rational
+}
+
+// IsInterlaced returns true if the stream is flagged as interlaced.
+func (v *VideoStreamInfo) IsInterlaced() bool {
+	switch v.FieldOrder {
+	case "tt", "bb", "tb", "bt":
+		return true
+	}
+	return false
+}
+
+// IsVariableFrameRate returns true if the average frame rate differs from the base rate.
+func (v *VideoStreamInfo) IsVariableFrameRate() bool {
+	if !v.AvgFrameRate.Valid() || !v.RealFrameRate.Valid() {
+		return false
+	}
+	return v.AvgFrameRate != v.RealFrameRate
+}
+
+// Rational is a frame rate expressed as a fraction, e.g. 30000/1001.
+type Rational struct {
+	Num int
+	Den int
+}
+
+// Valid returns true if the rational is a positive, finite value.
+func (r Rational) Valid() bool {
+	return r.Num > 0 && r.Den > 0
+}
+
+// Float returns the rational as a float64.
+func (r Rational) Float() float64 {
+	if !r.Valid() {
+		return 0
+	}
+	return float64(r.Num) / float64(r.Den)
+}
+
+// String returns the rational in FFmpeg's num/den notation.
+func (r Rational) String() string {
+	if r.Den == 1 {
+		return strconv.Itoa(r.Num)
+	}
+	return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+// parseRational parses an FFmpeg rational such as "30000/1001" or "25".
+func parseRational(s string) Rational {
+	num, den, found := strings.Cut(s, "/")
+	n, err := strconv.Atoi(num)
+	if err != nil {
+		return Rational{}
+	}
+	d := 1
+	if found {
+		if d, err = strconv.Atoi(den); err != nil {
+			return Rational{}
+		}
+	}
+	return Rational{Num: n, Den: d}
+}
+
+// Probe runs ffprobe against the input and returns its stream information.
+func (t *Transcoder) Probe(ctx context.Context, inputPath string) (*ProbeResult, error) {
+	ctx, span := tracer.Start(ctx, "ffprobe")
+	defer span.End()
+
+	cmd, finish, err := t.command(ctx, "ffprobe",
+		"-v", "error",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		inputPath,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+	defer finish()
+
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	return parseProbeOutput(output)
+}
+
+// ffprobeOutput mirrors the JSON document emitted by ffprobe.
+type ffprobeOutput struct {
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		Size       string `json:"size"`
+	} `json:"format"`
+	Streams []struct {
+		CodecType    string            `json:"codec_type"`
+		CodecName    string            `json:"codec_name"`
+		Width        int               `json:"width"`
+		Height       int               `json:"height"`
+		FieldOrder   string            `json:"field_order"`
+		AvgFrameRate string            `json:"avg_frame_rate"`
+		RFrameRate   string            `json:"r_frame_rate"`
+		Tags         map[string]string `json:"tags"`
+		SideDataList []struct {
+			SideDataType string  `json:"side_data_type"`
+			Rotation     float64 `json:"rotation"`
+		} `json:"side_data_list"`
+		Disposition struct {
+			AttachedPic int `json:"attached_pic"`
+		} `json:"disposition"`
+	} `json:"streams"`
+}
+
+// parseProbeOutput converts raw ffprobe JSON into a ProbeResult.
+func parseProbeOutput(data []byte) (*ProbeResult, error) {
+	var out ffprobeOutput
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, fmt.Errorf("failed to parse ffprobe output: %w", err)
+	}
+
+	result := &ProbeResult{
+		FormatName: out.Format.FormatName,
+	}
+	result.DurationSeconds, _ = strconv.ParseFloat(out.Format.Duration, 64)
+	result.SizeBytes, _ = strconv.ParseInt(out.Format.Size, 10, 64)
+
+	for _, s := range out.Streams {
+		switch s.CodecType {
+		case "audio":
+			result.HasAudio = true
+		case "video":
+			// Skip cover art and take the first real video stream
+			if result.Video != nil || s.Disposition.AttachedPic == 1 {
+				continue
+			}
+
+			// Legacy containers use a rotate tag (clockwise), newer ones a
+			// display matrix (counter-clockwise).
+			var rotation int
+			if tag, ok := s.Tags["rotate"]; ok {
+				rotation, _ = strconv.Atoi(tag)
+			}
+			for _, sd := range s.SideDataList {
+				if sd.SideDataType == "Display Matrix" {
+					rotation = -int(sd.Rotation)
+				}
+			}
+
+			result.Video = &VideoStreamInfo{
+				Codec:         s.CodecName,
+				Width:         s.Width,
+				Height:        s.Height,
+				Rotation:      normalizeRotation(rotation),
+				FieldOrder:    s.FieldOrder,
+				AvgFrameRate:  parseRational(s.AvgFrameRate),
+				RealFrameRate: parseRational(s.RFrameRate),
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// normalizeRotation maps any rotation to 0, 90, 180 or 270 degrees clockwise.
+func normalizeRotation(degrees int) int {
+	r := ((degrees % 360) + 360) % 360
+	// Snap to the nearest quarter turn
+	return ((r + 45) / 90 % 4) * 90
+}
@@ -1,10 +1,16 @@
 package transcoder
 
 import (
+	"bytes"
+	"context"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
 )
 
 func TestBuildFilterComplex(t *testing.T) {
@@ -110,6 +116,81 @@ func TestGetPresetByName(t *testing.T) {
 	}
 }
 
+func TestProfilePresets(t *testing.T) {
+	tests := []struct {
+		name      string
+		wantCount int
+		wantErr   bool
+	}{
+		{"", len(DefaultPresets), false},
+		{DefaultProfile, len(DefaultPresets), false},
+		{"mobile", 2, false},
+		{"4k", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ProfilePresets(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProfilePresets(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			}
+			if len(got) != tt.wantCount {
+				t.Errorf("ProfilePresets(%q) returned %d presets, want %d", tt.name, len(got), tt.wantCount)
+			}
+		})
+	}
+}
+
+func TestWithPresets(t *testing.T) {
+	tc := NewTranscoder(&FFmpegConfig{Presets: DefaultPresets, Deinterlacer: DeinterlacerYADIF})
+	mobile := tc.WithPresets(Profiles["mobile"])
+
+	if len(mobile.GetPresets()) != 2 {
+		t.Errorf("WithPresets() presets = %d, want 2", len(mobile.GetPresets()))
+	}
+	if mobile.config.Deinterlacer != DeinterlacerYADIF {
+		t.Errorf("WithPresets() deinterlacer = %s, want %s", mobile.config.Deinterlacer, DeinterlacerYADIF)
+	}
+	if len(tc.GetPresets()) != len(DefaultPresets) {
+		t.Errorf("WithPresets() changed the original ladder")
+	}
+}
+
+func TestCommand_PipeInput(t *testing.T) {
+	ctx := context.Background()
+	tc := NewTranscoder(DefaultFFmpegConfig(nil))
+
+	if _, _, err := tc.command(ctx, "sh", "-c", "cat", PipeInput); err == nil {
+		t.Error("command() error = nil without an input stream")
+	}
+
+	opened := 0
+	piped := tc.WithStdin(func(context.Context) (io.ReadCloser, error) {
+		opened++
+		return io.NopCloser(strings.NewReader("source")), nil
+	})
+	for range 2 {
+		// sh takes PipeInput as $0 and cat copies stdin
+		cmd, finish, err := piped.command(ctx, "sh", "-c", "cat", PipeInput)
+		if err != nil {
+			t.Fatalf("command() error = %v", err)
+		}
+		out, err := cmd.Output()
+		finish()
+		if err != nil || string(out) != "source" {
+			t.Errorf("command() output = %q, %v, want %q", out, err, "source")
+		}
+	}
+	if opened != 2 {
+		t.Errorf("input stream opened %d times, want 2", opened)
+	}
+
+	cmd, _, err := piped.WithPresets(Profiles["mobile"]).command(ctx, "true")
+	if err != nil || cmd.Stdin != nil {
+		t.Errorf("command() without PipeInput stdin = %v, %v, want none", cmd.Stdin, err)
+	}
+}
+
 func TestToModelPresets(t *testing.T) {
 	presets := []Preset{
 		{"1080p", 1920, 1080, "5M", "5.5M", "7.5M", "192k", 5500000},
@@ -177,6 +258,60 @@ func TestGenerateMasterPlaylist(t *testing.T) {
 	}
 }
 
+func TestValidateOutput(t *testing.T) {
+	presets := DefaultPresets[1:]
+
+	// writeOutput builds a complete output, then applies breakage to it.
+	writeOutput := func(t *testing.T, breakage func(dir string)) string {
+		t.Helper()
+		dir := t.TempDir()
+		if err := CreateOutputDirectories(dir, presets); err != nil {
+			t.Fatal(err)
+		}
+		if err := GenerateMasterPlaylist(dir, presets); err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range presets {
+			playlist := "#EXTM3U\n#EXTINF:6.0,\nseg_000.ts\n#EXTINF:2.0,\nseg_001.ts\n#EXT-X-ENDLIST\n"
+			if err := os.WriteFile(filepath.Join(dir, p.Name, "playlist.m3u8"), []byte(playlist), 0644); err != nil {
+				t.Fatal(err)
+			}
+			for _, seg := range []string{"seg_000.ts", "seg_001.ts"} {
+				if err := os.WriteFile(filepath.Join(dir, p.Name, seg), []byte("ts"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if breakage != nil {
+			breakage(dir)
+		}
+		return dir
+	}
+
+	tests := []struct {
+		name     string
+		breakage func(dir string)
+		wantErr  bool
+	}{
+		{"complete", nil, false},
+		{"no master", func(dir string) { os.Remove(filepath.Join(dir, "master.m3u8")) }, true},
+		{"missing segment", func(dir string) { os.Remove(filepath.Join(dir, "480p", "seg_001.ts")) }, true},
+		{"empty segment", func(dir string) { os.WriteFile(filepath.Join(dir, "720p", "seg_000.ts"), nil, 0644) }, true},
+		{"unfinished playlist", func(dir string) {
+			os.WriteFile(filepath.Join(dir, "720p", "playlist.m3u8"), []byte("#EXTM3U\n#EXTINF:6.0,\nseg_000.ts\n"), 0644)
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateOutput(writeOutput(t, tt.breakage), presets)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateOutput() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestCreateOutputDirectories(t *testing.T) {
 	// Create temp directory
 	tmpDir, err := os.MkdirTemp("", "hls-test-*")
@@ -205,3 +340,346 @@ func TestCreateOutputDirectories(t *testing.T) {
 		}
 	}
 }
+
+func TestBuildNormalizedFilterComplex(t *testing.T) {
+	presets := []Preset{
+		{"720p", 1280, 720, "2.5M", "2.75M", "5M", "128k", 2750000},
+	}
+
+	tests := []struct {
+		name string
+		norm Normalization
+		want string
+	}{
+		{
+			name: "no normalisation",
+			norm: Normalization{},
+			want: "[0:v]split=1[v1];[v1]scale=1280:720[v1out]",
+		},
+		{
+			name: "rotate and cfr",
+			norm: Normalization{Rotation: 90, FrameRate: Rational{30000, 1001}},
+			want: "[0:v]transpose=clock,fps=30000/1001,split=1[v1];[v1]scale=1280:720[v1out]",
+		},
+		{
+			name: "deinterlace with yadif",
+			norm: Normalization{Deinterlace: true, Deinterlacer: DeinterlacerYADIF, Rotation: 180, FrameRate: Rational{25, 1}},
+			want: "[0:v]yadif=mode=send_frame:parity=auto:deint=all,hflip,vflip,fps=25,split=1[v1];[v1]scale=1280:720[v1out]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := BuildNormalizedFilterComplex(presets, tt.norm)
+			if got != tt.want {
+				t.Errorf("BuildNormalizedFilterComplex() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseProbeOutput(t *testing.T) {
+	data := []byte(`{
+		"streams": [
+			{"codec_type": "video", "codec_name": "mjpeg", "width": 300, "height": 300, "disposition": {"attached_pic": 1}},
+			{
+				"codec_type": "video", "codec_name": "h264", "width": 1920, "height": 1080,
+				"field_order": "tt", "avg_frame_rate": "29917/1000", "r_frame_rate": "30/1",
+				"side_data_list": [{"side_data_type": "Display Matrix", "rotation": -90}]
+			},
+			{"codec_type": "audio", "codec_name": "aac"}
+		],
+		"format": {"format_name": "mov,mp4,m4a,3gp,3g2,mj2", "duration": "12.500000", "size": "1048576"}
+	}`)
+
+	got, err := parseProbeOutput(data)
+	if err != nil {
+		t.Fatalf("parseProbeOutput() error = %v", err)
+	}
+
+	if got.DurationSeconds != 12.5 {
+		t.Errorf("DurationSeconds = %v, want 12.5", got.DurationSeconds)
+	}
+	if got.SizeBytes != 1048576 {
+		t.Errorf("SizeBytes = %d, want 1048576", got.SizeBytes)
+	}
+	if !got.HasAudio {
+		t.Error("HasAudio = false, want true")
+	}
+	if got.Video == nil {
+		t.Fatal("Video = nil, want stream")
+	}
+	if got.Video.Codec != "h264" {
+		t.Errorf("Video.Codec = %s, want h264 (cover art should be skipped)", got.Video.Codec)
+	}
+	if got.Video.Rotation != 90 {
+		t.Errorf("Video.Rotation = %d, want 90", got.Video.Rotation)
+	}
+	if !got.Video.IsInterlaced() {
+		t.Error("IsInterlaced() = false, want true")
+	}
+	if !got.Video.IsVariableFrameRate() {
+		t.Error("IsVariableFrameRate() = false, want true")
+	}
+}
+
+func TestNewNormalization(t *testing.T) {
+	if norm := NewNormalization(nil, DeinterlacerBWDIF); len(norm.Filters()) != 0 || norm.GOPSize() != LegacyGOPSize {
+		t.Errorf("NewNormalization(nil) = %+v, want no-op with legacy GOP", norm)
+	}
+
+	probe := &ProbeResult{
+		Video: &VideoStreamInfo{
+			Rotation:      270,
+			FieldOrder:    "progressive",
+			AvgFrameRate:  Rational{29917, 1000},
+			RealFrameRate: Rational{30, 1},
+		},
+	}
+
+	norm := NewNormalization(probe, "")
+	if norm.Deinterlace {
+		t.Error("Deinterlace = true for progressive input")
+	}
+	if norm.Rotation != 270 {
+		t.Errorf("Rotation = %d, want 270", norm.Rotation)
+	}
+	if norm.FrameRate != (Rational{30000, 1001}) {
+		t.Errorf("FrameRate = %s, want 30000/1001", norm.FrameRate)
+	}
+	if norm.GOPSize() != 60 {
+		t.Errorf("GOPSize() = %d, want 60", norm.GOPSize())
+	}
+}
+
+func TestSnapFrameRate(t *testing.T) {
+	tests := []struct {
+		in   Rational
+		want Rational
+	}{
+		{Rational{}, Rational{}},
+		{Rational{25, 1}, Rational{25, 1}},
+		{Rational{2997, 100}, Rational{30000, 1001}},
+		{Rational{120, 1}, Rational{60, 1}},
+		{Rational{12, 1}, Rational{24000, 1001}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in.String(), func(t *testing.T) {
+			if got := SnapFrameRate(tt.in); got != tt.want {
+				t.Errorf("SnapFrameRate(%s) = %s, want %s", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildFFmpegArgs_PerOutputGOP(t *testing.T) {
+	tc := NewTranscoder(&FFmpegConfig{Presets: DefaultPresets})
+	norm := Normalization{FrameRate: Rational{25, 1}}
+
+	args := tc.buildFFmpegArgs("in.mp4", "/tmp/out", norm)
+
+	gops := 0
+	for i, arg := range args {
+		if arg == "-g" {
+			gops++
+			if args[i+1] != "50" {
+				t.Errorf("-g = %s, want 50", args[i+1])
+			}
+		}
+	}
+	if gops != len(DefaultPresets) {
+		t.Errorf("found %d -g options, want one per preset (%d)", gops, len(DefaultPresets))
+	}
+}
+
+func TestBuildFFmpegArgs_Threads(t *testing.T) {
+	tc := NewTranscoder(&FFmpegConfig{Presets: DefaultPresets})
+	norm := Normalization{FrameRate: Rational{25, 1}}
+
+	if args := tc.buildFFmpegArgs("in.mp4", "/tmp/out", norm); slices.Contains(args, "-threads") {
+		t.Errorf("buildFFmpegArgs() without a thread cap sets -threads")
+	}
+
+	args := tc.WithLimits(ProcessLimits{Threads: 2}).buildFFmpegArgs("in.mp4", "/tmp/out", norm)
+	threads := 0
+	for i, arg := range args {
+		if arg == "-threads" {
+			threads++
+			if args[i+1] != "2" {
+				t.Errorf("-threads = %s, want 2", args[i+1])
+			}
+		}
+	}
+	// One for the decoder and one per encoder
+	if threads != len(DefaultPresets)+1 {
+		t.Errorf("found %d -threads options, want %d", threads, len(DefaultPresets)+1)
+	}
+	if i := slices.Index(args, "-threads"); i < 0 || i > slices.Index(args, "-i") {
+		t.Error("decoder -threads does not precede the input")
+	}
+}
+
+func TestCommand_Limits(t *testing.T) {
+	ctx := context.Background()
+	usage := &ProcessUsage{}
+	tc := NewTranscoder(DefaultFFmpegConfig(nil)).WithLimits(ProcessLimits{Nice: 5, Usage: usage})
+
+	cmd, finish, err := tc.command(ctx, "sh", "-c", "echo ok")
+	if err != nil {
+		t.Fatalf("command() error = %v", err)
+	}
+	if want := []string{"nice", "-n", "5", "sh"}; !slices.Equal(cmd.Args[:4], want) {
+		t.Errorf("command() args = %v, want prefix %v", cmd.Args, want)
+	}
+	if out, err := cmd.Output(); err != nil || string(out) != "ok\n" {
+		t.Fatalf("command() output = %q, %v", out, err)
+	}
+	finish()
+	if usage.Processes() != 1 {
+		t.Errorf("Processes() = %d, want 1", usage.Processes())
+	}
+
+	ffmpeg, _, err := tc.WithLimits(ProcessLimits{Threads: 3}).command(ctx, "ffmpeg", "-i", "in.mp4")
+	if err != nil {
+		t.Fatalf("command() error = %v", err)
+	}
+	if want := []string{"ffmpeg", "-filter_threads", "3", "-filter_complex_threads", "3", "-i"}; !slices.Equal(ffmpeg.Args[:6], want) {
+		t.Errorf("command() args = %v, want prefix %v", ffmpeg.Args, want)
+	}
+}
+
+func TestParseAnalysisOutput(t *testing.T) {
+	log := bytes.NewBufferString(`Input #0, mov,mp4,m4a,3gp,3g2,mj2, from 'in.mp4':
+[blackdetect @ 0x1] black_start:0 black_end:1.5 black_duration:1.5
+[silencedetect @ 0x2] silence_start: 4.2
+[Parsed_metadata_2 @ 0x3] frame:0    pts:3003    pts_time:3.003
+[Parsed_metadata_2 @ 0x3] lavfi.scene_score=0.612000
+[silencedetect @ 0x2] silence_end: 8.7 | silence_duration: 4.5
+[Parsed_metadata_2 @ 0x3] frame:1    pts:9009    pts_time:9.009
+[Parsed_metadata_2 @ 0x3] lavfi.scene_score=0.450000
+[blackdetect @ 0x1] black_start:58 black_end:60 black_duration:2
+`)
+
+	timeline := parseAnalysisOutput(log)
+
+	if len(timeline.BlackSegments) != 2 {
+		t.Fatalf("BlackSegments len = %d, want 2", len(timeline.BlackSegments))
+	}
+	if timeline.BlackSegments[0] != (models.TimeRange{Start: 0, End: 1.5}) {
+		t.Errorf("BlackSegments[0] = %+v", timeline.BlackSegments[0])
+	}
+	if len(timeline.Silences) != 1 || timeline.Silences[0] != (models.TimeRange{Start: 4.2, End: 8.7}) {
+		t.Errorf("Silences = %+v, want [{4.2 8.7}]", timeline.Silences)
+	}
+	if len(timeline.SceneChanges) != 2 {
+		t.Fatalf("SceneChanges len = %d, want 2", len(timeline.SceneChanges))
+	}
+	if timeline.SceneChanges[0].Time != 3.003 || timeline.SceneChanges[0].Score != 0.612 {
+		t.Errorf("SceneChanges[0] = %+v", timeline.SceneChanges[0])
+	}
+}
+
+func TestSummarizeTimeline(t *testing.T) {
+	timeline := &models.Timeline{
+		DurationSeconds: 60,
+		BlackSegments: []models.TimeRange{
+			{Start: 0, End: 1.5},
+			{Start: 20, End: 21},
+			{Start: 58, End: 60},
+		},
+		Silences: []models.TimeRange{
+			{Start: 4, End: 8.5},
+			{Start: 30, End: 32},
+		},
+		SceneChanges: []models.SceneChange{
+			{Time: 1.0, Score: 0.9},  // Inside leading black, before trim start
+			{Time: 20.2, Score: 0.5}, // Lands in a black segment
+			{Time: 25, Score: 0.7},
+		},
+	}
+
+	summary := SummarizeTimeline(timeline, "hls/abc/timeline.json")
+
+	if summary.LeadingBlackSeconds != 1.5 || summary.TrimStartSeconds != 1.5 {
+		t.Errorf("leading black = %v, trim start = %v, want 1.5", summary.LeadingBlackSeconds, summary.TrimStartSeconds)
+	}
+	if summary.TrailingBlackSeconds != 2 || summary.TrimEndSeconds != 58 {
+		t.Errorf("trailing black = %v, trim end = %v, want 2 and 58", summary.TrailingBlackSeconds, summary.TrimEndSeconds)
+	}
+	if summary.LongestSilenceSeconds != 4.5 {
+		t.Errorf("LongestSilenceSeconds = %v, want 4.5", summary.LongestSilenceSeconds)
+	}
+	if summary.PosterTimeSeconds != 25.5 {
+		t.Errorf("PosterTimeSeconds = %v, want 25.5", summary.PosterTimeSeconds)
+	}
+
+	// Without usable cuts the poster falls back to 10% into the trimmed content
+	timeline.SceneChanges = nil
+	summary = SummarizeTimeline(timeline, "")
+	if want := 1.5 + (58-1.5)*0.1; summary.PosterTimeSeconds != want {
+		t.Errorf("fallback PosterTimeSeconds = %v, want %v", summary.PosterTimeSeconds, want)
+	}
+}
+
+func TestPreviewClipStarts(t *testing.T) {
+	starts := PreviewClipStarts(60, 5, 1)
+	want := []float64{9.5, 19.5, 29.5, 39.5, 49.5}
+	if len(starts) != len(want) {
+		t.Fatalf("PreviewClipStarts() len = %d, want %d", len(starts), len(want))
+	}
+	for i := range want {
+		if starts[i] != want[i] {
+			t.Errorf("starts[%d] = %v, want %v", i, starts[i], want[i])
+		}
+	}
+
+	if short := PreviewClipStarts(3, 5, 1); len(short) != 1 || short[0] != 0 {
+		t.Errorf("PreviewClipStarts(short) = %v, want [0]", short)
+	}
+}
+
+func TestBuildPreviewArgs(t *testing.T) {
+	out := &PreviewResult{WebPPath: "p.webp", MP4Path: "p.mp4"}
+	norm := Normalization{FrameRate: Rational{PreviewFrameRate, 1}}
+
+	args := buildPreviewArgs("in.mp4", []float64{1, 5}, 1, norm, 0, out)
+	joined := strings.Join(args, " ")
+
+	if strings.Count(joined, "-i in.mp4") != 2 {
+		t.Errorf("expected one input per clip, got %q", joined)
+	}
+	wantFilter := "[0:v]fps=12,setpts=PTS-STARTPTS[c0];[1:v]fps=12,setpts=PTS-STARTPTS[c1];[c0][c1]concat=n=2:v=1:a=0,scale=320:-2,split=2[webp][mp4]"
+	if !strings.Contains(joined, wantFilter) {
+		t.Errorf("filter_complex missing, got %q", joined)
+	}
+	if !strings.HasSuffix(joined, "p.mp4") || !strings.Contains(joined, "libwebp") {
+		t.Errorf("expected WebP and MP4 outputs, got %q", joined)
+	}
+}
+
+func TestRedactOutput(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{
+			"https://bucket.s3.amazonaws.com/uploads/v1.mp4?X-Amz-Credential=AKIA%2F&X-Amz-Signature=abc: Server returned 403 Forbidden",
+			"https://bucket.s3.amazonaws.com/uploads/v1.mp4?REDACTED Server returned 403 Forbidden",
+		},
+		{
+			"Input #0, mov,mp4, from 'https://bucket/uploads/v1.mp4?sig=abc':",
+			"Input #0, mov,mp4, from 'https://bucket/uploads/v1.mp4?REDACTED':",
+		},
+		{"Error opening input file /tmp/uploads/v1.mp4.", "Error opening input file /tmp/uploads/v1.mp4."},
+	}
+
+	for _, tt := range tests {
+		if got := redactOutput(tt.line); got != tt.want {
+			t.Errorf("redactOutput(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+	if got := lastLine([]byte("frame=1\nhttps://host/v1.mp4?sig=abc: I/O error\n")); strings.Contains(got, "sig=") {
+		t.Errorf("lastLine() = %q, leaks the query string", got)
+	}
+}
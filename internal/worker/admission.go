@@ -0,0 +1,196 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Admission control
+const (
+	// OutputSizeFactor estimates a job's local output as a multiple of its
+	// source size. The ladder, preview and analysis frames rarely exceed
+	// twice the source; low-bitrate sources may, which MinFreeDiskMB absorbs.
+	OutputSizeFactor = 2
+
+	// AdmissionRetryDelay is how long a deferred job is held back before it
+	// is delivered again, and how long a worker that deferred a job waits
+	// for running jobs to free space before it receives again.
+	AdmissionRetryDelay = time.Minute
+
+	// MaxDeferrals caps how often a job is republished for lack of disk
+	// space. Later deferrals return the message to the queue, counting
+	// towards its redrive limit.
+	MaxDeferrals = 30
+)
+
+// errInsufficientDisk defers a job whose files would not fit in the disk
+// space left by running jobs.
+var errInsufficientDisk = errors.New("insufficient disk space")
+
+// errExceedsDisk marks a job whose files would not fit even on an idle
+// worker, so deferring it cannot help.
+var errExceedsDisk = errors.New("job exceeds disk capacity")
+
+// diskStats describes the filesystem holding a directory.
+type diskStats struct {
+	device uint64 // Identifies the filesystem
+	free   uint64 // Bytes available to the worker
+	total  uint64
+}
+
+// statDisk reports the filesystem holding a directory; see diskUsage.
+var statDisk = diskUsage
+
+// diskAdmission reserves local disk space for running jobs, so concurrent
+// large jobs cannot together fill the disk mid-encode. Free space already
+// reflects what running jobs have written, so counting their whole
+// reservation on top is conservative.
+type diskAdmission struct {
+	minFree uint64 // Bytes never reserved
+
+	mu       sync.Mutex
+	reserved map[uint64]uint64 // Bytes reserved by running jobs, by device
+	full     bool              // A job was deferred since space was last released
+	fullAt   time.Time         // When the last job was deferred
+	released chan struct{}     // Closed when a reservation is released
+}
+
+// newDiskAdmission creates a diskAdmission leaving minFree bytes untouched.
+func newDiskAdmission(minFree uint64) *diskAdmission {
+	return &diskAdmission{
+		minFree:  minFree,
+		reserved: make(map[uint64]uint64),
+		released: make(chan struct{}),
+	}
+}
+
+// reservation is the disk space held for one job.
+type reservation struct {
+	admission *diskAdmission
+	bytes     map[uint64]uint64
+}
+
+// reserve holds needs bytes in each directory, creating the directories.
+// Directories on the same filesystem share its free space. It returns
+// errInsufficientDisk if the space is not free now and errExceedsDisk if
+// it never could be. Without disk statistics on this platform nothing is
+// reserved.
+func (a *diskAdmission) reserve(needs map[string]uint64) (*reservation, error) {
+	want := make(map[uint64]uint64)
+	stats := make(map[uint64]diskStats)
+	for dir, n := range needs {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		st, err := statDisk(dir)
+		if errors.Is(err, errors.ErrUnsupported) {
+			return &reservation{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		want[st.device] += n
+		stats[st.device] = st
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for device, n := range want {
+		st := stats[device]
+		if n+a.minFree > st.total {
+			return nil, fmt.Errorf("%w: needs %d bytes of a %d byte disk", errExceedsDisk, n, st.total)
+		}
+		if a.reserved[device]+n+a.minFree > st.free {
+			a.full, a.fullAt = true, time.Now()
+			return nil, fmt.Errorf("%w: needs %d bytes, %d free and %d reserved by running jobs",
+				errInsufficientDisk, n, st.free, a.reserved[device])
+		}
+	}
+	for device, n := range want {
+		a.reserved[device] += n
+	}
+	return &reservation{admission: a, bytes: want}, nil
+}
+
+// release returns the reserved space.
+func (r *reservation) release() {
+	if r.admission == nil {
+		return
+	}
+	r.admission.mu.Lock()
+	defer r.admission.mu.Unlock()
+	for device, n := range r.bytes {
+		r.admission.reserved[device] -= n
+	}
+	r.admission.full = false
+	close(r.admission.released)
+	r.admission.released = make(chan struct{})
+}
+
+// wait blocks after a job has been deferred until a running job releases
+// its reservation, delay has passed since the deferral or ctx is done.
+// Receiving meanwhile would only defer more jobs.
+func (a *diskAdmission) wait(ctx context.Context, delay time.Duration) {
+	a.mu.Lock()
+	full, fullAt, released := a.full, a.fullAt, a.released
+	a.mu.Unlock()
+	if !full {
+		return
+	}
+
+	timer := time.NewTimer(time.Until(fullAt.Add(delay)))
+	defer timer.Stop()
+	select {
+	case <-released:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// admit reserves local disk space for a job before its video is claimed,
+// sizing it from the source object. The returned function releases it. A
+// job that does not fit yet fails with errInsufficientDisk, unless this is
+// its last delivery: a deferral returned with a nack would dead-letter it,
+// so it runs and takes its chances, as does a job too large for the disk at
+// all or one whose space cannot be checked.
+func (w *Worker) admit(ctx context.Context, job *models.VideoJob, receiveCount int) (func(), error) {
+	ctx, span := tracer.Start(ctx, "admit-job")
+	defer span.End()
+
+	size, err := w.downloader.Size(ctx, job)
+	if err != nil {
+		// The download stage reports a missing source properly
+		w.log.WarnContext(ctx, "Failed to size source, admitting without a reservation",
+			"videoId", job.VideoID,
+			"error", err,
+		)
+		return func() {}, nil
+	}
+
+	needs := map[string]uint64{TempHLSDir: uint64(size) * OutputSizeFactor}
+	if w.cfg.Worker.IngestMode != IngestStream {
+		needs[TempUploadDir] += uint64(size)
+	}
+
+	res, err := w.admission.reserve(needs)
+	if err == nil {
+		return res.release, nil
+	}
+	if errors.Is(err, errInsufficientDisk) && receiveCount < w.cfg.Worker.MaxReceiveCount {
+		metrics.JobsDeferred.WithLabelValues("disk").Inc()
+		return nil, err
+	}
+	w.log.WarnContext(ctx, "Admitting job without a disk reservation",
+		"videoId", job.VideoID,
+		"sourceBytes", size,
+		"reason", err,
+	)
+	return func() {}, nil
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// CancelPollInterval is how often a running job checks whether its video
+// has been cancelled.
+const CancelPollInterval = 15 * time.Second
+
+// watchCancellation polls the video every interval until stopped and cancels
+// the job with models.ErrVideoCancelled as the cause once cancellation has
+// been requested.
+func (w *Worker) watchCancellation(ctx context.Context, videoID string, interval time.Duration, cancel context.CancelCauseFunc) (stop func()) {
+	return keepAlive(ctx, interval, func(ctx context.Context) bool {
+		video, err := w.videos.GetVideo(ctx, videoID)
+		switch {
+		case err == nil:
+			if cancellationRequested(video) {
+				w.log.InfoContext(ctx, "Cancellation requested, stopping job", "videoId", videoID)
+				cancel(models.ErrVideoCancelled)
+				return false
+			}
+		case ctx.Err() != nil:
+			return false
+		default:
+			w.log.WarnContext(ctx, "Failed to check for cancellation",
+				"videoId", videoID,
+				"error", err,
+			)
+		}
+		return true
+	})
+}
+
+// cancellationRequested reports whether processing of video should stop.
+func cancellationRequested(video *models.VideoMetadata) bool {
+	return video.CancelRequested || video.Status == models.StatusCancelled
+}
+
+// finishCancellation removes the partial output of a cancelled job under
+// prefix and moves its video to cancelled, as the lease holder owner. If the
+// API already cancelled the video only the lease is released. Earlier output
+// versions are kept.
+func (w *Worker) finishCancellation(ctx context.Context, videoID, owner, prefix string) {
+	ctx = context.WithoutCancel(ctx)
+	metrics.RecordCancelled()
+
+	deleted, err := w.uploader.DeletePrefix(ctx, prefix)
+	if err != nil {
+		w.log.ErrorContext(ctx, "Failed to remove partial output",
+			"videoId", videoID,
+			"prefix", prefix,
+			"error", err,
+		)
+	}
+
+	err = w.videos.CancelVideo(ctx, videoID, owner, "cancelled by user")
+	if errors.Is(err, models.ErrInvalidTransition) {
+		err = w.videos.ReleaseVideoLease(ctx, videoID, owner)
+	}
+	if err != nil && !errors.Is(err, models.ErrLeaseNotHeld) {
+		w.log.ErrorContext(ctx, "Failed to mark video as cancelled",
+			"videoId", videoID,
+			"error", err,
+		)
+		return
+	}
+
+	w.log.InfoContext(ctx, "Video processing cancelled",
+		"videoId", videoID,
+		"objectsDeleted", deleted,
+	)
+}
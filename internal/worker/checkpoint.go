@@ -0,0 +1,219 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/transcoder"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// checkpoint describes how a stage's outputs are saved when it finishes, so
+// that a retry of the same output version can restore them instead of
+// running the stage again.
+type checkpoint struct {
+	// paths lists the workspace files and directories (with a trailing
+	// slash) the stage writes, relative to the workspace. They are copied to
+	// the job's checkpoint prefix; see checkpointPrefix. It is nil for
+	// stages without files.
+	paths func(run *jobRun) []string
+
+	// restore rebuilds the stage's in-memory outputs once its files are
+	// back in the workspace. It may be nil.
+	restore func(ctx context.Context, run *jobRun) error
+}
+
+// withCheckpoints wraps the run function of every checkpointed stage so its
+// outputs are saved once it succeeds or has nothing to do.
+func (w *Worker) withCheckpoints(stages []stage) []stage {
+	for i := range stages {
+		s := stages[i]
+		if s.checkpoint == nil {
+			continue
+		}
+		stages[i].run = func(ctx context.Context, run *jobRun) error {
+			err := s.run(ctx, run)
+			if err == nil || errors.Is(err, errStageSkipped) {
+				w.saveCheckpoint(ctx, run, s, err != nil)
+			}
+			return err
+		}
+	}
+	return stages
+}
+
+// saveCheckpoint copies a finished stage's outputs to the checkpoint prefix
+// and records it on the video. Failures are logged: the job continues and a
+// retry runs the stage again.
+func (w *Worker) saveCheckpoint(ctx context.Context, run *jobRun, s stage, skipped bool) {
+	if !w.cfg.Worker.CheckpointsEnabled {
+		return
+	}
+	job := run.job
+
+	if !skipped && s.checkpoint.paths != nil {
+		if paths := s.checkpoint.paths(run); len(paths) > 0 {
+			if _, err := w.uploader.Upload(ctx, checkpointPrefix(run), run.hlsDir, paths...); err != nil {
+				w.log.WarnContext(ctx, "Failed to save checkpoint files",
+					"videoId", job.VideoID,
+					"stage", s.name,
+					"error", err,
+				)
+				return
+			}
+		}
+	}
+
+	cp := models.Checkpoint{
+		Stage:       s.name,
+		Version:     job.Version,
+		Skipped:     skipped,
+		CompletedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := w.videos.SaveCheckpoint(ctx, job.VideoID, run.owner, cp); err != nil {
+		w.log.WarnContext(ctx, "Failed to record checkpoint",
+			"videoId", job.VideoID,
+			"stage", s.name,
+			"error", err,
+		)
+	}
+}
+
+// restoreCheckpoints restores the outputs of the stages an earlier attempt
+// at the job's output version finished, and returns the names of the
+// stages restored. A checkpoint that cannot be restored is ignored and its
+// stage runs again.
+func (w *Worker) restoreCheckpoints(ctx context.Context, run *jobRun, video *models.VideoMetadata) map[string]bool {
+	restored := make(map[string]bool)
+	if !w.cfg.Worker.CheckpointsEnabled {
+		return restored
+	}
+	job := run.job
+	prefix := checkpointPrefix(run)
+
+	for _, s := range w.pipeline.stages {
+		if s.checkpoint == nil {
+			continue
+		}
+		cp := video.FindCheckpoint(s.name, job.Version)
+		if cp == nil {
+			continue
+		}
+
+		// Checkpointed files are restored into a fresh workspace
+		if run.hlsDir == "" {
+			if err := w.workspaceStage(ctx, run); err != nil {
+				w.log.WarnContext(ctx, "Failed to create workspace for checkpoints", "videoId", job.VideoID, "error", err)
+				return map[string]bool{}
+			}
+			restored["workspace"] = true
+		}
+
+		if !cp.Skipped {
+			if err := w.restoreStage(ctx, run, s, prefix); err != nil {
+				w.log.WarnContext(ctx, "Failed to restore checkpoint, running stage again",
+					"videoId", job.VideoID,
+					"stage", s.name,
+					"error", err,
+				)
+				continue
+			}
+		}
+		restored[s.name] = true
+	}
+
+	if len(restored) > 0 {
+		w.log.InfoContext(ctx, "Restored checkpoints",
+			"videoId", job.VideoID,
+			"version", job.Version,
+			"stages", len(restored),
+		)
+	}
+	return restored
+}
+
+// restoreStage downloads a stage's checkpointed files into the workspace
+// and rebuilds its outputs. On failure the partially restored files are
+// removed so the stage starts clean.
+func (w *Worker) restoreStage(ctx context.Context, run *jobRun, s stage, prefix string) error {
+	var paths []string
+	if s.checkpoint.paths != nil {
+		paths = s.checkpoint.paths(run)
+	}
+	err := func() error {
+		for _, path := range paths {
+			dest := filepath.Join(run.hlsDir, filepath.FromSlash(path))
+			if _, err := w.downloader.DownloadPrefix(ctx, w.cfg.AWS.ProcessedBucket, prefix+path, dest); err != nil {
+				return err
+			}
+		}
+		if s.checkpoint.restore != nil {
+			return s.checkpoint.restore(ctx, run)
+		}
+		return nil
+	}()
+	if err != nil {
+		for _, path := range paths {
+			_ = os.RemoveAll(filepath.Join(run.hlsDir, filepath.FromSlash(path)))
+		}
+	}
+	return err
+}
+
+// checkpointPrefix returns where the checkpointed files of a job are saved.
+// Nothing serves a versioned prefix until publish, so versioned output is
+// checkpointed straight into it and the upload stage, which skips files
+// already stored, does not send it again. The unversioned prefix may be
+// live, so version 0 is checkpointed to scratch.
+func checkpointPrefix(run *jobRun) string {
+	if run.job.Version > 0 {
+		return run.hlsPrefix
+	}
+	return models.ScratchPrefix(run.job.VideoID, run.job.Version)
+}
+
+// deleteScratch removes the checkpointed files of a job's output version.
+func (w *Worker) deleteScratch(ctx context.Context, job *models.VideoJob) {
+	prefix := models.ScratchPrefix(job.VideoID, job.Version)
+	if _, err := w.uploader.DeletePrefix(ctx, prefix); err != nil {
+		w.log.WarnContext(ctx, "Failed to remove checkpoint files",
+			"videoId", job.VideoID,
+			"prefix", prefix,
+			"error", err,
+		)
+	}
+}
+
+// renditionPaths returns the workspace paths written by the transcode stage.
+func renditionPaths(run *jobRun) []string {
+	paths := []string{"master.m3u8"}
+	for _, preset := range run.presets {
+		paths = append(paths, preset.Name+"/")
+	}
+	return paths
+}
+
+// restoreRenditions checks that restored renditions are complete.
+func restoreRenditions(ctx context.Context, run *jobRun) error {
+	return transcoder.ValidateOutput(run.hlsDir, run.presets)
+}
+
+// restoreTimeline rebuilds the analysis summary from a restored timeline.
+func restoreTimeline(ctx context.Context, run *jobRun) error {
+	data, err := os.ReadFile(filepath.Join(run.hlsDir, transcoder.TimelineFilename))
+	if err != nil {
+		return err
+	}
+	var timeline models.Timeline
+	if err := json.Unmarshal(data, &timeline); err != nil {
+		return fmt.Errorf("invalid timeline: %w", err)
+	}
+	summary := transcoder.SummarizeTimeline(&timeline, run.hlsPrefix+transcoder.TimelineFilename)
+	run.analysis = &summary
+	return nil
+}
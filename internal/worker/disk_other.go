@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package worker
+
+import "errors"
+
+// diskUsage is not implemented on this platform; jobs are admitted without
+// disk checks.
+func diskUsage(dir string) (diskStats, error) {
+	return diskStats{}, errors.ErrUnsupported
+}
@@ -0,0 +1,31 @@
+//go:build linux || darwin
+
+package worker
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// diskUsage reports the filesystem holding dir.
+func diskUsage(dir string) (diskStats, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return diskStats{}, err
+	}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return diskStats{}, fmt.Errorf("no device for %s", dir)
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return diskStats{}, fmt.Errorf("failed to stat filesystem of %s: %w", dir, err)
+	}
+	return diskStats{
+		device: uint64(st.Dev),
+		free:   uint64(fs.Bavail) * uint64(fs.Bsize),
+		total:  uint64(fs.Blocks) * uint64(fs.Bsize),
+	}, nil
+}
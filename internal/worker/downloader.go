@@ -5,13 +5,16 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/internal/storage"
 	"github.com/amillerrr/hls-pipeline/pkg/models"
 )
 
@@ -21,21 +24,27 @@ const (
 	TempHLSDir    = "/tmp/hls"
 )
 
-// Downloader handles downloading videos from S3.
+// Downloader handles downloading videos from object storage.
 type Downloader struct {
-	s3Client *s3.Client
-	log      *slog.Logger
+	objects    storage.ObjectStore
+	httpClient *http.Client // Reads streamed sources
+	opts       TransferOptions
+	log        *slog.Logger
 }
 
 // NewDownloader creates a new Downloader.
-func NewDownloader(s3Client *s3.Client, log *slog.Logger) *Downloader {
+func NewDownloader(objects storage.ObjectStore, opts TransferOptions, log *slog.Logger) *Downloader {
 	return &Downloader{
-		s3Client: s3Client,
-		log:      log,
+		objects:    objects,
+		httpClient: &http.Client{},
+		opts:       opts,
+		log:        log,
 	}
 }
 
-// Download downloads a video from S3 to a local temporary file.
+// Download downloads a video from object storage to a local temporary file. The object
+// is fetched in parallel ranged parts, each retried on its own, and the
+// file is checked against the object's checksum.
 func (d *Downloader) Download(ctx context.Context, job *models.VideoJob) (string, error) {
 	ctx, span := tracer.Start(ctx, "download-video")
 	defer span.End()
@@ -53,40 +62,193 @@ func (d *Downloader) Download(ctx context.Context, job *models.VideoJob) (string
 	}
 	tmpPath := tmpFile.Name()
 
-	// Download from S3
-	result, err := d.s3Client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(job.Bucket),
-		Key:    aws.String(job.S3Key),
-	})
-	if err != nil {
-		tmpFile.Close()
-		os.Remove(tmpPath)
-		return "", fmt.Errorf("failed to get object from S3: %w", err)
-	}
-	defer result.Body.Close()
-
-	// Copy to file
-	written, err := io.Copy(tmpFile, result.Body)
+	start := time.Now()
+	written, parts, err := d.downloadFile(ctx, job.Bucket, job.S3Key, tmpFile)
 	if err != nil {
 		tmpFile.Close()
 		os.Remove(tmpPath)
-		return "", fmt.Errorf("failed to write file: %w", err)
+		return "", err
 	}
 
 	if err := tmpFile.Close(); err != nil {
 		os.Remove(tmpPath)
 		return "", fmt.Errorf("failed to close temp file: %w", err)
 	}
+	if elapsed := time.Since(start).Seconds(); written > 0 && elapsed > 0 {
+		metrics.DownloadThroughput.Observe(float64(written) / elapsed)
+	}
+	metrics.DownloadBytes.Add(float64(written))
 
-	span.SetAttributes(attribute.Int64("video.size_bytes", written))
+	span.SetAttributes(
+		attribute.Int64("video.size_bytes", written),
+		attribute.Int("download.parts", parts),
+	)
 	d.log.InfoContext(ctx, "Downloaded video",
 		"videoId", job.VideoID,
 		"sizeBytes", written,
+		"parts", parts,
 	)
 
 	return tmpPath, nil
 }
 
+// downloadFile fetches an object into file and verifies it, returning the
+// number of bytes and parts fetched. Every part is requested with the
+// object's ETag, so an object replaced mid-download fails instead of
+// mixing content.
+func (d *Downloader) downloadFile(ctx context.Context, bucket, key string, file *os.File) (int64, int, error) {
+	head, err := d.objects.Head(ctx, bucket, key, storage.HeadOptions{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get object from storage: %w", err)
+	}
+	size := head.Size
+	if err := file.Truncate(size); err != nil {
+		return 0, 0, fmt.Errorf("failed to allocate file: %w", err)
+	}
+
+	parts := partRanges(size, d.opts.PartSize)
+	err = forEachPart(ctx, parts, d.opts.PartConcurrency, func(ctx context.Context, i int, part byteRange) error {
+		return retryPart(ctx, func() error {
+			return d.downloadPart(ctx, bucket, key, head.ETag, part, file)
+		})
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if err := d.verifyDownload(ctx, bucket, key, file.Name(), head); err != nil {
+		return 0, 0, err
+	}
+	return size, len(parts), nil
+}
+
+// downloadPart writes one ranged part of an object into file.
+func (d *Downloader) downloadPart(ctx context.Context, bucket, key, etag string, part byteRange, file *os.File) error {
+	body, _, err := d.objects.Get(ctx, bucket, key, storage.GetOptions{Range: part.header(), IfMatch: etag})
+	if err != nil {
+		return fmt.Errorf("failed to get %s of object: %w", part.header(), err)
+	}
+	defer body.Close()
+
+	written, err := io.Copy(io.NewOffsetWriter(file, part.off), body)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", part.header(), err)
+	}
+	if written != part.n {
+		return fmt.Errorf("short read of %s: got %d bytes", part.header(), written)
+	}
+	return nil
+}
+
+// verifyDownload checks a downloaded file against the SHA-256 checksum its
+// object was stored with. An object without one is checked against its
+// ETag if that is an MD5, and otherwise cannot be verified. For an object
+// stored with a multipart upload the part size is read from its first part.
+func (d *Downloader) verifyDownload(ctx context.Context, bucket, key, path string, head *storage.ObjectInfo) error {
+	switch {
+	case head.ChecksumSHA256 != "":
+		multipart := etagParts(head.ChecksumSHA256) > 0
+		partSize, err := d.partSize(ctx, bucket, key, multipart)
+		if err != nil {
+			return err
+		}
+		_, checksum, err := fileChecksums(path, multipart, partSize)
+		if err != nil {
+			return fmt.Errorf("failed to checksum download: %w", err)
+		}
+		if checksum != head.ChecksumSHA256 {
+			return fmt.Errorf("downloaded file does not match checksum %s", head.ChecksumSHA256)
+		}
+	case head.MD5ETag:
+		partSize, err := d.partSize(ctx, bucket, key, etagParts(head.ETag) > 0)
+		if err != nil {
+			return err
+		}
+		if !matchesETag(path, head.ETag, partSize) {
+			return fmt.Errorf("downloaded file does not match ETag %s", head.ETag)
+		}
+	default:
+		d.log.WarnContext(ctx, "Download not verified: object has no checksum and its ETag is not an MD5",
+			"bucket", bucket,
+			"key", key,
+		)
+	}
+	return nil
+}
+
+// partSize returns the size of the first part of a multipart object, or 0
+// for an object stored in one piece.
+func (d *Downloader) partSize(ctx context.Context, bucket, key string, multipart bool) (int64, error) {
+	if !multipart {
+		return 0, nil
+	}
+	head, err := d.objects.Head(ctx, bucket, key, storage.HeadOptions{PartNumber: 1})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get part size: %w", err)
+	}
+	return head.Size, nil
+}
+
+// Size returns the size of a job's source object.
+func (d *Downloader) Size(ctx context.Context, job *models.VideoJob) (int64, error) {
+	head, err := d.objects.Head(ctx, job.Bucket, job.S3Key, storage.HeadOptions{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get object size: %w", err)
+	}
+	return head.Size, nil
+}
+
+// DownloadPrefix downloads every object under prefix in bucket to dest,
+// keeping the key layout below prefix. A prefix naming a single object is
+// downloaded to dest itself. It returns the number of files downloaded and
+// fails if there are none.
+func (d *Downloader) DownloadPrefix(ctx context.Context, bucket, prefix, dest string) (int, error) {
+	ctx, span := tracer.Start(ctx, "download-prefix")
+	defer span.End()
+
+	objects, err := d.objects.List(ctx, bucket, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	downloaded := 0
+	for _, obj := range objects {
+		path := filepath.Join(dest, filepath.FromSlash(strings.TrimPrefix(obj.Key, prefix)))
+		if err := d.downloadObject(ctx, bucket, obj.Key, path); err != nil {
+			return downloaded, err
+		}
+		downloaded++
+	}
+	if downloaded == 0 {
+		return 0, fmt.Errorf("no objects under %s", prefix)
+	}
+
+	span.SetAttributes(attribute.Int("files.downloaded", downloaded))
+	return downloaded, nil
+}
+
+// downloadObject writes one object to path, creating its directory.
+func (d *Downloader) downloadObject(ctx context.Context, bucket, key, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", key, err)
+	}
+
+	body, _, err := d.objects.Get(ctx, bucket, key, storage.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get %s: %w", key, err)
+	}
+	defer body.Close()
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := io.Copy(file, body); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
 // CreateHLSDir creates the output directory for HLS files.
 func (d *Downloader) CreateHLSDir(videoID string) (string, error) {
 	hlsDir := filepath.Join(TempHLSDir, videoID)
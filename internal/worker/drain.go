@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/queue"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// errDraining is the cancellation cause for jobs still running when the
+// drain grace period ends.
+var errDraining = errors.New("worker draining")
+
+// drain waits up to timeout for in-progress jobs to finish, then cancels the
+// rest with errDraining so they return their messages to the queue, and
+// waits for them to do so.
+func (w *Worker) drain(ctx context.Context, wg *sync.WaitGroup, timeout time.Duration, cancelJobs context.CancelCauseFunc) {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	w.log.InfoContext(ctx, "Draining in-progress jobs", "timeout", timeout)
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		w.log.InfoContext(ctx, "All jobs completed, shutting down")
+		return
+	case <-timer.C:
+	}
+
+	w.log.WarnContext(ctx, "Drain timeout reached, returning unfinished jobs to the queue")
+	cancelJobs(errDraining)
+	<-done
+	w.log.InfoContext(ctx, "Unfinished jobs returned, shutting down")
+}
+
+// returnToQueue hands an unfinished message back to the queue and, if its
+// video was claimed by owner, first puts the video back to pending so the
+// next worker picks it up without counting this as a failure. The message
+// is republished so a drain does not use up one of the job's deliveries;
+// if that fails it is made visible again immediately instead.
+func (w *Worker) returnToQueue(ctx context.Context, msg *queue.Message, job *models.VideoJob, owner string) {
+	ctx = context.WithoutCancel(ctx)
+
+	if job != nil {
+		err := w.videos.ReleaseVideo(ctx, job.VideoID, owner, "worker shutting down")
+		if err != nil && !errors.Is(err, models.ErrLeaseNotHeld) {
+			w.log.ErrorContext(ctx, "Failed to return video to pending", "videoId", job.VideoID, "error", err)
+		}
+	}
+
+	if !w.republish(ctx, msg, msg.Body, 0) {
+		if err := w.queue.Nack(ctx, msg, 0); err != nil {
+			w.log.ErrorContext(ctx, "Failed to return message to queue", "messageId", msg.ID, "error", err)
+			return
+		}
+	}
+	if job != nil {
+		w.log.InfoContext(ctx, "Returned unfinished job to the queue", "videoId", job.VideoID, "messageId", msg.ID)
+	}
+}
@@ -0,0 +1,74 @@
+package worker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/smithy-go"
+
+	"github.com/amillerrr/hls-pipeline/internal/storage"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Retry backoff for transient failures
+const (
+	RetryBaseDelay = 30 * time.Second
+	RetryMaxDelay  = 15 * time.Minute
+)
+
+// permanentAPIErrorCodes are AWS error codes that retrying cannot fix.
+var permanentAPIErrorCodes = map[string]bool{
+	"NoSuchKey":          true, // Raw upload was deleted
+	"InvalidObjectState": true, // Raw upload was archived
+	"NoSuchBucket":       true, // Bucket is misconfigured
+}
+
+// classifyError decides whether a failed job is worth retrying. Anything not
+// known to be permanent is treated as transient; the queue's redrive policy
+// bounds how often it is retried.
+func classifyError(err error) models.ErrorClass {
+	if class, ok := models.ClassOf(err); ok {
+		return class
+	}
+
+	if errors.Is(err, models.ErrInputRejected) || errors.Is(err, models.ErrJobParseFailed) ||
+		errors.Is(err, models.ErrInvalidTransition) || errors.Is(err, models.ErrVideoNotFound) {
+		return models.ErrorClassPermanent
+	}
+
+	if errors.Is(err, models.ErrResourceLimit) {
+		return models.ErrorClassResource
+	}
+
+	// A missing raw upload will not reappear, and denied access needs an
+	// operator; throttling and outages are worth waiting out
+	if storage.IsRetryable(err) {
+		return models.ErrorClassTransient
+	}
+	if errors.Is(err, models.ErrObjectNotFound) || errors.Is(err, models.ErrAccessDenied) {
+		return models.ErrorClassPermanent
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) && permanentAPIErrorCodes[apiErr.ErrorCode()] {
+		return models.ErrorClassPermanent
+	}
+
+	return models.ErrorClassTransient
+}
+
+// retryBackoff returns the visibility delay before the given delivery attempt
+// is retried: RetryBaseDelay doubled per attempt, capped at RetryMaxDelay.
+func retryBackoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	delay := RetryBaseDelay
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= RetryMaxDelay {
+			return RetryMaxDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,315 @@
+package worker
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amillerrr/hls-pipeline/internal/storage"
+	"github.com/amillerrr/hls-pipeline/internal/transcoder"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Ingest modes
+const (
+	IngestDownload = "download" // Copy the raw upload to local disk first
+	IngestStream   = "stream"   // Read the raw upload from storage in place
+)
+
+// StreamURLExpiry is how long the presigned URL of a streamed source stays
+// valid when it is read without a deadline. Stages get a URL that outlasts
+// their own timeout instead; see remoteSource.URL.
+const StreamURLExpiry = 6 * time.Hour
+
+// streamURLMargin is how long a presigned source URL must stay valid past
+// the deadline of the FFmpeg run reading it.
+const streamURLMargin = 5 * time.Minute
+
+// maxTopLevelBoxes bounds the box headers read looking for an MP4's moov.
+const maxTopLevelBoxes = 64
+
+// errMoovAtEnd means an MP4 keeps its index after the media data. Reading
+// it in place would make FFmpeg seek to the end of the object and back
+// again for every read, so it is downloaded instead.
+var errMoovAtEnd = errors.New("moov box follows the media data")
+
+// presignFunc returns a URL of an object and how long it stays valid:
+// expires, or less if the credentials signing it expire sooner.
+type presignFunc func(ctx context.Context, expires time.Duration) (string, time.Duration, error)
+
+// remoteSource is a raw upload read in place over HTTP, normally through a
+// presigned storage URL. Range requests let it be sniffed and checked without
+// downloading it.
+type remoteSource struct {
+	client  *http.Client
+	presign presignFunc
+	size    int64  // Object size, set by openRemoteSource
+	header  []byte // Up to sniffHeaderSize leading bytes
+
+	mu        sync.Mutex // Guards url and expiresAt; stages read in parallel
+	url       string
+	expiresAt time.Time
+}
+
+// Stream presigns a GET URL for a job's raw upload and reads its header.
+func (d *Downloader) Stream(ctx context.Context, job *models.VideoJob) (*remoteSource, error) {
+	ctx, span := tracer.Start(ctx, "stream-video")
+	defer span.End()
+
+	presign := func(ctx context.Context, expires time.Duration) (string, time.Duration, error) {
+		if signer, ok := d.objects.(storage.ExpiringSigner); ok {
+			until, err := signer.SigningExpiry(ctx)
+			if err != nil {
+				return "", 0, err
+			}
+			if !until.IsZero() {
+				expires = min(expires, time.Until(until))
+			}
+		}
+		rawURL, err := d.objects.Presign(ctx, job.Bucket, job.S3Key, storage.PresignOptions{
+			Method:  http.MethodGet,
+			Expires: expires,
+		})
+		return rawURL, expires, err
+	}
+	src, err := openRemoteSource(ctx, d.httpClient, presign)
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.Int64("video.size_bytes", src.size))
+	return src, nil
+}
+
+// openRemoteSource reads the header and size of the object presign signs
+// URLs for.
+func openRemoteSource(ctx context.Context, client *http.Client, presign presignFunc) (*remoteSource, error) {
+	src := &remoteSource{client: client, presign: presign}
+	header, size, err := src.readRange(ctx, 0, sniffHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, errors.New("source size is unknown")
+	}
+	src.header, src.size = header, size
+	return src, nil
+}
+
+// URL returns a presigned URL of the source that stays valid until ctx's
+// deadline, or for StreamURLExpiry without one, presigning a new URL if the
+// current one expires sooner. Each stage attempt reads the source within its
+// own timeout, so a retry never inherits an expired URL. No URL outlives
+// the credentials signing it, so a stage that runs past their expiry loses
+// the source and is retried with new ones.
+func (s *remoteSource) URL(ctx context.Context) (string, error) {
+	needed := time.Now().Add(StreamURLExpiry)
+	if deadline, ok := ctx.Deadline(); ok {
+		needed = deadline
+	}
+	needed = needed.Add(streamURLMargin)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.url != "" && !s.expiresAt.Before(needed) {
+		return s.url, nil
+	}
+
+	// Signed no earlier than now, so the URL lasts as long as it was granted
+	now := time.Now()
+	rawURL, expires, err := s.presign(ctx, needed.Sub(now))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign source URL: %w", err)
+	}
+	s.url, s.expiresAt = rawURL, now.Add(expires)
+	return rawURL, nil
+}
+
+// readRange reads up to n bytes at off and returns them with the object
+// size the response reports, -1 if it reports none. Reads past the end
+// return no data.
+func (s *remoteSource) readRange(ctx context.Context, off, n int64) ([]byte, int64, error) {
+	rawURL, err := s.URL(ctx)
+	if err != nil {
+		return nil, -1, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to build range request: %w", redactURL(err))
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, off+n-1))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, -1, fmt.Errorf("range request failed: %w", redactURL(err))
+	}
+	defer resp.Body.Close()
+
+	var size int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		size = contentRangeSize(resp.Header.Get("Content-Range"))
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The object ends before off; an empty object always does
+		return nil, contentRangeSize(resp.Header.Get("Content-Range")), nil
+	case http.StatusOK:
+		// The whole object was returned; only its start is usable
+		if off > 0 {
+			return nil, -1, errors.New("source does not support range requests")
+		}
+		size = resp.ContentLength
+	default:
+		return nil, -1, fmt.Errorf("range request failed: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, n))
+	if err != nil {
+		return nil, -1, fmt.Errorf("failed to read range: %w", redactURL(err))
+	}
+	return data, size, nil
+}
+
+// open streams the whole object, for piping to FFmpeg.
+func (s *remoteSource) open(ctx context.Context) (io.ReadCloser, error) {
+	rawURL, err := s.URL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build source request: %w", redactURL(err))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("source request failed: %w", redactURL(err))
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("source request failed: %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// moovFirst walks the top-level boxes of an MP4 or MOV and reports whether
+// its moov box comes before its media data.
+func (s *remoteSource) moovFirst(ctx context.Context) (bool, error) {
+	var off int64
+	for range maxTopLevelBoxes {
+		if off+8 > s.size {
+			break
+		}
+		header, _, err := s.readRange(ctx, off, 16)
+		if err != nil {
+			return false, err
+		}
+		if len(header) < 8 {
+			break
+		}
+
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		switch boxSize {
+		case 0:
+			// The box runs to the end of the file
+			boxSize = s.size - off
+		case 1:
+			// A 64-bit size follows the type
+			if len(header) < 16 {
+				return false, fmt.Errorf("truncated box header at offset %d", off)
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+		}
+
+		switch string(header[4:8]) {
+		case "moov":
+			return true, nil
+		case "mdat":
+			return false, nil
+		}
+		if boxSize < 8 {
+			return false, fmt.Errorf("invalid box size %d at offset %d", boxSize, off)
+		}
+		off += boxSize
+	}
+	return false, errors.New("no moov or mdat box found")
+}
+
+// contentRangeSize parses the complete length from a Content-Range header
+// such as "bytes 0-15/1024" or "bytes */0", returning -1 if it is unknown.
+func contentRangeSize(header string) int64 {
+	_, total, ok := strings.Cut(header, "/")
+	if !ok {
+		return -1
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// remoteInput stands in for the presigned URL of a streamed source in
+// jobRun, which is presigned afresh for each stage; see jobRun.sourceInput.
+const remoteInput = "remote"
+
+// redactURL drops the URL from HTTP client errors; a presigned URL carries
+// credentials and must not reach the logs.
+func redactURL(err error) error {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+	return err
+}
+
+// streamSource sets up a job's raw upload to be read in place. Seekable
+// containers are read through the presigned URL with range requests;
+// Matroska and WebM, which FFmpeg reads front to back, are piped to its
+// stdin instead. An MP4 with its moov box at the end is refused with
+// errMoovAtEnd. Preview generation always uses the URL because its clips
+// seek into the source.
+func (w *Worker) streamSource(ctx context.Context, run *jobRun) error {
+	src, err := w.downloader.Stream(ctx, run.job)
+	if err != nil {
+		return err
+	}
+
+	container := sniffHeader(src.header)
+	input := remoteInput
+	switch container {
+	case ContainerISOBMFF:
+		first, err := src.moovFirst(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to locate moov box: %w", err)
+		}
+		if !first {
+			return errMoovAtEnd
+		}
+	case ContainerMatroska:
+		input = transcoder.PipeInput
+		run.tc = run.tc.WithStdin(src.open)
+	}
+
+	run.remote = src
+	run.input = input
+	run.seekableInput = remoteInput
+
+	piped := input == transcoder.PipeInput
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("ingest.piped", piped))
+	w.log.InfoContext(ctx, "Streaming video",
+		"videoId", run.job.VideoID,
+		"container", container,
+		"sizeBytes", src.size,
+		"piped", piped,
+	)
+	return nil
+}
@@ -0,0 +1,107 @@
+package worker
+
+import (
+	"context"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Janitor settings
+const (
+	// JanitorInterval is how often expired output versions are deleted.
+	JanitorInterval = time.Hour
+
+	// janitorPageSize is how many videos are read per listing page.
+	janitorPageSize = 100
+)
+
+// RunJanitor deletes expired output versions every interval until the
+// context is cancelled. Several workers may run it at once: versions are
+// removed from the video record before their objects are deleted, with a
+// conditional write, so each version is deleted once.
+func (w *Worker) RunJanitor(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		deleted, err := w.cleanupVersions(ctx, time.Now())
+		switch {
+		case err != nil && ctx.Err() == nil:
+			w.log.WarnContext(ctx, "Output version cleanup failed", "versionsDeleted", deleted, "error", err)
+		case deleted > 0:
+			w.log.InfoContext(ctx, "Deleted expired output versions", "versionsDeleted", deleted)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanupVersions walks every video and deletes the output versions that
+// have expired as of now. It returns the number of versions deleted.
+func (w *Worker) cleanupVersions(ctx context.Context, now time.Time) (int, error) {
+	keep := w.cfg.Worker.KeepVersions
+	retention := time.Duration(w.cfg.Worker.VersionRetentionHours) * time.Hour
+
+	deleted := 0
+	var cursor string
+	for {
+		videos, next, err := w.videos.ListVideos(ctx, janitorPageSize, cursor)
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, video := range videos {
+			expired := models.ExpiredVersions(video.Versions, video.CurrentVersion, keep, retention, now)
+			if len(expired) == 0 {
+				continue
+			}
+			deleted += w.deleteVersions(ctx, video.VideoID, expired)
+		}
+
+		if next == "" || ctx.Err() != nil {
+			return deleted, ctx.Err()
+		}
+		cursor = next
+	}
+}
+
+// deleteVersions removes expired versions from a video's record and then
+// deletes their objects. It returns the number of versions deleted.
+func (w *Worker) deleteVersions(ctx context.Context, videoID string, expired []models.OutputVersion) int {
+	prune := make([]int, len(expired))
+	for i, entry := range expired {
+		prune[i] = entry.Version
+	}
+
+	removed, err := w.videos.PruneVersions(ctx, videoID, prune)
+	if err != nil {
+		w.log.WarnContext(ctx, "Failed to prune output versions", "videoId", videoID, "versions", prune, "error", err)
+		return 0
+	}
+
+	deleted := 0
+	for _, version := range removed {
+		prefix := models.HLSPrefix(videoID, version)
+		objects, err := w.uploader.DeletePrefix(ctx, prefix)
+		if err != nil {
+			w.log.ErrorContext(ctx, "Failed to delete output version",
+				"videoId", videoID,
+				"prefix", prefix,
+				"error", err,
+			)
+			continue
+		}
+		w.log.InfoContext(ctx, "Deleted output version",
+			"videoId", videoID,
+			"version", version,
+			"objectsDeleted", objects,
+		)
+		deleted++
+	}
+	return deleted
+}
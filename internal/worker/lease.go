@@ -0,0 +1,116 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// LeaseRenewInterval is how often a running job's queue lease is extended.
+// It leaves room for two missed renewals before QueueLease runs out.
+const LeaseRenewInterval = QueueLease / 3
+
+// keepLease extends msg's queue lease every interval until the returned stop
+// function is called. If the lease is lost, another worker may already have
+// the message, so the job is cancelled with queue.ErrLeaseLost as the cause.
+func (w *Worker) keepLease(ctx context.Context, msg *queue.Message, interval, lease time.Duration, cancel context.CancelCauseFunc) (stop func()) {
+	return keepAlive(ctx, interval, func(ctx context.Context) bool {
+		err := w.queue.ExtendLease(ctx, msg, lease)
+		switch {
+		case err == nil:
+			metrics.LeaseExtensions.Inc()
+		case errors.Is(err, queue.ErrLeaseLost):
+			metrics.LeasesLost.Inc()
+			w.log.WarnContext(ctx, "Queue lease lost, abandoning job",
+				"messageId", msg.ID,
+				"error", err,
+			)
+			cancel(queue.ErrLeaseLost)
+			return false
+		case ctx.Err() != nil:
+			return false
+		default:
+			// Retry on the next tick; the lease outlives a few failures
+			w.log.WarnContext(ctx, "Failed to extend queue lease",
+				"messageId", msg.ID,
+				"error", err,
+			)
+		}
+		return true
+	})
+}
+
+// leaseOwner returns the token one job holds its video's processing lease
+// with: the worker ID, so operators can tell which worker holds it, and a
+// random suffix, so concurrent jobs of one worker never share a lease.
+func (w *Worker) leaseOwner() string {
+	return w.cfg.Worker.ID + "/" + uuid.NewString()
+}
+
+// keepVideoLease renews owner's processing lease on a video every interval
+// until stopped. Losing it cancels the job with models.ErrLeaseNotHeld as
+// the cause.
+func (w *Worker) keepVideoLease(ctx context.Context, videoID, owner string, interval, lease time.Duration, cancel context.CancelCauseFunc) (stop func()) {
+	return keepAlive(ctx, interval, func(ctx context.Context) bool {
+		err := w.videos.RenewVideoLease(ctx, videoID, owner, lease)
+		switch {
+		case err == nil:
+		case errors.Is(err, models.ErrLeaseNotHeld):
+			w.log.WarnContext(ctx, "Video lease lost, abandoning job",
+				"videoId", videoID,
+				"error", err,
+			)
+			cancel(models.ErrLeaseNotHeld)
+			return false
+		case ctx.Err() != nil:
+			return false
+		default:
+			w.log.WarnContext(ctx, "Failed to renew video lease",
+				"videoId", videoID,
+				"error", err,
+			)
+		}
+		return true
+	})
+}
+
+// keepAlive calls renew every interval until stop is called, the context is
+// done, or renew returns false.
+func keepAlive(ctx context.Context, interval time.Duration, renew func(context.Context) bool) (stop func()) {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			if !renew(ctx) {
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
@@ -0,0 +1,47 @@
+package worker
+
+import (
+	"strings"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// newManifest describes a job's uploaded files, mapping each to the
+// rendition whose directory holds it.
+func newManifest(run *jobRun, files []models.ManifestFile) *models.Manifest {
+	manifest := &models.Manifest{
+		VideoID:     run.job.VideoID,
+		Version:     run.job.Version,
+		Profile:     run.profile,
+		Renditions:  make([]models.ManifestRendition, 0, len(run.presets)),
+		Files:       files,
+		GeneratedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	index := make(map[string]int, len(run.presets))
+	for _, preset := range run.presets {
+		index[preset.Name] = len(manifest.Renditions)
+		manifest.Renditions = append(manifest.Renditions, models.ManifestRendition{
+			Name:     preset.Name,
+			Width:    preset.Width,
+			Height:   preset.Height,
+			Bitrate:  preset.Bandwidth,
+			Playlist: preset.Name + "/playlist.m3u8",
+		})
+	}
+
+	for i := range manifest.Files {
+		file := &manifest.Files[i]
+		dir, name, ok := strings.Cut(file.Path, "/")
+		r, known := index[dir]
+		if !ok || !known {
+			continue
+		}
+		file.Rendition = dir
+		if strings.HasSuffix(name, ".ts") {
+			manifest.Renditions[r].Segments++
+		}
+	}
+	return manifest
+}
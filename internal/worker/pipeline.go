@@ -0,0 +1,359 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// errStageSkipped is returned by a stage that has nothing to do, such as a
+// disabled one. The stage is recorded as skipped rather than failed.
+var errStageSkipped = errors.New("stage skipped")
+
+// stageRetryDelay is the pause before a stage's next attempt, multiplied by
+// the number of attempts made so far.
+var stageRetryDelay = 2 * time.Second
+
+// stage is one step of the processing pipeline. Stages name the artifacts
+// they read and write; a stage starts once every stage producing one of its
+// inputs, and every stage named in after, has finished. Stages whose
+// dependencies have all finished run in parallel.
+type stage struct {
+	name    string
+	inputs  []string // Artifacts read
+	outputs []string // Artifacts written; each is produced by exactly one stage
+	after   []string // Stages to wait for without sharing an artifact
+
+	// Optional stages may fail without failing the job. Stages depending on
+	// them still run and must cope with their outputs being missing.
+	optional bool
+
+	attempts int           // Runs per delivery while failures are transient; 0 means 1
+	timeout  time.Duration // Per attempt; 0 means only the job's limits apply
+
+	// Checkpointed stages save their outputs when they finish so a retry
+	// can restore them instead of running the stage; see checkpoint.go.
+	checkpoint *checkpoint
+
+	run func(ctx context.Context, run *jobRun) error
+}
+
+// withDefaultTimeout gives stages without a timeout of their own timeout, so
+// a stuck encode cannot hold the job until its queue lease runs out.
+func withDefaultTimeout(stages []stage, timeout time.Duration) []stage {
+	for i := range stages {
+		if stages[i].timeout <= 0 {
+			stages[i].timeout = timeout
+		}
+	}
+	return stages
+}
+
+// pipeline runs a validated set of stages as a dependency graph.
+type pipeline struct {
+	stages     []stage // In dependency order
+	deps       [][]int // Indexes of the stages each stage waits for
+	dependents [][]int // Indexes of the stages waiting for each stage
+}
+
+// newPipeline validates stages and orders them by their dependencies. Every
+// input must be produced by a stage, no artifact may be produced twice and
+// the dependencies must not form a cycle. Independent stages keep their
+// declared order.
+func newPipeline(stages []stage) (*pipeline, error) {
+	index := make(map[string]int, len(stages))
+	producers := make(map[string]int)
+	for i, s := range stages {
+		if s.name == "" || s.run == nil {
+			return nil, fmt.Errorf("stage %d: name and run are required", i)
+		}
+		if _, dup := index[s.name]; dup {
+			return nil, fmt.Errorf("duplicate stage %s", s.name)
+		}
+		index[s.name] = i
+
+		for _, artifact := range s.outputs {
+			if p, dup := producers[artifact]; dup {
+				return nil, fmt.Errorf("artifact %s is produced by both %s and %s", artifact, stages[p].name, s.name)
+			}
+			producers[artifact] = i
+		}
+	}
+
+	deps := make([][]int, len(stages))
+	for i, s := range stages {
+		seen := make(map[int]bool)
+		add := func(j int) {
+			if !seen[j] {
+				seen[j] = true
+				deps[i] = append(deps[i], j)
+			}
+		}
+		for _, artifact := range s.inputs {
+			p, ok := producers[artifact]
+			if !ok {
+				return nil, fmt.Errorf("stage %s: no stage produces %s", s.name, artifact)
+			}
+			add(p)
+		}
+		for _, name := range s.after {
+			j, ok := index[name]
+			if !ok {
+				return nil, fmt.Errorf("stage %s: unknown stage %s", s.name, name)
+			}
+			add(j)
+		}
+	}
+
+	// Topological sort, taking ready stages in declared order
+	waiting := make([]int, len(stages))
+	dependents := make([][]int, len(stages))
+	var ready []int
+	for i := range stages {
+		waiting[i] = len(deps[i])
+		for _, j := range deps[i] {
+			dependents[j] = append(dependents[j], i)
+		}
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	order := make([]int, 0, len(stages))
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		order = append(order, i)
+		for _, d := range dependents[i] {
+			if waiting[d]--; waiting[d] == 0 {
+				ready = append(ready, d)
+			}
+		}
+	}
+	if len(order) != len(stages) {
+		var cyclic []string
+		for i, s := range stages {
+			if waiting[i] > 0 {
+				cyclic = append(cyclic, s.name)
+			}
+		}
+		return nil, fmt.Errorf("dependency cycle between stages %s", strings.Join(cyclic, ", "))
+	}
+
+	// Re-index the graph in dependency order
+	pos := make([]int, len(stages))
+	for k, i := range order {
+		pos[i] = k
+	}
+	p := &pipeline{
+		stages:     make([]stage, len(stages)),
+		deps:       make([][]int, len(stages)),
+		dependents: make([][]int, len(stages)),
+	}
+	for k, i := range order {
+		p.stages[k] = stages[i]
+		for _, j := range deps[i] {
+			p.deps[k] = append(p.deps[k], pos[j])
+			p.dependents[pos[j]] = append(p.dependents[pos[j]], k)
+		}
+	}
+	return p, nil
+}
+
+// mustPipeline is newPipeline for the built-in stage registry, which is
+// fixed at compile time.
+func mustPipeline(stages []stage) *pipeline {
+	p, err := newPipeline(stages)
+	if err != nil {
+		panic("invalid pipeline: " + err.Error())
+	}
+	return p
+}
+
+// stageResult is the outcome of a stage reported back to the scheduler.
+type stageResult struct {
+	index  int
+	record models.StageRun
+	err    error
+}
+
+// execute runs the stages of one processing attempt, starting each as soon
+// as its dependencies have finished. Stages in restored already have their
+// outputs from an earlier attempt and are not run, nor are stages that only
+// restored stages depend on. When a required stage fails, running stages
+// are cancelled, the rest are skipped and its error is returned. report, if
+// not nil, is called from a single goroutine with every stage's record
+// whenever stages start or finish.
+func (p *pipeline) execute(ctx context.Context, run *jobRun, restored map[string]bool, report func([]models.StageRun)) ([]models.StageRun, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	// A stage is needed unless it was restored or everything depending on
+	// it is not needed; stages nothing depends on are always needed
+	needed := make([]bool, len(p.stages))
+	for i := len(p.stages) - 1; i >= 0; i-- {
+		if restored[p.stages[i].name] {
+			continue
+		}
+		needed[i] = len(p.dependents[i]) == 0
+		for _, d := range p.dependents[i] {
+			needed[i] = needed[i] || needed[d]
+		}
+	}
+
+	records := make([]models.StageRun, len(p.stages))
+	waiting := make([]int, len(p.stages))
+	var ready []int
+	for i, s := range p.stages {
+		records[i] = models.StageRun{Name: s.name, Status: models.StagePending, Optional: s.optional}
+		waiting[i] = len(p.deps[i])
+		if waiting[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+
+	results := make(chan stageResult)
+	finished := 0
+	var failed error
+
+	// release counts a stage as finished and returns the stages it unblocks.
+	release := func(i int) []int {
+		finished++
+		var unblocked []int
+		for _, d := range p.dependents[i] {
+			if waiting[d]--; waiting[d] == 0 {
+				unblocked = append(unblocked, d)
+			}
+		}
+		return unblocked
+	}
+
+	for {
+		for k := 0; k < len(ready); k++ {
+			i := ready[k]
+			if failed == nil && ctx.Err() != nil {
+				failed = fmt.Errorf("%w: before %s", models.ErrContextCanceled, p.stages[i].name)
+			}
+			if failed != nil || !needed[i] {
+				records[i].Status = models.StageSkipped
+				if restored[p.stages[i].name] {
+					records[i].Status = models.StageRestored
+				}
+				ready = append(ready, release(i)...)
+				continue
+			}
+
+			records[i].Status = models.StageRunning
+			records[i].StartedAt = time.Now().UTC().Format(time.RFC3339)
+			go func(i int) {
+				results <- p.runStage(ctx, i, run)
+			}(i)
+		}
+		ready = ready[:0]
+
+		if report != nil {
+			report(append([]models.StageRun(nil), records...))
+		}
+		if finished == len(p.stages) {
+			return records, failed
+		}
+
+		result := <-results
+		records[result.index] = result.record
+		if result.err != nil && !p.stages[result.index].optional && failed == nil {
+			failed = fmt.Errorf("stage %s: %w", p.stages[result.index].name, result.err)
+			cancel(failed)
+		}
+		ready = append(ready, release(result.index)...)
+	}
+}
+
+// runStage runs one stage in its own span, retrying transient failures up
+// to the stage's attempt limit.
+func (p *pipeline) runStage(ctx context.Context, i int, run *jobRun) stageResult {
+	s := p.stages[i]
+	attempts := max(s.attempts, 1)
+	record := models.StageRun{
+		Name:      s.name,
+		Optional:  s.optional,
+		StartedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	ctx, span := tracer.Start(ctx, "stage-"+s.name, trace.WithAttributes(
+		attribute.String("stage.name", s.name),
+		attribute.Bool("stage.optional", s.optional),
+	))
+	defer span.End()
+
+	start := time.Now()
+	var err error
+	for {
+		record.Attempts++
+		err = s.attempt(ctx, run)
+		if err == nil || errors.Is(err, errStageSkipped) || record.Attempts >= attempts ||
+			classifyError(err) != models.ErrorClassTransient {
+			break
+		}
+
+		span.AddEvent("retry", trace.WithAttributes(
+			attribute.Int("stage.attempt", record.Attempts),
+			attribute.String("error", err.Error()),
+		))
+		timer := time.NewTimer(stageRetryDelay * time.Duration(record.Attempts))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	duration := time.Since(start)
+	record.DurationMs = duration.Milliseconds()
+
+	switch {
+	case err == nil:
+		record.Status = models.StageSucceeded
+	case errors.Is(err, errStageSkipped):
+		record.Status = models.StageSkipped
+		err = nil
+	default:
+		record.Status = models.StageFailed
+		record.Error = err.Error()
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.SetAttributes(
+		attribute.String("stage.status", string(record.Status)),
+		attribute.Int("stage.attempts", record.Attempts),
+	)
+	metrics.StageDuration.WithLabelValues(s.name, string(record.Status)).Observe(duration.Seconds())
+
+	return stageResult{index: i, record: record, err: err}
+}
+
+// attempt runs the stage once within its timeout. Running out of time is a
+// resource failure.
+func (s *stage) attempt(ctx context.Context, run *jobRun) error {
+	if s.timeout <= 0 {
+		return s.run(ctx, run)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+	err := s.run(attemptCtx, run)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: timed out after %s: %w", models.ErrResourceLimit, s.timeout, err)
+	}
+	return err
+}
@@ -0,0 +1,365 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/internal/transcoder"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Artifacts passed between pipeline stages
+const (
+	artifactSource     = "source"     // Downloaded raw upload
+	artifactWorkspace  = "workspace"  // Local HLS output directory
+	artifactProbe      = "probe"      // Validated ffprobe result
+	artifactRenditions = "renditions" // Validated HLS ladder
+	artifactPreview    = "preview"    // Animated teaser
+	artifactTimeline   = "timeline"   // Content analysis
+	artifactUploaded   = "uploaded"   // Verified output in S3
+)
+
+// jobRun is the state shared by the stages of one processing attempt. Each
+// artifact field is written only by the stage that outputs it and read only
+// by stages that depend on that stage, so it needs no locking.
+type jobRun struct {
+	job       *models.VideoJob
+	profile   string
+	presets   []transcoder.Preset
+	tc        *transcoder.Transcoder // Configured with presets
+	hlsPrefix string
+	owner     string // Lease token the video was claimed with
+
+	// The source is either downloaded to localPath or read in place from
+	// remote. input is what FFmpeg reads: the local path, remoteInput or
+	// transcoder.PipeInput. seekableInput is the local path or remoteInput,
+	// for stages that seek. Stages resolve them with sourceInput.
+	localPath     string        // source
+	remote        *remoteSource // source
+	input         string        // source
+	seekableInput string        // source
+
+	hlsDir      string                  // workspace
+	probe       *transcoder.ProbeResult // probe
+	preview     *models.PreviewAssets   // preview; nil if disabled or failed
+	analysis    *models.AnalysisSummary // timeline; nil if disabled or failed
+	playbackURL string                  // Set by publish
+}
+
+// sourceInput returns what FFmpeg reads the source from within ctx: input,
+// or seekableInput if seek is set. A streamed source's URL is presigned to
+// outlast ctx's deadline.
+func (run *jobRun) sourceInput(ctx context.Context, seek bool) (string, error) {
+	input := run.input
+	if seek {
+		input = run.seekableInput
+	}
+	if input != remoteInput {
+		return input, nil
+	}
+	return run.remote.URL(ctx)
+}
+
+// stages returns the stage registry. Preview generation and content
+// analysis run alongside the ladder encode; everything written into the
+// workspace is uploaded together once they have all finished.
+func (w *Worker) stages() []stage {
+	return w.withCheckpoints([]stage{
+		{
+			name:     "download",
+			outputs:  []string{artifactSource},
+			attempts: 3,
+			run:      w.downloadStage,
+		},
+		{
+			name:    "workspace",
+			outputs: []string{artifactWorkspace},
+			run:     w.workspaceStage,
+		},
+		{
+			name:    "probe",
+			inputs:  []string{artifactSource},
+			outputs: []string{artifactProbe},
+			run:     w.probeStage,
+		},
+		{
+			name:    "transcode",
+			inputs:  []string{artifactSource, artifactProbe, artifactWorkspace},
+			outputs: []string{artifactRenditions},
+			checkpoint: &checkpoint{
+				paths:   renditionPaths,
+				restore: restoreRenditions,
+			},
+			run: w.transcodeStage,
+		},
+		{
+			name:     "preview",
+			inputs:   []string{artifactSource, artifactProbe, artifactWorkspace},
+			outputs:  []string{artifactPreview},
+			optional: true,
+			checkpoint: &checkpoint{
+				paths: func(*jobRun) []string { return []string{transcoder.PreviewDir + "/"} },
+				restore: func(ctx context.Context, run *jobRun) error {
+					run.preview = w.previewAssets(run.hlsPrefix)
+					return nil
+				},
+			},
+			run: w.previewStage,
+		},
+		{
+			name:     "analysis",
+			inputs:   []string{artifactSource, artifactProbe, artifactWorkspace},
+			outputs:  []string{artifactTimeline},
+			optional: true,
+			checkpoint: &checkpoint{
+				paths:   func(*jobRun) []string { return []string{transcoder.TimelineFilename} },
+				restore: restoreTimeline,
+			},
+			run: w.analysisStage,
+		},
+		{
+			// Checkpointed so a retry need not download the source for it
+			name:       "quality",
+			inputs:     []string{artifactSource, artifactRenditions},
+			optional:   true,
+			checkpoint: &checkpoint{},
+			run:        w.qualityStage,
+		},
+		{
+			// Quality scoring writes temporary frames into the workspace
+			name:     "upload",
+			inputs:   []string{artifactRenditions, artifactPreview, artifactTimeline},
+			after:    []string{"quality"},
+			outputs:  []string{artifactUploaded},
+			attempts: 3,
+			run:      w.uploadStage,
+		},
+		{
+			name:   "publish",
+			inputs: []string{artifactUploaded, artifactPreview, artifactTimeline},
+			run:    w.publishStage,
+		},
+	})
+}
+
+// cleanupRun removes the local files of a processing attempt.
+func (w *Worker) cleanupRun(run *jobRun) {
+	if run.localPath != "" {
+		w.downloader.Cleanup(run.localPath)
+	}
+	if run.hlsDir != "" {
+		w.downloader.CleanupDir(run.hlsDir)
+	}
+}
+
+// downloadStage fetches the raw upload from S3. In stream mode the upload
+// is read in place instead, unless it cannot be streamed efficiently.
+func (w *Worker) downloadStage(ctx context.Context, run *jobRun) error {
+	if w.cfg.Worker.IngestMode == IngestStream {
+		err := w.streamSource(ctx, run)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", models.ErrDownloadFailed, err)
+		}
+		w.log.InfoContext(ctx, "Downloading video instead of streaming",
+			"videoId", run.job.VideoID,
+			"reason", err,
+		)
+	}
+
+	start := time.Now()
+	localPath, err := w.downloader.Download(ctx, run.job)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrDownloadFailed, err)
+	}
+	metrics.DownloadDuration.Observe(time.Since(start).Seconds())
+	run.localPath = localPath
+	run.input = localPath
+	run.seekableInput = localPath
+	return nil
+}
+
+// workspaceStage creates the local HLS output directories.
+func (w *Worker) workspaceStage(ctx context.Context, run *jobRun) error {
+	hlsDir, err := w.downloader.CreateHLSDir(run.job.VideoID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrTranscodeFailed, err)
+	}
+	run.hlsDir = hlsDir
+
+	if err := transcoder.CreateOutputDirectories(hlsDir, run.presets); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrTranscodeFailed, err)
+	}
+	return nil
+}
+
+// probeStage probes and validates the input before time is spent on FFmpeg.
+func (w *Worker) probeStage(ctx context.Context, run *jobRun) error {
+	input, err := run.sourceInput(ctx, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrDownloadFailed, err)
+	}
+	probe, probeErr := run.tc.Probe(ctx, input)
+	if run.remote != nil {
+		err = ValidateSource(run.remote.header, run.remote.size, probe, probeErr, w.inputLimits())
+	} else {
+		err = ValidateInput(run.localPath, probe, probeErr, w.inputLimits())
+	}
+	if err != nil {
+		var rejection *models.RejectionError
+		if errors.As(err, &rejection) {
+			w.log.WarnContext(ctx, "Input rejected",
+				"videoId", run.job.VideoID,
+				"code", rejection.Code,
+				"reason", rejection.Reason,
+				"probeError", probeErr,
+			)
+			return err
+		}
+		return fmt.Errorf("%w: %v", models.ErrTranscodeFailed, err)
+	}
+	run.probe = probe
+	return nil
+}
+
+// transcodeStage encodes the ladder and refuses incomplete output.
+func (w *Worker) transcodeStage(ctx context.Context, run *jobRun) error {
+	input, err := run.sourceInput(ctx, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrDownloadFailed, err)
+	}
+	if err := run.tc.TranscodeToHLS(ctx, run.job.VideoID, input, run.hlsDir, run.probe); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrTranscodeFailed, err)
+	}
+	if err := transcoder.ValidateOutput(run.hlsDir, run.presets); err != nil {
+		return fmt.Errorf("%w: invalid output: %v", models.ErrTranscodeFailed, err)
+	}
+	return nil
+}
+
+// previewStage builds the animated teaser inside the workspace so it is
+// uploaded with the playlists.
+func (w *Worker) previewStage(ctx context.Context, run *jobRun) error {
+	if !w.cfg.Worker.PreviewEnabled {
+		return errStageSkipped
+	}
+	input, err := run.sourceInput(ctx, true)
+	if err != nil {
+		return err
+	}
+	preview, err := w.generatePreview(ctx, run.tc, run.hlsPrefix, input, run.hlsDir, run.probe)
+	if err != nil {
+		return err
+	}
+	run.preview = preview
+	return nil
+}
+
+// analysisStage detects dead air and picks a poster frame, writing the
+// timeline into the workspace so it is uploaded with the playlists.
+func (w *Worker) analysisStage(ctx context.Context, run *jobRun) error {
+	if !w.cfg.Worker.AnalysisEnabled {
+		return errStageSkipped
+	}
+	input, err := run.sourceInput(ctx, false)
+	if err != nil {
+		return err
+	}
+	analysis, err := w.analyzeContent(ctx, run.tc, run.job.VideoID, run.hlsPrefix, input, run.hlsDir, run.probe)
+	if err != nil {
+		return err
+	}
+	run.analysis = analysis
+	return nil
+}
+
+// qualityStage records the SSIM of the encoded output.
+func (w *Worker) qualityStage(ctx context.Context, run *jobRun) error {
+	input, err := run.sourceInput(ctx, false)
+	if err != nil {
+		return err
+	}
+	run.tc.CalculateQualityMetrics(ctx, input, run.hlsDir)
+	return nil
+}
+
+// uploadStage uploads the workspace to the version's prefix, checks that
+// every file arrived intact and stores the version's manifest. Files a
+// failed attempt already uploaded are not sent again.
+func (w *Worker) uploadStage(ctx context.Context, run *jobRun) error {
+	start := time.Now()
+	files, err := w.uploader.Upload(ctx, run.hlsPrefix, run.hlsDir)
+	if err != nil {
+		return fmt.Errorf("%w: %v", models.ErrUploadFailed, err)
+	}
+	manifest := newManifest(run, files)
+	if err := w.uploader.VerifyUpload(ctx, run.hlsPrefix, manifest); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrUploadFailed, err)
+	}
+	if err := w.uploader.PutManifest(ctx, run.hlsPrefix, manifest); err != nil {
+		return fmt.Errorf("%w: %v", models.ErrUploadFailed, err)
+	}
+	metrics.UploadDuration.Observe(time.Since(start).Seconds())
+
+	w.log.InfoContext(ctx, "Output verified",
+		"videoId", run.job.VideoID,
+		"files", len(manifest.Files),
+		"totalBytes", manifest.TotalBytes(),
+	)
+	return nil
+}
+
+// publishStage completes the video, switching playback to this version, and
+// stores the derived assets. A failure to complete the video fails the job
+// so it is retried; the uploaded output is kept and not sent again.
+func (w *Worker) publishStage(ctx context.Context, run *jobRun) error {
+	job := run.job
+	run.playbackURL = models.PlaybackURL(w.cfg.AWS.CDNDomain, job.VideoID, job.Version)
+
+	output := models.OutputVersion{
+		Version: job.Version,
+		Profile: run.profile,
+		Presets: transcoder.ToModelPresets(run.presets),
+	}
+	if err := w.videos.CompleteVideoProcessing(ctx, job.VideoID, run.owner, run.playbackURL, run.hlsPrefix, output); err != nil {
+		if errors.Is(err, models.ErrLeaseNotHeld) || ctx.Err() != nil {
+			return err
+		}
+		return fmt.Errorf("failed to mark video as completed: %w", err)
+	}
+	w.deleteScratch(ctx, job)
+
+	if run.preview != nil {
+		if err := w.videos.UpdateVideoPreview(ctx, job.VideoID, *run.preview); err != nil {
+			w.log.WarnContext(ctx, "Failed to store preview locations",
+				"videoId", job.VideoID,
+				"error", err,
+			)
+		}
+	}
+
+	if run.analysis != nil {
+		if err := w.videos.UpdateVideoAnalysis(ctx, job.VideoID, *run.analysis); err != nil {
+			w.log.WarnContext(ctx, "Failed to store analysis summary",
+				"videoId", job.VideoID,
+				"error", err,
+			)
+		}
+	}
+	return nil
+}
+
+// recordStages stores stage records on the video. Recording is best effort
+// and survives the job context being cancelled, so the final records of a
+// cancelled or failed attempt are kept.
+func (w *Worker) recordStages(ctx context.Context, videoID, owner string, records []models.StageRun) {
+	ctx = context.WithoutCancel(ctx)
+	if err := w.videos.RecordStages(ctx, videoID, owner, records); err != nil {
+		w.log.WarnContext(ctx, "Failed to record pipeline stages", "videoId", videoID, "error", err)
+	}
+}
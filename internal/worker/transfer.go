@@ -0,0 +1,246 @@
+package worker
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/amillerrr/hls-pipeline/internal/config"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// partAttempts is how often one part of a transfer is tried before the
+// transfer fails.
+const partAttempts = 3
+
+// partRetryDelay is the pause before a part's next attempt, multiplied by
+// the number of attempts made so far.
+var partRetryDelay = 500 * time.Millisecond
+
+// TransferOptions tunes S3 transfers.
+type TransferOptions struct {
+	PartSize           int64 // Bytes per ranged GET or multipart upload part
+	PartConcurrency    int   // Parts in flight per file
+	UploadConcurrency  int   // Files uploaded at once
+	MultipartThreshold int64 // Files at least this large are uploaded in parts
+}
+
+// NewTransferOptions returns the transfer options of a worker
+// configuration, using the defaults for unset values.
+func NewTransferOptions(cfg config.WorkerConfig) TransferOptions {
+	orDefault := func(v, def int) int {
+		if v > 0 {
+			return v
+		}
+		return def
+	}
+	const mb = 1 << 20
+	return TransferOptions{
+		PartSize:           int64(orDefault(cfg.TransferPartSizeMB, config.DefaultTransferPartSizeMB)) * mb,
+		PartConcurrency:    orDefault(cfg.PartConcurrency, config.DefaultPartConcurrency),
+		UploadConcurrency:  orDefault(cfg.UploadConcurrency, config.DefaultUploadConcurrency),
+		MultipartThreshold: int64(orDefault(cfg.MultipartThresholdMB, config.DefaultMultipartThresholdMB)) * mb,
+	}
+}
+
+// byteRange is one part of a file or object.
+type byteRange struct {
+	off int64
+	n   int64
+}
+
+// header returns the part as an HTTP Range header value.
+func (r byteRange) header() string {
+	return fmt.Sprintf("bytes=%d-%d", r.off, r.off+r.n-1)
+}
+
+// partRanges splits size bytes into parts of partSize; the last part holds
+// the remainder.
+func partRanges(size, partSize int64) []byteRange {
+	var parts []byteRange
+	for off := int64(0); off < size; off += partSize {
+		parts = append(parts, byteRange{off: off, n: min(partSize, size-off)})
+	}
+	return parts
+}
+
+// forEachPart calls fn for every part with at most concurrency calls
+// running at once. Once a call fails no more parts are started, the
+// context passed to running calls is cancelled and the first error is
+// returned.
+func forEachPart(ctx context.Context, parts []byteRange, concurrency int, fn func(ctx context.Context, i int, part byteRange) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	for i, part := range parts {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int, part byteRange) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := fn(ctx, i, part); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}(i, part)
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// retryPart runs fn until it succeeds, fails permanently or has been tried
+// partAttempts times.
+func retryPart(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= partAttempts || classifyError(err) != models.ErrorClassTransient {
+			return err
+		}
+
+		timer := time.NewTimer(partRetryDelay * time.Duration(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// etagParts returns the number of parts in a multipart upload's ETag, or
+// 0 for an object stored with a single PUT.
+func etagParts(etag string) int {
+	_, count, ok := strings.Cut(strings.Trim(etag, `"`), "-")
+	if !ok {
+		return 0
+	}
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+// fileETag computes the ETag S3 gives a file's content when unencrypted or
+// stored with SSE-S3: the MD5 of the content for a single PUT and the MD5
+// of the parts' MD5s, with the part count appended, for a multipart upload
+// in parts of partSize.
+func fileETag(path string, multipart bool, partSize int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if !multipart {
+		hash := md5.New()
+		if _, err := io.Copy(hash, file); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	if partSize <= 0 {
+		return "", errors.New("multipart ETag needs a part size")
+	}
+	sums := md5.New()
+	parts := 0
+	for {
+		hash := md5.New()
+		n, err := io.CopyN(hash, file, partSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n == 0 && parts > 0 {
+			break
+		}
+		sums.Write(hash.Sum(nil))
+		parts++
+		if n < partSize {
+			break
+		}
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), parts), nil
+}
+
+// fileChecksums computes the SHA-256 of a file's content as a hex digest
+// and the SHA-256 checksum S3 stores for it: the base64 digest for a single
+// PUT, or for a multipart upload in parts of partSize the base64 digest of
+// the part digests with the part count appended.
+func fileChecksums(path string, multipart bool, partSize int64) (sum, checksum string, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	whole := sha256.New()
+	if !multipart {
+		if _, err := io.Copy(whole, file); err != nil {
+			return "", "", err
+		}
+		digest := whole.Sum(nil)
+		return hex.EncodeToString(digest), base64.StdEncoding.EncodeToString(digest), nil
+	}
+
+	if partSize <= 0 {
+		return "", "", errors.New("multipart checksum needs a part size")
+	}
+	sums := sha256.New()
+	parts := 0
+	for {
+		hash := sha256.New()
+		n, err := io.CopyN(io.MultiWriter(hash, whole), file, partSize)
+		if err != nil && err != io.EOF {
+			return "", "", err
+		}
+		if n == 0 && parts > 0 {
+			break
+		}
+		sums.Write(hash.Sum(nil))
+		parts++
+		if n < partSize {
+			break
+		}
+	}
+	checksum = fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(sums.Sum(nil)), parts)
+	return hex.EncodeToString(whole.Sum(nil)), checksum, nil
+}
+
+// matchesETag reports whether a local file has the content of an object
+// with the given ETag. partSize is the object's part size if it was stored
+// with a multipart upload.
+func matchesETag(path, etag string, partSize int64) bool {
+	etag = strings.Trim(etag, `"`)
+	got, err := fileETag(path, etagParts(etag) > 0, partSize)
+	return err == nil && got == etag
+}
@@ -1,55 +1,77 @@
 package worker
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/internal/storage"
 	"github.com/amillerrr/hls-pipeline/pkg/models"
 )
 
-// Upload configuration
-const (
-	MaxConcurrentUploads = 20
-)
-
-// Uploader handles uploading HLS files to S3.
+// Uploader handles uploading HLS files to object storage.
 type Uploader struct {
-	s3Client *s3.Client
-	bucket   string
-	log      *slog.Logger
+	objects storage.ObjectStore
+	bucket  string
+	opts    TransferOptions
+	log     *slog.Logger
 }
 
 // NewUploader creates a new Uploader.
-func NewUploader(s3Client *s3.Client, bucket string, log *slog.Logger) *Uploader {
+func NewUploader(objects storage.ObjectStore, bucket string, opts TransferOptions, log *slog.Logger) *Uploader {
 	return &Uploader{
-		s3Client: s3Client,
-		bucket:   bucket,
-		log:      log,
+		objects: objects,
+		bucket:  bucket,
+		opts:    opts,
+		log:     log,
 	}
 }
 
-// Upload uploads all HLS files to S3.
-func (u *Uploader) Upload(ctx context.Context, videoID, hlsDir string) error {
+// Upload uploads the HLS files in hlsDir to object storage under prefix and
+// returns their manifest entries, sorted by path. If paths are given only
+// those files and directories, relative to hlsDir, are uploaded. Every file
+// is sent with its SHA-256 checksum, which the store checks and keeps.
+// Files already stored under prefix with the same content and a checksum
+// are not sent again, so a retried upload only sends what is missing. Files
+// of at least the multipart threshold are uploaded in parts if the store
+// supports it.
+func (u *Uploader) Upload(ctx context.Context, prefix, hlsDir string, paths ...string) ([]models.ManifestFile, error) {
 	ctx, span := tracer.Start(ctx, "upload-hls")
 	defer span.End()
 
+	start := time.Now()
+
+	existing, err := u.listObjects(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
 	// Atomic counters for thread safety
 	var filesUploaded atomic.Int64
+	var filesSkipped atomic.Int64
 	var totalBytes atomic.Int64
 	var firstErr atomic.Pointer[error]
 
+	var filesMu sync.Mutex
+	var files []models.ManifestFile
+
 	// Concurrency control
-	sem := make(chan struct{}, MaxConcurrentUploads)
+	sem := make(chan struct{}, u.opts.UploadConcurrency)
 	var wg sync.WaitGroup
 
 	walkErr := filepath.Walk(hlsDir, func(path string, info os.FileInfo, err error) error {
@@ -60,8 +82,16 @@ func (u *Uploader) Upload(ctx context.Context, videoID, hlsDir string) error {
 			return nil
 		}
 
-		// Skip temporary files (like SSIM frames)
-		if strings.HasSuffix(path, ".png") {
+		if skipUpload(path) {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(hlsDir, path)
+		if err != nil {
+			return fmt.Errorf("failed to get relative path: %w", err)
+		}
+		relPath = filepath.ToSlash(relPath)
+		if !includesPath(paths, relPath) {
 			return nil
 		}
 
@@ -79,7 +109,7 @@ func (u *Uploader) Upload(ctx context.Context, videoID, hlsDir string) error {
 
 		wg.Add(1)
 
-		go func(filePath string, fileInfo os.FileInfo) {
+		go func(filePath, s3Key string, fileInfo os.FileInfo) {
 			defer wg.Done()
 			defer func() { <-sem }()
 
@@ -88,35 +118,28 @@ func (u *Uploader) Upload(ctx context.Context, videoID, hlsDir string) error {
 				return
 			}
 
-			// Calculate S3 key
-			relPath, err := filepath.Rel(hlsDir, filePath)
+			sum, checksum, err := fileChecksums(filePath, u.multipart(fileInfo.Size()), u.opts.PartSize)
 			if err != nil {
-				wrappedErr := fmt.Errorf("failed to get relative path: %w", err)
+				wrappedErr := fmt.Errorf("failed to checksum %s: %w", filePath, err)
 				firstErr.CompareAndSwap(nil, &wrappedErr)
 				return
 			}
-			s3Key := fmt.Sprintf("hls/%s/%s", videoID, relPath)
+			filesMu.Lock()
+			files = append(files, models.ManifestFile{
+				Path:     strings.TrimPrefix(s3Key, prefix),
+				Size:     fileInfo.Size(),
+				SHA256:   sum,
+				Checksum: checksum,
+			})
+			filesMu.Unlock()
 
-			// Open file
-			file, err := os.Open(filePath)
-			if err != nil {
-				wrappedErr := fmt.Errorf("failed to open file %s: %w", filePath, err)
-				firstErr.CompareAndSwap(nil, &wrappedErr)
+			if obj, ok := existing[s3Key]; ok && obj.Size == fileInfo.Size() && obj.HasSHA256 &&
+				matchesETag(filePath, obj.ETag, u.opts.PartSize) {
+				filesSkipped.Add(1)
 				return
 			}
-			defer file.Close()
 
-			// Determine content type
-			contentType := u.getContentType(filePath)
-
-			// Upload to S3
-			_, err = u.s3Client.PutObject(ctx, &s3.PutObjectInput{
-				Bucket:      aws.String(u.bucket),
-				Key:         aws.String(s3Key),
-				Body:        file,
-				ContentType: aws.String(contentType),
-			})
-			if err != nil {
+			if err := u.putFile(ctx, filePath, s3Key, fileInfo.Size(), checksum); err != nil {
 				wrappedErr := fmt.Errorf("failed to upload %s: %w", s3Key, err)
 				firstErr.CompareAndSwap(nil, &wrappedErr)
 				return
@@ -128,7 +151,7 @@ func (u *Uploader) Upload(ctx context.Context, videoID, hlsDir string) error {
 
 			u.log.DebugContext(ctx, "Uploaded file", "key", s3Key)
 
-		}(path, info)
+		}(path, prefix+relPath, info)
 
 		return nil
 	})
@@ -138,31 +161,216 @@ func (u *Uploader) Upload(ctx context.Context, videoID, hlsDir string) error {
 
 	// Check for walk errors
 	if walkErr != nil {
-		return walkErr
+		return nil, walkErr
 	}
 
 	// Check for async upload errors
 	if errPtr := firstErr.Load(); errPtr != nil {
-		return *errPtr
+		return nil, *errPtr
 	}
 
 	uploaded := filesUploaded.Load()
+	skipped := filesSkipped.Load()
 	bytes := totalBytes.Load()
+	if elapsed := time.Since(start).Seconds(); bytes > 0 && elapsed > 0 {
+		metrics.UploadThroughput.Observe(float64(bytes) / elapsed)
+	}
+	metrics.UploadBytes.Add(float64(bytes))
 
 	span.SetAttributes(
 		attribute.Int64("files.uploaded", uploaded),
+		attribute.Int64("files.skipped", skipped),
 		attribute.Int64("bytes.total", bytes),
 	)
 
 	u.log.InfoContext(ctx, "HLS upload complete",
-		"videoId", videoID,
+		"prefix", prefix,
 		"filesUploaded", uploaded,
+		"filesSkipped", skipped,
 		"totalBytes", bytes,
 	)
 
+	slices.SortFunc(files, func(a, b models.ManifestFile) int { return strings.Compare(a.Path, b.Path) })
+	return files, nil
+}
+
+// multipart reports whether a file of size bytes is uploaded in parts.
+func (u *Uploader) multipart(size int64) bool {
+	_, ok := u.objects.(storage.MultipartStore)
+	return ok && size >= u.opts.MultipartThreshold
+}
+
+// putFile uploads one file with its stored checksum, in parts if it is at
+// least the multipart threshold.
+func (u *Uploader) putFile(ctx context.Context, path, key string, size int64, checksum string) error {
+	if u.multipart(size) {
+		return u.putMultipart(ctx, u.objects.(storage.MultipartStore), path, key, size)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	return u.objects.Put(ctx, u.bucket, key, file, storage.PutOptions{
+		ContentType:    u.getContentType(path),
+		ChecksumSHA256: checksum,
+	})
+}
+
+// putMultipart uploads a file as a multipart upload, sending parts in
+// parallel. Each part carries its SHA-256 so S3 rejects corrupted parts,
+// and is retried on its own. A failed upload is aborted so its parts are
+// not kept.
+func (u *Uploader) putMultipart(ctx context.Context, store storage.MultipartStore, path, key string, size int64) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	uploadID, err := store.CreateMultipart(ctx, u.bucket, key, storage.PutOptions{ContentType: u.getContentType(path)})
+	if err != nil {
+		return fmt.Errorf("failed to start multipart upload: %w", err)
+	}
+
+	parts := partRanges(size, u.opts.PartSize)
+	completed := make([]storage.CompletedPart, len(parts))
+	err = forEachPart(ctx, parts, u.opts.PartConcurrency, func(ctx context.Context, i int, part byteRange) error {
+		number := int32(i + 1)
+		return retryPart(ctx, func() error {
+			body := io.NewSectionReader(file, part.off, part.n)
+			hash := sha256.New()
+			if _, err := io.Copy(hash, body); err != nil {
+				return fmt.Errorf("failed to read part %d: %w", i+1, err)
+			}
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+
+			checksum := base64.StdEncoding.EncodeToString(hash.Sum(nil))
+			etag, err := store.PutPart(ctx, u.bucket, key, uploadID, number, body, part.n, checksum)
+			if err != nil {
+				return fmt.Errorf("failed to upload part %d: %w", i+1, err)
+			}
+			completed[i] = storage.CompletedPart{Number: number, ETag: etag, ChecksumSHA256: checksum}
+			return nil
+		})
+	})
+	if err == nil {
+		if err = store.CompleteMultipart(ctx, u.bucket, key, uploadID, completed); err != nil {
+			err = fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+	}
+	if err != nil {
+		if abortErr := store.AbortMultipart(context.WithoutCancel(ctx), u.bucket, key, uploadID); abortErr != nil {
+			u.log.WarnContext(ctx, "Failed to abort multipart upload", "key", key, "error", abortErr)
+		}
+		return err
+	}
+
+	u.log.DebugContext(ctx, "Uploaded file in parts", "key", key, "parts", len(parts))
+	return nil
+}
+
+// VerifyUpload checks with a HEAD request that every file in manifest is
+// stored under prefix with its size and checksum, so a version is only
+// published once all of its output is in place and intact.
+func (u *Uploader) VerifyUpload(ctx context.Context, prefix string, manifest *models.Manifest) error {
+	ctx, span := tracer.Start(ctx, "verify-hls-upload")
+	defer span.End()
+
+	problems, err := storage.VerifyManifest(ctx, u.objects, u.bucket, prefix, manifest, u.opts.UploadConcurrency, false)
+	if err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%d files failed verification, including %s: %s", len(problems), problems[0].Path, problems[0].Problem)
+	}
+
+	span.SetAttributes(
+		attribute.String("prefix", prefix),
+		attribute.Int("files.verified", len(manifest.Files)),
+	)
+	return nil
+}
+
+// PutManifest stores manifest at the root of prefix.
+func (u *Uploader) PutManifest(ctx context.Context, prefix string, manifest *models.Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	digest := sha256.Sum256(data)
+
+	err = u.objects.Put(ctx, u.bucket, prefix+models.ManifestFilename, bytes.NewReader(data), storage.PutOptions{
+		ContentType:    "application/json",
+		ChecksumSHA256: base64.StdEncoding.EncodeToString(digest[:]),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to store manifest: %w", err)
+	}
 	return nil
 }
 
+// listObjects returns every object stored under prefix by key.
+func (u *Uploader) listObjects(ctx context.Context, prefix string) (map[string]storage.ObjectInfo, error) {
+	list, err := u.objects.List(ctx, u.bucket, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	objects := make(map[string]storage.ObjectInfo, len(list))
+	for _, obj := range list {
+		objects[obj.Key] = obj
+	}
+	return objects, nil
+}
+
+// includesPath reports whether the slash-separated relative path is one of
+// paths or lies under one of them. Every path is included if paths is empty.
+func includesPath(paths []string, relPath string) bool {
+	if len(paths) == 0 {
+		return true
+	}
+	for _, p := range paths {
+		p = strings.TrimSuffix(p, "/")
+		if relPath == p || strings.HasPrefix(relPath, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// skipUpload reports whether a local output file is temporary (like SSIM
+// frames) and not uploaded.
+func skipUpload(path string) bool {
+	return strings.HasSuffix(path, ".png")
+}
+
+// DeletePrefix removes every object under prefix, such as the partial output
+// of a cancelled job. It returns the number of objects deleted.
+func (u *Uploader) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	ctx, span := tracer.Start(ctx, "delete-hls-prefix")
+	defer span.End()
+
+	objects, err := u.objects.List(ctx, u.bucket, prefix)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list %s: %w", prefix, err)
+	}
+	keys := make([]string, len(objects))
+	for i, obj := range objects {
+		keys[i] = obj.Key
+	}
+	if err := u.objects.Delete(ctx, u.bucket, keys...); err != nil {
+		return 0, fmt.Errorf("failed to delete objects under %s: %w", prefix, err)
+	}
+	deleted := len(keys)
+
+	span.SetAttributes(attribute.Int("files.deleted", deleted))
+	return deleted, nil
+}
+
 // getContentType returns the appropriate content type for the file.
 func (u *Uploader) getContentType(filePath string) string {
 	switch {
@@ -170,6 +378,12 @@ func (u *Uploader) getContentType(filePath string) string {
 		return "application/vnd.apple.mpegurl"
 	case strings.HasSuffix(filePath, ".ts"):
 		return "video/MP2T"
+	case strings.HasSuffix(filePath, ".json"):
+		return "application/json"
+	case strings.HasSuffix(filePath, ".webp"):
+		return "image/webp"
+	case strings.HasSuffix(filePath, ".mp4"):
+		return "video/mp4"
 	default:
 		return "application/octet-stream"
 	}
@@ -0,0 +1,143 @@
+package worker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/amillerrr/hls-pipeline/internal/transcoder"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+// Container families recognised by magic-byte sniffing.
+const (
+	ContainerISOBMFF  = "isobmff" // MP4, MOV
+	ContainerMatroska = "matroska"
+	ContainerAVI      = "avi"
+)
+
+// sniffHeaderSize is the number of leading bytes inspected by SniffContainer.
+const sniffHeaderSize = 16
+
+// isobmffBoxTypes are top-level box types that may open an MP4/MOV file.
+var isobmffBoxTypes = map[string]bool{
+	"ftyp": true,
+	"moov": true,
+	"mdat": true,
+	"free": true,
+	"skip": true,
+	"wide": true,
+	"pnot": true,
+}
+
+// InputLimits bounds what the worker will accept for transcoding.
+type InputLimits struct {
+	MaxDurationSeconds float64
+	MaxWidth           int
+	MaxHeight          int
+}
+
+// SniffContainer identifies the container family from the file's magic bytes.
+func SniffContainer(path string) (string, error) {
+	header, err := readHeader(path)
+	if err != nil {
+		return "", err
+	}
+	return sniffHeader(header), nil
+}
+
+// readHeader returns up to sniffHeaderSize leading bytes of a file.
+func readHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input: %w", err)
+	}
+	defer f.Close()
+
+	header := make([]byte, sniffHeaderSize)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("failed to read input header: %w", err)
+	}
+	return header[:n], nil
+}
+
+// sniffHeader matches a file header against known container signatures.
+func sniffHeader(header []byte) string {
+	switch {
+	case len(header) >= 8 && isobmffBoxTypes[string(header[4:8])]:
+		return ContainerISOBMFF
+	case len(header) >= 4 && bytes.Equal(header[:4], []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return ContainerMatroska
+	case len(header) >= 12 && string(header[:4]) == "RIFF" && string(header[8:12]) == "AVI ":
+		return ContainerAVI
+	}
+	return ""
+}
+
+// ValidateInput checks a downloaded file before it is handed to FFmpeg. It
+// returns a *models.RejectionError describing the first failed check.
+func ValidateInput(path string, probe *transcoder.ProbeResult, probeErr error, limits InputLimits) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat input: %w", err)
+	}
+
+	header, err := readHeader(path)
+	if err != nil {
+		return err
+	}
+
+	return ValidateSource(header, info.Size(), probe, probeErr, limits)
+}
+
+// ValidateSource is ValidateInput for an input read in place, given its
+// size and leading bytes.
+func ValidateSource(header []byte, size int64, probe *transcoder.ProbeResult, probeErr error, limits InputLimits) error {
+	if size == 0 {
+		return models.NewRejection(models.RejectEmptyFile, "uploaded file is empty")
+	}
+
+	if sniffHeader(header) == "" {
+		return models.NewRejection(models.RejectUnsupportedContainer, "file is not a supported video container (mp4, mov, mkv, webm, avi)")
+	}
+
+	if probeErr != nil {
+		// Only a non-zero ffprobe exit says anything about the file itself
+		var exitErr *exec.ExitError
+		if !errors.As(probeErr, &exitErr) {
+			return fmt.Errorf("failed to probe input: %w", probeErr)
+		}
+		return models.NewRejection(models.RejectCorruptInput, "file could not be read as video")
+	}
+	if probe == nil {
+		return models.NewRejection(models.RejectCorruptInput, "file could not be read as video")
+	}
+
+	return ValidateProbe(probe, limits)
+}
+
+// ValidateProbe enforces stream and size limits on probe data.
+func ValidateProbe(probe *transcoder.ProbeResult, limits InputLimits) error {
+	if probe.Video == nil || probe.Video.Width <= 0 || probe.Video.Height <= 0 {
+		return models.NewRejection(models.RejectNoVideoStream, "file contains no video stream")
+	}
+
+	if limits.MaxDurationSeconds > 0 && probe.DurationSeconds > limits.MaxDurationSeconds {
+		return models.NewRejection(models.RejectDurationExceeded,
+			"duration %.0fs exceeds the %.0fs limit", probe.DurationSeconds, limits.MaxDurationSeconds)
+	}
+
+	// Compare orientation-independently so portrait sources are not penalised
+	long, short := max(probe.Video.Width, probe.Video.Height), min(probe.Video.Width, probe.Video.Height)
+	maxLong, maxShort := max(limits.MaxWidth, limits.MaxHeight), min(limits.MaxWidth, limits.MaxHeight)
+	if maxShort > 0 && (long > maxLong || short > maxShort) {
+		return models.NewRejection(models.RejectResolutionExceeded,
+			"resolution %dx%d exceeds the %dx%d limit", probe.Video.Width, probe.Video.Height, limits.MaxWidth, limits.MaxHeight)
+	}
+
+	return nil
+}
@@ -3,52 +3,54 @@ package worker
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
 	"github.com/amillerrr/hls-pipeline/internal/config"
 	"github.com/amillerrr/hls-pipeline/internal/metrics"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
 	"github.com/amillerrr/hls-pipeline/internal/storage"
 	"github.com/amillerrr/hls-pipeline/internal/transcoder"
 	"github.com/amillerrr/hls-pipeline/pkg/models"
 )
 
-// SQS configuration constants
+// Queue configuration constants
 const (
-	SQSMaxMessages       = 1
-	SQSWaitTimeSeconds   = 20
-	SQSVisibilityTimeout = 900 // 15 minutes
-	RetryBackoffPeriod   = 5 * time.Second
+	QueueMaxMessages   = 1
+	QueueLease         = 15 * time.Minute
+	RetryBackoffPeriod = 5 * time.Second
 )
 
 var tracer = otel.Tracer("hls-worker")
 
-// Worker handles video processing jobs from SQS.
+// Worker handles video processing jobs from the job queue.
 type Worker struct {
-	s3Client    *s3.Client
-	sqsClient   *sqs.Client
-	videoRepo   *storage.VideoRepository
+	objects     storage.ObjectStore
+	queue       queue.Consumer
+	publisher   queue.DelayedLanePublisher
+	videos      storage.VideoStore
 	transcoder  *transcoder.Transcoder
 	downloader  *Downloader
 	uploader    *Uploader
+	pipeline    *pipeline
+	admission   *diskAdmission
 	cfg         *config.Config
 	log         *slog.Logger
 }
 
 // Config holds worker dependencies.
 type Config struct {
-	S3Client   *s3.Client
-	SQSClient  *sqs.Client
-	VideoRepo  *storage.VideoRepository
+	Objects    storage.ObjectStore
+	Queue      queue.Consumer
+	Publisher  queue.DelayedLanePublisher // Optional; republishes jobs handed back untried
+	Videos     storage.VideoStore
 	Transcoder *transcoder.Transcoder
 	AppConfig  *config.Config
 	Logger     *slog.Logger
@@ -56,114 +58,179 @@ type Config struct {
 
 // New creates a new Worker with the given configuration.
 func New(cfg *Config) *Worker {
-	return &Worker{
-		s3Client:   cfg.S3Client,
-		sqsClient:  cfg.SQSClient,
-		videoRepo:  cfg.VideoRepo,
+	transfers := NewTransferOptions(cfg.AppConfig.Worker)
+	w := &Worker{
+		objects:    cfg.Objects,
+		queue:      cfg.Queue,
+		publisher:  cfg.Publisher,
+		videos:     cfg.Videos,
 		transcoder: cfg.Transcoder,
-		downloader: NewDownloader(cfg.S3Client, cfg.Logger),
-		uploader:   NewUploader(cfg.S3Client, cfg.AppConfig.AWS.ProcessedBucket, cfg.Logger),
+		downloader: NewDownloader(cfg.Objects, transfers, cfg.Logger),
+		uploader:   NewUploader(cfg.Objects, cfg.AppConfig.AWS.ProcessedBucket, transfers, cfg.Logger),
+		admission:  newDiskAdmission(uint64(cfg.AppConfig.Worker.MinFreeDiskMB) << 20),
 		cfg:        cfg.AppConfig,
 		log:        cfg.Logger,
 	}
+	stageTimeout := time.Duration(cfg.AppConfig.Worker.StageTimeoutSeconds) * time.Second
+	if stageTimeout <= 0 {
+		stageTimeout = config.DefaultStageTimeoutSeconds * time.Second
+	}
+	w.pipeline = mustPipeline(withDefaultTimeout(w.stages(), stageTimeout))
+	return w
 }
 
-// Run starts the worker and blocks until the context is cancelled.
+// Run starts the worker and blocks until the context is cancelled. On
+// cancellation it stops receiving and drains in-progress jobs; see drain.
 func (w *Worker) Run(ctx context.Context) {
 	w.log.InfoContext(ctx, "Starting queue polling",
-		"queueURL", w.cfg.AWS.SQSQueueURL,
+		"backend", w.cfg.Queue.Backend,
 		"maxConcurrent", w.cfg.Worker.MaxConcurrentJobs,
 	)
 
 	sem := make(chan struct{}, w.cfg.Worker.MaxConcurrentJobs)
 	var wg sync.WaitGroup
 
+	// Jobs outlive ctx so they can finish during the drain grace period
+	jobsCtx, cancelJobs := context.WithCancelCause(context.WithoutCancel(ctx))
+	defer cancelJobs(nil)
+
 messageLoop:
-	for {
-		select {
-		case <-ctx.Done():
-			w.log.InfoContext(ctx, "Waiting for in-progress jobs to complete...")
-			wg.Wait()
-			w.log.InfoContext(ctx, "All jobs completed, shutting down")
-			return
-		default:
-		}
+	for ctx.Err() == nil {
+		w.admission.wait(ctx, AdmissionRetryDelay)
 
 		// Receive messages
-		result, err := w.sqsClient.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
-			QueueUrl:            aws.String(w.cfg.AWS.SQSQueueURL),
-			MaxNumberOfMessages: SQSMaxMessages,
-			WaitTimeSeconds:     SQSWaitTimeSeconds,
-			VisibilityTimeout:   SQSVisibilityTimeout,
-		})
+		messages, err := w.queue.Receive(ctx, QueueMaxMessages, QueueLease)
 		if err != nil {
 			if ctx.Err() != nil {
-				continue // Shutting down
+				break // Shutting down
 			}
 			w.log.ErrorContext(ctx, "Failed to receive messages", "error", err)
 			time.Sleep(RetryBackoffPeriod)
 			continue
 		}
 
-		for _, msg := range result.Messages {
+		for i, msg := range messages {
 			select {
 			case sem <- struct{}{}:
 				wg.Add(1)
-				go func(msg types.Message) {
+				go func(msg *queue.Message) {
 					defer wg.Done()
 					defer func() { <-sem }()
-
-					metrics.ActiveJobs.Inc()
-					defer metrics.ActiveJobs.Dec()
-
-					if err := w.processMessage(ctx, msg); err != nil {
-						w.log.ErrorContext(ctx, "Failed to process message",
-							"error", err,
-							"messageId", safeStringDeref(msg.MessageId),
-						)
-						metrics.RecordFailure()
-					} else {
-						// Delete message on success
-						_, delErr := w.sqsClient.DeleteMessage(ctx, &sqs.DeleteMessageInput{
-							QueueUrl:      aws.String(w.cfg.AWS.SQSQueueURL),
-							ReceiptHandle: msg.ReceiptHandle,
-						})
-						if delErr != nil {
-							w.log.ErrorContext(ctx, "Failed to delete message", "error", delErr)
-						}
-						metrics.RecordSuccess()
-					}
+					w.runJob(jobsCtx, msg)
 				}(msg)
 			case <-ctx.Done():
 				w.log.InfoContext(ctx, "Context cancelled, stopping message processing")
+				for _, unstarted := range messages[i:] {
+					w.returnToQueue(jobsCtx, unstarted, nil, "")
+				}
 				break messageLoop
 			}
 		}
 	}
+
+	w.drain(jobsCtx, &wg, time.Duration(w.cfg.Worker.DrainTimeoutSeconds)*time.Second, cancelJobs)
 }
 
-func safeStringDeref(s *string) string {
-	if s == nil {
-		return ""
+// runJob processes one message and settles it according to the outcome.
+func (w *Worker) runJob(ctx context.Context, msg *queue.Message) {
+	metrics.ActiveJobs.Inc()
+	defer metrics.ActiveJobs.Dec()
+
+	// Keep the message hidden for as long as the job runs
+	jobCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stopLease := w.keepLease(jobCtx, msg, LeaseRenewInterval, QueueLease, cancel)
+
+	owner := w.leaseOwner()
+	job, err := w.processMessage(jobCtx, msg, owner)
+	stopLease()
+
+	// Settlement must survive the drain cancelling the job context
+	ctx = context.WithoutCancel(ctx)
+
+	switch {
+	case errors.Is(context.Cause(jobCtx), queue.ErrLeaseLost), errors.Is(err, models.ErrLeaseNotHeld):
+		// Another worker owns the job now; leave its message and record alone
+		return
+	case errors.Is(context.Cause(jobCtx), errDraining):
+		w.returnToQueue(ctx, msg, job, owner)
+		return
+	case errors.Is(err, models.ErrVideoAlreadyCompleted):
+		w.log.InfoContext(ctx, "Video already completed, dropping duplicate job", "messageId", msg.ID)
+		w.ackMessage(ctx, msg)
+		return
+	case errors.Is(err, models.ErrVideoCancelled):
+		w.log.InfoContext(ctx, "Video cancelled, dropping job", "messageId", msg.ID)
+		w.ackMessage(ctx, msg)
+		return
+	case errors.Is(err, models.ErrVideoNotFound):
+		w.log.WarnContext(ctx, "Video not found, dropping job", "messageId", msg.ID)
+		w.ackMessage(ctx, msg)
+		return
+	case errors.Is(err, models.ErrStaleJob):
+		w.log.InfoContext(ctx, "Newer version allocated, dropping stale job", "messageId", msg.ID, "error", err)
+		w.ackMessage(ctx, msg)
+		return
+	case errors.Is(err, errInsufficientDisk):
+		// Not claimed yet; another worker, or this one once running jobs
+		// finish, may have room. A new message keeps the deferral from
+		// using up the job's deliveries, up to MaxDeferrals.
+		w.log.InfoContext(ctx, "Deferring job until disk space frees up",
+			"messageId", msg.ID,
+			"deferrals", job.Deferrals,
+			"reason", err,
+		)
+		if job.Deferrals < MaxDeferrals && w.republishDeferred(ctx, msg, job) {
+			return
+		}
+		if nackErr := w.queue.Nack(ctx, msg, AdmissionRetryDelay); nackErr != nil {
+			w.log.ErrorContext(ctx, "Failed to delay message", "error", nackErr)
+		}
+		return
+	case errors.Is(err, models.ErrLeaseHeld):
+		// Try again once the current holder has finished or its lease lapsed
+		w.log.InfoContext(ctx, "Video is being processed by another worker", "messageId", msg.ID)
+		if nackErr := w.queue.Nack(ctx, msg, retryBackoff(msg.ReceiveCount)); nackErr != nil {
+			w.log.ErrorContext(ctx, "Failed to delay message", "error", nackErr)
+		}
+		return
+	case err != nil:
+		w.handleFailure(ctx, msg, job, owner, err)
+		return
 	}
-	return *s
+
+	// Acknowledge message on success
+	w.ackMessage(ctx, msg)
+	metrics.RecordSuccess()
 }
 
-func (w *Worker) processMessage(ctx context.Context, msg types.Message) error {
+// inputLimits returns the configured limits for incoming videos.
+func (w *Worker) inputLimits() InputLimits {
+	return InputLimits{
+		MaxDurationSeconds: float64(w.cfg.Worker.MaxInputDurationSeconds),
+		MaxWidth:           w.cfg.Worker.MaxInputWidth,
+		MaxHeight:          w.cfg.Worker.MaxInputHeight,
+	}
+}
+
+// processMessage parses and processes a single message, claiming its video
+// as owner. The parsed job is returned alongside any error so failures can
+// be recorded against the video.
+func (w *Worker) processMessage(ctx context.Context, msg *queue.Message, owner string) (*models.VideoJob, error) {
 	ctx, span := tracer.Start(ctx, "process-message")
 	defer span.End()
 
-	if msg.Body == nil {
-		return fmt.Errorf("%w: empty message body", models.ErrJobParseFailed)
+	if msg.Body == "" {
+		return nil, fmt.Errorf("%w: empty message body", models.ErrJobParseFailed)
 	}
 
 	var job models.VideoJob
-	if err := json.Unmarshal([]byte(*msg.Body), &job); err != nil {
-		return fmt.Errorf("%w: %v", models.ErrJobParseFailed, err)
+	if err := json.Unmarshal([]byte(msg.Body), &job); err != nil {
+		return nil, fmt.Errorf("%w: %v", models.ErrJobParseFailed, err)
 	}
 
 	if err := job.Validate(); err != nil {
-		return fmt.Errorf("%w: %v", models.ErrJobParseFailed, err)
+		return nil, fmt.Errorf("%w: %v", models.ErrJobParseFailed, err)
 	}
 
 	span.SetAttributes(
@@ -172,115 +239,347 @@ func (w *Worker) processMessage(ctx context.Context, msg types.Message) error {
 		attribute.String("video.filename", job.Filename),
 	)
 
-	return w.processVideo(ctx, &job)
+	release, err := w.admit(ctx, &job, msg.ReceiveCount)
+	if err != nil {
+		return &job, err
+	}
+	defer release()
+
+	if err := w.processVideo(ctx, &job, msg.ReceiveCount, owner); err != nil {
+		span.RecordError(err)
+		return &job, err
+	}
+	return &job, nil
 }
 
-func (w *Worker) processVideo(ctx context.Context, job *models.VideoJob) error {
-	w.log.InfoContext(ctx, "Processing video",
-		"videoId", job.VideoID,
-		"s3Key", job.S3Key,
-		"filename", job.Filename,
+// handleFailure records a failed job and decides what happens to its message.
+// Permanent failures are deleted immediately; transient ones are retried with
+// exponential backoff until the final delivery, which is left for the
+// redrive policy to move to the DLQ. owner is the job's lease token.
+func (w *Worker) handleFailure(ctx context.Context, msg *queue.Message, job *models.VideoJob, owner string, err error) {
+	// Bookkeeping must survive shutdown cancelling the job context
+	ctx = context.WithoutCancel(ctx)
+
+	class := classifyError(err)
+	attempt := msg.ReceiveCount
+	metrics.RecordFailure(string(class))
+
+	w.log.ErrorContext(ctx, "Failed to process message",
+		"error", err,
+		"class", class,
+		"attempt", attempt,
+		"messageId", msg.ID,
 	)
 
-	// Update status to processing
-	if err := w.videoRepo.UpdateVideoProcessing(ctx, job.VideoID); err != nil {
-		w.log.WarnContext(ctx, "Failed to update video status to processing",
-			"videoId", job.VideoID,
-			"error", err,
-		)
+	finalAttempt := attempt >= w.cfg.Worker.MaxReceiveCount
+
+	if job != nil {
+		var recordErr error
+		var rejection *models.RejectionError
+		switch {
+		case errors.As(err, &rejection):
+			recordErr = w.videos.RejectVideo(ctx, job.VideoID, owner, rejection.Code, rejection.Reason)
+		case class == models.ErrorClassPermanent || finalAttempt:
+			recordErr = w.videos.FailVideoProcessing(ctx, job.VideoID, owner, err.Error(), class)
+		default:
+			recordErr = w.videos.RetryVideoProcessing(ctx, job.VideoID, owner, err.Error(), class)
+		}
+		if recordErr != nil {
+			w.log.ErrorContext(ctx, "Failed to record video failure",
+				"videoId", job.VideoID,
+				"error", recordErr,
+			)
+		} else if class == models.ErrorClassPermanent || finalAttempt {
+			w.discardOutput(ctx, job)
+		}
 	}
 
-	// Track processing error for deferred failure handling
-	var processingErr error
-	defer func() {
-		if processingErr != nil {
-			if failErr := w.videoRepo.FailVideoProcessing(ctx, job.VideoID, processingErr.Error()); failErr != nil {
-				w.log.ErrorContext(ctx, "Failed to mark video as failed",
-					"videoId", job.VideoID,
-					"error", failErr,
-				)
-			}
+	switch {
+	case class == models.ErrorClassPermanent:
+		w.ackMessage(ctx, msg)
+	case finalAttempt:
+		// Leave the message to become visible again and be redriven to the DLQ
+	default:
+		if visErr := w.queue.Nack(ctx, msg, retryBackoff(attempt)); visErr != nil {
+			w.log.ErrorContext(ctx, "Failed to set retry backoff", "error", visErr)
 		}
-	}()
+	}
+}
 
-	start := time.Now()
+// discardOutput deletes the partial output and checkpoints of a job that
+// will not be retried. Unversioned output is kept because it may be live.
+func (w *Worker) discardOutput(ctx context.Context, job *models.VideoJob) {
+	w.deleteScratch(ctx, job)
+	if job.Version == 0 {
+		return
+	}
+	prefix := models.HLSPrefix(job.VideoID, job.Version)
+	deleted, err := w.uploader.DeletePrefix(ctx, prefix)
+	if err != nil {
+		w.log.ErrorContext(ctx, "Failed to remove partial output",
+			"videoId", job.VideoID,
+			"prefix", prefix,
+			"error", err,
+		)
+		return
+	}
+	if deleted > 0 {
+		w.log.InfoContext(ctx, "Removed partial output", "videoId", job.VideoID, "prefix", prefix, "objectsDeleted", deleted)
+	}
+}
 
-	// Download video from S3
-	downloadStart := time.Now()
-	localPath, err := w.downloader.Download(ctx, job)
+// republishDeferred republishes a job deferred by admission control with
+// its deferral counted, to be delivered after AdmissionRetryDelay.
+func (w *Worker) republishDeferred(ctx context.Context, msg *queue.Message, job *models.VideoJob) bool {
+	deferred := *job
+	deferred.Deferrals++
+	body, err := json.Marshal(deferred)
 	if err != nil {
-		processingErr = fmt.Errorf("%w: %v", models.ErrDownloadFailed, err)
-		return processingErr
+		w.log.ErrorContext(ctx, "Failed to encode deferred job", "messageId", msg.ID, "error", err)
+		return false
+	}
+	return w.republish(ctx, msg, string(body), AdmissionRetryDelay)
+}
+
+// republish hands msg back to its lane as a new message with body, delivered
+// after delay, and acks the original, so the handover does not count
+// towards the redrive limit. It returns false, leaving msg to the caller, if
+// the worker has no publisher or publishing failed.
+func (w *Worker) republish(ctx context.Context, msg *queue.Message, body string, delay time.Duration) bool {
+	if w.publisher == nil {
+		return false
+	}
+	if _, err := w.publisher.PublishToAfter(ctx, msg.Lane, body, delay); err != nil {
+		w.log.ErrorContext(ctx, "Failed to republish message", "messageId", msg.ID, "error", err)
+		return false
 	}
-	metrics.DownloadDuration.Observe(time.Since(downloadStart).Seconds())
-	defer w.downloader.Cleanup(localPath)
+	w.ackMessage(ctx, msg)
+	return true
+}
 
-	// Check for context cancellation before transcoding
-	if ctx.Err() != nil {
-		processingErr = fmt.Errorf("%w: before transcoding", models.ErrContextCanceled)
-		return processingErr
+// ackMessage removes a message from the queue.
+func (w *Worker) ackMessage(ctx context.Context, msg *queue.Message) {
+	if err := w.queue.Ack(ctx, msg); err != nil {
+		w.log.ErrorContext(ctx, "Failed to acknowledge message", "error", err)
 	}
+}
 
-	// Create HLS output directory
-	hlsDir, err := w.downloader.CreateHLSDir(job.VideoID)
+func (w *Worker) processVideo(ctx context.Context, job *models.VideoJob, receiveCount int, owner string) (err error) {
+	// Resolve the ladder before claiming so an unknown profile fails the job
+	profile := job.Profile
+	if profile == "" {
+		profile = transcoder.DefaultProfile
+	}
+	presets, err := transcoder.ProfilePresets(profile)
 	if err != nil {
-		processingErr = fmt.Errorf("%w: %v", models.ErrTranscodeFailed, err)
-		return processingErr
+		return fmt.Errorf("%w: %v", models.ErrJobParseFailed, err)
 	}
-	defer w.downloader.CleanupDir(hlsDir)
+	tc := w.transcoder.WithPresets(presets)
+	hlsPrefix := models.HLSPrefix(job.VideoID, job.Version)
 
-	// Create output directories for each quality level
-	if err := transcoder.CreateOutputDirectories(hlsDir, w.transcoder.GetPresets()); err != nil {
-		processingErr = fmt.Errorf("%w: %v", models.ErrTranscodeFailed, err)
-		return processingErr
+	// Claim the video so no other worker processes it concurrently
+	video, err := w.videos.ClaimVideo(ctx, job.VideoID, owner, QueueLease, receiveCount, job.Version)
+	if err != nil {
+		if errors.Is(err, models.ErrVideoAlreadyCompleted) || errors.Is(err, models.ErrLeaseHeld) ||
+			errors.Is(err, models.ErrVideoCancelled) || errors.Is(err, models.ErrStaleJob) ||
+			errors.Is(err, models.ErrVideoNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to claim video: %w", err)
 	}
 
-	// Transcode to HLS
-	if err := w.transcoder.TranscodeToHLS(ctx, job.VideoID, localPath, hlsDir); err != nil {
-		processingErr = fmt.Errorf("%w: %v", models.ErrTranscodeFailed, err)
-		return processingErr
+	w.log.InfoContext(ctx, "Processing video",
+		"videoId", job.VideoID,
+		"s3Key", job.S3Key,
+		"filename", job.Filename,
+		"attempt", video.Attempts,
+		"receiveCount", receiveCount,
+		"profile", profile,
+		"version", job.Version,
+	)
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	stopLease := w.keepVideoLease(ctx, job.VideoID, owner, LeaseRenewInterval, QueueLease, cancel)
+	defer stopLease()
+	stopWatch := w.watchCancellation(ctx, job.VideoID, CancelPollInterval, cancel)
+	defer stopWatch()
+	defer func() {
+		if err == nil {
+			return
+		}
+		switch cause := context.Cause(ctx); {
+		case errors.Is(cause, models.ErrLeaseNotHeld):
+			err = fmt.Errorf("%w: %v", models.ErrLeaseNotHeld, err)
+		case errors.Is(cause, models.ErrVideoCancelled):
+			w.finishCancellation(ctx, job.VideoID, owner, hlsPrefix)
+			w.deleteScratch(context.WithoutCancel(ctx), job)
+			err = fmt.Errorf("%w: %v", models.ErrVideoCancelled, err)
+		}
+	}()
+
+	// The flag may have been set while the video waited for a retry
+	if cancellationRequested(video) {
+		cancel(models.ErrVideoCancelled)
+		return errors.New("cancelled before processing started")
 	}
 
-	// Calculate quality metrics (non-blocking)
-	w.transcoder.CalculateQualityMetrics(ctx, localPath, hlsDir)
+	limits, releaseLimits := w.processLimits(ctx, job)
+	defer releaseLimits()
+	defer func() {
+		if err != nil && limits.Cgroup != nil && limits.Cgroup.OOMKills() > 0 {
+			err = fmt.Errorf("%w: killed at the %d MB memory cap: %w", models.ErrResourceLimit, w.cfg.Worker.FFmpegMemoryMB, err)
+		}
+		w.recordUsage(ctx, job.VideoID, limits.Usage)
+	}()
 
-	// Check for context cancellation before uploading
-	if ctx.Err() != nil {
-		processingErr = fmt.Errorf("%w: before upload", models.ErrContextCanceled)
-		return processingErr
+	run := &jobRun{
+		job:       job,
+		profile:   profile,
+		presets:   presets,
+		tc:        tc.WithLimits(limits),
+		hlsPrefix: hlsPrefix,
+		owner:     owner,
 	}
+	defer w.cleanupRun(run)
 
-	// Upload HLS files to S3
-	uploadStart := time.Now()
-	if err := w.uploader.Upload(ctx, job.VideoID, hlsDir); err != nil {
-		processingErr = fmt.Errorf("%w: %v", models.ErrUploadFailed, err)
-		return processingErr
+	start := time.Now()
+	restored := w.restoreCheckpoints(ctx, run, video)
+	records, err := w.pipeline.execute(ctx, run, restored, func(records []models.StageRun) {
+		w.recordStages(ctx, job.VideoID, owner, records)
+	})
+
+	durations := make(map[string]int64, len(records))
+	for _, record := range records {
+		durations[record.Name] = record.DurationMs
+		if record.Optional && record.Status == models.StageFailed {
+			w.log.WarnContext(ctx, "Optional stage failed",
+				"videoId", job.VideoID,
+				"stage", record.Name,
+				"error", record.Error,
+			)
+		}
+	}
+	if err != nil {
+		return err
 	}
-	metrics.UploadDuration.Observe(time.Since(uploadStart).Seconds())
 
 	// Record total processing duration
 	duration := time.Since(start).Seconds()
 	metrics.ProcessingDuration.WithLabelValues("all").Observe(duration)
 
-	// Update DynamoDB with completion info
-	hlsPrefix := fmt.Sprintf("hls/%s/", job.VideoID)
-	playbackURL := fmt.Sprintf("https://%s/hls/%s/master.m3u8", w.cfg.AWS.CDNDomain, job.VideoID)
+	w.log.InfoContext(ctx, "Video processed successfully",
+		"videoId", job.VideoID,
+		"filename", job.Filename,
+		"durationSeconds", duration,
+		"stageDurationsMs", durations,
+		"playbackURL", run.playbackURL,
+	)
+
+	return nil
+}
+
+// processLimits returns the limits a job's FFmpeg processes run within,
+// creating its cgroup if one is configured. The returned function removes
+// the cgroup once the job's processes have exited. A job whose cgroup
+// cannot be created runs without one.
+func (w *Worker) processLimits(ctx context.Context, job *models.VideoJob) (transcoder.ProcessLimits, func()) {
+	cfg := w.cfg.Worker
+	limits := transcoder.ProcessLimits{
+		Threads: cfg.FFmpegThreads,
+		Nice:    cfg.FFmpegNice,
+		Usage:   &transcoder.ProcessUsage{},
+	}
+	if cfg.FFmpegCgroupParent == "" {
+		return limits, func() {}
+	}
 
-	modelPresets := transcoder.ToModelPresets(w.transcoder.GetPresets())
-	if err := w.videoRepo.CompleteVideoProcessing(ctx, job.VideoID, playbackURL, hlsPrefix, modelPresets); err != nil {
-		w.log.ErrorContext(ctx, "Failed to mark video as completed in DynamoDB",
+	name := fmt.Sprintf("job-%s-%d", job.VideoID, time.Now().UnixNano())
+	cgroup, err := transcoder.NewCgroup(cfg.FFmpegCgroupParent, name, cfg.FFmpegCPUMillicores, int64(cfg.FFmpegMemoryMB)<<20)
+	if err != nil {
+		w.log.WarnContext(ctx, "Failed to create job cgroup, running without CPU and memory caps",
 			"videoId", job.VideoID,
 			"error", err,
 		)
-		// Don't set processingErr here - the video was processed successfully
+		return limits, func() {}
+	}
+	limits.Cgroup = cgroup
+	return limits, func() {
+		if err := cgroup.Close(); err != nil {
+			w.log.WarnContext(ctx, "Failed to remove job cgroup",
+				"videoId", job.VideoID,
+				"error", err,
+			)
+		}
 	}
+}
 
-	w.log.InfoContext(ctx, "Video processed successfully",
-		"videoId", job.VideoID,
-		"filename", job.Filename,
-		"durationSeconds", duration,
-		"playbackURL", playbackURL,
+// recordUsage reports the resources used by a job's processes.
+func (w *Worker) recordUsage(ctx context.Context, videoID string, usage *transcoder.ProcessUsage) {
+	if usage.Processes() == 0 {
+		return
+	}
+	cpu := usage.CPUTime()
+	peakRSS := usage.PeakRSSBytes()
+
+	metrics.JobCPUTime.Observe(cpu.Seconds())
+	if peakRSS > 0 {
+		metrics.JobPeakRSS.Observe(float64(peakRSS))
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.Float64("job.cpu_seconds", cpu.Seconds()),
+		attribute.Int64("job.peak_rss_bytes", peakRSS),
 	)
+	w.log.InfoContext(ctx, "Job resource usage",
+		"videoId", videoID,
+		"processes", usage.Processes(),
+		"cpuSeconds", cpu.Seconds(),
+		"peakRSSBytes", peakRSS,
+	)
+}
 
-	return nil
+// analyzeContent runs content analysis and writes the timeline into hlsDir so
+// it is uploaded with the playlists.
+func (w *Worker) analyzeContent(ctx context.Context, tc *transcoder.Transcoder, videoID, hlsPrefix, input, hlsDir string, probe *transcoder.ProbeResult) (*models.AnalysisSummary, error) {
+	timeline, err := tc.Analyze(ctx, videoID, input, probe)
+	if err != nil {
+		return nil, fmt.Errorf("content analysis failed: %w", err)
+	}
+
+	if err := transcoder.WriteTimeline(hlsDir, timeline); err != nil {
+		return nil, fmt.Errorf("failed to write timeline: %w", err)
+	}
+
+	summary := transcoder.SummarizeTimeline(timeline, hlsPrefix+transcoder.TimelineFilename)
+	w.log.InfoContext(ctx, "Content analysis complete",
+		"videoId", videoID,
+		"trimStart", summary.TrimStartSeconds,
+		"trimEnd", summary.TrimEndSeconds,
+		"posterTime", summary.PosterTimeSeconds,
+		"sceneChanges", summary.SceneChangeCount,
+	)
+
+	return &summary, nil
+}
+
+// generatePreview builds the animated teaser inside hlsDir so it is uploaded
+// with the playlists.
+func (w *Worker) generatePreview(ctx context.Context, tc *transcoder.Transcoder, hlsPrefix, input, hlsDir string, probe *transcoder.ProbeResult) (*models.PreviewAssets, error) {
+	if _, err := tc.GeneratePreview(ctx, input, hlsDir, probe); err != nil {
+		return nil, fmt.Errorf("preview generation failed: %w", err)
+	}
+	return w.previewAssets(hlsPrefix), nil
+}
+
+// previewAssets returns the locations of the teaser uploaded under hlsPrefix.
+func (w *Worker) previewAssets(hlsPrefix string) *models.PreviewAssets {
+	webpKey := fmt.Sprintf("%s%s/%s", hlsPrefix, transcoder.PreviewDir, transcoder.PreviewWebPFilename)
+	mp4Key := fmt.Sprintf("%s%s/%s", hlsPrefix, transcoder.PreviewDir, transcoder.PreviewMP4Filename)
+
+	return &models.PreviewAssets{
+		WebPKey: webpKey,
+		WebPURL: fmt.Sprintf("https://%s/%s", w.cfg.AWS.CDNDomain, webpKey),
+		MP4Key:  mp4Key,
+		MP4URL:  fmt.Sprintf("https://%s/%s", w.cfg.AWS.CDNDomain, mp4Key),
+	}
 }
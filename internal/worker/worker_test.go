@@ -0,0 +1,1490 @@
+package worker
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/smithy-go"
+
+	"github.com/amillerrr/hls-pipeline/internal/config"
+	"github.com/amillerrr/hls-pipeline/internal/queue"
+	"github.com/amillerrr/hls-pipeline/internal/storage"
+	"github.com/amillerrr/hls-pipeline/internal/transcoder"
+	"github.com/amillerrr/hls-pipeline/pkg/models"
+)
+
+func TestSniffHeader(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+	}{
+		{"mp4", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"), ContainerISOBMFF},
+		{"mov", []byte("\x00\x00\x00\x14ftypqt  \x00\x00\x00\x00"), ContainerISOBMFF},
+		{"webm", []byte{0x1A, 0x45, 0xDF, 0xA3, 0x9F, 0x42, 0x86, 0x81}, ContainerMatroska},
+		{"avi", []byte("RIFF\x00\x10\x00\x00AVI LIST"), ContainerAVI},
+		{"text file", []byte("hello, this is not a video"), ""},
+		{"too short", []byte{0x00, 0x00}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sniffHeader(tt.header); got != tt.want {
+				t.Errorf("sniffHeader() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateInput_Rejections(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data []byte) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("WriteFile() error = %v", err)
+		}
+		return path
+	}
+
+	mp4 := write("ok.mp4", []byte("\x00\x00\x00\x20ftypisom\x00\x00\x02\x00"))
+	limits := InputLimits{MaxDurationSeconds: 60, MaxWidth: 1920, MaxHeight: 1080}
+	okProbe := &transcoder.ProbeResult{
+		DurationSeconds: 30,
+		Video:           &transcoder.VideoStreamInfo{Width: 1080, Height: 1920},
+	}
+
+	tests := []struct {
+		name  string
+		path  string
+		probe *transcoder.ProbeResult
+		want  models.RejectionCode
+	}{
+		{"empty file", write("empty.mp4", nil), okProbe, models.RejectEmptyFile},
+		{"renamed text file", write("notes.mp4", []byte("just some text, not a video")), okProbe, models.RejectUnsupportedContainer},
+		{"audio only", mp4, &transcoder.ProbeResult{DurationSeconds: 30}, models.RejectNoVideoStream},
+		{"too long", mp4, &transcoder.ProbeResult{DurationSeconds: 120, Video: okProbe.Video}, models.RejectDurationExceeded},
+		{"too large", mp4, &transcoder.ProbeResult{DurationSeconds: 30, Video: &transcoder.VideoStreamInfo{Width: 3840, Height: 2160}}, models.RejectResolutionExceeded},
+		{"valid portrait", mp4, okProbe, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInput(tt.path, tt.probe, nil, limits)
+
+			if tt.want == "" {
+				if err != nil {
+					t.Errorf("ValidateInput() error = %v, want nil", err)
+				}
+				return
+			}
+
+			var rejection *models.RejectionError
+			if !errors.As(err, &rejection) {
+				t.Fatalf("ValidateInput() error = %v, want RejectionError", err)
+			}
+			if rejection.Code != tt.want {
+				t.Errorf("Code = %s, want %s", rejection.Code, tt.want)
+			}
+			if !errors.Is(err, models.ErrInputRejected) {
+				t.Error("errors.Is(err, ErrInputRejected) = false")
+			}
+		})
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want models.ErrorClass
+	}{
+		{"rejected input", models.NewRejection(models.RejectCorruptInput, "bad"), models.ErrorClassPermanent},
+		{"unparseable job", fmt.Errorf("%w: bad json", models.ErrJobParseFailed), models.ErrorClassPermanent},
+		{"cancelled video", fmt.Errorf("failed to claim video: %w", models.ErrInvalidTransition), models.ErrorClassPermanent},
+		{"deleted video", fmt.Errorf("failed to record stages: %w", models.ErrVideoNotFound), models.ErrorClassPermanent},
+		{"missing raw object", fmt.Errorf("%w: %w", models.ErrDownloadFailed, &smithy.GenericAPIError{Code: "NoSuchKey"}), models.ErrorClassPermanent},
+		{"missing bucket", fmt.Errorf("%w: %w", models.ErrDownloadFailed, &smithy.GenericAPIError{Code: "NoSuchBucket"}), models.ErrorClassPermanent},
+		{"s3 throttling", fmt.Errorf("%w: %w", models.ErrUploadFailed, &smithy.GenericAPIError{Code: "SlowDown"}), models.ErrorClassTransient},
+		{"ffmpeg failure", fmt.Errorf("%w: exit status 1", models.ErrFFmpegFailed), models.ErrorClassTransient},
+		{"explicit permanent", models.Permanent(errors.New("boom")), models.ErrorClassPermanent},
+		{"stage timeout", fmt.Errorf("stage transcode: %w: timed out after 1h", models.ErrResourceLimit), models.ErrorClassResource},
+		{"raw object not found", fmt.Errorf("%w: %w", models.ErrDownloadFailed, models.ErrObjectNotFound), models.ErrorClassPermanent},
+		{"storage access denied", fmt.Errorf("%w: %w", models.ErrUploadFailed, models.ErrAccessDenied), models.ErrorClassPermanent},
+		{"storage throttled", fmt.Errorf("%w: %w", models.ErrDownloadFailed, models.ErrThrottled), models.ErrorClassTransient},
+		{"storage unavailable", fmt.Errorf("failed to record stages: %w", models.ErrStorageUnavailable), models.ErrorClassTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyError(tt.err); got != tt.want {
+				t.Errorf("classifyError() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{0, RetryBaseDelay},
+		{1, RetryBaseDelay},
+		{2, 2 * RetryBaseDelay},
+		{3, 4 * RetryBaseDelay},
+		{10, RetryMaxDelay},
+	}
+
+	for _, tt := range tests {
+		if got := retryBackoff(tt.attempt); got != tt.want {
+			t.Errorf("retryBackoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+}
+
+func TestHandleFailure_SettlesMessage(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		attempt   int
+		wantAcked bool
+	}{
+		{"permanent is acked", fmt.Errorf("%w: bad json", models.ErrJobParseFailed), 1, true},
+		{"transient is retried", errors.New("connection reset"), 1, false},
+		{"final transient is left for DLQ", errors.New("connection reset"), 3, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			q := queue.NewMemoryQueue()
+			if err := q.Publish(ctx, "{}"); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			msgs, err := q.Receive(ctx, 1, time.Minute)
+			if err != nil || len(msgs) != 1 {
+				t.Fatalf("Receive() = %d messages, error = %v", len(msgs), err)
+			}
+			msg := msgs[0]
+			msg.ReceiveCount = tt.attempt
+
+			w := &Worker{
+				queue: q,
+				cfg:   &config.Config{Worker: config.WorkerConfig{MaxReceiveCount: 3}},
+				log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			w.handleFailure(ctx, msg, nil, "", tt.err)
+
+			// A message still in the queue can be acked; a removed one cannot
+			ackErr := q.Ack(ctx, msg)
+			if gotAcked := errors.Is(ackErr, queue.ErrLeaseLost); gotAcked != tt.wantAcked {
+				t.Errorf("message acked = %v, want %v (ack error %v)", gotAcked, tt.wantAcked, ackErr)
+			}
+		})
+	}
+}
+
+// leaseQueue is a queue.Consumer that counts lease extensions.
+type leaseQueue struct {
+	queue.Consumer
+	mu         sync.Mutex
+	extensions int
+	err        error
+}
+
+func (q *leaseQueue) ExtendLease(ctx context.Context, msg *queue.Message, lease time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.extensions++
+	return q.err
+}
+
+func (q *leaseQueue) count() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.extensions
+}
+
+func TestKeepLease(t *testing.T) {
+	t.Run("extends until stopped", func(t *testing.T) {
+		q := &leaseQueue{}
+		w := &Worker{queue: q, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		stop := w.keepLease(ctx, &queue.Message{ID: "m1"}, 5*time.Millisecond, time.Minute, cancel)
+		time.Sleep(40 * time.Millisecond)
+		stop()
+
+		extended := q.count()
+		if extended == 0 {
+			t.Fatal("lease was never extended")
+		}
+		time.Sleep(20 * time.Millisecond)
+		if q.count() != extended {
+			t.Error("lease extended after stop")
+		}
+		if ctx.Err() != nil {
+			t.Errorf("job context cancelled: %v", context.Cause(ctx))
+		}
+	})
+
+	t.Run("cancels job when lease lost", func(t *testing.T) {
+		q := &leaseQueue{err: queue.ErrLeaseLost}
+		w := &Worker{queue: q, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		stop := w.keepLease(ctx, &queue.Message{ID: "m1"}, 5*time.Millisecond, time.Minute, cancel)
+		defer stop()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+			t.Fatal("job context not cancelled after lease loss")
+		}
+		if !errors.Is(context.Cause(ctx), queue.ErrLeaseLost) {
+			t.Errorf("cause = %v, want ErrLeaseLost", context.Cause(ctx))
+		}
+	})
+
+	t.Run("keeps trying after transient errors", func(t *testing.T) {
+		q := &leaseQueue{err: errors.New("throttled")}
+		w := &Worker{queue: q, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+		stop := w.keepLease(ctx, &queue.Message{ID: "m1"}, 5*time.Millisecond, time.Minute, cancel)
+		time.Sleep(40 * time.Millisecond)
+		stop()
+
+		if q.count() < 2 {
+			t.Errorf("extensions attempted = %d, want at least 2", q.count())
+		}
+		if ctx.Err() != nil {
+			t.Errorf("job context cancelled: %v", context.Cause(ctx))
+		}
+	})
+}
+
+func TestLeaseOwner(t *testing.T) {
+	w := &Worker{cfg: &config.Config{Worker: config.WorkerConfig{ID: "host-1"}}}
+
+	a, b := w.leaseOwner(), w.leaseOwner()
+	if a == b {
+		t.Errorf("leaseOwner() returned %q twice; jobs of one worker must not share a lease", a)
+	}
+	if !strings.HasPrefix(a, "host-1/") {
+		t.Errorf("leaseOwner() = %q, want the worker ID as prefix", a)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	t.Run("waits for jobs that finish in time", func(t *testing.T) {
+		w := &Worker{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			time.Sleep(10 * time.Millisecond)
+		}()
+
+		w.drain(ctx, &wg, time.Second, cancel)
+		if ctx.Err() != nil {
+			t.Errorf("jobs cancelled although they finished in time: %v", context.Cause(ctx))
+		}
+	})
+
+	t.Run("cancels jobs after the grace period", func(t *testing.T) {
+		w := &Worker{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+		ctx, cancel := context.WithCancelCause(context.Background())
+		defer cancel(nil)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+		}()
+
+		start := time.Now()
+		w.drain(ctx, &wg, 20*time.Millisecond, cancel)
+		if !errors.Is(context.Cause(ctx), errDraining) {
+			t.Errorf("cause = %v, want errDraining", context.Cause(ctx))
+		}
+		if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+			t.Errorf("drain returned after %v, before the grace period", elapsed)
+		}
+	})
+}
+
+func TestReturnToQueue_MakesMessageVisible(t *testing.T) {
+	ctx := context.Background()
+	q := queue.NewMemoryQueue()
+	if err := q.Publish(ctx, "{}"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	msgs, err := q.Receive(ctx, 1, time.Hour)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Receive() = %d messages, error = %v", len(msgs), err)
+	}
+
+	w := &Worker{queue: q, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	w.returnToQueue(ctx, msgs[0], nil, "")
+
+	// Visible again straight away rather than after the hour-long lease
+	again, err := q.Receive(ctx, 1, time.Hour)
+	if err != nil || len(again) != 1 {
+		t.Fatalf("Receive() after return = %d messages, error = %v", len(again), err)
+	}
+	if again[0].ReceiveCount != 2 {
+		t.Errorf("ReceiveCount = %d, want 2", again[0].ReceiveCount)
+	}
+}
+
+// laneless publishes every lane's messages to one queue.
+type laneless struct{ queue.DelayedPublisher }
+
+func (p laneless) PublishToAfter(ctx context.Context, lane queue.Lane, body string, delay time.Duration) (queue.Lane, error) {
+	return lane, p.PublishAfter(ctx, body, delay)
+}
+
+func TestReturnToQueue_KeepsDeliveries(t *testing.T) {
+	ctx := context.Background()
+	q := queue.NewMemoryQueue()
+	if err := q.Publish(ctx, "{}"); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	msgs, err := q.Receive(ctx, 1, time.Hour)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("Receive() = %d messages, error = %v", len(msgs), err)
+	}
+
+	w := &Worker{queue: q, publisher: laneless{q}, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	w.returnToQueue(ctx, msgs[0], nil, "")
+
+	again, err := q.Receive(ctx, 10, time.Hour)
+	if err != nil || len(again) != 1 {
+		t.Fatalf("Receive() after return = %d messages, error = %v, want 1", len(again), err)
+	}
+	if again[0].ReceiveCount != 1 {
+		t.Errorf("ReceiveCount = %d, want 1: a drain must not use up a delivery", again[0].ReceiveCount)
+	}
+}
+
+func TestIncludesPath(t *testing.T) {
+	tests := []struct {
+		paths []string
+		rel   string
+		want  bool
+	}{
+		{nil, "720p/segment_000.ts", true},
+		{[]string{"720p/"}, "720p/segment_000.ts", true},
+		{[]string{"720p/"}, "720p", true},
+		{[]string{"720p/"}, "720pX/segment_000.ts", false},
+		{[]string{"master.m3u8"}, "master.m3u8", true},
+		{[]string{"master.m3u8", "480p/"}, "1080p/playlist.m3u8", false},
+	}
+
+	for _, tt := range tests {
+		if got := includesPath(tt.paths, tt.rel); got != tt.want {
+			t.Errorf("includesPath(%v, %q) = %v, want %v", tt.paths, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestMatchesETag(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment.ts")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	md5Hello := `"5d41402abc4b2a76b9719d911017c592"`
+	if !matchesETag(path, md5Hello, 0) {
+		t.Error("matchesETag() = false for matching ETag")
+	}
+	multipart := `"5d41402abc4b2a76b9719d911017c592-2"`
+	if matchesETag(path, multipart, 1<<20) {
+		t.Error("matchesETag() = true for multipart ETag of other content")
+	}
+
+	// Parts "hel" and "lo": MD5 of md5("hel") || md5("lo"), with the count
+	parts, err := fileETag(path, true, 3)
+	if err != nil {
+		t.Fatalf("fileETag() error = %v", err)
+	}
+	if !strings.HasSuffix(parts, "-2") || !matchesETag(path, `"`+parts+`"`, 3) {
+		t.Errorf("fileETag() = %s, want a matching 2-part ETag", parts)
+	}
+	if matchesETag(path, parts, 4) {
+		t.Error("matchesETag() = true with the wrong part size")
+	}
+}
+
+func TestVerifyDownload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "source.mp4")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sumHello := sha256.Sum256([]byte("hello"))
+	checksumHello := base64.StdEncoding.EncodeToString(sumHello[:])
+	md5Hello := `"5d41402abc4b2a76b9719d911017c592"`
+	kmsETag := `"c1c0c1c0c1c0c1c0c1c0c1c0c1c0c1c0"`
+
+	tests := []struct {
+		name    string
+		head    storage.ObjectInfo
+		wantErr bool
+	}{
+		{"checksum", storage.ObjectInfo{ETag: kmsETag, ChecksumSHA256: checksumHello}, false},
+		{"checksum mismatch", storage.ObjectInfo{ETag: md5Hello, ChecksumSHA256: base64.StdEncoding.EncodeToString(make([]byte, 32)), MD5ETag: true}, true},
+		{"MD5 ETag", storage.ObjectInfo{ETag: md5Hello, MD5ETag: true}, false},
+		{"MD5 ETag mismatch", storage.ObjectInfo{ETag: kmsETag, MD5ETag: true}, true},
+		{"unverifiable", storage.ObjectInfo{ETag: kmsETag}, false},
+	}
+
+	d := &Downloader{log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := d.verifyDownload(context.Background(), "raw", "uploads/abc/source.mp4", path, &tt.head)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("verifyDownload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileChecksums(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "segment.ts")
+	if err := os.WriteFile(path, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	digest := func(s string) []byte {
+		sum := sha256.Sum256([]byte(s))
+		return sum[:]
+	}
+
+	sum, checksum, err := fileChecksums(path, false, 0)
+	if err != nil {
+		t.Fatalf("fileChecksums() error = %v", err)
+	}
+	if want := hex.EncodeToString(digest("hello")); sum != want {
+		t.Errorf("fileChecksums() sum = %s, want %s", sum, want)
+	}
+	if want := base64.StdEncoding.EncodeToString(digest("hello")); checksum != want {
+		t.Errorf("fileChecksums() checksum = %s, want %s", checksum, want)
+	}
+
+	// Parts "hel" and "lo": SHA-256 of sha256("hel") || sha256("lo"), with the count
+	partSum, checksum, err := fileChecksums(path, true, 3)
+	if err != nil {
+		t.Fatalf("fileChecksums() error = %v", err)
+	}
+	composite := sha256.Sum256(append(digest("hel"), digest("lo")...))
+	if want := base64.StdEncoding.EncodeToString(composite[:]) + "-2"; checksum != want {
+		t.Errorf("fileChecksums() multipart checksum = %s, want %s", checksum, want)
+	}
+	if partSum != sum {
+		t.Errorf("fileChecksums() multipart sum = %s, want the content digest %s", partSum, sum)
+	}
+}
+
+func TestNewManifest(t *testing.T) {
+	run := &jobRun{
+		job:     &models.VideoJob{VideoID: "vid", Version: 2},
+		profile: "mobile",
+		presets: []transcoder.Preset{{Name: "720p", Width: 1280, Height: 720, Bandwidth: 2750000}},
+	}
+	files := []models.ManifestFile{
+		{Path: "720p/playlist.m3u8"},
+		{Path: "720p/seg_000.ts"},
+		{Path: "720p/seg_001.ts"},
+		{Path: "master.m3u8"},
+		{Path: "preview/preview.mp4"},
+	}
+
+	manifest := newManifest(run, files)
+	if manifest.VideoID != "vid" || manifest.Version != 2 || manifest.Profile != "mobile" {
+		t.Errorf("newManifest() = %+v, want vid v2 mobile", manifest)
+	}
+	want := models.ManifestRendition{Name: "720p", Width: 1280, Height: 720, Bitrate: 2750000, Playlist: "720p/playlist.m3u8", Segments: 2}
+	if len(manifest.Renditions) != 1 || manifest.Renditions[0] != want {
+		t.Errorf("Renditions = %+v, want [%+v]", manifest.Renditions, want)
+	}
+	for _, file := range manifest.Files {
+		wantRendition := ""
+		if strings.HasPrefix(file.Path, "720p/") {
+			wantRendition = "720p"
+		}
+		if file.Rendition != wantRendition {
+			t.Errorf("%s rendition = %q, want %q", file.Path, file.Rendition, wantRendition)
+		}
+	}
+}
+
+func TestTransfers_LocalStore(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Parts of 3 bytes and a threshold of 4, which the local store uploads whole
+	opts := TransferOptions{PartSize: 3, PartConcurrency: 2, UploadConcurrency: 2, MultipartThreshold: 4}
+	uploader := NewUploader(store, "processed", opts, log)
+	downloader := NewDownloader(store, opts, log)
+
+	hlsDir := t.TempDir()
+	for path, content := range map[string]string{
+		"master.m3u8":      "#EXTM3U",
+		"720p/seg_000.ts":  "segment-data",
+		"720p/frame_1.png": "skipped",
+	} {
+		path = filepath.Join(hlsDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prefix := "hls/vid/v1/"
+	files, err := uploader.Upload(ctx, prefix, hlsDir)
+	if err != nil {
+		t.Fatalf("Upload() error = %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "720p/seg_000.ts" || files[1].Path != "master.m3u8" {
+		t.Fatalf("Upload() files = %+v", files)
+	}
+	if strings.Contains(files[0].Checksum, "-") {
+		t.Errorf("checksum %s is multipart, want whole-object", files[0].Checksum)
+	}
+	manifest := &models.Manifest{Files: files}
+	if err := uploader.VerifyUpload(ctx, prefix, manifest); err != nil {
+		t.Errorf("VerifyUpload() error = %v", err)
+	}
+
+	// A file changed after upload fails verification
+	if err := store.Put(ctx, "processed", prefix+"master.m3u8", strings.NewReader("#EXTM3U changed"), storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := uploader.VerifyUpload(ctx, prefix, manifest); err == nil {
+		t.Error("VerifyUpload() of a changed file succeeded, want error")
+	}
+
+	file, err := os.Create(filepath.Join(t.TempDir(), "source"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	written, parts, err := downloader.downloadFile(ctx, "processed", prefix+"720p/seg_000.ts", file)
+	if err != nil {
+		t.Fatalf("downloadFile() error = %v", err)
+	}
+	if got, _ := os.ReadFile(file.Name()); string(got) != "segment-data" || written != 12 || parts != 4 {
+		t.Errorf("downloadFile() = %q in %d parts, want segment-data in 4", got, parts)
+	}
+
+	dest := t.TempDir()
+	if n, err := downloader.DownloadPrefix(ctx, "processed", prefix+"720p/", dest); err != nil || n != 1 {
+		t.Errorf("DownloadPrefix() = %d, %v, want 1 file", n, err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dest, "seg_000.ts")); string(got) != "segment-data" {
+		t.Errorf("DownloadPrefix() wrote %q, want segment-data", got)
+	}
+
+	if n, err := uploader.DeletePrefix(ctx, prefix); err != nil || n != 2 {
+		t.Errorf("DeletePrefix() = %d, %v, want 2 objects", n, err)
+	}
+	if objects, _ := store.List(ctx, "processed", prefix); len(objects) != 0 {
+		t.Errorf("objects left after DeletePrefix: %+v", objects)
+	}
+}
+
+// countingStore is an ObjectStore that counts the objects put by key.
+type countingStore struct {
+	storage.ObjectStore
+	mu   sync.Mutex
+	puts map[string]int
+}
+
+func (s *countingStore) Put(ctx context.Context, bucket, key string, body io.ReadSeeker, opts storage.PutOptions) error {
+	s.mu.Lock()
+	s.puts[key]++
+	s.mu.Unlock()
+	return s.ObjectStore.Put(ctx, bucket, key, body, opts)
+}
+
+func TestCheckpoint_UploadsOutputOnce(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	local, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &countingStore{ObjectStore: local, puts: make(map[string]int)}
+	opts := TransferOptions{PartSize: 1 << 20, PartConcurrency: 2, UploadConcurrency: 2, MultipartThreshold: 1 << 30}
+
+	videos := storage.NewMemoryVideoStore()
+	if _, err := videos.CreateVideo(ctx, "vid", "clip.mp4", "uploads/vid.mp4", 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := videos.ClaimVideo(ctx, "vid", "w1", time.Minute, 1, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Worker: config.WorkerConfig{CheckpointsEnabled: true}}
+	cfg.AWS.ProcessedBucket = "processed"
+	w := &Worker{
+		videos:     videos,
+		uploader:   NewUploader(store, "processed", opts, log),
+		downloader: NewDownloader(store, opts, log),
+		cfg:        cfg,
+		log:        log,
+	}
+
+	hlsDir := t.TempDir()
+	files := map[string]string{
+		"master.m3u8":        "#EXTM3U",
+		"720p/playlist.m3u8": "#EXTM3U\n#EXT-X-ENDLIST",
+		"720p/seg_000.ts":    "segment-data",
+	}
+	for path, content := range files {
+		path = filepath.Join(hlsDir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	run := &jobRun{
+		job:       &models.VideoJob{VideoID: "vid", S3Key: "uploads/vid.mp4", Bucket: "raw", Version: 1},
+		presets:   []transcoder.Preset{{Name: "720p"}},
+		hlsPrefix: models.HLSPrefix("vid", 1),
+		hlsDir:    hlsDir,
+		owner:     "w1",
+	}
+
+	transcode := stage{name: "transcode", checkpoint: &checkpoint{paths: renditionPaths}}
+	w.saveCheckpoint(ctx, run, transcode, false)
+	if err := w.uploadStage(ctx, run); err != nil {
+		t.Fatalf("uploadStage() error = %v", err)
+	}
+
+	for path := range files {
+		key := run.hlsPrefix + path
+		if n := store.puts[key]; n != 1 {
+			t.Errorf("%s put %d times, want 1", key, n)
+		}
+	}
+	if total := len(files) + 1; len(store.puts) != total {
+		t.Errorf("objects put = %v, want the %d files and the manifest", store.puts, total)
+	}
+	if video := mustGetVideo(t, videos, "vid"); video.FindCheckpoint("transcode", 1) == nil {
+		t.Error("transcode checkpoint not recorded")
+	}
+}
+
+// mustGetVideo returns a video that must exist.
+func mustGetVideo(t *testing.T, videos storage.VideoStore, videoID string) *models.VideoMetadata {
+	t.Helper()
+	video, err := videos.GetVideo(context.Background(), videoID)
+	if err != nil {
+		t.Fatalf("GetVideo() error = %v", err)
+	}
+	return video
+}
+
+// completeErrStore is a VideoStore whose CompleteVideoProcessing fails.
+type completeErrStore struct {
+	storage.VideoStore
+	err error
+}
+
+func (s *completeErrStore) CompleteVideoProcessing(ctx context.Context, videoID, owner, playbackURL, hlsPrefix string, output models.OutputVersion) error {
+	return s.err
+}
+
+func TestPublishStage_CompletionFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want models.ErrorClass
+	}{
+		{"throttled", fmt.Errorf("failed to complete video: %w", models.ErrThrottled), models.ErrorClassTransient},
+		{"invalid transition", fmt.Errorf("%w: video is cancelled", models.ErrInvalidTransition), models.ErrorClassPermanent},
+		{"versions changed", errors.New("ConditionalCheckFailedException: versions changed"), models.ErrorClassTransient},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Worker{
+				videos: &completeErrStore{err: tt.err},
+				cfg:    &config.Config{},
+				log:    slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+			run := &jobRun{job: &models.VideoJob{VideoID: "vid", Version: 1}, hlsPrefix: models.HLSPrefix("vid", 1), owner: "w1"}
+
+			err := w.publishStage(context.Background(), run)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("publishStage() error = %v, want %v", err, tt.err)
+			}
+			if got := classifyError(err); got != tt.want {
+				t.Errorf("classifyError() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPartRanges(t *testing.T) {
+	tests := []struct {
+		size, partSize int64
+		want           []byteRange
+	}{
+		{0, 8, nil},
+		{5, 8, []byteRange{{0, 5}}},
+		{16, 8, []byteRange{{0, 8}, {8, 8}}},
+		{17, 8, []byteRange{{0, 8}, {8, 8}, {16, 1}}},
+	}
+	for _, tt := range tests {
+		if got := partRanges(tt.size, tt.partSize); !slices.Equal(got, tt.want) {
+			t.Errorf("partRanges(%d, %d) = %v, want %v", tt.size, tt.partSize, got, tt.want)
+		}
+	}
+	if got := (byteRange{8, 8}).header(); got != "bytes=8-15" {
+		t.Errorf("header() = %s, want bytes=8-15", got)
+	}
+}
+
+func TestForEachPart(t *testing.T) {
+	oldDelay := partRetryDelay
+	partRetryDelay = time.Millisecond
+	defer func() { partRetryDelay = oldDelay }()
+	ctx := context.Background()
+	parts := partRanges(100, 10)
+
+	t.Run("retries transient failures", func(t *testing.T) {
+		var mu sync.Mutex
+		tries := make(map[int]int)
+		err := forEachPart(ctx, parts, 3, func(ctx context.Context, i int, part byteRange) error {
+			return retryPart(ctx, func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				tries[i]++
+				if i == 4 && tries[i] < partAttempts {
+					return errors.New("connection reset")
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			t.Fatalf("forEachPart() error = %v", err)
+		}
+		if len(tries) != len(parts) || tries[4] != partAttempts || tries[0] != 1 {
+			t.Errorf("tries = %v, want every part once and part 4 %d times", tries, partAttempts)
+		}
+	})
+
+	t.Run("stops after a failure", func(t *testing.T) {
+		var started atomic.Int32
+		err := forEachPart(ctx, parts, 1, func(ctx context.Context, i int, part byteRange) error {
+			started.Add(1)
+			return retryPart(ctx, func() error {
+				return &smithy.GenericAPIError{Code: "NoSuchKey"}
+			})
+		})
+		if err == nil {
+			t.Fatal("forEachPart() error = nil, want the part's error")
+		}
+		if n := started.Load(); n != 1 {
+			t.Errorf("parts started = %d, want 1", n)
+		}
+	})
+}
+
+func TestDiskAdmission(t *testing.T) {
+	upload, hls, other := t.TempDir(), t.TempDir(), t.TempDir()
+	oldStat := statDisk
+	defer func() { statDisk = oldStat }()
+	statDisk = func(dir string) (diskStats, error) {
+		// upload and hls share a 1000 byte disk with 800 free
+		if dir == other {
+			return diskStats{device: 2, free: 100, total: 100}, nil
+		}
+		return diskStats{device: 1, free: 800, total: 1000}, nil
+	}
+
+	a := newDiskAdmission(100)
+	first, err := a.reserve(map[string]uint64{upload: 200, hls: 300})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+
+	// 500 reserved + 100 minimum free leaves 200 on the shared disk
+	if _, err := a.reserve(map[string]uint64{upload: 100, hls: 200}); !errors.Is(err, errInsufficientDisk) {
+		t.Errorf("reserve() error = %v, want errInsufficientDisk", err)
+	}
+	second, err := a.reserve(map[string]uint64{upload: 100, hls: 100})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if _, err := a.reserve(map[string]uint64{other: 1}); !errors.Is(err, errExceedsDisk) {
+		t.Errorf("reserve() error = %v, want errExceedsDisk", err)
+	}
+
+	first.release()
+	second.release()
+	if a.reserved[1] != 0 {
+		t.Errorf("reserved after release = %d, want 0", a.reserved[1])
+	}
+	if _, err := a.reserve(map[string]uint64{hls: 700}); err != nil {
+		t.Errorf("reserve() after release error = %v", err)
+	}
+
+	statDisk = func(string) (diskStats, error) { return diskStats{}, errors.ErrUnsupported }
+	res, err := a.reserve(map[string]uint64{hls: 1 << 40})
+	if err != nil {
+		t.Fatalf("reserve() without disk stats error = %v", err)
+	}
+	res.release()
+}
+
+func TestDiskAdmission_Wait(t *testing.T) {
+	hls := t.TempDir()
+	oldStat := statDisk
+	defer func() { statDisk = oldStat }()
+	statDisk = func(string) (diskStats, error) {
+		return diskStats{device: 1, free: 500, total: 1000}, nil
+	}
+	ctx := context.Background()
+
+	a := newDiskAdmission(0)
+	start := time.Now()
+	a.wait(ctx, time.Hour)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("wait() blocked %v without a deferred job", elapsed)
+	}
+
+	res, err := a.reserve(map[string]uint64{hls: 400})
+	if err != nil {
+		t.Fatalf("reserve() error = %v", err)
+	}
+	if _, err := a.reserve(map[string]uint64{hls: 400}); !errors.Is(err, errInsufficientDisk) {
+		t.Fatalf("reserve() error = %v, want errInsufficientDisk", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		a.wait(ctx, time.Hour)
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("wait() returned while the disk was full")
+	case <-time.After(20 * time.Millisecond):
+	}
+	res.release()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("wait() still blocked after a reservation was released")
+	}
+
+	if _, err := a.reserve(map[string]uint64{hls: 600}); !errors.Is(err, errInsufficientDisk) {
+		t.Fatalf("reserve() error = %v, want errInsufficientDisk", err)
+	}
+	start = time.Now()
+	a.wait(ctx, 20*time.Millisecond)
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond || elapsed > time.Second {
+		t.Errorf("wait() returned after %v, want the 20ms delay", elapsed)
+	}
+}
+
+// lanePublisher is a queue.DelayedLanePublisher that records what it
+// publishes.
+type lanePublisher struct {
+	lanes  []queue.Lane
+	bodies []string
+	delays []time.Duration
+	err    error
+}
+
+func (p *lanePublisher) PublishToAfter(ctx context.Context, lane queue.Lane, body string, delay time.Duration) (queue.Lane, error) {
+	if p.err != nil {
+		return "", p.err
+	}
+	p.lanes = append(p.lanes, lane)
+	p.bodies = append(p.bodies, body)
+	p.delays = append(p.delays, delay)
+	return lane, nil
+}
+
+func TestRepublish(t *testing.T) {
+	receive := func(t *testing.T) (*queue.MemoryQueue, *queue.Message) {
+		ctx := context.Background()
+		q := queue.NewMemoryQueue()
+		if err := q.Publish(ctx, `{"videoId":"v1"}`); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+		msgs, err := q.Receive(ctx, 1, time.Hour)
+		if err != nil || len(msgs) != 1 {
+			t.Fatalf("Receive() = %d messages, error = %v", len(msgs), err)
+		}
+		msgs[0].Lane = queue.LaneBulk
+		return q, msgs[0]
+	}
+	ctx := context.Background()
+
+	t.Run("publishes a copy and acks the original", func(t *testing.T) {
+		q, msg := receive(t)
+		pub := &lanePublisher{}
+		w := &Worker{queue: q, publisher: pub, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+
+		if !w.republish(ctx, msg, msg.Body, time.Minute) {
+			t.Fatal("republish() = false, want true")
+		}
+		if !slices.Equal(pub.lanes, []queue.Lane{queue.LaneBulk}) || !slices.Equal(pub.bodies, []string{msg.Body}) {
+			t.Errorf("published %v to %v, want the body to the bulk lane", pub.bodies, pub.lanes)
+		}
+		if !slices.Equal(pub.delays, []time.Duration{time.Minute}) {
+			t.Errorf("published with delays %v, want [1m]", pub.delays)
+		}
+		if err := q.Ack(ctx, msg); !errors.Is(err, queue.ErrLeaseLost) {
+			t.Errorf("Ack() of original error = %v, want it already acked", err)
+		}
+	})
+
+	for name, pub := range map[string]queue.DelayedLanePublisher{
+		"without a publisher": nil,
+		"publish fails":       &lanePublisher{err: errors.New("throttled")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			q, msg := receive(t)
+			w := &Worker{queue: q, publisher: pub, log: slog.New(slog.NewTextHandler(io.Discard, nil))}
+			if w.republish(ctx, msg, msg.Body, 0) {
+				t.Fatal("republish() = true, want false")
+			}
+			if err := q.Ack(ctx, msg); err != nil {
+				t.Errorf("Ack() of original error = %v, want it left alone", err)
+			}
+		})
+	}
+}
+
+func TestRunJob_DefersForDisk(t *testing.T) {
+	ctx := context.Background()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	store, err := storage.NewLocalStore(t.TempDir(), "http://localhost:8080", []byte("secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(ctx, "raw", "uploads/vid.mp4", strings.NewReader("source"), storage.PutOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	oldStat := statDisk
+	defer func() { statDisk = oldStat }()
+	statDisk = func(string) (diskStats, error) {
+		// Room for the source once nothing else runs, but not now
+		return diskStats{device: 1, free: 0, total: 1 << 20}, nil
+	}
+
+	tests := []struct {
+		name          string
+		deferrals     int
+		wantPublished bool
+	}{
+		{"republished with its deferral counted", 2, true},
+		{"returned to the queue at the cap", MaxDeferrals, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := queue.NewMemoryQueue()
+			body, _ := json.Marshal(models.VideoJob{VideoID: "vid", S3Key: "uploads/vid.mp4", Bucket: "raw", Deferrals: tt.deferrals})
+			if err := q.Publish(ctx, string(body)); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			msgs, err := q.Receive(ctx, 1, time.Hour)
+			if err != nil || len(msgs) != 1 {
+				t.Fatalf("Receive() = %d messages, error = %v", len(msgs), err)
+			}
+
+			pub := &lanePublisher{}
+			nacks := &nackRecorder{Consumer: q}
+			w := &Worker{
+				queue:      nacks,
+				publisher:  pub,
+				downloader: NewDownloader(store, TransferOptions{}, log),
+				admission:  newDiskAdmission(0),
+				cfg:        &config.Config{Worker: config.WorkerConfig{ID: "w1", MaxReceiveCount: 3}},
+				log:        log,
+			}
+			w.runJob(ctx, msgs[0])
+
+			if !tt.wantPublished {
+				if len(pub.bodies) != 0 {
+					t.Fatalf("published %v, want the message returned instead", pub.bodies)
+				}
+				if !slices.Equal(nacks.delays, []time.Duration{AdmissionRetryDelay}) {
+					t.Errorf("Nack() delays = %v, want [%v]", nacks.delays, AdmissionRetryDelay)
+				}
+				return
+			}
+
+			if len(pub.bodies) != 1 || !slices.Equal(pub.delays, []time.Duration{AdmissionRetryDelay}) {
+				t.Fatalf("published %v with delays %v, want one job after %v", pub.bodies, pub.delays, AdmissionRetryDelay)
+			}
+			var job models.VideoJob
+			if err := json.Unmarshal([]byte(pub.bodies[0]), &job); err != nil {
+				t.Fatal(err)
+			}
+			if job.Deferrals != tt.deferrals+1 || job.VideoID != "vid" {
+				t.Errorf("republished job = %+v, want %d deferrals", job, tt.deferrals+1)
+			}
+			if err := q.Ack(ctx, msgs[0]); !errors.Is(err, queue.ErrLeaseLost) {
+				t.Errorf("Ack() of original error = %v, want it already acked", err)
+			}
+		})
+	}
+}
+
+// nackRecorder is a queue.Consumer that records the delays of its nacks.
+type nackRecorder struct {
+	queue.Consumer
+	delays []time.Duration
+}
+
+func (q *nackRecorder) Nack(ctx context.Context, msg *queue.Message, delay time.Duration) error {
+	q.delays = append(q.delays, delay)
+	return q.Consumer.Nack(ctx, msg, delay)
+}
+
+// box encodes an ISOBMFF box with a payload of n zero bytes.
+func box(typ string, n int) []byte {
+	b := make([]byte, 8+n)
+	b[3] = byte(8 + n)
+	copy(b[4:8], typ)
+	return b
+}
+
+// staticURL presigns rawURL for any expiry.
+func staticURL(rawURL string) presignFunc {
+	return func(_ context.Context, expires time.Duration) (string, time.Duration, error) {
+		return rawURL, expires, nil
+	}
+}
+
+func TestRemoteSource_URL(t *testing.T) {
+	var signed []time.Duration
+	src := &remoteSource{presign: func(_ context.Context, expires time.Duration) (string, time.Duration, error) {
+		signed = append(signed, expires)
+		return fmt.Sprintf("https://bucket/v1.mp4?n=%d", len(signed)), expires, nil
+	}}
+
+	short, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	first, err := src.URL(short)
+	if err != nil {
+		t.Fatalf("URL() error = %v", err)
+	}
+	if again, _ := src.URL(short); again != first {
+		t.Errorf("URL() = %q within the same deadline, want %q reused", again, first)
+	}
+
+	long, cancel := context.WithTimeout(context.Background(), 4*time.Hour)
+	defer cancel()
+	second, err := src.URL(long)
+	if err != nil {
+		t.Fatalf("URL() error = %v", err)
+	}
+	if second == first {
+		t.Error("URL() reused a URL expiring before the deadline")
+	}
+	if len(signed) != 2 || signed[1] < 4*time.Hour+streamURLMargin-time.Second || signed[1] > 4*time.Hour+streamURLMargin {
+		t.Errorf("presigned for %v, want about %v", signed, 4*time.Hour+streamURLMargin)
+	}
+}
+
+func TestRemoteSource_URLCappedByCredentials(t *testing.T) {
+	signed := 0
+	src := &remoteSource{presign: func(_ context.Context, expires time.Duration) (string, time.Duration, error) {
+		signed++
+		return fmt.Sprintf("https://bucket/v1.mp4?n=%d", signed), min(expires, time.Hour), nil
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*time.Hour)
+	defer cancel()
+	first, err := src.URL(ctx)
+	if err != nil {
+		t.Fatalf("URL() error = %v", err)
+	}
+	if again, _ := src.URL(ctx); again == first {
+		t.Error("URL() reused a URL whose credentials expire before the deadline")
+	}
+}
+
+func TestRemoteSource(t *testing.T) {
+	mkv := append([]byte{0x1A, 0x45, 0xDF, 0xA3}, make([]byte, 60)...)
+	objects := map[string][]byte{
+		"/faststart.mp4": slices.Concat(box("ftyp", 16), box("moov", 32), box("mdat", 64)),
+		"/moov-end.mp4":  slices.Concat(box("ftyp", 16), box("free", 0), box("mdat", 64), box("moov", 32)),
+		"/video.mkv":     mkv,
+		"/empty.mp4":     {},
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, r.URL.Path, time.Time{}, strings.NewReader(string(data)))
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	t.Run("moov first", func(t *testing.T) {
+		src, err := openRemoteSource(ctx, srv.Client(), staticURL(srv.URL+"/faststart.mp4"))
+		if err != nil {
+			t.Fatalf("openRemoteSource() error = %v", err)
+		}
+		if src.size != int64(len(objects["/faststart.mp4"])) {
+			t.Errorf("size = %d, want %d", src.size, len(objects["/faststart.mp4"]))
+		}
+		if got := sniffHeader(src.header); got != ContainerISOBMFF {
+			t.Errorf("sniffHeader() = %q, want %q", got, ContainerISOBMFF)
+		}
+		if first, err := src.moovFirst(ctx); err != nil || !first {
+			t.Errorf("moovFirst() = %v, %v, want true", first, err)
+		}
+	})
+
+	t.Run("moov at end", func(t *testing.T) {
+		src, err := openRemoteSource(ctx, srv.Client(), staticURL(srv.URL+"/moov-end.mp4"))
+		if err != nil {
+			t.Fatalf("openRemoteSource() error = %v", err)
+		}
+		if first, err := src.moovFirst(ctx); err != nil || first {
+			t.Errorf("moovFirst() = %v, %v, want false", first, err)
+		}
+	})
+
+	t.Run("piped", func(t *testing.T) {
+		src, err := openRemoteSource(ctx, srv.Client(), staticURL(srv.URL+"/video.mkv"))
+		if err != nil {
+			t.Fatalf("openRemoteSource() error = %v", err)
+		}
+		body, err := src.open(ctx)
+		if err != nil {
+			t.Fatalf("open() error = %v", err)
+		}
+		defer body.Close()
+		data, err := io.ReadAll(body)
+		if err != nil || len(data) != len(mkv) {
+			t.Errorf("open() read %d bytes, %v, want %d", len(data), err, len(mkv))
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		src, err := openRemoteSource(ctx, srv.Client(), staticURL(srv.URL+"/empty.mp4"))
+		if err != nil {
+			t.Fatalf("openRemoteSource() error = %v", err)
+		}
+		var rejection *models.RejectionError
+		err = ValidateSource(src.header, src.size, nil, nil, InputLimits{})
+		if !errors.As(err, &rejection) || rejection.Code != models.RejectEmptyFile {
+			t.Errorf("ValidateSource() error = %v, want %s", err, models.RejectEmptyFile)
+		}
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		if _, err := openRemoteSource(ctx, srv.Client(), staticURL(srv.URL+"/missing.mp4")); err == nil {
+			t.Error("openRemoteSource() error = nil for a missing object")
+		}
+	})
+}
+
+func TestContentRangeSize(t *testing.T) {
+	tests := map[string]int64{
+		"bytes 0-15/1024": 1024,
+		"bytes */0":       0,
+		"bytes 0-15/*":    -1,
+		"":                -1,
+	}
+	for header, want := range tests {
+		if got := contentRangeSize(header); got != want {
+			t.Errorf("contentRangeSize(%q) = %d, want %d", header, got, want)
+		}
+	}
+}
+
+func TestCancellationRequested(t *testing.T) {
+	tests := []struct {
+		name  string
+		video models.VideoMetadata
+		want  bool
+	}{
+		{"processing", models.VideoMetadata{Status: models.StatusProcessing}, false},
+		{"flagged", models.VideoMetadata{Status: models.StatusProcessing, CancelRequested: true}, true},
+		{"cancelled by api", models.VideoMetadata{Status: models.StatusCancelled}, true},
+		{"completed", models.VideoMetadata{Status: models.StatusCompleted}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := cancellationRequested(&tt.video); got != tt.want {
+				t.Errorf("cancellationRequested() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewPipeline_Validation(t *testing.T) {
+	noop := func(context.Context, *jobRun) error { return nil }
+
+	tests := []struct {
+		name    string
+		stages  []stage
+		wantErr bool
+	}{
+		{"valid", []stage{
+			{name: "b", inputs: []string{"x"}, run: noop},
+			{name: "a", outputs: []string{"x"}, run: noop},
+		}, false},
+		{"duplicate stage", []stage{{name: "a", run: noop}, {name: "a", run: noop}}, true},
+		{"missing run", []stage{{name: "a"}}, true},
+		{"unproduced input", []stage{{name: "a", inputs: []string{"x"}, run: noop}}, true},
+		{"artifact produced twice", []stage{
+			{name: "a", outputs: []string{"x"}, run: noop},
+			{name: "b", outputs: []string{"x"}, run: noop},
+		}, true},
+		{"unknown after", []stage{{name: "a", after: []string{"z"}, run: noop}}, true},
+		{"cycle", []stage{
+			{name: "a", inputs: []string{"y"}, outputs: []string{"x"}, run: noop},
+			{name: "b", inputs: []string{"x"}, outputs: []string{"y"}, run: noop},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := newPipeline(tt.stages)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newPipeline() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && p.stages[0].name != "a" {
+				t.Errorf("first stage = %s, want producer a", p.stages[0].name)
+			}
+		})
+	}
+
+	t.Run("built-in registry", func(t *testing.T) {
+		if _, err := newPipeline((&Worker{}).stages()); err != nil {
+			t.Errorf("newPipeline(stages()) error = %v", err)
+		}
+	})
+}
+
+func TestPipeline_Execute(t *testing.T) {
+	defer func(delay time.Duration) { stageRetryDelay = delay }(stageRetryDelay)
+	stageRetryDelay = 0
+
+	t.Run("independent stages run in parallel", func(t *testing.T) {
+		// Each branch waits for the other to start, so a serial run would time out
+		left, right := make(chan struct{}), make(chan struct{})
+		branch := func(mine, other chan struct{}) func(context.Context, *jobRun) error {
+			return func(ctx context.Context, _ *jobRun) error {
+				close(mine)
+				select {
+				case <-other:
+					return nil
+				case <-time.After(time.Second):
+					return errors.New("sibling stage did not start")
+				}
+			}
+		}
+		var order []string
+		var mu sync.Mutex
+		last := func(context.Context, *jobRun) error {
+			mu.Lock()
+			order = append(order, "join")
+			mu.Unlock()
+			return nil
+		}
+
+		p := mustPipeline([]stage{
+			{name: "left", outputs: []string{"l"}, run: branch(left, right)},
+			{name: "right", outputs: []string{"r"}, run: branch(right, left)},
+			{name: "join", inputs: []string{"l", "r"}, run: last},
+		})
+		var reports int
+		records, err := p.execute(context.Background(), &jobRun{}, nil, func([]models.StageRun) { reports++ })
+		if err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		for _, record := range records {
+			if record.Status != models.StageSucceeded || record.Attempts != 1 {
+				t.Errorf("stage %s = %s after %d attempts, want succeeded after 1", record.Name, record.Status, record.Attempts)
+			}
+		}
+		if len(order) != 1 || reports < 3 {
+			t.Errorf("join ran %d times with %d reports", len(order), reports)
+		}
+	})
+
+	t.Run("required failure skips dependents", func(t *testing.T) {
+		boom := fmt.Errorf("%w: corrupt", models.ErrTranscodeFailed)
+		p := mustPipeline([]stage{
+			{name: "encode", outputs: []string{"x"}, run: func(context.Context, *jobRun) error { return boom }},
+			{name: "extra", optional: true, run: func(context.Context, *jobRun) error { return errors.New("flaky") }},
+			{name: "upload", inputs: []string{"x"}, run: func(context.Context, *jobRun) error {
+				t.Error("dependent of a failed stage ran")
+				return nil
+			}},
+		})
+		records, err := p.execute(context.Background(), &jobRun{}, nil, nil)
+		if !errors.Is(err, models.ErrTranscodeFailed) {
+			t.Fatalf("execute() error = %v, want ErrTranscodeFailed", err)
+		}
+		want := map[string]models.StageStatus{
+			"encode": models.StageFailed,
+			"extra":  models.StageFailed,
+			"upload": models.StageSkipped,
+		}
+		for _, record := range records {
+			if record.Status != want[record.Name] {
+				t.Errorf("stage %s = %s, want %s", record.Name, record.Status, want[record.Name])
+			}
+		}
+	})
+
+	t.Run("optional failure and skips do not fail the job", func(t *testing.T) {
+		p := mustPipeline([]stage{
+			{name: "preview", outputs: []string{"p"}, optional: true, run: func(context.Context, *jobRun) error { return errors.New("no frames") }},
+			{name: "disabled", outputs: []string{"d"}, run: func(context.Context, *jobRun) error { return errStageSkipped }},
+			{name: "upload", inputs: []string{"p", "d"}, run: func(context.Context, *jobRun) error { return nil }},
+		})
+		records, err := p.execute(context.Background(), &jobRun{}, nil, nil)
+		if err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		got := []models.StageStatus{records[0].Status, records[1].Status, records[2].Status}
+		want := []models.StageStatus{models.StageFailed, models.StageSkipped, models.StageSucceeded}
+		if !slices.Equal(got, want) {
+			t.Errorf("statuses = %v, want %v", got, want)
+		}
+	})
+
+	t.Run("transient failures are retried up to the limit", func(t *testing.T) {
+		calls := map[string]int{}
+		failing := func(name string, err error, succeedOn int) func(context.Context, *jobRun) error {
+			return func(context.Context, *jobRun) error {
+				calls[name]++
+				if calls[name] == succeedOn {
+					return nil
+				}
+				return err
+			}
+		}
+		p := mustPipeline([]stage{
+			{name: "download", attempts: 3, run: failing("download", errors.New("connection reset"), 2)},
+			{name: "parse", after: []string{"download"}, attempts: 3, run: failing("parse", fmt.Errorf("%w: bad", models.ErrJobParseFailed), 0)},
+		})
+		records, err := p.execute(context.Background(), &jobRun{}, nil, nil)
+		if !errors.Is(err, models.ErrJobParseFailed) {
+			t.Fatalf("execute() error = %v, want ErrJobParseFailed", err)
+		}
+		if calls["download"] != 2 || records[0].Attempts != 2 || records[0].Status != models.StageSucceeded {
+			t.Errorf("download ran %d times, record %+v", calls["download"], records[0])
+		}
+		if calls["parse"] != 1 {
+			t.Errorf("permanent failure ran %d times, want 1", calls["parse"])
+		}
+	})
+
+	t.Run("restored stages and what only they need are not run", func(t *testing.T) {
+		var ran []string
+		var mu sync.Mutex
+		track := func(name string) func(context.Context, *jobRun) error {
+			return func(context.Context, *jobRun) error {
+				mu.Lock()
+				ran = append(ran, name)
+				mu.Unlock()
+				return nil
+			}
+		}
+		p := mustPipeline([]stage{
+			{name: "download", outputs: []string{"source"}, run: track("download")},
+			{name: "transcode", inputs: []string{"source"}, outputs: []string{"renditions"}, run: track("transcode")},
+			{name: "preview", inputs: []string{"source"}, outputs: []string{"preview"}, run: track("preview")},
+			{name: "upload", inputs: []string{"renditions", "preview"}, run: track("upload")},
+		})
+
+		records, err := p.execute(context.Background(), &jobRun{}, map[string]bool{"transcode": true, "preview": true}, nil)
+		if err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		if !slices.Equal(ran, []string{"upload"}) {
+			t.Errorf("ran %v, want only upload", ran)
+		}
+		want := []models.StageStatus{models.StageSkipped, models.StageRestored, models.StageRestored, models.StageSucceeded}
+		for i, record := range records {
+			if record.Status != want[i] {
+				t.Errorf("stage %s = %s, want %s", record.Name, record.Status, want[i])
+			}
+		}
+
+		// The source is still needed while any of its consumers must run
+		ran = nil
+		if _, err := p.execute(context.Background(), &jobRun{}, map[string]bool{"transcode": true}, nil); err != nil {
+			t.Fatalf("execute() error = %v", err)
+		}
+		if !slices.Equal(ran, []string{"download", "preview", "upload"}) {
+			t.Errorf("ran %v, want download, preview and upload", ran)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		p := mustPipeline([]stage{{name: "slow", timeout: 10 * time.Millisecond, run: func(ctx context.Context, _ *jobRun) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}})
+		records, err := p.execute(context.Background(), &jobRun{}, nil, nil)
+		if err == nil || records[0].Status != models.StageFailed {
+			t.Errorf("execute() error = %v, record %+v, want timed out failure", err, records[0])
+		}
+		if !errors.Is(err, models.ErrResourceLimit) {
+			t.Errorf("execute() error = %v, want ErrResourceLimit", err)
+		}
+	})
+
+	t.Run("default timeout", func(t *testing.T) {
+		stages := withDefaultTimeout([]stage{
+			{name: "own", timeout: time.Minute},
+			{name: "unset"},
+		}, time.Hour)
+		if stages[0].timeout != time.Minute || stages[1].timeout != time.Hour {
+			t.Errorf("timeouts = %s, %s, want 1m0s, 1h0m0s", stages[0].timeout, stages[1].timeout)
+		}
+	})
+}
@@ -16,10 +16,54 @@ var (
 	ErrUploadFailed    = errors.New("failed to upload HLS files")
 	ErrFFmpegFailed    = errors.New("ffmpeg execution failed")
 	ErrContextCanceled = errors.New("context canceled")
+	ErrInputRejected   = errors.New("input rejected")
+	ErrResourceLimit   = errors.New("resource limit exceeded")
 
 	// Storage errors
 	ErrVideoNotFound = errors.New("video not found")
+	ErrVideoExists   = errors.New("video already exists")
 	ErrInvalidStatus = errors.New("invalid video status")
+	ErrInvalidCursor = errors.New("invalid list cursor")
+
+	// ErrInvalidTransition is returned when a status change is not allowed
+	// from the video's current status.
+	ErrInvalidTransition = errors.New("invalid status transition")
+
+	// Processing lease errors
+	ErrVideoAlreadyCompleted = errors.New("video already completed")
+	ErrLeaseHeld             = errors.New("video is leased by another worker")
+	ErrLeaseNotHeld          = errors.New("video lease not held")
+
+	// ErrVideoCancelled is returned when processing stops because the video
+	// was cancelled.
+	ErrVideoCancelled = errors.New("video cancelled")
+
+	// Output version errors
+	ErrVersionNotFound = errors.New("output version not found")
+	ErrStaleJob        = errors.New("job superseded by a newer version")
+
+	// ErrManifestNotFound is returned for output versions published before
+	// manifests were written.
+	ErrManifestNotFound = errors.New("output manifest not found")
+
+	// Object storage errors
+	ErrObjectNotFound = errors.New("object not found")
+	ErrObjectChanged  = errors.New("object changed since it was read")
+
+	// Storage service errors. ErrThrottled and ErrStorageUnavailable are
+	// temporary and worth retrying; ErrAccessDenied needs the deployment's
+	// credentials or permissions fixed.
+	ErrAccessDenied       = errors.New("storage access denied")
+	ErrThrottled          = errors.New("storage request throttled")
+	ErrStorageUnavailable = errors.New("storage unavailable")
+
+	// ErrChecksumMismatch is returned when stored content does not match
+	// the checksum it was sent with.
+	ErrChecksumMismatch = errors.New("content does not match checksum")
+
+	// ErrInvalidSignature is returned for presigned URLs that were not
+	// signed by this deployment, have been altered or have expired.
+	ErrInvalidSignature = errors.New("invalid or expired signature")
 
 	// Validation errors for uploads
 	ErrInvalidFileType    = errors.New("invalid file type")
@@ -27,3 +71,49 @@ var (
 	ErrInvalidContentType = errors.New("invalid content type")
 	ErrInvalidKeyFormat   = errors.New("invalid key format")
 )
+
+// ErrorClass categorises a processing failure for retry decisions.
+type ErrorClass string
+
+const (
+	// ErrorClassTransient failures (throttling, network, timeouts) may succeed on retry.
+	ErrorClassTransient ErrorClass = "transient"
+	// ErrorClassPermanent failures (corrupt input, validation) will never succeed.
+	ErrorClassPermanent ErrorClass = "permanent"
+	// ErrorClassResource failures (stage timeouts, memory caps) hit a job's
+	// resource limits; they are retried through the queue but not in place.
+	ErrorClassResource ErrorClass = "resource"
+)
+
+// ClassifiedError attaches an explicit ErrorClass to an error.
+type ClassifiedError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func (e *ClassifiedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ClassifiedError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks err as not worth retrying.
+func Permanent(err error) error {
+	return &ClassifiedError{Class: ErrorClassPermanent, Err: err}
+}
+
+// Transient marks err as retryable.
+func Transient(err error) error {
+	return &ClassifiedError{Class: ErrorClassTransient, Err: err}
+}
+
+// ClassOf returns the explicit class attached to err, if any.
+func ClassOf(err error) (ErrorClass, bool) {
+	var classified *ClassifiedError
+	if errors.As(err, &classified) {
+		return classified.Class, true
+	}
+	return "", false
+}
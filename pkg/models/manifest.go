@@ -0,0 +1,48 @@
+package models
+
+// ManifestFilename is the integrity manifest stored at the root of an
+// output version's prefix.
+const ManifestFilename = "manifest.json"
+
+// Manifest lists every file of an output version with the checksums it was
+// uploaded with. It is written once the uploaded files have been verified,
+// so a version without one was never verified.
+type Manifest struct {
+	VideoID     string              `json:"videoId"`
+	Version     int                 `json:"version"`
+	Profile     string              `json:"profile,omitempty"`
+	Renditions  []ManifestRendition `json:"renditions"`
+	Files       []ManifestFile      `json:"files"` // Sorted by path
+	GeneratedAt string              `json:"generatedAt"`
+}
+
+// ManifestRendition maps a rendition of the ladder to its files.
+type ManifestRendition struct {
+	Name     string `json:"name"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Bitrate  int    `json:"bitrate"`
+	Playlist string `json:"playlist"` // Path of the media playlist
+	Segments int    `json:"segments"`
+}
+
+// ManifestFile is one stored file. Paths are relative to the version's
+// prefix. Checksum is the SHA-256 checksum S3 stores for the object: the
+// base64 digest of the content, or for a multipart upload the base64 digest
+// of the part digests followed by "-" and the part count.
+type ManifestFile struct {
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`              // Hex digest of the content
+	Checksum  string `json:"checksum"`            // As S3 reports it
+	Rendition string `json:"rendition,omitempty"` // Owning rendition, if any
+}
+
+// TotalBytes returns the combined size of the manifest's files.
+func (m *Manifest) TotalBytes() int64 {
+	var total int64
+	for _, f := range m.Files {
+		total += f.Size
+	}
+	return total
+}
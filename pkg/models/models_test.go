@@ -0,0 +1,185 @@
+package models
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestCanTransitionTo(t *testing.T) {
+	tests := []struct {
+		from VideoStatus
+		to   VideoStatus
+		want bool
+	}{
+		{StatusPending, StatusQueued, true},
+		{StatusQueued, StatusProcessing, true},
+		{StatusProcessing, StatusProcessing, true}, // expired lease re-claimed
+		{StatusProcessing, StatusCompleted, true},
+		{StatusProcessing, StatusPending, true}, // transient retry
+		{StatusCompleted, StatusReprocessing, true},
+		{StatusFailed, StatusQueued, true},
+		{StatusCancelled, StatusQueued, true},
+		{StatusReprocessing, StatusProcessing, true},
+
+		{StatusCompleted, StatusFailed, false},
+		{StatusCompleted, StatusProcessing, false},
+		{StatusFailed, StatusProcessing, false},
+		{StatusCancelled, StatusProcessing, false},
+		{StatusPending, StatusCompleted, false},
+		{StatusQueued, StatusCompleted, false},
+		{VideoStatus("bogus"), StatusQueued, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.from)+"->"+string(tt.to), func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("%s.CanTransitionTo(%s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransitionSources(t *testing.T) {
+	tests := []struct {
+		to   VideoStatus
+		want []VideoStatus
+	}{
+		{StatusProcessing, []VideoStatus{StatusPending, StatusQueued, StatusProcessing, StatusReprocessing}},
+		{StatusCompleted, []VideoStatus{StatusProcessing, StatusReprocessing}},
+		{StatusReprocessing, []VideoStatus{StatusCompleted, StatusFailed}},
+		{StatusPending, []VideoStatus{StatusProcessing}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.to), func(t *testing.T) {
+			if got := TransitionSources(tt.to); !slices.Equal(got, tt.want) {
+				t.Errorf("TransitionSources(%s) = %v, want %v", tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTransitionsUseValidStatuses(t *testing.T) {
+	for from, targets := range transitions {
+		if !from.IsValid() {
+			t.Errorf("transition source %q is not a valid status", from)
+		}
+		for _, to := range targets {
+			if !to.IsValid() {
+				t.Errorf("transition %s -> %q targets an invalid status", from, to)
+			}
+		}
+	}
+	for _, s := range allStatuses {
+		if _, ok := transitions[s]; !ok {
+			t.Errorf("status %s has no transition entry", s)
+		}
+	}
+}
+
+func TestHLSPrefix(t *testing.T) {
+	tests := []struct {
+		version int
+		want    string
+	}{
+		{0, "hls/abc/"},
+		{1, "hls/abc/v1/"},
+		{12, "hls/abc/v12/"},
+	}
+
+	for _, tt := range tests {
+		if got := HLSPrefix("abc", tt.version); got != tt.want {
+			t.Errorf("HLSPrefix(abc, %d) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestPublishAndRestoreVersion(t *testing.T) {
+	versions := PublishVersion(nil, OutputVersion{Version: 1}, "2026-01-01T00:00:00Z")
+	versions = PublishVersion(versions, OutputVersion{Version: 2}, "2026-01-02T00:00:00Z")
+
+	if len(versions) != 2 {
+		t.Fatalf("len(versions) = %d, want 2", len(versions))
+	}
+	if versions[0].SupersededAt != "2026-01-02T00:00:00Z" {
+		t.Errorf("v1 SupersededAt = %q, want 2026-01-02T00:00:00Z", versions[0].SupersededAt)
+	}
+	if versions[1].SupersededAt != "" || versions[1].PublishedAt != "2026-01-02T00:00:00Z" {
+		t.Errorf("v2 = %+v, want current", versions[1])
+	}
+
+	video := &VideoMetadata{CurrentVersion: 2, Versions: versions}
+	if prev := video.PreviousVersion(); prev == nil || prev.Version != 1 {
+		t.Fatalf("PreviousVersion() = %+v, want v1", prev)
+	}
+
+	restored, ok := RestoreVersion(versions, 1, "2026-01-03T00:00:00Z")
+	if !ok {
+		t.Fatal("RestoreVersion(1) = false, want true")
+	}
+	video = &VideoMetadata{CurrentVersion: 1, Versions: restored}
+	if got := video.FindVersion(1); got == nil || got.SupersededAt != "" {
+		t.Errorf("restored v1 = %+v, want current", got)
+	}
+	if got := video.FindVersion(2); got == nil || got.SupersededAt != "2026-01-03T00:00:00Z" {
+		t.Errorf("v2 after rollback = %+v, want superseded", got)
+	}
+
+	if _, ok := RestoreVersion(versions, 7, "2026-01-03T00:00:00Z"); ok {
+		t.Error("RestoreVersion(7) = true, want false")
+	}
+}
+
+func TestExpiredVersions(t *testing.T) {
+	now := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	versions := []OutputVersion{
+		{Version: 0, SupersededAt: "2026-01-01T00:00:00Z"},
+		{Version: 1, SupersededAt: "2026-01-02T00:00:00Z"},
+		{Version: 2, SupersededAt: "2026-01-03T00:00:00Z"},
+		{Version: 3, SupersededAt: "2026-01-31T12:00:00Z"},
+		{Version: 4},
+	}
+
+	tests := []struct {
+		name      string
+		keep      int
+		retention time.Duration
+		want      []int
+	}{
+		{"keep none", 0, 0, []int{3, 2, 1}},
+		{"keep two", 2, 0, []int{1}},
+		{"retention protects recent", 0, 24 * time.Hour, []int{2, 1}},
+		{"keep all", 10, 0, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for _, entry := range ExpiredVersions(versions, 4, tt.keep, tt.retention, now) {
+				got = append(got, entry.Version)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ExpiredVersions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCheckpoint(t *testing.T) {
+	video := &VideoMetadata{Checkpoints: []Checkpoint{
+		{Stage: "transcode", Version: 1},
+		{Stage: "transcode", Version: 2},
+		{Stage: "preview", Version: 2, Skipped: true},
+	}}
+
+	if cp := video.FindCheckpoint("transcode", 2); cp == nil || cp.Version != 2 {
+		t.Errorf("FindCheckpoint(transcode, 2) = %+v", cp)
+	}
+	if cp := video.FindCheckpoint("preview", 1); cp != nil {
+		t.Errorf("FindCheckpoint(preview, 1) = %+v, want nil", cp)
+	}
+	if got := ScratchPrefix("abc", 2); got != "scratch/abc/v2/" {
+		t.Errorf("ScratchPrefix() = %q", got)
+	}
+}
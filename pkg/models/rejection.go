@@ -0,0 +1,35 @@
+package models
+
+import "fmt"
+
+// RejectionCode is a machine-readable reason an uploaded file was refused.
+type RejectionCode string
+
+const (
+	RejectEmptyFile            RejectionCode = "empty_file"
+	RejectUnsupportedContainer RejectionCode = "unsupported_container"
+	RejectCorruptInput         RejectionCode = "corrupt_input"
+	RejectNoVideoStream        RejectionCode = "no_video_stream"
+	RejectDurationExceeded     RejectionCode = "duration_exceeded"
+	RejectResolutionExceeded   RejectionCode = "resolution_exceeded"
+)
+
+// RejectionError reports why an input failed validation before transcoding.
+type RejectionError struct {
+	Code   RejectionCode
+	Reason string
+}
+
+// NewRejection creates a RejectionError with a formatted reason.
+func NewRejection(code RejectionCode, format string, args ...any) *RejectionError {
+	return &RejectionError{Code: code, Reason: fmt.Sprintf(format, args...)}
+}
+
+func (e *RejectionError) Error() string {
+	return fmt.Sprintf("%s: %s (%s)", ErrInputRejected, e.Reason, e.Code)
+}
+
+// Unwrap allows errors.Is(err, ErrInputRejected).
+func (e *RejectionError) Unwrap() error {
+	return ErrInputRejected
+}
@@ -0,0 +1,53 @@
+package models
+
+import "fmt"
+
+// StageStatus is the outcome of one processing stage.
+type StageStatus string
+
+const (
+	StagePending   StageStatus = "pending"
+	StageRunning   StageStatus = "running"
+	StageSucceeded StageStatus = "succeeded"
+	StageFailed    StageStatus = "failed"
+	StageSkipped   StageStatus = "skipped"  // Disabled, not needed, or not run because an earlier stage failed
+	StageRestored  StageStatus = "restored" // Outputs restored from an earlier attempt's checkpoint
+)
+
+// StageRun records one stage of a video's latest processing attempt.
+type StageRun struct {
+	Name       string      `dynamodbav:"name" json:"name"`
+	Status     StageStatus `dynamodbav:"status" json:"status"`
+	Optional   bool        `dynamodbav:"optional,omitempty" json:"optional,omitempty"` // Failure does not fail the job
+	Attempts   int         `dynamodbav:"attempts,omitempty" json:"attempts,omitempty"`
+	StartedAt  string      `dynamodbav:"started_at,omitempty" json:"startedAt,omitempty"`
+	DurationMs int64       `dynamodbav:"duration_ms,omitempty" json:"durationMs,omitempty"`
+	Error      string      `dynamodbav:"error,omitempty" json:"error,omitempty"`
+}
+
+// Checkpoint records a stage finished by an earlier attempt at an output
+// version. The stage's output files are kept under the version's scratch
+// prefix so a retry can restore them instead of running the stage again.
+type Checkpoint struct {
+	Stage       string `dynamodbav:"stage" json:"stage"`
+	Version     int    `dynamodbav:"version" json:"version"`
+	Skipped     bool   `dynamodbav:"skipped,omitempty" json:"skipped,omitempty"` // Stage had nothing to do
+	CompletedAt string `dynamodbav:"completed_at" json:"completedAt"`
+}
+
+// ScratchPrefix returns the S3 prefix holding the checkpointed intermediate
+// files of a video's output version.
+func ScratchPrefix(videoID string, version int) string {
+	return fmt.Sprintf("scratch/%s/v%d/", videoID, version)
+}
+
+// FindCheckpoint returns the checkpoint of stage for an output version, or
+// nil if the stage has not finished for that version.
+func (v *VideoMetadata) FindCheckpoint(stage string, version int) *Checkpoint {
+	for i := len(v.Checkpoints) - 1; i >= 0; i-- {
+		if v.Checkpoints[i].Stage == stage && v.Checkpoints[i].Version == version {
+			return &v.Checkpoints[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package models
+
+import "slices"
+
+// Actors recorded in the status history for changes not made by a worker.
+const (
+	ActorAPI = "api"
+)
+
+// allStatuses lists every status in lifecycle order.
+var allStatuses = []VideoStatus{
+	StatusPending, StatusQueued, StatusProcessing, StatusCompleted,
+	StatusFailed, StatusCancelled, StatusReprocessing,
+}
+
+// transitions lists the statuses each status may move to.
+var transitions = map[VideoStatus][]VideoStatus{
+	StatusPending:      {StatusQueued, StatusProcessing, StatusFailed, StatusCancelled},
+	StatusQueued:       {StatusProcessing, StatusFailed, StatusCancelled},
+	StatusProcessing:   {StatusProcessing, StatusCompleted, StatusFailed, StatusPending, StatusCancelled},
+	StatusCompleted:    {StatusReprocessing},
+	StatusFailed:       {StatusQueued, StatusReprocessing},
+	StatusCancelled:    {StatusQueued},
+	StatusReprocessing: {StatusProcessing, StatusCompleted, StatusFailed, StatusCancelled},
+}
+
+// StatusTransition records a status change in a video's history. The status
+// it moved from is the previous entry's Status.
+type StatusTransition struct {
+	Status VideoStatus `dynamodbav:"status" json:"status"`
+	At     string      `dynamodbav:"at" json:"at"`
+	Actor  string      `dynamodbav:"actor" json:"actor"`
+	Reason string      `dynamodbav:"reason,omitempty" json:"reason,omitempty"`
+}
+
+// CanTransitionTo reports whether a video may move from s to next.
+// Processing may move to processing so an expired lease can be re-claimed.
+func (s VideoStatus) CanTransitionTo(next VideoStatus) bool {
+	return slices.Contains(transitions[s], next)
+}
+
+// TransitionSources returns the statuses from which a video may move to
+// next, in a stable order.
+func TransitionSources(next VideoStatus) []VideoStatus {
+	var sources []VideoStatus
+	for _, s := range allStatuses {
+		if s.CanTransitionTo(next) {
+			sources = append(sources, s)
+		}
+	}
+	return sources
+}
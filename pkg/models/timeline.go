@@ -0,0 +1,46 @@
+package models
+
+// Timeline is the content analysis document stored alongside a video's HLS output.
+type Timeline struct {
+	VideoID         string        `json:"videoId"`
+	DurationSeconds float64       `json:"durationSeconds"`
+	BlackSegments   []TimeRange   `json:"blackSegments"`
+	Silences        []TimeRange   `json:"silences"`
+	SceneChanges    []SceneChange `json:"sceneChanges"`
+	GeneratedAt     string        `json:"generatedAt"`
+}
+
+// TimeRange is a span of the source in seconds.
+type TimeRange struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// Duration returns the length of the range in seconds.
+func (r TimeRange) Duration() float64 {
+	return r.End - r.Start
+}
+
+// Contains returns true if t falls within the range.
+func (r TimeRange) Contains(t float64) bool {
+	return t >= r.Start && t <= r.End
+}
+
+// SceneChange is a detected cut with its FFmpeg scene score (0-1).
+type SceneChange struct {
+	Time  float64 `json:"time"`
+	Score float64 `json:"score"`
+}
+
+// AnalysisSummary is the condensed analysis result stored on VideoMetadata.
+type AnalysisSummary struct {
+	LeadingBlackSeconds   float64 `dynamodbav:"leading_black_seconds" json:"leadingBlackSeconds"`
+	TrailingBlackSeconds  float64 `dynamodbav:"trailing_black_seconds" json:"trailingBlackSeconds"`
+	SilenceCount          int     `dynamodbav:"silence_count" json:"silenceCount"`
+	LongestSilenceSeconds float64 `dynamodbav:"longest_silence_seconds" json:"longestSilenceSeconds"`
+	SceneChangeCount      int     `dynamodbav:"scene_change_count" json:"sceneChangeCount"`
+	TrimStartSeconds      float64 `dynamodbav:"trim_start_seconds" json:"trimStartSeconds"`
+	TrimEndSeconds        float64 `dynamodbav:"trim_end_seconds" json:"trimEndSeconds"`
+	PosterTimeSeconds     float64 `dynamodbav:"poster_time_seconds" json:"posterTimeSeconds"`
+	TimelineKey           string  `dynamodbav:"timeline_key" json:"timelineKey"`
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// OutputVersion is a published HLS output of a video. Every processing run
+// writes a new version under hls/<id>/v<N>/ and the video's CurrentVersion
+// is switched to it once the output has been validated. Version 0 is the
+// unversioned layout under hls/<id>/ written before versioning.
+type OutputVersion struct {
+	Version      int             `dynamodbav:"version" json:"version"`
+	Profile      string          `dynamodbav:"profile,omitempty" json:"profile,omitempty"`
+	Presets      []QualityPreset `dynamodbav:"presets,omitempty" json:"presets,omitempty"`
+	PublishedAt  string          `dynamodbav:"published_at" json:"publishedAt"`
+	SupersededAt string          `dynamodbav:"superseded_at,omitempty" json:"supersededAt,omitempty"` // Empty while current
+}
+
+// HLSPrefix returns the S3 prefix of a video's HLS output version.
+func HLSPrefix(videoID string, version int) string {
+	if version == 0 {
+		return fmt.Sprintf("hls/%s/", videoID)
+	}
+	return fmt.Sprintf("hls/%s/v%d/", videoID, version)
+}
+
+// PlaybackURL returns the CDN URL of the master playlist of an output version.
+func PlaybackURL(cdnDomain, videoID string, version int) string {
+	return fmt.Sprintf("https://%s/%smaster.m3u8", cdnDomain, HLSPrefix(videoID, version))
+}
+
+// FindVersion returns the published version n, or nil if it is not stored.
+func (v *VideoMetadata) FindVersion(n int) *OutputVersion {
+	for i := range v.Versions {
+		if v.Versions[i].Version == n {
+			return &v.Versions[i]
+		}
+	}
+	return nil
+}
+
+// PreviousVersion returns the most recently superseded version, which a
+// rollback without an explicit version restores, or nil if there is none.
+func (v *VideoMetadata) PreviousVersion() *OutputVersion {
+	var previous *OutputVersion
+	for i := range v.Versions {
+		entry := &v.Versions[i]
+		if entry.Version == v.CurrentVersion || entry.SupersededAt == "" {
+			continue
+		}
+		if previous == nil || entry.SupersededAt > previous.SupersededAt ||
+			(entry.SupersededAt == previous.SupersededAt && entry.Version > previous.Version) {
+			previous = entry
+		}
+	}
+	return previous
+}
+
+// PublishVersion returns versions with published made current as of now.
+// The versions it replaces are marked superseded.
+func PublishVersion(versions []OutputVersion, published OutputVersion, now string) []OutputVersion {
+	result := make([]OutputVersion, 0, len(versions)+1)
+	for _, entry := range versions {
+		if entry.Version == published.Version {
+			continue
+		}
+		if entry.SupersededAt == "" {
+			entry.SupersededAt = now
+		}
+		result = append(result, entry)
+	}
+	published.PublishedAt = now
+	published.SupersededAt = ""
+	return append(result, published)
+}
+
+// RestoreVersion returns versions with version n made current again as of
+// now, or false if n is not stored.
+func RestoreVersion(versions []OutputVersion, n int, now string) ([]OutputVersion, bool) {
+	i := slices.IndexFunc(versions, func(entry OutputVersion) bool { return entry.Version == n })
+	if i < 0 {
+		return nil, false
+	}
+	restored := versions[i]
+	return PublishVersion(versions, restored, now), true
+}
+
+// ExpiredVersions returns the stored versions that may be deleted: those
+// superseded for longer than retention, other than the current version and
+// the keep most recently superseded ones. Version 0 is never returned
+// because its files share the video's root prefix with later versions.
+func ExpiredVersions(versions []OutputVersion, current, keep int, retention time.Duration, now time.Time) []OutputVersion {
+	var superseded []OutputVersion
+	for _, entry := range versions {
+		if entry.Version != current && entry.SupersededAt != "" {
+			superseded = append(superseded, entry)
+		}
+	}
+
+	// Most recently superseded first
+	slices.SortFunc(superseded, func(a, b OutputVersion) int {
+		if a.SupersededAt != b.SupersededAt {
+			if a.SupersededAt > b.SupersededAt {
+				return -1
+			}
+			return 1
+		}
+		return b.Version - a.Version
+	})
+
+	var expired []OutputVersion
+	for i, entry := range superseded {
+		if i < keep || entry.Version == 0 {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, entry.SupersededAt)
+		if err != nil || now.Sub(at) < retention {
+			continue
+		}
+		expired = append(expired, entry)
+	}
+	return expired
+}
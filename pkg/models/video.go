@@ -4,16 +4,20 @@ package models
 type VideoStatus string
 
 const (
-	StatusPending    VideoStatus = "pending"
-	StatusProcessing VideoStatus = "processing"
-	StatusCompleted  VideoStatus = "completed"
-	StatusFailed     VideoStatus = "failed"
+	StatusPending      VideoStatus = "pending"
+	StatusQueued       VideoStatus = "queued"
+	StatusProcessing   VideoStatus = "processing"
+	StatusCompleted    VideoStatus = "completed"
+	StatusFailed       VideoStatus = "failed"
+	StatusCancelled    VideoStatus = "cancelled"
+	StatusReprocessing VideoStatus = "reprocessing"
 )
 
 // IsValid returns true if the status is a valid VideoStatus.
 func (s VideoStatus) IsValid() bool {
 	switch s {
-	case StatusPending, StatusProcessing, StatusCompleted, StatusFailed:
+	case StatusPending, StatusQueued, StatusProcessing, StatusCompleted,
+		StatusFailed, StatusCancelled, StatusReprocessing:
 		return true
 	}
 	return false
@@ -22,10 +26,10 @@ func (s VideoStatus) IsValid() bool {
 // VideoMetadata represents the full metadata for a video.
 type VideoMetadata struct {
 	// Keys
-	PK     string `dynamodbav:"pk"`
-	SK     string `dynamodbav:"sk"`
-	GSI1PK string `dynamodbav:"gsi1pk,omitempty"`
-	GSI1SK string `dynamodbav:"gsi1sk,omitempty"`
+	PK     string `dynamodbav:"pk" json:"-"`
+	SK     string `dynamodbav:"sk" json:"-"`
+	GSI1PK string `dynamodbav:"gsi1pk,omitempty" json:"-"`
+	GSI1SK string `dynamodbav:"gsi1sk,omitempty" json:"-"`
 
 	// Attributes
 	VideoID         string          `dynamodbav:"video_id" json:"videoId"`
@@ -41,6 +45,43 @@ type VideoMetadata struct {
 	ProcessedAt     string          `dynamodbav:"processed_at,omitempty" json:"processedAt,omitempty"`
 	QualityPresets  []QualityPreset `dynamodbav:"quality_presets,omitempty" json:"qualityPresets,omitempty"`
 	ErrorMessage    string          `dynamodbav:"error_message,omitempty" json:"errorMessage,omitempty"`
+
+	// Failure details
+	ErrorClass ErrorClass `dynamodbav:"error_class,omitempty" json:"errorClass,omitempty"`
+
+	// Status history, oldest first
+	StatusHistory []StatusTransition `dynamodbav:"status_history,omitempty" json:"statusHistory,omitempty"`
+
+	// Processing lease, held by the worker currently processing the video
+	LeaseOwner     string `dynamodbav:"lease_owner,omitempty" json:"-"`
+	LeaseExpiresAt int64  `dynamodbav:"lease_expires_at,omitempty" json:"-"` // Unix seconds
+	Attempts       int    `dynamodbav:"attempts,omitempty" json:"attempts,omitempty"`
+	ReceiveCount   int    `dynamodbav:"receive_count,omitempty" json:"receiveCount,omitempty"` // Queue deliveries of the job, as of the last claim
+
+	// Cancellation, requested by the user and honoured by the processing worker
+	CancelRequested bool `dynamodbav:"cancel_requested,omitempty" json:"cancelRequested,omitempty"`
+
+	// Output versions; see version.go
+	CurrentVersion int             `dynamodbav:"current_version,omitempty" json:"currentVersion,omitempty"` // Version served by PlaybackURL
+	LatestVersion  int             `dynamodbav:"latest_version,omitempty" json:"latestVersion,omitempty"`   // Highest version allocated
+	Profile        string          `dynamodbav:"profile,omitempty" json:"profile,omitempty"`                // Encoding profile of the current version
+	Versions       []OutputVersion `dynamodbav:"versions,omitempty" json:"versions,omitempty"`              // Published versions still stored
+	VersionsRev    int             `dynamodbav:"versions_rev,omitempty" json:"-"`                           // Incremented on every write of Versions
+
+	// Pipeline stages of the latest processing attempt; see stage.go
+	Stages      []StageRun `dynamodbav:"stages,omitempty" json:"stages,omitempty"`
+	StagesOwner string     `dynamodbav:"stages_owner,omitempty" json:"-"` // Worker that recorded Stages
+
+	// Stages finished by earlier attempts, cleared when the video completes
+	Checkpoints []Checkpoint `dynamodbav:"checkpoints,omitempty" json:"checkpoints,omitempty"`
+
+	// Input validation
+	RejectionCode   RejectionCode `dynamodbav:"rejection_code,omitempty" json:"rejectionCode,omitempty"`
+	RejectionReason string        `dynamodbav:"rejection_reason,omitempty" json:"rejectionReason,omitempty"`
+
+	// Derived assets
+	Analysis *AnalysisSummary `dynamodbav:"analysis,omitempty" json:"analysis,omitempty"`
+	Preview  *PreviewAssets   `dynamodbav:"preview,omitempty" json:"preview,omitempty"`
 }
 
 // QualityPreset represents a video quality level configuration.
@@ -51,12 +92,19 @@ type QualityPreset struct {
 	Bitrate int    `dynamodbav:"bitrate" json:"bitrate"`
 }
 
-// VideoJob represents a video processing job from SQS.
+// VideoJob represents a video processing job from the job queue.
 type VideoJob struct {
 	VideoID  string `json:"videoId"`
 	S3Key    string `json:"s3Key"`
 	Bucket   string `json:"bucket"`
 	Filename string `json:"filename"`
+	Priority string `json:"priority,omitempty"` // Queue lane the job was published to
+	Profile  string `json:"profile,omitempty"`  // Encoding profile; empty for the default
+	Version  int    `json:"version,omitempty"`  // Output version; 0 for the unversioned layout
+
+	// Deferrals counts how often admission control has republished the job
+	// because the worker's disk was full.
+	Deferrals int `json:"deferrals,omitempty"`
 }
 
 // Validate checks if the video job has all required fields.
@@ -72,3 +120,11 @@ func (j *VideoJob) Validate() error {
 	}
 	return nil
 }
+
+// PreviewAssets describes the animated teaser generated for a video.
+type PreviewAssets struct {
+	WebPKey string `dynamodbav:"webp_key" json:"webpKey"`
+	WebPURL string `dynamodbav:"webp_url" json:"webpUrl"`
+	MP4Key  string `dynamodbav:"mp4_key" json:"mp4Key"`
+	MP4URL  string `dynamodbav:"mp4_url" json:"mp4Url"`
+}